@@ -21,32 +21,32 @@ import (
 	"time"
 
 	"github.com/elastic/beats/v7/filebeat/config"
+	"github.com/elastic/beats/v7/filebeat/registrar"
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/logp"
-	"github.com/elastic/beats/v7/libbeat/paths"
 	"github.com/elastic/beats/v7/libbeat/statestore"
-	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
 )
 
 type filebeatStore struct {
-	registry      *statestore.Registry
-	storeName     string
-	cleanInterval time.Duration
+	registry        *statestore.Registry
+	storeName       string
+	cleanInterval   time.Duration
+	flushInterval   time.Duration
+	flushMaxPending int
 }
 
 func openStateStore(info beat.Info, logger *logp.Logger, cfg config.Registry) (*filebeatStore, error) {
-	memlog, err := memlog.New(logger, memlog.Settings{
-		Root:     paths.Resolve(paths.Data, cfg.Path),
-		FileMode: cfg.Permissions,
-	})
+	backend, err := registrar.NewBackend(logger, cfg, info.Beat)
 	if err != nil {
 		return nil, err
 	}
 
 	return &filebeatStore{
-		registry:      statestore.NewRegistry(memlog),
-		storeName:     info.Beat,
-		cleanInterval: cfg.CleanInterval,
+		registry:        statestore.NewRegistry(backend),
+		storeName:       info.Beat,
+		cleanInterval:   cfg.CleanInterval,
+		flushInterval:   cfg.FlushBatchInterval,
+		flushMaxPending: cfg.FlushMaxPending,
 	}, nil
 }
 
@@ -61,3 +61,11 @@ func (s *filebeatStore) Access() (*statestore.Store, error) {
 func (s *filebeatStore) CleanupInterval() time.Duration {
 	return s.cleanInterval
 }
+
+func (s *filebeatStore) FlushInterval() time.Duration {
+	return s.flushInterval
+}
+
+func (s *filebeatStore) FlushMaxPending() int {
+	return s.flushMaxPending
+}
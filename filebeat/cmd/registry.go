@@ -0,0 +1,233 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/filebeat/config"
+	"github.com/elastic/beats/v7/filebeat/registrar"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+)
+
+func genRegistryCmd(settings instance.Settings) *cobra.Command {
+	registryCmd := cobra.Command{
+		Use:   "registry",
+		Short: "Inspect and edit the registry while Filebeat is stopped",
+	}
+	registryCmd.AddCommand(genRegistryListCmd(settings))
+	registryCmd.AddCommand(genRegistryExportCmd(settings))
+	registryCmd.AddCommand(genRegistryImportCmd(settings))
+	registryCmd.AddCommand(genRegistrySetOffsetCmd(settings))
+	registryCmd.AddCommand(genRegistryResetCmd(settings))
+	registryCmd.AddCommand(genRegistryCompactCmd(settings))
+
+	return &registryCmd
+}
+
+func genRegistryListCmd(settings instance.Settings) *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List registry entries",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistryEditor(settings, func(editor *registrar.Editor) error {
+				entries, err := editor.List(registryFilterFromFlags(cmd))
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "KEY\tINPUT ID\tPATH\tOFFSET")
+				for _, entry := range entries {
+					offset := "-"
+					if n, ok := entry.Offset(); ok {
+						offset = fmt.Sprint(n)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Key, entry.InputID(), entry.Path(), offset)
+				}
+				return w.Flush()
+			})
+		}),
+	}
+	addRegistryFilterFlags(listCmd)
+
+	return listCmd
+}
+
+func genRegistryExportCmd(settings instance.Settings) *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export registry entries as NDJSON",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+
+			return withRegistryEditor(settings, func(editor *registrar.Editor) error {
+				var w io.Writer = os.Stdout
+				if output != "" {
+					f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+					if err != nil {
+						return fmt.Errorf("failed to create export file: %w", err)
+					}
+					defer f.Close()
+					w = f
+				}
+
+				n, err := editor.Export(w, registryFilterFromFlags(cmd))
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Exported %d registry entries\n", n)
+				return nil
+			})
+		}),
+	}
+	addRegistryFilterFlags(exportCmd)
+	exportCmd.Flags().StringP("output", "o", "", "Write the entries to a file instead of stdout")
+
+	return exportCmd
+}
+
+func genRegistryImportCmd(settings instance.Settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import registry entries from an NDJSON file",
+		Args:  cobra.ExactArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open import file: %w", err)
+			}
+			defer f.Close()
+
+			return withRegistryEditor(settings, func(editor *registrar.Editor) error {
+				n, err := editor.Import(f)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Imported %d registry entries\n", n)
+				return nil
+			})
+		}),
+	}
+}
+
+func genRegistrySetOffsetCmd(settings instance.Settings) *cobra.Command {
+	setOffsetCmd := &cobra.Command{
+		Use:   "set-offset",
+		Short: "Set the read offset of the files matching --path",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			offset, _ := cmd.Flags().GetInt64("offset")
+			return setRegistryOffset(settings, cmd, offset)
+		}),
+	}
+	addRegistryFilterFlags(setOffsetCmd)
+	setOffsetCmd.Flags().Int64("offset", 0, "Offset in bytes to continue reading the files from")
+	_ = setOffsetCmd.MarkFlagRequired("offset")
+	_ = setOffsetCmd.MarkFlagRequired("path")
+
+	return setOffsetCmd
+}
+
+func genRegistryResetCmd(settings instance.Settings) *cobra.Command {
+	resetCmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Reset the read offset of the files matching --path, such that they are read again",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return setRegistryOffset(settings, cmd, 0)
+		}),
+	}
+	addRegistryFilterFlags(resetCmd)
+	_ = resetCmd.MarkFlagRequired("path")
+
+	return resetCmd
+}
+
+func genRegistryCompactCmd(settings instance.Settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "compact",
+		Short: "Write a new registry checkpoint and remove the operations log",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistryEditor(settings, func(editor *registrar.Editor) error {
+				return editor.Compact()
+			})
+		}),
+	}
+}
+
+func setRegistryOffset(settings instance.Settings, cmd *cobra.Command, offset int64) error {
+	return withRegistryEditor(settings, func(editor *registrar.Editor) error {
+		keys, err := editor.SetOffset(registryFilterFromFlags(cmd), offset)
+		for _, key := range keys {
+			fmt.Printf("Set offset of %s to %d\n", key, offset)
+		}
+		return err
+	})
+}
+
+func addRegistryFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("input-id", "", "Only select entries of the filestream input with this ID")
+	cmd.Flags().String("path", "", "Only select entries of files matching this glob pattern")
+}
+
+func registryFilterFromFlags(cmd *cobra.Command) registrar.EntryFilter {
+	inputID, _ := cmd.Flags().GetString("input-id")
+	path, _ := cmd.Flags().GetString("path")
+	return registrar.EntryFilter{InputID: inputID, Path: path}
+}
+
+// withRegistryEditor opens the registry configured for the beat. The data
+// path is locked while fn runs, so the registry is never modified while
+// Filebeat is running.
+func withRegistryEditor(settings instance.Settings, fn func(*registrar.Editor) error) error {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return fmt.Errorf("error initializing beat: %w", err)
+	}
+
+	unlock, err := instance.LockDataPath(b)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg := struct {
+		Registry config.Registry `config:"registry"`
+	}{Registry: config.DefaultConfig.Registry}
+	if b.Beat.BeatConfig != nil {
+		if err := b.Beat.BeatConfig.Unpack(&cfg); err != nil {
+			return fmt.Errorf("error reading registry settings: %w", err)
+		}
+	}
+
+	editor, err := registrar.OpenEditor(cfg.Registry, b.Info.Beat)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(editor); err != nil {
+		editor.Close()
+		return err
+	}
+	return editor.Close()
+}
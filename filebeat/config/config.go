@@ -51,20 +51,25 @@ type Config struct {
 }
 
 type Registry struct {
-	Path          string        `config:"path"`
-	Permissions   os.FileMode   `config:"file_permissions"`
-	FlushTimeout  time.Duration `config:"flush"`
-	CleanInterval time.Duration `config:"cleanup_interval"`
-	MigrateFile   string        `config:"migrate_file"`
+	Path               string        `config:"path"`
+	Backend            string        `config:"backend"`
+	Permissions        os.FileMode   `config:"file_permissions"`
+	FlushTimeout       time.Duration `config:"flush"`
+	FlushBatchInterval time.Duration `config:"flush_batch_interval" validate:"min=0"`
+	FlushMaxPending    int           `config:"flush_max_pending" validate:"min=0"`
+	CleanInterval      time.Duration `config:"cleanup_interval"`
+	MigrateFile        string        `config:"migrate_file"`
 }
 
 var (
 	DefaultConfig = Config{
 		Registry: Registry{
-			Path:          "registry",
-			Permissions:   0600,
-			MigrateFile:   "",
-			CleanInterval: 5 * time.Minute,
+			Path:            "registry",
+			Backend:         "memlog",
+			Permissions:     0600,
+			MigrateFile:     "",
+			CleanInterval:   5 * time.Minute,
+			FlushMaxPending: 8192,
 		},
 		ShutdownTimeout:    0,
 		OverwritePipelines: false,
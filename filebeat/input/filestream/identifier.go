@@ -74,6 +74,11 @@ func (f fileSource) Name() string {
 	return f.fileID
 }
 
+// Path returns the current path of the file.
+func (f fileSource) Path() string {
+	return f.newPath
+}
+
 // newFileIdentifier creates a new state identifier for a log input.
 func newFileIdentifier(ns *common.ConfigNamespace, suffix string) (fileIdentifier, error) {
 	if ns == nil {
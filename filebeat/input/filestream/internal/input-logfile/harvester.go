@@ -135,6 +135,7 @@ type defaultHarvesterGroup struct {
 	store        *store
 	ackCH        *updateChan
 	identifier   *sourceIdentifier
+	throttle     *inputThrottle
 	tg           unison.TaskGroup
 }
 
@@ -202,7 +203,12 @@ func startHarvester(ctx input.Context, hg *defaultHarvesterGroup, s Source, rest
 
 		hg.store.UpdateTTL(resource, hg.cleanTimeout)
 		cursor := makeCursor(resource)
-		publisher := &cursorPublisher{canceler: ctx.Cancelation, client: client, cursor: &cursor}
+		var publisher Publisher = &cursorPublisher{canceler: ctx.Cancelation, client: client, cursor: &cursor}
+		if hg.throttle != nil {
+			fileThrottle := hg.throttle.newFileThrottle(srcID, s)
+			defer fileThrottle.close()
+			publisher = newThrottledPublisher(ctx.Cancelation, fileThrottle, publisher)
+		}
 
 		err = hg.harvester.Run(ctx, s, cursor, publisher)
 		if err != nil && err != context.Canceled {
@@ -37,6 +37,7 @@ type managedInput struct {
 	harvester        Harvester
 	cleanTimeout     time.Duration
 	harvesterLimit   uint64
+	rateLimit        rateLimitConfig
 }
 
 // Name is required to implement the v2.Input interface
@@ -69,6 +70,7 @@ func (inp *managedInput) Run(
 		store:        groupStore,
 		ackCH:        inp.ackCH,
 		identifier:   inp.sourceIdentifier,
+		throttle:     newInputThrottle(inp.userID, inp.rateLimit),
 		tg: unison.TaskGroup{
 			OnQuit: unison.ContinueOnErrors, // harvester should keep running if a single harvester errored
 		},
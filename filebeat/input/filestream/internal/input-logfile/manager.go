@@ -32,6 +32,7 @@ import (
 	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 	"github.com/elastic/beats/v7/libbeat/statestore"
 )
 
@@ -95,6 +96,16 @@ type StateStore interface {
 	CleanupInterval() time.Duration
 }
 
+// UpdateFlushSettings can optionally be implemented by a StateStore to
+// configure how cursor updates are batched before being written to the
+// persistent store. FlushInterval is the maximum time an update is kept in
+// memory and FlushMaxPending limits the number of keys with pending updates.
+// By default updates are written as soon as possible.
+type UpdateFlushSettings interface {
+	FlushInterval() time.Duration
+	FlushMaxPending() int
+}
+
 func (cim *InputManager) init() error {
 	cim.initOnce.Do(func() {
 		if cim.DefaultCleanTimeout <= 0 {
@@ -109,9 +120,19 @@ func (cim *InputManager) init() error {
 			return
 		}
 
+		var (
+			flushInterval time.Duration
+			maxPending    int
+		)
+		if settings, ok := cim.StateStore.(UpdateFlushSettings); ok {
+			flushInterval = settings.FlushInterval()
+			maxPending = settings.FlushMaxPending()
+		}
+		metrics := newUpdateMetrics(registrarMetrics(), cim.Type)
+
 		cim.store = store
-		cim.ackCH = newUpdateChan()
-		cim.ackUpdater = newUpdateWriter(store, cim.ackCH)
+		cim.ackCH = newBatchedUpdateChan(flushInterval, maxPending, metrics)
+		cim.ackUpdater = newUpdateWriter(store, cim.ackCH, metrics)
 		cim.ids = map[string]struct{}{}
 	})
 
@@ -152,6 +173,16 @@ func (cim *InputManager) Init(group unison.Group, mode v2.Mode) error {
 	return nil
 }
 
+// registrarMetrics returns the registry the update pipeline metrics are
+// reported to.
+func registrarMetrics() *monitoring.Registry {
+	reg := monitoring.Default.GetRegistry("registrar")
+	if reg == nil {
+		reg = monitoring.Default.NewRegistry("registrar")
+	}
+	return reg
+}
+
 func (cim *InputManager) shutdown() {
 	cim.ackUpdater.Close()
 	cim.store.Release()
@@ -165,9 +196,10 @@ func (cim *InputManager) Create(config *common.Config) (v2.Input, error) {
 	}
 
 	settings := struct {
-		ID             string        `config:"id"`
-		CleanTimeout   time.Duration `config:"clean_timeout"`
-		HarvesterLimit uint64        `config:"harvester_limit"`
+		ID             string          `config:"id"`
+		CleanTimeout   time.Duration   `config:"clean_timeout"`
+		HarvesterLimit uint64          `config:"harvester_limit"`
+		RateLimit      rateLimitConfig `config:"rate_limit"`
 	}{CleanTimeout: cim.DefaultCleanTimeout}
 	if err := config.Unpack(&settings); err != nil {
 		return nil, err
@@ -229,6 +261,7 @@ func (cim *InputManager) Create(config *common.Config) (v2.Input, error) {
 		sourceIdentifier: sourceIdentifier,
 		cleanTimeout:     settings.CleanTimeout,
 		harvesterLimit:   settings.HarvesterLimit,
+		rateLimit:        settings.RateLimit,
 	}, nil
 }
 
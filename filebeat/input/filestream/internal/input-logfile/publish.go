@@ -117,35 +117,75 @@ func (op *updateOp) done(n uint) {
 }
 
 // Execute updates the persistent store with the scheduled changes and releases the resource.
-func (op *updateOp) Execute(store *store, n uint) {
+// The state is written with w, which can be a batch of the persistent store.
+// The in memory state is updated once the state has been written, so it is not
+// updated if the batch fails.
+func (op *updateOp) Execute(store *store, w stateWriter, n uint) {
+	resource := op.resource
+	apply := op.write(store, w, n)
+	if apply == nil {
+		return
+	}
+
+	commit := func() {
+		resource.stateMutex.Lock()
+		defer resource.stateMutex.Unlock()
+		apply()
+	}
+	if c, ok := w.(committer); ok {
+		c.OnCommit(commit)
+	} else {
+		commit()
+	}
+}
+
+// write writes the state updated by the last n operations with w. It returns
+// the function updating the in memory state, or nil if nothing was written.
+func (op *updateOp) write(store *store, w stateWriter, n uint) func() {
 	resource := op.resource
 
 	resource.stateMutex.Lock()
 	defer resource.stateMutex.Unlock()
 
 	if resource.lockedVersion != op.resource.version || resource.isDeleted() {
-		return
+		return nil
 	}
 
 	defer op.done(n)
 	resource.activeCursorOperations -= n
+
+	var cursor interface{}
 	if resource.activeCursorOperations == 0 {
-		resource.cursor = resource.pendingCursor()
+		cursor = resource.pendingCursor()
 		resource.pendingCursorValue = nil
 	} else {
-		typeconv.Convert(&resource.cursor, op.delta)
+		typeconv.Convert(&cursor, &resource.cursor)
+		typeconv.Convert(&cursor, op.delta)
 	}
 
-	if resource.internalState.Updated.Before(op.timestamp) {
-		resource.internalState.Updated = op.timestamp
+	updated := resource.internalState.Updated
+	if updated.Before(op.timestamp) {
+		updated = op.timestamp
 	}
 
-	err := store.persistentStore.Set(resource.key, resource.inSyncStateSnapshot())
+	err := w.Set(resource.key, state{
+		TTL:     resource.internalState.TTL,
+		Updated: updated,
+		Cursor:  cursor,
+		Meta:    resource.cursorMeta,
+	})
 	if err != nil {
 		if !statestore.IsClosed(err) {
 			store.log.Errorf("Failed to update state in the registry for '%v'", resource.key)
 		}
-	} else {
+		return nil
+	}
+
+	return func() {
+		resource.cursor = cursor
+		if resource.internalState.Updated.Before(updated) {
+			resource.internalState.Updated = updated
+		}
 		resource.stored = true
 	}
 }
@@ -26,6 +26,7 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	"github.com/elastic/beats/v7/libbeat/statestore"
 )
 
 func TestPublish(t *testing.T) {
@@ -84,7 +85,7 @@ func TestOp_Execute(t *testing.T) {
 		require.False(t, res.Finished())
 
 		// this was the last op, the resource should become inactive
-		op.Execute(store, 1)
+		op.Execute(store, store.persistentStore, 1)
 		require.True(t, res.Finished())
 
 		// validate state:
@@ -110,7 +111,7 @@ func TestOp_Execute(t *testing.T) {
 		require.False(t, res.Finished())
 
 		// this was the last op, the resource should become inactive
-		op.Execute(store, 2)
+		op.Execute(store, store.persistentStore, 2)
 		require.True(t, res.Finished())
 
 		// validate state:
@@ -138,7 +139,7 @@ func TestOp_Execute(t *testing.T) {
 		defer op2.done(1) // cleanup after test
 
 		// this was the intermediate op, the resource should still be active
-		op1.Execute(store, 1)
+		op1.Execute(store, store.persistentStore, 1)
 		require.False(t, res.Finished())
 
 		// validate state (in memory state is always up to data to most recent update):
@@ -147,8 +148,50 @@ func TestOp_Execute(t *testing.T) {
 		assert.Equal(t, "test-updated-cursor-state-intermediate", inSyncCursor)
 		assert.Equal(t, "test-updated-cursor-state-final", inMemCursor)
 	})
+	t.Run("state is applied once the batch is written", func(t *testing.T) {
+		store := testOpenStore(t, "test", createSampleStore(t, nil))
+		defer store.Release()
+		res := store.Get("test::key")
+
+		op := mustCreateUpdateOp(t, res, "test-updated-cursor-state")
+		res.Release()
+
+		err := store.persistentStore.Batch(func(batch *statestore.Batch) error {
+			op.Execute(store, batch, 1)
+			return nil
+		})
+		require.NoError(t, err)
+		require.True(t, res.Finished())
+		assert.Equal(t, "test-updated-cursor-state", storeInSyncSnapshot(store)["test::key"].Cursor)
+	})
+
+	t.Run("state is not applied if the batch fails", func(t *testing.T) {
+		store := testOpenStore(t, "test", createSampleStore(t, nil))
+		defer store.Release()
+		res := store.Get("test::key")
+		before := storeInSyncSnapshot(store)["test::key"]
+
+		op := mustCreateUpdateOp(t, res, "test-updated-cursor-state")
+		res.Release()
+
+		w := &failedBatch{}
+		op.Execute(store, w, 1)
+		require.True(t, res.Finished())
+		assert.Equal(t, 1, w.sets)
+		assert.Equal(t, before.Cursor, storeInSyncSnapshot(store)["test::key"].Cursor)
+		assert.False(t, res.stored)
+	})
 }
 
+// failedBatch is a batch whose commit fails, so the commit functions are never
+// called.
+type failedBatch struct {
+	sets int
+}
+
+func (b *failedBatch) Set(string, interface{}) error { b.sets++; return nil }
+func (b *failedBatch) OnCommit(func())               {}
+
 func mustCreateUpdateOp(t *testing.T, resource *resource, updates interface{}) *updateOp {
 	op, err := createUpdateOp(resource, updates)
 	if err != nil {
@@ -311,7 +311,7 @@ func TestStore_ResetCursor(t *testing.T) {
 		store.resetCursor("test::key", cur{Offset: 0})
 
 		// try to update cursor after it has been reset
-		op.Execute(store, 1)
+		op.Execute(store, store.persistentStore, 1)
 		releaseResource(res)
 
 		res = store.Get("test::key")
@@ -0,0 +1,517 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package input_logfile
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/go-concert/ctxtool"
+)
+
+// minThrottleDelay is the minimum time a publisher must have been blocked by
+// the limiters for the event to be reported as throttled.
+const minThrottleDelay = time.Millisecond
+
+// anticipationTimeout is the maximum time the input throttle keeps the
+// limits reserved for a harvester that just published and is expected to
+// publish again with a smaller finish tag than all queued requests.
+const anticipationTimeout = 5 * time.Millisecond
+
+var (
+	throttleMetrics = monitoring.GetNamespace("dataset").GetRegistry()
+	throttleSeq     atomic.Uint64
+)
+
+// rateLimitConfig configures the throughput limits of an input.
+// The input limits are shared by all harvesters of the input, the file
+// limits are applied to every harvester separately.
+type rateLimitConfig struct {
+	Input   rateLimit      `config:"input"`
+	File    rateLimit      `config:"file"`
+	Weights []weightConfig `config:"weights"`
+}
+
+type rateLimit struct {
+	BytesPerSecond  cfgtype.ByteSize `config:"bytes_per_second" validate:"min=0"`
+	EventsPerSecond float64          `config:"events_per_second" validate:"min=0"`
+}
+
+// weightConfig sets the share of the input limits of the files matching
+// any of the glob patterns in Paths. Files not matching any pattern get
+// the weight 1.
+type weightConfig struct {
+	Paths  []string `config:"paths" validate:"required"`
+	Weight float64  `config:"weight" validate:"min=1"`
+}
+
+// pathSource is implemented by sources that are read from a path, like the
+// files of the filestream input. The path is used to select the weight of
+// the source.
+type pathSource interface {
+	Path() string
+}
+
+func (c rateLimitConfig) enabled() bool {
+	return c.Input.enabled() || c.File.enabled()
+}
+
+func (c rateLimitConfig) Validate() error {
+	for _, w := range c.Weights {
+		for _, p := range w.Paths {
+			if _, err := filepath.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid rate_limit.weights path pattern '%s': %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (l rateLimit) enabled() bool {
+	return l.BytesPerSecond > 0 || l.EventsPerSecond > 0
+}
+
+func (l rateLimit) bytesLimiter() *rate.Limiter {
+	if l.BytesPerSecond <= 0 {
+		return nil
+	}
+	return newLimiter(float64(l.BytesPerSecond))
+}
+
+func (l rateLimit) eventsLimiter() *rate.Limiter {
+	if l.EventsPerSecond <= 0 {
+		return nil
+	}
+	return newLimiter(l.EventsPerSecond)
+}
+
+// newLimiter creates a token bucket allowing bursts of up to one second
+// worth of tokens.
+func newLimiter(perSecond float64) *rate.Limiter {
+	burst := int(math.Ceil(perSecond))
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+// inputThrottle limits the throughput of all harvesters of an input.
+// Harvesters waiting for the input limits are served in the order of
+// their virtual finish time (start-time fair queueing), such that every
+// harvester gets a share of the input throughput proportional to its
+// weight, no matter how much data it has available.
+type inputThrottle struct {
+	id     string
+	config rateLimitConfig
+	bytes  *rate.Limiter
+	events *rate.Limiter
+
+	mu     sync.Mutex
+	vtime  float64
+	seq    uint64
+	queue  throttleQueue
+	active bool
+
+	// Every harvester only has one outstanding request. Without anticipation
+	// the queue would alternate between harvesters, as the harvester that
+	// just published has not queued its next request yet when the next
+	// request is selected. `anticipate` is set if the throttle is waiting for
+	// the harvester with the smallest next finish tag. `anticipateGen` is
+	// incremented for every anticipation, such that the timer of an earlier
+	// anticipation of the same harvester can not end the current one.
+	anticipate          *fileThrottle
+	anticipateGen       uint64
+	anticipateTimer     *time.Timer
+	anticipationTimeout time.Duration
+}
+
+type throttleRequest struct {
+	flow  *fileThrottle
+	cost  float64
+	start float64
+	tag   float64
+	seq   uint64
+	ready chan struct{}
+	index int
+}
+
+// newInputThrottle creates the throttle shared by all harvesters of the input
+// with the given ID. It returns nil if no limit is configured.
+func newInputThrottle(id string, config rateLimitConfig) *inputThrottle {
+	if !config.enabled() {
+		return nil
+	}
+	if id == "" {
+		id = globalInputID
+	}
+	return &inputThrottle{
+		id:                  id,
+		config:              config,
+		bytes:               config.Input.bytesLimiter(),
+		events:              config.Input.eventsLimiter(),
+		anticipationTimeout: anticipationTimeout,
+	}
+}
+
+// newFileThrottle creates the per harvester throttle state. The metrics of
+// the file are registered in the dataset namespace until close is called.
+// The registry is named after the input ID and a sequence number, as
+// multiple harvesters of the same file can exist while one is shutting down.
+func (t *inputThrottle) newFileThrottle(srcID string, s Source) *fileThrottle {
+	path := ""
+	if ps, ok := s.(pathSource); ok {
+		path = ps.Path()
+	}
+
+	// dots would create nested registries
+	id := fmt.Sprintf("%s::%d", strings.ReplaceAll(t.id, ".", "_"), throttleSeq.Inc())
+
+	weight := t.weight(path)
+	reg := throttleMetrics.NewRegistry(id)
+	monitoring.NewString(reg, "input_id").Set(t.id)
+	monitoring.NewString(reg, "source").Set(srcID)
+	monitoring.NewString(reg, "path").Set(path)
+	monitoring.NewFloat(reg, "weight").Set(weight)
+
+	return &fileThrottle{
+		input:  t,
+		id:     id,
+		weight: weight,
+		bytes:  t.config.File.bytesLimiter(),
+		events: t.config.File.eventsLimiter(),
+		metrics: fileThrottleMetrics{
+			eventsTotal:          monitoring.NewUint(reg, "events_total"),
+			bytesTotal:           monitoring.NewUint(reg, "bytes_total"),
+			throttledEventsTotal: monitoring.NewUint(reg, "throttled_events_total"),
+			throttledTimeTotal:   monitoring.NewUint(reg, "throttled_time_ns_total"),
+		},
+	}
+}
+
+func (t *inputThrottle) weight(path string) float64 {
+	if path == "" {
+		return 1
+	}
+	for _, w := range t.config.Weights {
+		for _, p := range w.Paths {
+			if ok, _ := filepath.Match(p, path); ok {
+				return w.Weight
+			}
+		}
+	}
+	return 1
+}
+
+// acquire blocks until the harvester is allowed to publish events with the
+// given number of bytes according to the input limits.
+func (t *inputThrottle) acquire(ctx context.Context, f *fileThrottle, events, bytes int) error {
+	if t.bytes == nil && t.events == nil {
+		return nil
+	}
+
+	cost := float64(events)
+	if t.bytes != nil {
+		cost = float64(bytes)
+	}
+
+	t.mu.Lock()
+	t.seq++
+	prevTag := f.lastTag
+	start := math.Max(t.vtime, f.lastTag)
+	req := &throttleRequest{
+		flow:  f,
+		cost:  cost,
+		start: start,
+		tag:   start + cost/f.weight,
+		seq:   t.seq,
+		ready: make(chan struct{}),
+	}
+	f.lastTag = req.tag
+	heap.Push(&t.queue, req)
+	if t.anticipate == f {
+		t.stopAnticipation()
+	}
+	t.dispatch()
+	t.mu.Unlock()
+
+	select {
+	case <-req.ready:
+	case <-ctx.Done():
+		t.mu.Lock()
+		// the request has not been served, don't charge it to the harvester
+		f.lastTag = prevTag
+		if req.index >= 0 {
+			heap.Remove(&t.queue, req.index)
+			t.mu.Unlock()
+			return ctx.Err()
+		}
+		t.mu.Unlock()
+
+		// the request has been selected concurrently, pass on to the next one
+		t.release(req, false)
+		return ctx.Err()
+	}
+
+	err := waitN(ctx, t.bytes, bytes)
+	if err == nil {
+		err = waitN(ctx, t.events, events)
+	}
+	if err != nil {
+		t.mu.Lock()
+		f.lastTag = prevTag
+		t.mu.Unlock()
+		t.release(req, false)
+		return err
+	}
+	t.release(req, true)
+	return nil
+}
+
+// dispatch selects the request with the smallest finish tag if no other
+// request is currently waiting for the input limits. Must be called with
+// the lock held.
+func (t *inputThrottle) dispatch() {
+	if t.active || t.anticipate != nil || t.queue.Len() == 0 {
+		return
+	}
+	req := heap.Pop(&t.queue).(*throttleRequest)
+	t.active = true
+	close(req.ready)
+}
+
+// release passes the input limits on to the next request. If anticipate is
+// set and the next request of the same harvester is expected to finish before
+// all queued requests, the limits stay reserved for the harvester for up to
+// anticipationTimeout.
+func (t *inputThrottle) release(req *throttleRequest, anticipate bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if req.start > t.vtime {
+		t.vtime = req.start
+	}
+	t.active = false
+
+	if anticipate && t.queue.Len() > 0 {
+		f := req.flow
+		next := math.Max(t.vtime, f.lastTag) + req.cost/f.weight
+		if next < t.queue[0].tag {
+			t.anticipateGen++
+			gen := t.anticipateGen
+			t.anticipate = f
+			t.anticipateTimer = time.AfterFunc(t.anticipationTimeout, func() {
+				t.anticipationExpired(gen)
+			})
+			return
+		}
+	}
+	t.dispatch()
+}
+
+// anticipationExpired passes the limits on to the next request if the
+// anticipation gen is still active. Stopping the timer does not prevent the
+// callback from running if the timer fired already, so the callback of an
+// earlier anticipation can run after a new one has been started.
+func (t *inputThrottle) anticipationExpired(gen uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.anticipate != nil && t.anticipateGen == gen {
+		t.stopAnticipation()
+		t.dispatch()
+	}
+}
+
+// stopAnticipation must be called with the lock held.
+func (t *inputThrottle) stopAnticipation() {
+	t.anticipate = nil
+	if t.anticipateTimer != nil {
+		t.anticipateTimer.Stop()
+		t.anticipateTimer = nil
+	}
+}
+
+// fileThrottle limits the throughput of a single harvester and tracks its
+// position in the fair queue of the input.
+type fileThrottle struct {
+	input   *inputThrottle
+	id      string
+	weight  float64
+	bytes   *rate.Limiter
+	events  *rate.Limiter
+	lastTag float64
+	metrics fileThrottleMetrics
+}
+
+type fileThrottleMetrics struct {
+	eventsTotal          *monitoring.Uint // Number of events published.
+	bytesTotal           *monitoring.Uint // Number of message bytes published.
+	throttledEventsTotal *monitoring.Uint // Number of events delayed by a rate limit.
+	throttledTimeTotal   *monitoring.Uint // Total time in nanoseconds spent waiting for rate limits.
+}
+
+// wait blocks until an event with the given number of bytes can be
+// published. Blocking the publisher pauses the harvester, such that no data
+// is read from the file while the harvester is throttled.
+func (f *fileThrottle) wait(ctx context.Context, bytes int) error {
+	begin := time.Now()
+	err := f.doWait(ctx, bytes)
+
+	// ignore the bookkeeping overhead of the limiters if no limit was hit
+	if waited := time.Since(begin); waited >= minThrottleDelay {
+		f.metrics.throttledEventsTotal.Inc()
+		f.metrics.throttledTimeTotal.Add(uint64(waited))
+	}
+	if err != nil {
+		return err
+	}
+
+	f.metrics.eventsTotal.Inc()
+	f.metrics.bytesTotal.Add(uint64(bytes))
+	return nil
+}
+
+func (f *fileThrottle) doWait(ctx context.Context, bytes int) error {
+	if err := waitN(ctx, f.bytes, bytes); err != nil {
+		return err
+	}
+	if err := waitN(ctx, f.events, 1); err != nil {
+		return err
+	}
+	return f.input.acquire(ctx, f, 1, bytes)
+}
+
+func (f *fileThrottle) close() {
+	throttleMetrics.Remove(f.id)
+
+	t := f.input
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.anticipate == f {
+		t.stopAnticipation()
+		t.dispatch()
+	}
+}
+
+// waitN blocks until n tokens are available from lim. Requests larger than
+// the burst of the limiter are split up into multiple reservations.
+func waitN(ctx context.Context, lim *rate.Limiter, n int) error {
+	if lim == nil {
+		return nil
+	}
+
+	for n > 0 {
+		c := n
+		if b := lim.Burst(); c > b {
+			c = b
+		}
+
+		now := time.Now()
+		r := lim.ReserveN(now, c)
+		if delay := r.DelayFrom(now); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				r.Cancel()
+				return ctx.Err()
+			}
+		}
+		n -= c
+	}
+	return nil
+}
+
+// throttledPublisher applies the rate limits of the input and the file
+// before passing events to the wrapped Publisher.
+type throttledPublisher struct {
+	ctx       context.Context
+	throttle  *fileThrottle
+	publisher Publisher
+}
+
+func newThrottledPublisher(canceler input.Canceler, throttle *fileThrottle, publisher Publisher) *throttledPublisher {
+	return &throttledPublisher{
+		ctx:       ctxtool.FromCanceller(canceler),
+		throttle:  throttle,
+		publisher: publisher,
+	}
+}
+
+func (p *throttledPublisher) Publish(event beat.Event, cursor interface{}) error {
+	if err := p.throttle.wait(p.ctx, eventBytes(event)); err != nil {
+		return err
+	}
+	return p.publisher.Publish(event, cursor)
+}
+
+// eventBytes returns the size of the message of an event, which is used
+// as the cost of the event by the bytes_per_second limits.
+func eventBytes(event beat.Event) int {
+	if msg, ok := event.Fields["message"].(string); ok {
+		return len(msg)
+	}
+	return 0
+}
+
+// throttleQueue is a min-heap of requests ordered by finish tag.
+type throttleQueue []*throttleRequest
+
+func (q throttleQueue) Len() int { return len(q) }
+
+func (q throttleQueue) Less(i, j int) bool {
+	if q[i].tag == q[j].tag {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].tag < q[j].tag
+}
+
+func (q throttleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *throttleQueue) Push(x interface{}) {
+	req := x.(*throttleRequest)
+	req.index = len(*q)
+	*q = append(*q, req)
+}
+
+func (q *throttleQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	req := old[n-1]
+	old[n-1] = nil
+	req.index = -1
+	*q = old[:n-1]
+	return req
+}
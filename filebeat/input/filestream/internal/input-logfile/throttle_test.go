@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package input_logfile
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+type testPathSource struct {
+	name, path string
+}
+
+func (s testPathSource) Name() string { return s.name }
+func (s testPathSource) Path() string { return s.path }
+
+type countingPublisher struct {
+	events int64
+}
+
+func (p *countingPublisher) Publish(_ beat.Event, _ interface{}) error {
+	atomic.AddInt64(&p.events, 1)
+	return nil
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		var config rateLimitConfig
+		require.NoError(t, common.MustNewConfigFrom(map[string]interface{}{}).Unpack(&config))
+		require.False(t, config.enabled())
+		require.Nil(t, newInputThrottle("test", config))
+	})
+
+	t.Run("human readable byte sizes", func(t *testing.T) {
+		var config rateLimitConfig
+		require.NoError(t, common.MustNewConfigFrom(map[string]interface{}{
+			"file.bytes_per_second":   "1MiB",
+			"input.events_per_second": 100,
+		}).Unpack(&config))
+		require.True(t, config.enabled())
+		require.EqualValues(t, 1<<20, config.File.BytesPerSecond)
+		require.EqualValues(t, 100, config.Input.EventsPerSecond)
+	})
+
+	t.Run("invalid weight path", func(t *testing.T) {
+		var config rateLimitConfig
+		err := common.MustNewConfigFrom(map[string]interface{}{
+			"weights": []map[string]interface{}{{"paths": []string{"[-"}, "weight": 2}},
+		}).Unpack(&config)
+		require.Error(t, err)
+	})
+}
+
+func TestInputThrottleWeight(t *testing.T) {
+	throttle := newInputThrottle("test", rateLimitConfig{
+		Input: rateLimit{EventsPerSecond: 10},
+		Weights: []weightConfig{
+			{Paths: []string{"/var/log/important/*.log"}, Weight: 4},
+		},
+	})
+
+	important := throttle.newFileThrottle("a", testPathSource{"a", "/var/log/important/app.log"})
+	defer important.close()
+	other := throttle.newFileThrottle("b", testPathSource{"b", "/var/log/other.log"})
+	defer other.close()
+	noPath := throttle.newFileThrottle("c", &testSource{"c"})
+	defer noPath.close()
+
+	require.Equal(t, 4.0, important.weight)
+	require.Equal(t, 1.0, other.weight)
+	require.Equal(t, 1.0, noPath.weight)
+}
+
+func TestThrottledPublisher(t *testing.T) {
+	t.Run("file limit pauses publishing", func(t *testing.T) {
+		throttle := newInputThrottle("test", rateLimitConfig{
+			File: rateLimit{EventsPerSecond: 100},
+		})
+		fileThrottle := throttle.newFileThrottle("a", &testSource{"a"})
+		defer fileThrottle.close()
+
+		counter := &countingPublisher{}
+		publisher := newThrottledPublisher(context.Background(), fileThrottle, counter)
+
+		begin := time.Now()
+		for i := 0; i < 150; i++ {
+			require.NoError(t, publisher.Publish(beat.Event{Fields: common.MapStr{"message": "test"}}, nil))
+		}
+
+		require.GreaterOrEqual(t, time.Since(begin), 400*time.Millisecond)
+		require.EqualValues(t, 150, counter.events)
+		require.EqualValues(t, 150, fileThrottle.metrics.eventsTotal.Get())
+		require.EqualValues(t, 600, fileThrottle.metrics.bytesTotal.Get())
+		require.NotZero(t, fileThrottle.metrics.throttledEventsTotal.Get())
+		require.NotZero(t, fileThrottle.metrics.throttledTimeTotal.Get())
+	})
+
+	t.Run("cancel while throttled", func(t *testing.T) {
+		throttle := newInputThrottle("test", rateLimitConfig{
+			File: rateLimit{BytesPerSecond: 10},
+		})
+		fileThrottle := throttle.newFileThrottle("a", &testSource{"a"})
+		defer fileThrottle.close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		counter := &countingPublisher{}
+		publisher := newThrottledPublisher(ctx, fileThrottle, counter)
+		event := beat.Event{Fields: common.MapStr{"message": "a message larger than the burst"}}
+		require.ErrorIs(t, publisher.Publish(event, nil), context.DeadlineExceeded)
+		require.EqualValues(t, 0, counter.events)
+	})
+}
+
+func TestInputThrottleFairness(t *testing.T) {
+	throttle := newInputThrottle("test", rateLimitConfig{
+		Input: rateLimit{EventsPerSecond: 1000},
+		Weights: []weightConfig{
+			{Paths: []string{"/heavy.log"}, Weight: 3},
+		},
+	})
+
+	// Drain the burst, so the harvester started first can not consume it
+	// before the other harvester is running.
+	require.True(t, throttle.events.AllowN(time.Now(), 1000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	sources := []testPathSource{{"light", "/light.log"}, {"heavy", "/heavy.log"}}
+	counts := make([]int64, len(sources))
+
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		i, src := i, src
+		fileThrottle := throttle.newFileThrottle(src.name, src)
+		defer fileThrottle.close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for throttle.acquire(ctx, fileThrottle, 1, 0) == nil {
+				atomic.AddInt64(&counts[i], 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	light, heavy := float64(counts[0]), float64(counts[1])
+	require.NotZero(t, light)
+	require.InDelta(t, 3.0, heavy/light, 1.0, "light=%v heavy=%v", light, heavy)
+}
+
+func TestInputThrottleStaleAnticipation(t *testing.T) {
+	throttle := newInputThrottle("test", rateLimitConfig{
+		Input: rateLimit{EventsPerSecond: 1000},
+	})
+	throttle.anticipationTimeout = time.Hour
+
+	a := throttle.newFileThrottle("a", &testSource{"a"})
+	defer a.close()
+	b := throttle.newFileThrottle("b", &testSource{"b"})
+	defer b.close()
+
+	// a request of b with a large finish tag is queued while a publishes
+	throttle.mu.Lock()
+	heap.Push(&throttle.queue, &throttleRequest{flow: b, tag: 100, ready: make(chan struct{})})
+	throttle.mu.Unlock()
+
+	throttle.release(&throttleRequest{flow: a, cost: 1}, true)
+	require.Equal(t, a, throttle.anticipate)
+	stale := throttle.anticipateGen
+
+	// a publishes again and is anticipated again
+	throttle.mu.Lock()
+	throttle.stopAnticipation()
+	throttle.mu.Unlock()
+	throttle.release(&throttleRequest{flow: a, cost: 1}, true)
+
+	throttle.anticipationExpired(stale)
+	require.Equal(t, a, throttle.anticipate, "timer of an earlier anticipation must be ignored")
+
+	throttle.anticipationExpired(throttle.anticipateGen)
+	require.Nil(t, throttle.anticipate)
+	require.True(t, throttle.active, "queued request must be dispatched")
+}
+
+func TestInputThrottleCancelRestoresTag(t *testing.T) {
+	throttle := newInputThrottle("test", rateLimitConfig{
+		Input: rateLimit{EventsPerSecond: 1},
+	})
+	require.True(t, throttle.events.AllowN(time.Now(), 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// One harvester waits for the input limit, the other one is queued.
+	var wg sync.WaitGroup
+	files := []*fileThrottle{
+		throttle.newFileThrottle("a", &testSource{"a"}),
+		throttle.newFileThrottle("b", &testSource{"b"}),
+	}
+	errs := make([]error, len(files))
+	for i, f := range files {
+		i, f := i, f
+		defer f.close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = throttle.acquire(ctx, f, 1, 0)
+		}()
+	}
+	wg.Wait()
+
+	for i, f := range files {
+		require.ErrorIs(t, errs[i], context.DeadlineExceeded)
+		require.Zero(t, f.lastTag, "cancelled request must not be charged to %s", f.id)
+	}
+}
+
+func TestFileThrottleMetricsRegistry(t *testing.T) {
+	throttle := newInputThrottle("my.input", rateLimitConfig{
+		File: rateLimit{EventsPerSecond: 100},
+	})
+	f := throttle.newFileThrottle("a", &testSource{"a"})
+
+	require.Regexp(t, `^my_input::\d+$`, f.id)
+	reg := throttleMetrics.GetRegistry(f.id)
+	require.NotNil(t, reg)
+	require.Equal(t, "my.input", reg.Get("input_id").(*monitoring.String).Get())
+
+	f.close()
+	require.Nil(t, throttleMetrics.GetRegistry(f.id))
+}
@@ -20,7 +20,13 @@ package input_logfile
 import (
 	"context"
 	"sync"
+	"time"
 
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/monitoring/adapter"
+	"github.com/elastic/beats/v7/libbeat/statestore"
 	"github.com/elastic/go-concert/unison"
 )
 
@@ -29,9 +35,10 @@ import (
 // we overwrite the pending states that have not been written in memory,
 // until the disk is ready for more updates.
 type updateWriter struct {
-	store *store
-	tg    unison.TaskGroup
-	ch    *updateChan
+	store   *store
+	tg      unison.TaskGroup
+	ch      *updateChan
+	metrics *updateMetrics
 }
 
 type updateChan struct {
@@ -40,10 +47,38 @@ type updateChan struct {
 	pending map[string]int
 	updates []scheduledUpdate
 
+	// flushInterval is the maximum time an update is kept in memory before
+	// it is handed to the writer. If 0, updates are handed out immediately.
+	flushInterval time.Duration
+
+	// maxPending limits the number of keys with pending updates. Once the limit
+	// is reached the pending updates are handed to the writer right away and
+	// Send blocks for new keys until the writer did pick up the batch.
+	// If 0, the number of pending updates is not limited.
+	maxPending int
+
+	// oldest is the time the first update was added after the last Recv.
+	oldest time.Time
+	closed bool
+
+	pendingGauge *monitoring.Uint
+
 	// we use a chan as conditional, so we can break on context cancellation.
 	// `waiter` is set if the writer is waiting for new entries to be reported to the store.
+	// `full` is set if a sender is waiting for the writer to pick up pending updates.
 	mutex  sync.Mutex
 	waiter chan struct{}
+	full   chan struct{}
+}
+
+// updateMetrics reports the state of the update pipeline.
+type updateMetrics struct {
+	flushes           *monitoring.Uint // Number of batches written to the persistent store.
+	updatesWritten    *monitoring.Uint // Number of merged updates written to the persistent store.
+	pendingUpdates    *monitoring.Uint // Number of keys with updates not yet written (gauge).
+	durabilityWindow  *monitoring.Uint // Age in nanoseconds of the oldest update in the last flush (gauge).
+	flushLatency      metrics.Sample   // Histogram of the time in nanoseconds needed to write a batch.
+	durabilityWindows metrics.Sample   // Histogram of the age in nanoseconds of the oldest update per flush.
 }
 
 type scheduledUpdate struct {
@@ -53,13 +88,26 @@ type scheduledUpdate struct {
 
 type scheduledOp interface {
 	Key() string
-	Execute(store *store, n uint)
+	Execute(store *store, w stateWriter, n uint)
+}
+
+// stateWriter writes states to the persistent store. It is implemented by
+// statestore.Store and statestore.Batch.
+type stateWriter interface {
+	Set(key string, value interface{}) error
+}
+
+// committer is implemented by state writers deferring the writes until they
+// are committed, like statestore.Batch.
+type committer interface {
+	OnCommit(fn func())
 }
 
-func newUpdateWriter(store *store, ch *updateChan) *updateWriter {
+func newUpdateWriter(store *store, ch *updateChan, metrics *updateMetrics) *updateWriter {
 	w := &updateWriter{
-		store: store,
-		ch:    ch,
+		store:   store,
+		ch:      ch,
+		metrics: metrics,
 	}
 	w.tg.Go(func(ctx context.Context) error {
 		w.run(ctx)
@@ -73,34 +121,98 @@ func newUpdateWriter(store *store, ch *updateChan) *updateWriter {
 // all pending operations.
 func (w *updateWriter) Close() {
 	w.tg.Stop()
-	w.syncStates(w.ch.TryRecv())
+	updates, oldest := w.ch.close()
+	w.syncStates(updates, oldest)
 }
 
 func (w *updateWriter) run(ctx context.Context) {
 	for ctx.Err() == nil {
-		updates, err := w.ch.Recv(ctx)
+		updates, oldest, err := w.ch.recv(ctx)
 		if err != nil {
 			return
 		}
 
-		w.syncStates(updates)
+		w.syncStates(updates, oldest)
+	}
+}
+
+// syncStates writes all updates in a single batch, such that stores syncing
+// every write to disk only do so once per call.
+func (w *updateWriter) syncStates(updates []scheduledUpdate, oldest time.Time) {
+	if len(updates) == 0 {
+		return
+	}
+
+	start := time.Now()
+	err := w.store.persistentStore.Batch(func(batch *statestore.Batch) error {
+		for _, upd := range updates {
+			upd.op.Execute(w.store, batch, upd.n)
+		}
+		return nil
+	})
+	if err != nil && !statestore.IsClosed(err) {
+		w.store.log.Errorf("Failed to write %d updates to the registry: %v", len(updates), err)
+	}
+
+	if m := w.metrics; m != nil {
+		end := time.Now()
+		m.flushes.Inc()
+		m.updatesWritten.Add(uint64(len(updates)))
+		m.flushLatency.Update(end.Sub(start).Nanoseconds())
+		if !oldest.IsZero() {
+			window := end.Sub(oldest)
+			m.durabilityWindow.Set(uint64(window))
+			m.durabilityWindows.Update(window.Nanoseconds())
+		}
 	}
 }
 
-func (w *updateWriter) syncStates(updates []scheduledUpdate) {
-	for _, upd := range updates {
-		upd.op.Execute(w.store, upd.n)
+func newUpdateMetrics(parent *monitoring.Registry, name string) *updateMetrics {
+	reg := parent.GetRegistry(name)
+	if reg != nil {
+		// The registry already exists if the input manager has been recreated.
+		reg.Clear()
+	} else {
+		reg = parent.NewRegistry(name)
+	}
+
+	m := &updateMetrics{
+		flushes:           monitoring.NewUint(reg, "flushes_total"),
+		updatesWritten:    monitoring.NewUint(reg, "updates_written_total"),
+		pendingUpdates:    monitoring.NewUint(reg, "pending_updates_gauge"),
+		durabilityWindow:  monitoring.NewUint(reg, "durability_window_ns_gauge"),
+		flushLatency:      metrics.NewUniformSample(1024),
+		durabilityWindows: metrics.NewUniformSample(1024),
 	}
+	adapter.NewGoMetrics(reg, "flush_latency", adapter.Accept).
+		Register("histogram", metrics.NewHistogram(m.flushLatency))
+	adapter.NewGoMetrics(reg, "durability_window", adapter.Accept).
+		Register("histogram", metrics.NewHistogram(m.durabilityWindows))
+	return m
 }
 
 func newUpdateChan() *updateChan {
-	return &updateChan{
-		pending: map[string]int{},
+	return newBatchedUpdateChan(0, 0, nil)
+}
+
+// newBatchedUpdateChan creates an updateChan that collects updates for up to
+// flushInterval or until maxPending keys have pending updates.
+func newBatchedUpdateChan(flushInterval time.Duration, maxPending int, metrics *updateMetrics) *updateChan {
+	ch := &updateChan{
+		pending:       map[string]int{},
+		flushInterval: flushInterval,
+		maxPending:    maxPending,
+	}
+	if metrics != nil {
+		ch.pendingGauge = metrics.pendingUpdates
 	}
+	return ch
 }
 
 // Send adds a new update to the channel. Update operations
 // for the same resource key will be merged by dropping the old operation.
+// If the channel is bounded and full, Send blocks until the writer has
+// picked up the pending updates.
 func (ch *updateChan) Send(upd scheduledUpdate) {
 	ch.mutex.Lock()
 	defer ch.mutex.Unlock()
@@ -108,34 +220,70 @@ func (ch *updateChan) Send(upd scheduledUpdate) {
 	key := upd.op.Key()
 
 	idx, exists := ch.pending[key]
+	for !exists && ch.isFull() {
+		full := ch.full
+		if full == nil {
+			full = make(chan struct{})
+			ch.full = full
+		}
+		ch.notifyWaiter()
+
+		ch.mutex.Unlock()
+		<-full
+		ch.mutex.Lock()
+
+		idx, exists = ch.pending[key]
+	}
+
 	if !exists {
+		if len(ch.updates) == 0 {
+			ch.oldest = time.Now()
+		}
 		idx = len(ch.updates)
 		ch.updates = append(ch.updates, upd)
 		ch.pending[key] = idx
+		if ch.pendingGauge != nil {
+			ch.pendingGauge.Set(uint64(len(ch.updates)))
+		}
 	} else {
 		ch.updates[idx].op = upd.op
 		ch.updates[idx].n += upd.n
 	}
 
-	// notify pending Read that new updates are available.
-	if ch.waiter != nil {
-		close(ch.waiter)
-		ch.waiter = nil
+	// notify pending Read that new updates are available. If updates are
+	// batched, the reader only needs to be woken up for the first update and
+	// once the batch is full.
+	if ch.flushInterval <= 0 || len(ch.updates) == 1 || ch.isFull() {
+		ch.notifyWaiter()
 	}
 }
 
 // Recv waits until at least one entry is available and returns a table of key
 // value pairs with pending updates that need to be written to the registry.
+// If a flush interval is configured, Recv waits until the oldest pending update
+// has reached the flush interval or the maximum number of pending updates is
+// reached.
 func (ch *updateChan) Recv(ctx context.Context) ([]scheduledUpdate, error) {
+	updates, _, err := ch.recv(ctx)
+	return updates, err
+}
+
+func (ch *updateChan) recv(ctx context.Context) ([]scheduledUpdate, time.Time, error) {
 	ch.mutex.Lock()
 
 	for ctx.Err() == nil {
-		updates := ch.updates
-		if len(updates) > 0 {
-			ch.pending = map[string]int{}
-			ch.updates = nil
-			ch.mutex.Unlock()
-			return updates, nil
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if len(ch.updates) > 0 {
+			wait := ch.flushInterval - time.Since(ch.oldest)
+			if wait <= 0 || ch.isFull() {
+				updates, oldest := ch.takeLocked()
+				ch.mutex.Unlock()
+				return updates, oldest, nil
+			}
+
+			timer = time.NewTimer(wait)
+			timeout = timer.C
 		}
 
 		waiter := make(chan struct{})
@@ -144,13 +292,17 @@ func (ch *updateChan) Recv(ctx context.Context) ([]scheduledUpdate, error) {
 
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
 		case <-waiter:
-			ch.mutex.Lock()
+		case <-timeout:
 		}
+		if timer != nil {
+			timer.Stop()
+		}
+		ch.mutex.Lock()
 	}
 
-	return nil, ctx.Err()
+	ch.mutex.Unlock()
+	return nil, time.Time{}, ctx.Err()
 }
 
 // TryRecv returns available update operations or nil if there
@@ -160,11 +312,49 @@ func (ch *updateChan) TryRecv() []scheduledUpdate {
 	ch.mutex.Lock()
 	defer ch.mutex.Unlock()
 
-	updates := ch.updates
-	if len(updates) > 0 {
-		ch.pending = map[string]int{}
-		ch.updates = nil
+	updates, _ := ch.takeLocked()
+	return updates
+}
+
+// close returns all pending operations and unblocks all senders. After close
+// the channel is unbounded, so pending ACKs can not block shutdown.
+func (ch *updateChan) close() ([]scheduledUpdate, time.Time) {
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+
+	ch.closed = true
+	return ch.takeLocked()
+}
+
+func (ch *updateChan) takeLocked() ([]scheduledUpdate, time.Time) {
+	updates, oldest := ch.updates, ch.oldest
+	if len(updates) == 0 {
+		return nil, time.Time{}
 	}
 
-	return updates
+	ch.pending = map[string]int{}
+	ch.updates = nil
+	ch.oldest = time.Time{}
+	if ch.pendingGauge != nil {
+		ch.pendingGauge.Set(0)
+	}
+
+	// wake up blocked senders
+	if ch.full != nil {
+		close(ch.full)
+		ch.full = nil
+	}
+
+	return updates, oldest
+}
+
+func (ch *updateChan) isFull() bool {
+	return !ch.closed && ch.maxPending > 0 && len(ch.updates) >= ch.maxPending
+}
+
+func (ch *updateChan) notifyWaiter() {
+	if ch.waiter != nil {
+		close(ch.waiter)
+		ch.waiter = nil
+	}
 }
@@ -26,6 +26,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 )
 
 type testScheduledOp struct {
@@ -34,7 +36,7 @@ type testScheduledOp struct {
 }
 
 func (t *testScheduledOp) Key() string { return t.key }
-func (t *testScheduledOp) Execute(_ *store, n uint) {
+func (t *testScheduledOp) Execute(_ *store, _ stateWriter, n uint) {
 	if t.exec != nil {
 		t.exec(n)
 	}
@@ -43,7 +45,7 @@ func (t *testScheduledOp) Execute(_ *store, n uint) {
 func TestUpdateWriter(t *testing.T) {
 	t.Run("single op is executed", func(t *testing.T) {
 		ch := newUpdateChan()
-		w := newUpdateWriter(nil, ch)
+		w := newUpdateWriter(testOpenStore(t, "test", nil), ch, nil)
 		defer w.Close()
 
 		var wg sync.WaitGroup
@@ -66,7 +68,7 @@ func TestUpdateWriter(t *testing.T) {
 		const N = 100
 
 		ch := newUpdateChan()
-		w := newUpdateWriter(nil, ch)
+		w := newUpdateWriter(testOpenStore(t, "test", nil), ch, nil)
 		defer w.Close()
 
 		var wg sync.WaitGroup
@@ -89,6 +91,76 @@ func TestUpdateWriter(t *testing.T) {
 	})
 }
 
+func TestUpdateWriter_Batched(t *testing.T) {
+	t.Run("updates are merged until flush interval", func(t *testing.T) {
+		metrics := newUpdateMetrics(monitoring.NewRegistry(), "test")
+		ch := newBatchedUpdateChan(200*time.Millisecond, 0, metrics)
+		w := newUpdateWriter(testOpenStore(t, "test", nil), ch, metrics)
+		defer w.Close()
+
+		var mu sync.Mutex
+		var executed []uint
+		done := make(chan struct{})
+		for i := 0; i < 10; i++ {
+			ch.Send(scheduledUpdate{
+				op: &testScheduledOp{
+					key: "test",
+					exec: func(n uint) {
+						mu.Lock()
+						executed = append(executed, n)
+						mu.Unlock()
+						close(done)
+					},
+				},
+				n: 1,
+			})
+		}
+		assert.Equal(t, uint64(1), metrics.pendingUpdates.Get())
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("pending updates have not been flushed")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []uint{10}, executed)
+		assert.Equal(t, uint64(1), metrics.flushes.Get())
+		assert.Equal(t, uint64(0), metrics.pendingUpdates.Get())
+		assert.GreaterOrEqual(t, metrics.durabilityWindow.Get(), uint64(200*time.Millisecond))
+	})
+
+	t.Run("flush once max pending is reached", func(t *testing.T) {
+		ch := newBatchedUpdateChan(time.Hour, 3, nil)
+		w := newUpdateWriter(testOpenStore(t, "test", nil), ch, nil)
+		defer w.Close()
+
+		var wg sync.WaitGroup
+		wg.Add(3)
+		for _, key := range []string{"a", "b", "c"} {
+			ch.Send(scheduledUpdate{
+				op: &testScheduledOp{key: key, exec: func(n uint) { wg.Add(-int(n)) }},
+				n:  1,
+			})
+		}
+		wg.Wait()
+	})
+
+	t.Run("close flushes all pending updates", func(t *testing.T) {
+		ch := newBatchedUpdateChan(time.Hour, 0, nil)
+		w := newUpdateWriter(testOpenStore(t, "test", nil), ch, nil)
+
+		var executed uint
+		ch.Send(scheduledUpdate{
+			op: &testScheduledOp{key: "test", exec: func(n uint) { executed += n }},
+			n:  3,
+		})
+		w.Close()
+		assert.Equal(t, uint(3), executed)
+	})
+}
+
 func TestUpdateChan_SendRecv(t *testing.T) {
 	t.Run("read does not block if events are available", func(t *testing.T) {
 		ch := newUpdateChan()
@@ -125,6 +197,53 @@ func TestUpdateChan_SendRecv(t *testing.T) {
 	})
 }
 
+func TestUpdateChan_Bounded(t *testing.T) {
+	t.Run("send blocks for new keys if full", func(t *testing.T) {
+		ch := newBatchedUpdateChan(0, 1, nil)
+		ch.Send(scheduledUpdate{op: makeTestUpdateOp("a"), n: 1})
+
+		// updates for keys already pending are merged without blocking
+		ch.Send(scheduledUpdate{op: makeTestUpdateOp("a"), n: 1})
+
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			ch.Send(scheduledUpdate{op: makeTestUpdateOp("b"), n: 1})
+		}()
+
+		select {
+		case <-sent:
+			t.Fatal("send did not block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		got := ch.TryRecv()
+		require.Len(t, got, 1)
+		assert.Equal(t, uint(2), got[0].n)
+
+		<-sent
+		got = ch.TryRecv()
+		require.Len(t, got, 1)
+		assert.Equal(t, "b", got[0].op.Key())
+	})
+
+	t.Run("close unblocks senders", func(t *testing.T) {
+		ch := newBatchedUpdateChan(0, 1, nil)
+		ch.Send(scheduledUpdate{op: makeTestUpdateOp("a"), n: 1})
+
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			ch.Send(scheduledUpdate{op: makeTestUpdateOp("b"), n: 1})
+		}()
+
+		updates, _ := ch.close()
+		assert.Len(t, updates, 1)
+		<-sent
+		assert.Len(t, ch.TryRecv(), 1)
+	})
+}
+
 func TestUpdateChan_TryRecv(t *testing.T) {
 	t.Run("return empty list if channel is empty", func(t *testing.T) {
 		ch := newUpdateChan()
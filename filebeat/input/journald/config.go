@@ -21,7 +21,10 @@
 package journald
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/elastic/beats/v7/filebeat/input/journald/pkg/journalfield"
@@ -51,6 +54,43 @@ type config struct {
 
 	// SaveRemoteHostname defines if the original source of the entry needs to be saved.
 	SaveRemoteHostname bool `config:"save_remote_hostname"`
+
+	// Mode defines if the journal files in paths are merged or read one by one.
+	Mode journalread.FilesMode `config:"mode"`
+
+	// ScanFrequency is how often the paths are scanned for new journal files
+	// in file mode.
+	ScanFrequency time.Duration `config:"scan_frequency" validate:"min=0,nonzero"`
+
+	// FieldMappings stores the custom mappings of journal fields to event fields.
+	FieldMappings []fieldMapping `config:"field_mappings"`
+
+	// BootIDs limits the entries read to the given boots.
+	BootIDs []string `config:"boot_ids"`
+
+	// Since and Until limit the entries read to a time window.
+	Since timestamp `config:"since"`
+	Until timestamp `config:"until"`
+}
+
+// fieldMapping maps a journal field to an event field.
+type fieldMapping struct {
+	// Field is the name of the field in the journal.
+	Field string `config:"field" validate:"required"`
+
+	// Target is the name of the event field.
+	Target string `config:"target"`
+
+	// Type is the type of the event field, either string or integer.
+	Type string `config:"type"`
+
+	// Drop removes the field from the events.
+	Drop bool `config:"drop"`
+}
+
+// timestamp is a point in time configured as RFC 3339 timestamp.
+type timestamp struct {
+	time.Time
 }
 
 var errInvalidSeekFallback = errors.New("invalid setting for cursor_seek_fallback")
@@ -62,6 +102,8 @@ func defaultConfig() config {
 		Seek:               journalread.SeekCursor,
 		CursorSeekFallback: journalread.SeekHead,
 		SaveRemoteHostname: false,
+		Mode:               journalread.FilesModeMerge,
+		ScanFrequency:      10 * time.Second,
 	}
 }
 
@@ -69,5 +111,85 @@ func (c *config) Validate() error {
 	if c.CursorSeekFallback != journalread.SeekHead && c.CursorSeekFallback != journalread.SeekTail {
 		return errInvalidSeekFallback
 	}
+	if c.Mode == journalread.FilesModeFile && len(c.Paths) == 0 {
+		return errors.New("mode 'file' requires paths to journal files")
+	}
+	for i, id := range c.BootIDs {
+		normalized, err := normalizeBootID(id)
+		if err != nil {
+			return err
+		}
+		c.BootIDs[i] = normalized
+	}
+	if !c.Since.IsZero() && !c.Until.IsZero() && !c.Until.After(c.Since.Time) {
+		return errors.New("until must be after since")
+	}
 	return nil
 }
+
+// conversions returns the field conversion rules for the configured
+// field mappings, or nil if the default rules apply.
+func (c *config) conversions() journalfield.FieldConversion {
+	if len(c.FieldMappings) == 0 {
+		return nil
+	}
+
+	custom := make(journalfield.FieldConversion, len(c.FieldMappings))
+	for _, m := range c.FieldMappings {
+		custom[m.Field] = journalfield.Conversion{
+			Names:     []string{m.Target},
+			IsInteger: m.Type == "integer",
+			Dropped:   m.Drop,
+		}
+	}
+	return journalfield.WithDefaults(custom)
+}
+
+// bootIDMatchers returns the matchers selecting the entries of the
+// configured boots.
+func (c *config) bootIDMatchers() ([]journalfield.Matcher, error) {
+	matchers := make([]journalfield.Matcher, len(c.BootIDs))
+	for i, id := range c.BootIDs {
+		m, err := journalfield.BuildMatcher("_BOOT_ID=" + id)
+		if err != nil {
+			return nil, err
+		}
+		matchers[i] = m
+	}
+	return matchers, nil
+}
+
+func (m *fieldMapping) Validate() error {
+	switch {
+	case m.Drop && m.Target != "":
+		return fmt.Errorf("field mapping for '%s' can not set both target and drop", m.Field)
+	case !m.Drop && m.Target == "":
+		return fmt.Errorf("field mapping for '%s' requires a target", m.Field)
+	}
+
+	switch m.Type {
+	case "", "string", "integer":
+		return nil
+	default:
+		return fmt.Errorf("invalid type '%s' in field mapping for '%s'", m.Type, m.Field)
+	}
+}
+
+func (t *timestamp) Unpack(value string) error {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp '%s', expected RFC 3339 format: %w", value, err)
+	}
+	t.Time = parsed
+	return nil
+}
+
+// normalizeBootID converts boot IDs formatted as UUID into the format used by
+// the journal, 32 lowercase hexadecimal characters.
+func normalizeBootID(id string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if _, err := hex.DecodeString(normalized); err != nil || len(normalized) != 32 {
+		return "", fmt.Errorf("invalid boot ID '%s'", id)
+	}
+	return normalized, nil
+}
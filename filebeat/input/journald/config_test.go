@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux && cgo && withjournald
+// +build linux,cgo,withjournald
+
+package journald
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/filebeat/input/journald/pkg/journalfield"
+	"github.com/elastic/beats/v7/filebeat/input/journald/pkg/journalread"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := common.MustNewConfigFrom(common.MapStr{
+		"paths":    []string{"/var/lib/vehicles"},
+		"mode":     "file",
+		"boot_ids": []string{"1D5F3C2A-9E4B-4C1D-8F3E-2A1B0C9D8E7F", "0123456789abcdef0123456789abcdef"},
+		"since":    "2022-03-01T00:00:00Z",
+		"until":    "2022-03-02T12:00:00+01:00",
+		"field_mappings": []common.MapStr{
+			{"field": "_VEHICLE_ID", "target": "vehicle.id"},
+			{"field": "ODOMETER", "target": "vehicle.odometer", "type": "integer"},
+			{"field": "_DEBUG_DUMP", "drop": true},
+		},
+	})
+
+	c := defaultConfig()
+	require.NoError(t, cfg.Unpack(&c))
+
+	assert.Equal(t, journalread.FilesModeFile, c.Mode)
+	assert.Equal(t, []string{"1d5f3c2a9e4b4c1d8f3e2a1b0c9d8e7f", "0123456789abcdef0123456789abcdef"}, c.BootIDs)
+	assert.Equal(t, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), c.Since.UTC())
+	assert.Equal(t, time.Date(2022, 3, 2, 11, 0, 0, 0, time.UTC), c.Until.UTC())
+
+	conversions := c.conversions()
+	assert.Equal(t, journalfield.Conversion{Names: []string{"vehicle.id"}}, conversions["_VEHICLE_ID"])
+	assert.Equal(t, journalfield.Conversion{Names: []string{"vehicle.odometer"}, IsInteger: true}, conversions["ODOMETER"])
+	assert.True(t, conversions["_DEBUG_DUMP"].Dropped)
+	assert.Contains(t, conversions, "_SYSTEMD_UNIT")
+
+	matchers, err := c.bootIDMatchers()
+	require.NoError(t, err)
+	assert.Equal(t, "_BOOT_ID=1d5f3c2a9e4b4c1d8f3e2a1b0c9d8e7f", matchers[0].String())
+}
+
+func TestConfigDefaults(t *testing.T) {
+	c := defaultConfig()
+	require.NoError(t, common.NewConfig().Unpack(&c))
+	assert.Equal(t, journalread.FilesModeMerge, c.Mode)
+	assert.Nil(t, c.conversions())
+}
+
+func TestConfigInvalid(t *testing.T) {
+	cases := map[string]common.MapStr{
+		"file mode without paths": {"mode": "file"},
+		"unknown mode":            {"mode": "split"},
+		"invalid boot id":         {"boot_ids": []string{"not-a-boot-id"}},
+		"invalid timestamp":       {"since": "yesterday"},
+		"empty time window": {
+			"since": "2022-03-02T00:00:00Z",
+			"until": "2022-03-01T00:00:00Z",
+		},
+		"mapping without target": {"field_mappings": []common.MapStr{{"field": "_VEHICLE_ID"}}},
+		"mapping with target and drop": {
+			"field_mappings": []common.MapStr{{"field": "_VEHICLE_ID", "target": "vehicle.id", "drop": true}},
+		},
+		"mapping with invalid type": {
+			"field_mappings": []common.MapStr{{"field": "ODOMETER", "target": "vehicle.odometer", "type": "float"}},
+		},
+	}
+
+	for name, settings := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := defaultConfig()
+			assert.Error(t, common.MustNewConfigFrom(settings).Unpack(&c))
+		})
+	}
+}
+
+func TestInTimeWindow(t *testing.T) {
+	since := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+	usec := func(t time.Time) uint64 { return uint64(t.UnixNano() / int64(time.Microsecond)) }
+
+	inp := &journald{Since: since, Until: until}
+	assert.False(t, inp.inTimeWindow(usec(since.Add(-time.Microsecond))))
+	assert.True(t, inp.inTimeWindow(usec(since)))
+	assert.True(t, inp.inTimeWindow(usec(until)))
+	assert.False(t, inp.inTimeWindow(usec(until.Add(time.Microsecond))))
+
+	assert.True(t, (&journald{}).inTimeWindow(usec(since)))
+}
@@ -25,17 +25,15 @@ import (
 
 	"github.com/elastic/beats/v7/filebeat/input/journald/pkg/journalfield"
 	"github.com/elastic/beats/v7/libbeat/beat"
-	"github.com/elastic/beats/v7/libbeat/logp"
 )
 
 func eventFromFields(
-	log *logp.Logger,
+	c *journalfield.Converter,
 	timestamp uint64,
 	entryFields map[string]string,
 	saveRemoteHostname bool,
 ) beat.Event {
 	created := time.Now()
-	c := journalfield.NewConverter(log, nil)
 	fields := c.Convert(entryFields)
 	fields.Put("event.kind", "event")
 
@@ -21,6 +21,7 @@
 package journald
 
 import (
+	"sync"
 	"time"
 
 	"github.com/coreos/go-systemd/v22/sdjournal"
@@ -30,6 +31,7 @@ import (
 	"github.com/elastic/beats/v7/filebeat/input/journald/pkg/journalread"
 	input "github.com/elastic/beats/v7/filebeat/input/v2"
 	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/backoff"
 	"github.com/elastic/beats/v7/libbeat/feature"
@@ -43,6 +45,12 @@ type journald struct {
 	CursorSeekFallback journalread.SeekMode
 	Matches            []journalfield.Matcher
 	SaveRemoteHostname bool
+	Mode               journalread.FilesMode
+	ScanFrequency      time.Duration
+	Conversions        journalfield.FieldConversion
+	BootIDs            []journalfield.Matcher
+	Since              time.Time
+	Until              time.Time
 }
 
 type checkpoint struct {
@@ -50,6 +58,17 @@ type checkpoint struct {
 	Position           string
 	RealtimeTimestamp  uint64
 	MonotonicTimestamp uint64
+
+	// Files holds the positions of the journal files read in file mode by
+	// file path.
+	Files map[string]filePosition
+}
+
+// filePosition is the position in a journal file read in file mode.
+type filePosition struct {
+	Position           string
+	RealtimeTimestamp  uint64
+	MonotonicTimestamp uint64
 }
 
 // LocalSystemJournalID is the ID of the local system journal.
@@ -90,6 +109,18 @@ func configure(cfg *common.Config) ([]cursor.Source, cursor.Input, error) {
 	if len(paths) == 0 {
 		paths = []string{localSystemJournalID}
 	}
+	if config.Mode == journalread.FilesModeFile {
+		// The journal files are searched for when the input runs, this only
+		// checks the paths.
+		if _, err := journalread.FindFiles(paths); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	bootIDs, err := config.bootIDMatchers()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	sources := make([]cursor.Source, len(paths))
 	for i, p := range paths {
@@ -103,17 +134,36 @@ func configure(cfg *common.Config) ([]cursor.Source, cursor.Input, error) {
 		CursorSeekFallback: config.CursorSeekFallback,
 		Matches:            config.Matches,
 		SaveRemoteHostname: config.SaveRemoteHostname,
+		Mode:               config.Mode,
+		ScanFrequency:      config.ScanFrequency,
+		Conversions:        config.conversions(),
+		BootIDs:            bootIDs,
+		Since:              config.Since.Time,
+		Until:              config.Until.Time,
 	}, nil
 }
 
 func (inp *journald) Name() string { return pluginName }
 
 func (inp *journald) Test(src cursor.Source, ctx input.TestContext) error {
-	reader, err := inp.open(ctx.Logger, ctx.Cancelation, src)
-	if err != nil {
-		return err
+	paths := []string{src.Name()}
+	if inp.Mode == journalread.FilesModeFile {
+		var err error
+		if paths, err = journalread.FindFiles(paths); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		reader, err := inp.open(ctx.Logger, ctx.Cancelation, path)
+		if err != nil {
+			return err
+		}
+		if err := reader.Close(); err != nil {
+			return err
+		}
 	}
-	return reader.Close()
+	return nil
 }
 
 func (inp *journald) Run(
@@ -123,41 +173,195 @@ func (inp *journald) Run(
 	publisher cursor.Publisher,
 ) error {
 	log := ctx.Logger.With("path", src.Name())
-	checkpoint := initCheckpoint(log, cursor)
+	cp := initCheckpoint(log, cursor)
+
+	if inp.Mode == journalread.FilesModeFile {
+		inp.runFiles(ctx, log, src.Name(), &fileCheckpoints{publisher: publisher, checkpoint: cp})
+		return nil
+	}
+
+	reader, err := inp.open(ctx.Logger, ctx.Cancelation, src.Name())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return inp.read(ctx, log, reader, "", cp, func(event beat.Event, cp checkpoint) error {
+		return publisher.Publish(event, cp)
+	})
+}
+
+// runFiles reads the journal files matching path in file mode, each from its
+// own checkpoint. The path is scanned every scan frequency, so files added
+// after the input started are read too. A file that fails is not read again
+// until the input is restarted.
+func (inp *journald) runFiles(ctx input.Context, log *logp.Logger, path string, files *fileCheckpoints) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanFiles(ctx.Cancelation, log, path, inp.ScanFrequency, func(file string) {
+		log.Infof("Start reading journal file %s", file)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := inp.readFile(ctx, log, file, files); err != nil && ctx.Cancelation.Err() == nil {
+				log.Errorf("Stopped reading journal file %s: %v", file, err)
+			}
+		}()
+	})
+}
 
-	reader, err := inp.open(ctx.Logger, ctx.Cancelation, src)
+func (inp *journald) readFile(ctx input.Context, log *logp.Logger, path string, files *fileCheckpoints) error {
+	reader, err := inp.open(ctx.Logger, ctx.Cancelation, path)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	if err := reader.Seek(seekBy(ctx.Logger, checkpoint, inp.Seek, inp.CursorSeekFallback)); err != nil {
+	return inp.read(ctx, log.With("file", path), reader, path, files.get(path), func(event beat.Event, cp checkpoint) error {
+		return files.publish(path, event, cp)
+	})
+}
+
+// read publishes the entries of the journal, continuing from the checkpoint.
+// In file mode, path is the journal file added to the events.
+func (inp *journald) read(
+	ctx input.Context,
+	log *logp.Logger,
+	reader *journalread.Reader,
+	path string,
+	checkpoint checkpoint,
+	publish func(beat.Event, checkpoint) error,
+) error {
+	if err := inp.seek(ctx.Logger, reader, checkpoint); err != nil {
 		log.Error("Continue from current position. Seek failed with: %v", err)
 	}
 
+	converter := journalfield.NewConverter(ctx.Logger, inp.Conversions)
 	for {
 		entry, err := reader.Next(ctx.Cancelation)
 		if err != nil {
 			return err
 		}
+		if !inp.inTimeWindow(entry.RealtimeTimestamp) {
+			continue
+		}
 
-		event := eventFromFields(ctx.Logger, entry.RealtimeTimestamp, entry.Fields, inp.SaveRemoteHostname)
+		event := eventFromFields(converter, entry.RealtimeTimestamp, entry.Fields, inp.SaveRemoteHostname)
+		event.Meta = common.MapStr{"journald": common.MapStr{"cursor": entry.Cursor}}
+		if path != "" {
+			event.Fields.Put("log.file.path", path)
+		}
 
 		checkpoint.Position = entry.Cursor
 		checkpoint.RealtimeTimestamp = entry.RealtimeTimestamp
 		checkpoint.MonotonicTimestamp = entry.MonotonicTimestamp
 
-		if err := publisher.Publish(event, checkpoint); err != nil {
+		if err := publish(event, checkpoint); err != nil {
 			return err
 		}
 	}
 }
 
-func (inp *journald) open(log *logp.Logger, canceler input.Canceler, src cursor.Source) (*journalread.Reader, error) {
+// scanFiles calls start for every journal file matching path that was not
+// found before. The path is scanned every period until the input is stopped.
+func scanFiles(canceler input.Canceler, log *logp.Logger, path string, period time.Duration, start func(file string)) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	found := map[string]bool{}
+	for {
+		files, err := journalread.FindFiles([]string{path})
+		if err != nil {
+			log.Errorf("Failed to scan for journal files: %v", err)
+		}
+		for _, file := range files {
+			if !found[file] {
+				found[file] = true
+				start(file)
+			}
+		}
+
+		select {
+		case <-canceler.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fileCheckpoints holds the positions of the journal files read in file
+// mode. The cursor of a source is replaced on every update, so every event
+// carries the positions of all files.
+type fileCheckpoints struct {
+	mu         sync.Mutex
+	publisher  cursor.Publisher
+	checkpoint checkpoint
+}
+
+// get returns the checkpoint to continue reading the journal file from.
+func (f *fileCheckpoints) get(path string) checkpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pos := f.checkpoint.Files[path]
+	return checkpoint{
+		Version:            cursorVersion,
+		Position:           pos.Position,
+		RealtimeTimestamp:  pos.RealtimeTimestamp,
+		MonotonicTimestamp: pos.MonotonicTimestamp,
+	}
+}
+
+// publish publishes an event of the journal file with its checkpoint. The
+// positions are copied, as the publisher keeps the cursor of an event until
+// it is acknowledged.
+func (f *fileCheckpoints) publish(path string, event beat.Event, cp checkpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files := make(map[string]filePosition, len(f.checkpoint.Files)+1)
+	for p, pos := range f.checkpoint.Files {
+		files[p] = pos
+	}
+	files[path] = filePosition{
+		Position:           cp.Position,
+		RealtimeTimestamp:  cp.RealtimeTimestamp,
+		MonotonicTimestamp: cp.MonotonicTimestamp,
+	}
+	f.checkpoint.Files = files
+	return f.publisher.Publish(event, f.checkpoint)
+}
+
+// seek moves the reader to the position to continue reading from. If the
+// input starts at the head of the journal, entries older than the configured
+// time window are skipped.
+func (inp *journald) seek(log *logp.Logger, reader *journalread.Reader, cp checkpoint) error {
+	mode, cursor := seekBy(log, cp, inp.Seek, inp.CursorSeekFallback)
+	if mode == journalread.SeekHead && !inp.Since.IsZero() {
+		return reader.SeekRealtime(inp.Since)
+	}
+	return reader.Seek(mode, cursor)
+}
+
+// inTimeWindow checks if an entry with the given realtime timestamp in
+// microseconds was received by the journal in the configured time window.
+func (inp *journald) inTimeWindow(usec uint64) bool {
+	ts := time.Unix(0, int64(usec)*int64(time.Microsecond))
+	if !inp.Since.IsZero() && ts.Before(inp.Since) {
+		return false
+	}
+	if !inp.Until.IsZero() && ts.After(inp.Until) {
+		return false
+	}
+	return true
+}
+
+func (inp *journald) open(log *logp.Logger, canceler input.Canceler, path string) (*journalread.Reader, error) {
 	backoff := backoff.NewExpBackoff(canceler.Done(), inp.Backoff, inp.MaxBackoff)
-	reader, err := journalread.Open(log, src.Name(), backoff, withFilters(inp.Matches))
+	reader, err := journalread.Open(log, path, backoff, withFilters(inp.Matches, inp.BootIDs))
 	if err != nil {
-		return nil, sderr.Wrap(err, "failed to create reader for %{path} journal", src.Name())
+		return nil, sderr.Wrap(err, "failed to create reader for %{path} journal", path)
 	}
 
 	return reader, nil
@@ -168,7 +372,8 @@ func initCheckpoint(log *logp.Logger, c cursor.Cursor) checkpoint {
 		return checkpoint{Version: cursorVersion}
 	}
 
-	var cp checkpoint
+	// The map must be allocated to unpack the positions of the files.
+	cp := checkpoint{Files: map[string]filePosition{}}
 	err := c.Unpack(&cp)
 	if err != nil {
 		log.Errorf("Reset journald position. Failed to read checkpoint from registry: %v", err)
@@ -183,9 +388,9 @@ func initCheckpoint(log *logp.Logger, c cursor.Cursor) checkpoint {
 	return cp
 }
 
-func withFilters(filters []journalfield.Matcher) func(*sdjournal.Journal) error {
+func withFilters(filters, bootIDs []journalfield.Matcher) func(*sdjournal.Journal) error {
 	return func(j *sdjournal.Journal) error {
-		return journalfield.ApplyMatchersOr(j, filters)
+		return journalfield.ApplyMatchersOrWith(j, filters, bootIDs)
 	}
 }
 
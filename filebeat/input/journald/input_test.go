@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux && cgo && withjournald
+// +build linux,cgo,withjournald
+
+package journald
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+func TestConfigureFileModeEmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	sources, inp, err := configure(common.MustNewConfigFrom(common.MapStr{
+		"paths": []string{dir},
+		"mode":  "file",
+	}))
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, dir, sources[0].Name())
+	assert.Equal(t, 10*time.Second, inp.(*journald).ScanFrequency)
+}
+
+func TestScanFiles(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var started []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanFiles(ctx, logp.NewLogger("test"), dir, time.Millisecond, func(file string) {
+			mu.Lock()
+			defer mu.Unlock()
+			started = append(started, file)
+		})
+	}()
+
+	file := filepath.Join(dir, "system.journal")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(started) == 1
+	}, time.Second, time.Millisecond, "files added after the start must be found")
+
+	other := filepath.Join(dir, "user-1000.journal")
+	require.NoError(t, os.WriteFile(other, nil, 0o644))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(started) == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Equal(t, []string{file, other}, started, "every file must be started once")
+}
+
+type checkpointPublisher struct {
+	cursors []interface{}
+}
+
+func (p *checkpointPublisher) Publish(_ beat.Event, cursor interface{}) error {
+	var state interface{}
+	if err := typeconv.Convert(&state, cursor); err != nil {
+		return err
+	}
+	p.cursors = append(p.cursors, state)
+	return nil
+}
+
+func TestFileCheckpoints(t *testing.T) {
+	publisher := &checkpointPublisher{}
+	files := &fileCheckpoints{publisher: publisher, checkpoint: checkpoint{Version: cursorVersion}}
+
+	require.NoError(t, files.publish("a.journal", beat.Event{}, checkpoint{Position: "a1"}))
+	require.NoError(t, files.publish("b.journal", beat.Event{}, checkpoint{Position: "b1"}))
+	require.NoError(t, files.publish("a.journal", beat.Event{}, checkpoint{Position: "a2"}))
+	assert.Equal(t, "a2", files.get("a.journal").Position)
+	assert.Equal(t, checkpoint{Version: cursorVersion}, files.get("c.journal"))
+
+	// The checkpoints are restored the same way initCheckpoint unpacks the cursor.
+	unpack := func(state interface{}) checkpoint {
+		cp := checkpoint{Files: map[string]filePosition{}}
+		require.NoError(t, typeconv.Convert(&cp, state))
+		return cp
+	}
+	require.Len(t, publisher.cursors, 3)
+	first := unpack(publisher.cursors[0])
+	assert.Equal(t, cursorVersion, first.Version)
+	assert.Equal(t, map[string]filePosition{"a.journal": {Position: "a1"}}, first.Files)
+	assert.Equal(t, map[string]filePosition{
+		"a.journal": {Position: "a2"},
+		"b.journal": {Position: "b1"},
+	}, unpack(publisher.cursors[2]).Files)
+}
@@ -37,6 +37,20 @@ type Conversion struct {
 	Dropped   bool
 }
 
+// WithDefaults returns the default conversion rules extended by the given
+// conversion rules. Rules in custom replace the default rule for the same
+// journal field.
+func WithDefaults(custom FieldConversion) FieldConversion {
+	conversions := make(FieldConversion, len(journaldEventFields)+len(custom))
+	for field, conv := range journaldEventFields {
+		conversions[field] = conv
+	}
+	for field, conv := range custom {
+		conversions[field] = conv
+	}
+	return conversions
+}
+
 // Converter applis configured conversion rules to journald entries, producing
 // a new common.MapStr.
 type Converter struct {
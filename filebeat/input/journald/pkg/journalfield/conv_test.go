@@ -120,3 +120,42 @@ func TestConversion(t *testing.T) {
 		})
 	}
 }
+
+func TestConversionWithCustomRules(t *testing.T) {
+	conversions := WithDefaults(FieldConversion{
+		"_VEHICLE_ID":       text("vehicle.id"),
+		"ODOMETER":          integer("vehicle.odometer"),
+		"_DEBUG_DUMP":       ignoredField,
+		"SYSLOG_IDENTIFIER": text("process.title"),
+	})
+	fields := map[string]string{
+		"_VEHICLE_ID":                         "wp0zzz",
+		"ODOMETER":                            "12034",
+		"_DEBUG_DUMP":                         "AAAA",
+		"SYSLOG_IDENTIFIER":                   "telematics",
+		sdjournal.SD_JOURNAL_FIELD_SYSLOG_PID: "42",
+		"UNMAPPED":                            "value",
+	}
+
+	converted := NewConverter(logp.NewLogger("test"), conversions).Convert(fields)
+	assert.Equal(t, common.MapStr{
+		"vehicle": common.MapStr{
+			"id":       "wp0zzz",
+			"odometer": int64(12034),
+		},
+		"process": common.MapStr{
+			"title": "telematics",
+		},
+		"syslog": common.MapStr{
+			"pid": int64(42),
+		},
+		"journald": common.MapStr{
+			"custom": common.MapStr{
+				"unmapped": "value",
+			},
+		},
+	}, converted)
+
+	// the default rules are not modified
+	assert.Equal(t, []string{"syslog.identifier"}, journaldEventFields["SYSLOG_IDENTIFIER"].Names)
+}
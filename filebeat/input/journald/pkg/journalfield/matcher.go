@@ -118,3 +118,37 @@ func ApplyMatchersOr(j journal, matchers []Matcher) error {
 
 	return nil
 }
+
+// ApplyMatchersOrWith adds the matchers to the journal, such that entries
+// must match any of the matchers and the required matchers. journald combines
+// required matchers for the same field with OR and matchers for different
+// fields with AND.
+func ApplyMatchersOrWith(j journal, matchers, required []Matcher) error {
+	if len(matchers) == 0 {
+		return applyMatchers(j, required)
+	}
+
+	for _, m := range matchers {
+		if err := m.Apply(j); err != nil {
+			return err
+		}
+		if err := applyMatchers(j, required); err != nil {
+			return err
+		}
+
+		if err := j.AddDisjunction(); err != nil {
+			return fmt.Errorf("error adding disjunction to journal: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func applyMatchers(j journal, matchers []Matcher) error {
+	for _, m := range matchers {
+		if err := m.Apply(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
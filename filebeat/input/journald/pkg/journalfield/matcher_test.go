@@ -21,6 +21,7 @@
 package journalfield
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/coreos/go-systemd/v22/sdjournal"
@@ -79,3 +80,66 @@ func TestApplyMatchersOr(t *testing.T) {
 		})
 	}
 }
+
+type recordingJournal struct {
+	calls []string
+}
+
+func (j *recordingJournal) AddMatch(m string) error {
+	j.calls = append(j.calls, m)
+	return nil
+}
+
+func (j *recordingJournal) AddDisjunction() error {
+	j.calls = append(j.calls, "OR")
+	return nil
+}
+
+func TestApplyMatchersOrWith(t *testing.T) {
+	build := func(filters ...string) []Matcher {
+		matchers := make([]Matcher, len(filters))
+		for i, str := range filters {
+			m, err := BuildMatcher(str)
+			if err != nil {
+				t.Fatalf("unexpected error compiling the filters: %v", err)
+			}
+			matchers[i] = m
+		}
+		return matchers
+	}
+
+	cases := map[string]struct {
+		matchers []Matcher
+		required []Matcher
+		want     []string
+	}{
+		"no required matchers": {
+			matchers: build("systemd.unit=nginx", "systemd.unit=mysql"),
+			want:     []string{"_SYSTEMD_UNIT=nginx", "OR", "_SYSTEMD_UNIT=mysql", "OR"},
+		},
+		"only required matchers": {
+			required: build("_BOOT_ID=a", "_BOOT_ID=b"),
+			want:     []string{"_BOOT_ID=a", "_BOOT_ID=b"},
+		},
+		"required matchers are added to every alternative": {
+			matchers: build("systemd.unit=nginx", "systemd.unit=mysql"),
+			required: build("_BOOT_ID=a"),
+			want: []string{
+				"_SYSTEMD_UNIT=nginx", "_BOOT_ID=a", "OR",
+				"_SYSTEMD_UNIT=mysql", "_BOOT_ID=a", "OR",
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			var journal recordingJournal
+			if err := ApplyMatchersOrWith(&journal, test.matchers, test.required); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.want, journal.calls) {
+				t.Errorf("unexpected matches, expected %v, got %v", test.want, journal.calls)
+			}
+		})
+	}
+}
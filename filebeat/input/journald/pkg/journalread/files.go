@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package journalread
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FindFiles returns the journal files in the given paths. A path can be a
+// journal file, a directory that is searched recursively for journal files or
+// a glob pattern matching either of them. Active journal files (*.journal) and
+// files left behind by an unclean shutdown (*.journal~) are collected. The
+// returned paths are sorted and free of duplicates.
+func FindFiles(paths []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern '%s': %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() && (path == match || isJournalFile(path)) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to collect journal files in '%s': %w", match, err)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func isJournalFile(path string) bool {
+	return strings.HasSuffix(path, ".journal") || strings.HasSuffix(path, ".journal~")
+}
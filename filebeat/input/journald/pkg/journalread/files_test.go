@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package journalread
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"vehicle-1/system.journal",
+		"vehicle-1/system@0005f1-000001.journal~",
+		"vehicle-1/notes.txt",
+		"vehicle-2/machine-id/user-1000.journal",
+		"export.bin",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+	in := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+
+	t.Run("directories", func(t *testing.T) {
+		files, err := FindFiles([]string{in("vehicle-2"), in("vehicle-1")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			in("vehicle-1/system.journal"),
+			in("vehicle-1/system@0005f1-000001.journal~"),
+			in("vehicle-2/machine-id/user-1000.journal"),
+		}, files)
+	})
+
+	t.Run("explicit files and globs without duplicates", func(t *testing.T) {
+		files, err := FindFiles([]string{in("export.bin"), in("vehicle-*/*.journal"), in("vehicle-1")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			in("export.bin"),
+			in("vehicle-1/system.journal"),
+			in("vehicle-1/system@0005f1-000001.journal~"),
+		}, files)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		files, err := FindFiles([]string{in("missing")})
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := FindFiles([]string{in("[")})
+		assert.Error(t, err)
+	})
+}
@@ -55,3 +55,30 @@ func (m *SeekMode) Unpack(value string) error {
 	*m = mode
 	return nil
 }
+
+// FilesMode defines how the journal files found in a path are read.
+type FilesMode uint
+
+const (
+	// FilesModeInvalid is an invalid value for the files mode
+	FilesModeInvalid FilesMode = iota
+	// FilesModeMerge reads all journal files of a path as a single merged journal
+	FilesModeMerge
+	// FilesModeFile reads every journal file on its own, with a cursor per file
+	FilesModeFile
+)
+
+var filesModes = map[string]FilesMode{
+	"merge": FilesModeMerge,
+	"file":  FilesModeFile,
+}
+
+func (m *FilesMode) Unpack(value string) error {
+	mode, ok := filesModes[value]
+	if !ok {
+		return fmt.Errorf("invalid mode '%s'", value)
+	}
+
+	*m = mode
+	return nil
+}
@@ -56,3 +56,28 @@ func TestMode_Unpack(t *testing.T) {
 		}
 	})
 }
+
+func TestFilesMode_Unpack(t *testing.T) {
+	tests := map[string]FilesMode{
+		"merge": FilesModeMerge,
+		"file":  FilesModeFile,
+	}
+
+	for str, want := range tests {
+		t.Run(str, func(t *testing.T) {
+			var m FilesMode
+			if err := m.Unpack(str); err != nil {
+				t.Fatal(err)
+			}
+
+			if m != want {
+				t.Errorf("wrong mode, expected %v, got %v", want, m)
+			}
+		})
+	}
+
+	var m FilesMode
+	if err := m.Unpack("files"); err == nil {
+		t.Errorf("an error was expected, got %v", m)
+	}
+}
@@ -58,6 +58,7 @@ type journal interface {
 	SeekHead() error
 	SeekTail() error
 	SeekCursor(string) error
+	SeekRealtimeUsec(uint64) error
 }
 
 // LocalSystemJournalID is the ID of the local system journal.
@@ -151,6 +152,12 @@ func (r *Reader) Seek(mode SeekMode, cursor string) (err error) {
 
 // Next reads a new journald entry from the journal. It blocks if there is
 // currently no entry available in the journal, or until an error has occured.
+// SeekRealtime moves the read position to the first entry received by the
+// journal at or after the given time.
+func (r *Reader) SeekRealtime(t time.Time) error {
+	return r.journal.SeekRealtimeUsec(uint64(t.UnixNano() / int64(time.Microsecond)))
+}
+
 func (r *Reader) Next(cancel canceler) (*sdjournal.JournalEntry, error) {
 	for cancel.Err() == nil {
 		c, err := r.journal.Next()
@@ -26,6 +26,7 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
 	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/common/match"
 	"github.com/elastic/beats/v7/libbeat/common/transport/kerberos"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 	"github.com/elastic/beats/v7/libbeat/monitoring"
@@ -36,11 +37,14 @@ import (
 type kafkaInputConfig struct {
 	// Kafka hosts with port, e.g. "localhost:9092"
 	Hosts                    []string          `config:"hosts" validate:"required"`
-	Topics                   []string          `config:"topics" validate:"required"`
+	Topics                   []string          `config:"topics"`
+	TopicPatterns            []match.Matcher   `config:"topic_patterns"`
+	TopicRefreshInterval     time.Duration     `config:"topic_refresh_interval" validate:"positive,nonzero"`
 	GroupID                  string            `config:"group_id" validate:"required"`
 	ClientID                 string            `config:"client_id"`
 	Version                  kafka.Version     `config:"version"`
 	InitialOffset            initialOffset     `config:"initial_offset"`
+	InitialTimestamp         *startTimestamp   `config:"initial_timestamp"`
 	ConnectBackoff           time.Duration     `config:"connect_backoff" validate:"min=0"`
 	ConsumeBackoff           time.Duration     `config:"consume_backoff" validate:"min=0"`
 	WaitClose                time.Duration     `config:"wait_close" validate:"min=0"`
@@ -53,6 +57,8 @@ type kafkaInputConfig struct {
 	Username                 string            `config:"username"`
 	Password                 string            `config:"password"`
 	ExpandEventListFromField string            `config:"expand_event_list_from_field"`
+	MaxInFlightPerPartition  int               `config:"max_in_flight_per_partition" validate:"min=1"`
+	Headers                  kafkaHeaders      `config:"headers"`
 	Parsers                  parser.Config     `config:",inline"`
 }
 
@@ -69,6 +75,17 @@ type kafkaRebalance struct {
 	RetryBackoff time.Duration     `config:"retry_backoff" validate:"min=0"`
 }
 
+type kafkaHeaders struct {
+	Format  headersFormat `config:"format"`
+	Include []string      `config:"include"`
+}
+
+// startTimestamp is the time to start consuming partitions without a
+// committed offset from.
+type startTimestamp struct {
+	time.Time
+}
+
 type initialOffset int
 
 const (
@@ -83,6 +100,13 @@ const (
 	rebalanceStrategyRoundRobin
 )
 
+type headersFormat int
+
+const (
+	headersFormatString headersFormat = iota
+	headersFormatObject
+)
+
 type isolationLevel int
 
 const (
@@ -99,6 +123,10 @@ var (
 		"range":      rebalanceStrategyRange,
 		"roundrobin": rebalanceStrategyRoundRobin,
 	}
+	headersFormats = map[string]headersFormat{
+		"string": headersFormatString,
+		"object": headersFormatObject,
+	}
 	isolationLevels = map[string]isolationLevel{
 		"read_uncommitted": isolationLevelReadUncommitted,
 		"read_committed":   isolationLevelReadCommitted,
@@ -109,14 +137,15 @@ var (
 // were chosen to match sarama's defaults.
 func defaultConfig() kafkaInputConfig {
 	return kafkaInputConfig{
-		Version:        kafka.Version("1.0.0"),
-		InitialOffset:  initialOffsetOldest,
-		ClientID:       "filebeat",
-		ConnectBackoff: 30 * time.Second,
-		ConsumeBackoff: 2 * time.Second,
-		WaitClose:      2 * time.Second,
-		MaxWaitTime:    250 * time.Millisecond,
-		IsolationLevel: isolationLevelReadUncommitted,
+		Version:              kafka.Version("1.0.0"),
+		InitialOffset:        initialOffsetOldest,
+		ClientID:             "filebeat",
+		TopicRefreshInterval: time.Minute,
+		ConnectBackoff:       30 * time.Second,
+		ConsumeBackoff:       2 * time.Second,
+		WaitClose:            2 * time.Second,
+		MaxWaitTime:          250 * time.Millisecond,
+		IsolationLevel:       isolationLevelReadUncommitted,
 		Fetch: kafkaFetch{
 			Min:     1,
 			Default: (1 << 20), // 1 MB
@@ -128,6 +157,10 @@ func defaultConfig() kafkaInputConfig {
 			MaxRetries:   4,
 			RetryBackoff: 2 * time.Second,
 		},
+		MaxInFlightPerPartition: 1024,
+		Headers: kafkaHeaders{
+			Format: headersFormatString,
+		},
 	}
 }
 
@@ -137,6 +170,10 @@ func (c *kafkaInputConfig) Validate() error {
 		return errors.New("no hosts configured")
 	}
 
+	if len(c.Topics) == 0 && len(c.TopicPatterns) == 0 {
+		return errors.New("no topics or topic_patterns configured")
+	}
+
 	if err := c.Version.Validate(); err != nil {
 		return err
 	}
@@ -272,3 +309,38 @@ func (is *isolationLevel) Unpack(value string) error {
 	*is = isolationLevel
 	return nil
 }
+
+// Unpack validates and unpack the "initial_timestamp" config option
+func (ts *startTimestamp) Unpack(value string) error {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return fmt.Errorf("invalid initial_timestamp '%s', must be an RFC3339 timestamp", value)
+	}
+	ts.Time = t
+	return nil
+}
+
+// Unpack validates and unpack the "headers.format" config option
+func (f *headersFormat) Unpack(value string) error {
+	format, ok := headersFormats[value]
+	if !ok {
+		return fmt.Errorf("invalid headers format '%s'", value)
+	}
+	*f = format
+	return nil
+}
+
+// filter returns the headers to add to events. All headers are added when no
+// header keys are included explicitly.
+func (h kafkaHeaders) filter(headers []*sarama.RecordHeader) []*sarama.RecordHeader {
+	if len(h.Include) == 0 {
+		return headers
+	}
+	var filtered []*sarama.RecordHeader
+	for _, header := range headers {
+		if contains(h.Include, string(header.Key)) {
+			filtered = append(filtered, header)
+		}
+	}
+	return filtered
+}
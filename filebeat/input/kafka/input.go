@@ -26,8 +26,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/elastic/beats/v7/libbeat/common/atomic"
-
 	"github.com/Shopify/sarama"
 	"github.com/pkg/errors"
 
@@ -39,6 +37,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/kafka"
 	"github.com/elastic/beats/v7/libbeat/feature"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 	"github.com/elastic/beats/v7/libbeat/reader"
 	"github.com/elastic/beats/v7/libbeat/reader/parser"
 )
@@ -103,6 +102,13 @@ func (input *kafkaInput) Test(ctx input.TestContext) error {
 		return fmt.Errorf("Of configured topics %v, topics: %v are not in available topics %v", input.config.Topics, missingTopics, topics)
 	}
 
+	if len(input.config.TopicPatterns) > 0 {
+		subscription := topicSubscription{patterns: input.config.TopicPatterns}
+		if len(subscription.resolve(topics)) == 0 {
+			ctx.Logger.Warnf("No available topics %v match the configured topic patterns", topics)
+		}
+	}
+
 	return nil
 }
 
@@ -129,6 +135,9 @@ func (input *kafkaInput) Run(ctx input.Context, pipeline beat.Pipeline) error {
 	log.Info("Starting Kafka input")
 	defer log.Info("Kafka input stopped")
 
+	metrics := newInputMetrics(monitoring.GetNamespace("dataset").GetRegistry(), ctx.ID)
+	defer metrics.Close()
+
 	// Sarama uses standard go contexts to control cancellation, so we need
 	// to wrap our input context channel in that interface.
 	goContext := doneChannelContext(ctx)
@@ -142,14 +151,19 @@ func (input *kafkaInput) Run(ctx input.Context, pipeline beat.Pipeline) error {
 	)
 
 	for goContext.Err() == nil {
-		// Connect to Kafka with a new consumer group.
-		consumerGroup, err := sarama.NewConsumerGroup(
-			input.config.Hosts,
-			input.config.GroupID,
-			input.saramaConfig,
-		)
+		// Connect to Kafka with a new consumer group. The sarama client is
+		// shared with the consumer group to look up the topics matching the
+		// configured topic patterns.
+		saramaClient, err := sarama.NewClient(input.config.Hosts, input.saramaConfig)
+		if err != nil {
+			log.Errorw("Error initializing kafka client", "error", err)
+			connectDelay.Wait()
+			continue
+		}
+		consumerGroup, err := sarama.NewConsumerGroupFromClient(input.config.GroupID, saramaClient)
 		if err != nil {
 			log.Errorw("Error initializing kafka consumer group", "error", err)
+			saramaClient.Close()
 			connectDelay.Wait()
 			continue
 		}
@@ -161,7 +175,7 @@ func (input *kafkaInput) Run(ctx input.Context, pipeline beat.Pipeline) error {
 		// In an ideal run, this function never returns until shutdown; if it
 		// does, it means the errors have been logged and the consumer group
 		// has been closed, so we try creating a new one in the next iteration.
-		input.runConsumerGroup(log, client, goContext, consumerGroup)
+		input.runConsumerGroup(log, client, metrics, goContext, saramaClient, consumerGroup)
 	}
 
 	if ctx.Cancelation.Err() == context.Canceled {
@@ -188,19 +202,31 @@ func (input *kafkaInput) Wait() {
 	input.saramaWaitGroup.Wait()
 }
 
-func (input *kafkaInput) runConsumerGroup(log *logp.Logger, client beat.Client, context context.Context, consumerGroup sarama.ConsumerGroup) {
+func (input *kafkaInput) runConsumerGroup(log *logp.Logger, client beat.Client, metrics *inputMetrics, ctx context.Context, saramaClient sarama.Client, consumerGroup sarama.ConsumerGroup) {
 	handler := &groupHandler{
 		version: input.config.Version,
 		client:  client,
 		parsers: input.config.Parsers,
 		// expandEventListFromField will be assigned the configuration option expand_event_list_from_field
 		expandEventListFromField: input.config.ExpandEventListFromField,
+		maxInFlight:              input.config.MaxInFlightPerPartition,
+		headers:                  input.config.Headers,
+		initialTimestamp:         input.config.InitialTimestamp,
+		hosts:                    input.config.Hosts,
+		groupID:                  input.config.GroupID,
+		saramaConfig:             input.saramaConfig,
+		metrics:                  metrics,
 		log:                      log,
 	}
+	subscription := topicSubscription{
+		topics:   input.config.Topics,
+		patterns: input.config.TopicPatterns,
+	}
 
 	input.saramaWaitGroup.Add(1)
 	defer func() {
 		consumerGroup.Close()
+		saramaClient.Close()
 		input.saramaWaitGroup.Done()
 	}()
 
@@ -211,9 +237,61 @@ func (input *kafkaInput) runConsumerGroup(log *logp.Logger, client beat.Client,
 		}
 	}()
 
-	err := consumerGroup.Consume(context, input.config.Topics, handler)
-	if err != nil {
-		log.Errorw("Kafka consume error", "error", err, "topics", input.config.Topics)
+	for ctx.Err() == nil {
+		topics, err := subscription.fetch(saramaClient)
+		if err != nil {
+			log.Errorw("Error listing kafka topics", "error", err)
+			return
+		}
+		metrics.setTopics(topics)
+		if len(topics) == 0 {
+			log.Infow("No kafka topics match the configured topic patterns", "topic_patterns", input.config.TopicPatterns)
+			select {
+			case <-ctx.Done():
+			case <-time.After(input.config.TopicRefreshInterval):
+			}
+			continue
+		}
+
+		// Consume returns when the group is rebalanced, or when the session
+		// is canceled because the topics matching the topic patterns changed.
+		// The group is joined again with the current topics in both cases.
+		sessionCtx, cancel := context.WithCancel(ctx)
+		if subscription.dynamic() {
+			go input.watchTopics(log, sessionCtx, cancel, saramaClient, subscription, topics)
+		}
+		err = consumerGroup.Consume(sessionCtx, topics, handler)
+		cancel()
+		if err != nil {
+			log.Errorw("Kafka consume error", "error", err, "topics", topics)
+			return
+		}
+	}
+}
+
+// watchTopics refreshes the topics matching the topic patterns periodically,
+// and calls changed once they differ from the topics of the current session.
+func (input *kafkaInput) watchTopics(log *logp.Logger, ctx context.Context, changed func(), saramaClient sarama.Client, subscription topicSubscription, topics []string) {
+	ticker := time.NewTicker(input.config.TopicRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := subscription.fetch(saramaClient)
+		if err != nil {
+			log.Warnw("Error refreshing kafka topics", "error", err)
+			continue
+		}
+		if !equalTopics(current, topics) {
+			log.Infow("Kafka topics matching the topic patterns changed, rejoining consumer group", "topics", current)
+			changed()
+			return
+		}
 	}
 }
 
@@ -221,6 +299,7 @@ func (input *kafkaInput) runConsumerGroup(log *logp.Logger, client beat.Client,
 // been successfully sent.
 type eventMeta struct {
 	ackHandler func()
+	message    *trackedMessage
 }
 
 func arrayForKafkaHeaders(headers []*sarama.RecordHeader) []string {
@@ -240,6 +319,24 @@ func arrayForKafkaHeaders(headers []*sarama.RecordHeader) []string {
 	return array
 }
 
+// objectForKafkaHeaders maps the headers by their key. The values of a key
+// that occurs more than once are collected in a list.
+func objectForKafkaHeaders(headers []*sarama.RecordHeader) common.MapStr {
+	object := common.MapStr{}
+	for _, header := range headers {
+		key, value := string(header.Key), string(header.Value)
+		switch v := object[key].(type) {
+		case nil:
+			object[key] = value
+		case string:
+			object[key] = []string{v, value}
+		case []string:
+			object[key] = append(v, value)
+		}
+	}
+	return object
+}
+
 // A barebones implementation of context.Context wrapped around the done
 // channels that are more common in the beats codebase.
 // TODO(faec): Generalize this to a common utility in a shared library
@@ -275,6 +372,13 @@ type groupHandler struct {
 	// if the fileset using this input expects to receive multiple messages bundled under a specific field then this value is assigned
 	// ex. in this case are the azure fielsets where the events are found under the json object "records"
 	expandEventListFromField string // TODO
+	maxInFlight              int
+	headers                  kafkaHeaders
+	initialTimestamp         *startTimestamp
+	hosts                    []string
+	groupID                  string
+	saramaConfig             *sarama.Config
+	metrics                  *inputMetrics
 	log                      *logp.Logger
 	reader                   reader.Reader
 }
@@ -283,6 +387,60 @@ func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
 	h.Lock()
 	h.session = session
 	h.Unlock()
+
+	if h.initialTimestamp != nil {
+		if err := h.seekToTimestamp(session); err != nil {
+			h.log.Errorw("Failed to seek to initial_timestamp, falling back to initial_offset", "error", err)
+		}
+	}
+	return nil
+}
+
+// seekToTimestamp marks the offset of the first message at or after the
+// initial timestamp for each claimed partition without a committed offset.
+// If there is no such message, consumption starts with the next new message.
+func (h *groupHandler) seekToTimestamp(session sarama.ConsumerGroupSession) error {
+	client, err := sarama.NewClient(h.hosts, h.saramaConfig)
+	if err != nil {
+		return err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	defer admin.Close()
+
+	committed, err := admin.ListConsumerGroupOffsets(h.groupID, session.Claims())
+	if err != nil {
+		return err
+	}
+
+	timestamp := h.initialTimestamp.UnixNano() / int64(time.Millisecond)
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			block := committed.GetBlock(topic, partition)
+			if block == nil {
+				continue
+			}
+			if block.Err != sarama.ErrNoError {
+				return block.Err
+			}
+			if block.Offset >= 0 {
+				continue
+			}
+
+			offset, err := client.GetOffset(topic, partition, timestamp)
+			if err == nil && offset < 0 {
+				offset, err = client.GetOffset(topic, partition, sarama.OffsetNewest)
+			}
+			if err != nil {
+				return err
+			}
+			h.log.Infow("Starting partition at initial_timestamp", "topic", topic, "partition", partition, "offset", offset)
+			session.MarkOffset(topic, partition, offset, "")
+		}
+	}
 	return nil
 }
 
@@ -293,20 +451,16 @@ func (h *groupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
 	return nil
 }
 
-// ack informs the kafka cluster that this message has been consumed. Called
-// from the input's ACKEvents handler.
-func (h *groupHandler) ack(message *sarama.ConsumerMessage) {
-	h.Lock()
-	defer h.Unlock()
-	if h.session != nil {
-		h.session.MarkMessage(message, "")
-	}
-}
-
 func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	reader := h.createReader(claim)
+	metrics := h.metrics.newPartitionMetrics(claim.Topic(), claim.Partition())
+	defer metrics.Close()
+
+	// Offsets are marked by the tracker once the events of a message, and of
+	// all messages before it, are ACKed.
+	tracker := newPartitionTracker(session, claim, h.maxInFlight, metrics)
+	reader := h.createReader(claim, tracker)
 	parser := h.parsers.Create(reader)
-	for h.session.Context().Err() == nil {
+	for session.Context().Err() == nil {
 		message, err := parser.Next()
 		if err == io.EOF {
 			return nil
@@ -314,6 +468,11 @@ func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim s
 		if err != nil {
 			return err
 		}
+		if meta, ok := message.Private.(eventMeta); ok {
+			if !tracker.publish(session.Context(), meta.message) {
+				return nil
+			}
+		}
 		h.client.Publish(beat.Event{
 			Timestamp: message.Ts,
 			Meta:      message.Meta,
@@ -324,11 +483,12 @@ func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim s
 	return nil
 }
 
-func (h *groupHandler) createReader(claim sarama.ConsumerGroupClaim) reader.Reader {
+func (h *groupHandler) createReader(claim sarama.ConsumerGroupClaim, tracker *partitionTracker) reader.Reader {
 	if h.expandEventListFromField != "" {
 		return &listFromFieldReader{
 			claim:        claim,
 			groupHandler: h,
+			tracker:      tracker,
 			field:        h.expandEventListFromField,
 			log:          h.log,
 		}
@@ -336,6 +496,7 @@ func (h *groupHandler) createReader(claim sarama.ConsumerGroupClaim) reader.Read
 	return &recordReader{
 		claim:        claim,
 		groupHandler: h,
+		tracker:      tracker,
 		log:          h.log,
 	}
 }
@@ -343,6 +504,7 @@ func (h *groupHandler) createReader(claim sarama.ConsumerGroupClaim) reader.Read
 type recordReader struct {
 	claim        sarama.ConsumerGroupClaim
 	groupHandler *groupHandler
+	tracker      *partitionTracker
 	log          *logp.Logger
 }
 
@@ -357,15 +519,14 @@ func (m *recordReader) Next() (reader.Message, error) {
 	}
 
 	timestamp, kafkaFields := composeEventMetadata(m.claim, m.groupHandler, msg)
-	ackHandler := func() {
-		m.groupHandler.ack(msg)
-	}
-	return composeMessage(timestamp, msg.Value, kafkaFields, ackHandler), nil
+	tracked := m.tracker.track(msg, 1)
+	return composeMessage(timestamp, msg.Value, kafkaFields, m.tracker, tracked), nil
 }
 
 type listFromFieldReader struct {
 	claim        sarama.ConsumerGroupClaim
 	groupHandler *groupHandler
+	tracker      *partitionTracker
 	buffer       []reader.Message
 	field        string
 	log          *logp.Logger
@@ -376,28 +537,23 @@ func (l *listFromFieldReader) Close() error {
 }
 
 func (l *listFromFieldReader) Next() (reader.Message, error) {
-	if len(l.buffer) != 0 {
-		return l.returnFromBuffer()
-	}
-
-	msg, ok := <-l.claim.Messages()
-	if !ok {
-		return reader.Message{}, io.EOF
-	}
+	for len(l.buffer) == 0 {
+		msg, ok := <-l.claim.Messages()
+		if !ok {
+			return reader.Message{}, io.EOF
+		}
 
-	timestamp, kafkaFields := composeEventMetadata(l.claim, l.groupHandler, msg)
-	messages := l.parseMultipleMessages(msg.Value)
+		timestamp, kafkaFields := composeEventMetadata(l.claim, l.groupHandler, msg)
+		messages := l.parseMultipleMessages(msg.Value)
 
-	neededAcks := atomic.MakeInt(len(messages))
-	ackHandler := func() {
-		if neededAcks.Dec() == 0 {
-			l.groupHandler.ack(msg)
+		// The message is complete once the events of all of its list entries
+		// are ACKed. A message without entries is complete right away.
+		tracked := l.tracker.track(msg, len(messages))
+		for _, message := range messages {
+			newBuffer := append(l.buffer, composeMessage(timestamp, []byte(message), kafkaFields, l.tracker, tracked))
+			l.buffer = newBuffer
 		}
 	}
-	for _, message := range messages {
-		newBuffer := append(l.buffer, composeMessage(timestamp, []byte(message), kafkaFields, ackHandler))
-		l.buffer = newBuffer
-	}
 
 	return l.returnFromBuffer()
 }
@@ -446,21 +602,33 @@ func composeEventMetadata(claim sarama.ConsumerGroupClaim, handler *groupHandler
 		}
 	}
 	if versionOk && version.IsAtLeast(sarama.V0_11_0_0) {
-		kafkaFields["headers"] = arrayForKafkaHeaders(msg.Headers)
+		headers := handler.headers.filter(msg.Headers)
+		if handler.headers.Format == headersFormatObject {
+			kafkaFields["headers"] = objectForKafkaHeaders(headers)
+		} else {
+			kafkaFields["headers"] = arrayForKafkaHeaders(headers)
+		}
 	}
 	return timestamp, kafkaFields
 }
 
-func composeMessage(timestamp time.Time, content []byte, kafkaFields common.MapStr, ackHandler func()) reader.Message {
+func composeMessage(timestamp time.Time, content []byte, kafkaFields common.MapStr, tracker *partitionTracker, tracked *trackedMessage) reader.Message {
 	return reader.Message{
 		Ts:      timestamp,
 		Content: content,
+		// The topic is added to the metadata for routing events.
+		Meta: common.MapStr{
+			"kafka": common.MapStr{"topic": kafkaFields["topic"]},
+		},
 		Fields: common.MapStr{
 			"kafka":   kafkaFields,
 			"message": string(content),
 		},
 		Private: eventMeta{
-			ackHandler: ackHandler,
+			ackHandler: func() {
+				tracker.ack(tracked)
+			},
+			message: tracked,
 		},
 	}
 }
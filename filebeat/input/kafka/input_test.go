@@ -22,7 +22,10 @@ package kafka
 
 import (
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/common"
@@ -39,6 +42,101 @@ func TestNewInputDone(t *testing.T) {
 	AssertNotStartedInputCanBeDone(t, config)
 }
 
+func TestConfigHeadersAndInitialTimestamp(t *testing.T) {
+	config := defaultConfig()
+	err := common.MustNewConfigFrom(common.MapStr{
+		"hosts":             "localhost:9092",
+		"topics":            "messages",
+		"group_id":          "filebeat",
+		"initial_timestamp": "2022-06-01T12:00:00Z",
+		"headers.format":    "object",
+		"headers.include":   []string{"trace_id", "tag"},
+	}).Unpack(&config)
+	require.NoError(t, err)
+
+	require.NotNil(t, config.InitialTimestamp)
+	assert.Equal(t, time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC), config.InitialTimestamp.UTC())
+	assert.Equal(t, headersFormatObject, config.Headers.Format)
+
+	headers := []*sarama.RecordHeader{
+		{Key: []byte("trace_id"), Value: []byte("abc")},
+		{Key: []byte("tag"), Value: []byte("a")},
+		{Key: []byte("secret"), Value: []byte("hidden")},
+		{Key: []byte("tag"), Value: []byte("b")},
+	}
+	assert.Equal(t, common.MapStr{
+		"trace_id": "abc",
+		"tag":      []string{"a", "b"},
+	}, objectForKafkaHeaders(config.Headers.filter(headers)))
+	assert.Equal(t, []string{"trace_id: abc", "tag: a", "tag: b"},
+		arrayForKafkaHeaders(config.Headers.filter(headers)))
+}
+
+func TestTopicSubscription(t *testing.T) {
+	config := defaultConfig()
+	err := common.MustNewConfigFrom(common.MapStr{
+		"hosts":                  "localhost:9092",
+		"topics":                 []string{"logs", "trace.static"},
+		"topic_patterns":         []string{`^trace\.`},
+		"topic_refresh_interval": "10s",
+		"group_id":               "filebeat",
+	}).Unpack(&config)
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, config.TopicRefreshInterval)
+
+	subscription := topicSubscription{topics: config.Topics, patterns: config.TopicPatterns}
+	assert.True(t, subscription.dynamic())
+	assert.Equal(t,
+		[]string{"logs", "trace.fleet1", "trace.fleet2", "trace.static"},
+		subscription.resolve([]string{"trace.fleet2", "__consumer_offsets", "metrics", "trace.static", "trace.fleet1", "traces"}),
+	)
+
+	static := topicSubscription{topics: []string{"b", "a", "b"}}
+	assert.False(t, static.dynamic())
+	assert.Equal(t, []string{"a", "b"}, static.resolve([]string{"c"}))
+}
+
+func TestConfigTopicPatternsOnly(t *testing.T) {
+	config := defaultConfig()
+	err := common.MustNewConfigFrom(common.MapStr{
+		"hosts":          "localhost:9092",
+		"topic_patterns": []string{`^trace\.`},
+		"group_id":       "filebeat",
+	}).Unpack(&config)
+	require.NoError(t, err)
+	assert.Empty(t, config.Topics)
+	assert.Equal(t, time.Minute, config.TopicRefreshInterval)
+
+	config = defaultConfig()
+	err = common.MustNewConfigFrom(common.MapStr{
+		"hosts":    "localhost:9092",
+		"group_id": "filebeat",
+	}).Unpack(&config)
+	assert.Error(t, err)
+}
+
+func TestConfigInvalid(t *testing.T) {
+	for name, settings := range map[string]common.MapStr{
+		"initial_timestamp":           {"initial_timestamp": "yesterday"},
+		"headers.format":              {"headers.format": "xml"},
+		"max_in_flight_per_partition": {"max_in_flight_per_partition": 0},
+		"topic_patterns":              {"topic_patterns": []string{"trace.("}},
+		"topic_refresh_interval":      {"topic_refresh_interval": 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(common.MapStr{
+				"hosts":    "localhost:9092",
+				"topics":   "messages",
+				"group_id": "filebeat",
+			})
+			require.NoError(t, cfg.Merge(settings))
+
+			config := defaultConfig()
+			require.Error(t, cfg.Unpack(&config))
+		})
+	}
+}
+
 // AssertNotStartedInputCanBeDone checks that the context of an input can be
 // done before starting the input, and it doesn't leak goroutines. This is
 // important to confirm that leaks don't happen with CheckConfig.
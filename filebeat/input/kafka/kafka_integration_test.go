@@ -148,6 +148,86 @@ func TestInput(t *testing.T) {
 	assertOffset(t, groupID, testTopic, int64(len(messages)))
 }
 
+func TestInputWithInitialTimestamp(t *testing.T) {
+	testTopic := createTestTopicName()
+
+	writeToKafkaTopic(t, testTopic, "before", nil, time.Second*20)
+	// Message timestamps have millisecond precision.
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	writeToKafkaTopic(t, testTopic, "after", nil, time.Second*20)
+
+	// Setup the input config
+	config := common.MustNewConfigFrom(common.MapStr{
+		"hosts":             getTestKafkaHost(),
+		"topics":            []string{testTopic},
+		"group_id":          "filebeat-" + testTopic,
+		"wait_close":        0,
+		"initial_timestamp": start.UTC().Format(time.RFC3339Nano),
+	})
+
+	client := beattest.NewChanClient(100)
+	defer client.Close()
+	_, cancel := run(t, config, client)
+	defer cancel()
+
+	select {
+	case event := <-client.Channel:
+		text, err := event.Fields.GetValue("message")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "after", text)
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for incoming events")
+	}
+}
+
+func TestInputWithTopicPatterns(t *testing.T) {
+	prefix := createTestTopicName()
+	firstTopic := prefix + ".fleet1"
+	secondTopic := prefix + ".fleet2"
+
+	writeToKafkaTopic(t, firstTopic, "first", nil, time.Second*20)
+
+	// Setup the input config
+	config := common.MustNewConfigFrom(common.MapStr{
+		"hosts":                  getTestKafkaHost(),
+		"topic_patterns":         []string{"^" + prefix + `\.`},
+		"topic_refresh_interval": "1s",
+		"group_id":               "filebeat-" + prefix,
+		"wait_close":             0,
+	})
+
+	client := beattest.NewChanClient(100)
+	defer client.Close()
+	_, cancel := run(t, config, client)
+	defer cancel()
+
+	assertTopicEvent := func(topic, text string) {
+		select {
+		case event := <-client.Channel:
+			message, err := event.Fields.GetValue("message")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, text, message)
+			metaTopic, err := event.Meta.GetValue("kafka.topic")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, topic, metaTopic)
+		case <-time.After(60 * time.Second):
+			t.Fatal("timeout waiting for incoming events")
+		}
+	}
+	assertTopicEvent(firstTopic, "first")
+
+	// The input joins topics created after it was started.
+	writeToKafkaTopic(t, secondTopic, "second", nil, time.Second*20)
+	assertTopicEvent(secondTopic, "second")
+}
+
 func TestInputWithMultipleEvents(t *testing.T) {
 	testTopic := createTestTopicName()
 
@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// inputMetrics holds the metrics of a kafka input, with a registry of topic
+// metrics for each subscribed topic and a registry of partition metrics for
+// each currently claimed partition.
+type inputMetrics struct {
+	id         string               // Input ID.
+	parent     *monitoring.Registry // Parent registry holding this input's ID as a key.
+	topics     *monitoring.Registry // Registry holding the metrics of each subscribed topic.
+	partitions *monitoring.Registry // Registry holding the metrics of each claimed partition.
+
+	mu         sync.Mutex
+	subscribed map[string]*topicMetrics // Metrics of the subscribed topics by topic name.
+}
+
+// topicMetrics holds the metrics of a subscribed topic, summed over its
+// partitions.
+type topicMetrics struct {
+	messagesReceivedTotal *monitoring.Uint // Number of messages read from the topic.
+	messagesAckedTotal    *monitoring.Uint // Number of messages marked as consumed after their events were ACKed.
+	partitionsClaimed     *monitoring.Int  // Number of partitions of the topic claimed by this input (gauge).
+}
+
+// partitionMetrics holds the metrics of a claimed partition.
+type partitionMetrics struct {
+	name   string               // Name of the partition's registry.
+	parent *monitoring.Registry // Registry holding the metrics of each claimed partition.
+	topic  *topicMetrics        // Metrics of the partition's topic.
+
+	messagesReceivedTotal *monitoring.Uint // Number of messages read from the partition.
+	messagesAckedTotal    *monitoring.Uint // Number of messages marked as consumed after their events were ACKed.
+	messagesInflight      *monitoring.Uint // Number of published messages waiting to be ACKed (gauge).
+	highWaterMark         *monitoring.Int  // Offset of the next message that will be produced to the partition.
+	committedOffset       *monitoring.Int  // Offset of the next message to consume after a restart.
+	consumerLag           *monitoring.Uint // Number of messages between committed_offset and high_water_mark (gauge).
+}
+
+func newInputMetrics(parent *monitoring.Registry, id string) *inputMetrics {
+	// An input restarted with the same ID can start before the previous run
+	// removed its metrics.
+	reg := parent.GetRegistry(id)
+	if reg != nil {
+		reg.Clear()
+	} else {
+		reg = parent.NewRegistry(id)
+	}
+	monitoring.NewString(reg, "input").Set(pluginName)
+	monitoring.NewString(reg, "id").Set(id)
+	return &inputMetrics{
+		id:         id,
+		parent:     parent,
+		topics:     reg.NewRegistry("topics"),
+		partitions: reg.NewRegistry("partitions"),
+		subscribed: map[string]*topicMetrics{},
+	}
+}
+
+// Close removes the metrics from the registry.
+func (m *inputMetrics) Close() {
+	m.parent.Remove(m.id)
+}
+
+// setTopics updates the topic metrics to the subscribed topics. The metrics
+// of topics that are no longer subscribed are removed, while the metrics of
+// topics that stay subscribed are kept.
+func (m *inputMetrics) setTopics(topics []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for topic := range m.subscribed {
+		if !contains(topics, topic) {
+			m.topics.Remove(registryName(topic))
+			delete(m.subscribed, topic)
+		}
+	}
+	for _, topic := range topics {
+		m.topicMetricsLocked(topic)
+	}
+}
+
+// topicMetrics returns the metrics of a topic, creating them if the topic is
+// not subscribed yet.
+func (m *inputMetrics) topicMetrics(topic string) *topicMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.topicMetricsLocked(topic)
+}
+
+func (m *inputMetrics) topicMetricsLocked(topic string) *topicMetrics {
+	if metrics, ok := m.subscribed[topic]; ok {
+		return metrics
+	}
+
+	reg := m.topics.NewRegistry(registryName(topic))
+	monitoring.NewString(reg, "topic").Set(topic)
+	metrics := &topicMetrics{
+		messagesReceivedTotal: monitoring.NewUint(reg, "messages_received_total"),
+		messagesAckedTotal:    monitoring.NewUint(reg, "messages_acked_total"),
+		partitionsClaimed:     monitoring.NewInt(reg, "partitions_claimed_gauge"),
+	}
+	m.subscribed[topic] = metrics
+	return metrics
+}
+
+// newPartitionMetrics returns the metrics of a newly claimed partition,
+// replacing the metrics of an earlier claim of the same partition.
+func (m *inputMetrics) newPartitionMetrics(topic string, partition int32) *partitionMetrics {
+	name := registryName(topic) + "-" + strconv.Itoa(int(partition))
+	reg := m.partitions.GetRegistry(name)
+	if reg != nil {
+		reg.Clear()
+	} else {
+		reg = m.partitions.NewRegistry(name)
+	}
+
+	monitoring.NewString(reg, "topic").Set(topic)
+	monitoring.NewInt(reg, "partition").Set(int64(partition))
+	topicMetrics := m.topicMetrics(topic)
+	topicMetrics.partitionsClaimed.Inc()
+	return &partitionMetrics{
+		name:                  name,
+		parent:                m.partitions,
+		topic:                 topicMetrics,
+		messagesReceivedTotal: monitoring.NewUint(reg, "messages_received_total"),
+		messagesAckedTotal:    monitoring.NewUint(reg, "messages_acked_total"),
+		messagesInflight:      monitoring.NewUint(reg, "messages_inflight_gauge"),
+		highWaterMark:         monitoring.NewInt(reg, "high_water_mark"),
+		committedOffset:       monitoring.NewInt(reg, "committed_offset"),
+		consumerLag:           monitoring.NewUint(reg, "consumer_lag_gauge"),
+	}
+}
+
+// Close removes the partition metrics from the registry.
+func (m *partitionMetrics) Close() {
+	m.topic.partitionsClaimed.Dec()
+	m.parent.Remove(m.name)
+}
+
+// received counts a message read from the partition.
+func (m *partitionMetrics) received() {
+	m.messagesReceivedTotal.Inc()
+	m.topic.messagesReceivedTotal.Inc()
+}
+
+// acked counts messages marked as consumed.
+func (m *partitionMetrics) acked(n uint64) {
+	m.messagesAckedTotal.Add(n)
+	m.topic.messagesAckedTotal.Add(n)
+}
+
+// updateLag updates the consumer lag from the high water mark and the
+// committed offset.
+func (m *partitionMetrics) updateLag(highWaterMark, committedOffset int64) {
+	m.highWaterMark.Set(highWaterMark)
+	m.committedOffset.Set(committedOffset)
+	if lag := highWaterMark - committedOffset; lag > 0 && committedOffset >= 0 {
+		m.consumerLag.Set(uint64(lag))
+	} else {
+		m.consumerLag.Set(0)
+	}
+}
+
+// registryName returns the name of the registry for a topic. Registry names
+// are split on dots, which are allowed in topic names.
+func registryName(topic string) string {
+	return strings.ReplaceAll(topic, ".", "_")
+}
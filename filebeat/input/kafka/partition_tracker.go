@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// partitionTracker follows the messages of a claimed partition from the time
+// they are read until all of their events are ACKed. The offset of a message
+// is only marked in the consumer group session once the message and all
+// messages before it have been ACKed, so that ACKs received out of order never
+// commit an offset past a message that is still being processed. The tracker
+// also limits the number of published messages waiting for their ACKs.
+type partitionTracker struct {
+	session     sarama.ConsumerGroupSession
+	claim       sarama.ConsumerGroupClaim
+	maxInFlight int
+	metrics     *partitionMetrics
+
+	mu       sync.Mutex
+	messages []*trackedMessage // Messages read and not yet marked, in offset order.
+	inFlight int               // Number of published messages with events waiting for ACKs.
+	marked   int64             // Offset of the next message to consume after a restart.
+	space    chan struct{}     // Closed when a message is ACKed while the window is full.
+}
+
+// trackedMessage is a message read from the partition.
+type trackedMessage struct {
+	offset    int64
+	pending   int  // Number of events created from the message that are not ACKed yet.
+	published bool // Whether an event created from the message was published.
+
+	// foldedInto is the message whose event includes this message's content.
+	// Parsers like multiline merge several messages into one event, which only
+	// carries the first message. A merged message is complete once the next
+	// message that is published is complete.
+	foldedInto *trackedMessage
+}
+
+func newPartitionTracker(
+	session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim,
+	maxInFlight int,
+	metrics *partitionMetrics,
+) *partitionTracker {
+	t := &partitionTracker{
+		session:     session,
+		claim:       claim,
+		maxInFlight: maxInFlight,
+		metrics:     metrics,
+		marked:      claim.InitialOffset(),
+		space:       make(chan struct{}),
+	}
+	t.metrics.updateLag(claim.HighWaterMarkOffset(), t.marked)
+	return t
+}
+
+// track registers a message read from the partition that creates the given
+// number of events. A message without events is complete right away.
+func (t *partitionTracker) track(msg *sarama.ConsumerMessage, events int) *trackedMessage {
+	m := &trackedMessage{
+		offset:    msg.Offset,
+		pending:   events,
+		published: events == 0,
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, m)
+	t.metrics.received()
+	if events == 0 {
+		t.advance()
+	}
+	t.metrics.updateLag(t.claim.HighWaterMarkOffset(), t.marked)
+	return m
+}
+
+// publish is called before an event created from the message is published.
+// Earlier messages that were not published themselves were merged into the
+// event by a parser and are folded into the message. publish blocks while the
+// number of published messages waiting for ACKs is at the limit. It returns
+// false if the context is done before there is space for the message.
+func (t *partitionTracker) publish(ctx context.Context, m *trackedMessage) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if m.published {
+		return true
+	}
+
+	for t.inFlight >= t.maxInFlight {
+		space := t.space
+		t.mu.Unlock()
+		select {
+		case <-space:
+		case <-ctx.Done():
+			t.mu.Lock()
+			return false
+		}
+		t.mu.Lock()
+	}
+
+	for _, earlier := range t.messages {
+		if earlier == m {
+			break
+		}
+		if !earlier.published {
+			earlier.published = true
+			earlier.pending = 0
+			earlier.foldedInto = m
+		}
+	}
+
+	m.published = true
+	t.inFlight++
+	t.metrics.messagesInflight.Set(uint64(t.inFlight))
+	return true
+}
+
+// ack is called when an event created from the message has been ACKed.
+func (t *partitionTracker) ack(m *trackedMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m.pending--
+	if m.pending > 0 {
+		return
+	}
+
+	t.inFlight--
+	t.metrics.messagesInflight.Set(uint64(t.inFlight))
+	if t.inFlight == t.maxInFlight-1 {
+		close(t.space)
+		t.space = make(chan struct{})
+	}
+	t.advance()
+}
+
+// advance marks the offset after the last message of the longest sequence of
+// complete messages at the start of the tracked messages.
+func (t *partitionTracker) advance() {
+	n := 0
+	for n < len(t.messages) && t.messages[n].complete() {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	t.marked = t.messages[n-1].offset + 1
+	t.session.MarkOffset(t.claim.Topic(), t.claim.Partition(), t.marked, "")
+
+	// Release the references of the removed messages.
+	for i := 0; i < n; i++ {
+		t.messages[i] = nil
+	}
+	t.messages = t.messages[n:]
+
+	t.metrics.acked(uint64(n))
+	t.metrics.updateLag(t.claim.HighWaterMarkOffset(), t.marked)
+}
+
+func (m *trackedMessage) complete() bool {
+	if !m.published || m.pending > 0 {
+		return false
+	}
+	return m.foldedInto == nil || m.foldedInto.complete()
+}
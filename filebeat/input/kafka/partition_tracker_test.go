@@ -0,0 +1,213 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+func TestPartitionTracker_OutOfOrderACKs(t *testing.T) {
+	tracker, session, _ := newTestPartitionTracker(10)
+
+	messages := trackMessages(tracker, 5, 6, 7)
+	for _, m := range messages {
+		require.True(t, tracker.publish(context.Background(), m))
+	}
+
+	tracker.ack(messages[2])
+	tracker.ack(messages[1])
+	assert.Empty(t, session.marked)
+
+	tracker.ack(messages[0])
+	assert.Equal(t, []int64{8}, session.marked)
+}
+
+func TestPartitionTracker_ExpandedMessage(t *testing.T) {
+	tracker, session, _ := newTestPartitionTracker(10)
+
+	m := tracker.track(&sarama.ConsumerMessage{Offset: 5}, 3)
+	for i := 0; i < 3; i++ {
+		require.True(t, tracker.publish(context.Background(), m))
+	}
+	assert.Equal(t, 1, tracker.inFlight)
+
+	tracker.ack(m)
+	tracker.ack(m)
+	assert.Empty(t, session.marked)
+
+	tracker.ack(m)
+	assert.Equal(t, []int64{6}, session.marked)
+	assert.Equal(t, 0, tracker.inFlight)
+}
+
+func TestPartitionTracker_MessageWithoutEvents(t *testing.T) {
+	tracker, session, _ := newTestPartitionTracker(10)
+
+	first := tracker.track(&sarama.ConsumerMessage{Offset: 5}, 1)
+	tracker.track(&sarama.ConsumerMessage{Offset: 6}, 0)
+	require.True(t, tracker.publish(context.Background(), first))
+	assert.Empty(t, session.marked)
+
+	tracker.ack(first)
+	assert.Equal(t, []int64{7}, session.marked)
+}
+
+func TestPartitionTracker_FoldedMessages(t *testing.T) {
+	tracker, session, _ := newTestPartitionTracker(10)
+
+	// Messages 5 to 7 are merged into one event carrying message 5, message 8
+	// starts the next event.
+	messages := trackMessages(tracker, 5, 6, 7, 8)
+	require.True(t, tracker.publish(context.Background(), messages[0]))
+	require.True(t, tracker.publish(context.Background(), messages[3]))
+
+	tracker.ack(messages[0])
+	assert.Equal(t, []int64{6}, session.marked)
+
+	tracker.ack(messages[3])
+	assert.Equal(t, []int64{6, 9}, session.marked)
+}
+
+func TestPartitionTracker_InFlightWindow(t *testing.T) {
+	tracker, session, _ := newTestPartitionTracker(1)
+
+	messages := trackMessages(tracker, 5, 6)
+	require.True(t, tracker.publish(context.Background(), messages[0]))
+
+	published := make(chan bool)
+	go func() {
+		published <- tracker.publish(context.Background(), messages[1])
+	}()
+	select {
+	case <-published:
+		t.Fatal("message published while the window is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	tracker.ack(messages[0])
+	select {
+	case ok := <-published:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("message not published after the window was freed")
+	}
+	assert.Equal(t, []int64{6}, session.marked)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	third := tracker.track(&sarama.ConsumerMessage{Offset: 7}, 1)
+	assert.False(t, tracker.publish(ctx, third))
+}
+
+func TestPartitionTracker_Metrics(t *testing.T) {
+	tracker, _, reg := newTestPartitionTracker(10)
+
+	messages := trackMessages(tracker, 5, 6, 7)
+	for _, m := range messages {
+		require.True(t, tracker.publish(context.Background(), m))
+	}
+	tracker.ack(messages[0])
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	prefix := "partitions.logs_app-3."
+	assert.Equal(t, "logs.app", snapshot.Strings[prefix+"topic"])
+	assert.Equal(t, int64(3), snapshot.Ints[prefix+"partition"])
+	assert.Equal(t, int64(3), snapshot.Ints[prefix+"messages_received_total"])
+	assert.Equal(t, int64(1), snapshot.Ints[prefix+"messages_acked_total"])
+	assert.Equal(t, int64(2), snapshot.Ints[prefix+"messages_inflight_gauge"])
+	assert.Equal(t, int64(20), snapshot.Ints[prefix+"high_water_mark"])
+	assert.Equal(t, int64(6), snapshot.Ints[prefix+"committed_offset"])
+	assert.Equal(t, int64(14), snapshot.Ints[prefix+"consumer_lag_gauge"])
+
+	prefix = "topics.logs_app."
+	assert.Equal(t, "logs.app", snapshot.Strings[prefix+"topic"])
+	assert.Equal(t, int64(3), snapshot.Ints[prefix+"messages_received_total"])
+	assert.Equal(t, int64(1), snapshot.Ints[prefix+"messages_acked_total"])
+	assert.Equal(t, int64(1), snapshot.Ints[prefix+"partitions_claimed_gauge"])
+}
+
+func TestInputMetrics_SetTopics(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	metrics := newInputMetrics(reg, "test")
+
+	metrics.setTopics([]string{"trace.fleet1", "trace.fleet2"})
+	partition := metrics.newPartitionMetrics("trace.fleet1", 0)
+	partition.received()
+
+	// Metrics of topics that stay subscribed are kept.
+	metrics.setTopics([]string{"trace.fleet1", "trace.fleet3"})
+	snapshot := monitoring.CollectFlatSnapshot(reg.GetRegistry("test"), monitoring.Full, false)
+	assert.Equal(t, int64(1), snapshot.Ints["topics.trace_fleet1.messages_received_total"])
+	assert.Equal(t, int64(1), snapshot.Ints["topics.trace_fleet1.partitions_claimed_gauge"])
+	assert.Equal(t, "trace.fleet3", snapshot.Strings["topics.trace_fleet3.topic"])
+	assert.NotContains(t, snapshot.Strings, "topics.trace_fleet2.topic")
+
+	partition.Close()
+	snapshot = monitoring.CollectFlatSnapshot(reg.GetRegistry("test"), monitoring.Full, false)
+	assert.Equal(t, int64(0), snapshot.Ints["topics.trace_fleet1.partitions_claimed_gauge"])
+}
+
+func newTestPartitionTracker(maxInFlight int) (*partitionTracker, *testSession, *monitoring.Registry) {
+	reg := monitoring.NewRegistry()
+	metrics := newInputMetrics(reg, "test")
+	claim := &testClaim{topic: "logs.app", partition: 3, initialOffset: 5, highWaterMark: 20}
+	session := &testSession{}
+	tracker := newPartitionTracker(session, claim, maxInFlight, metrics.newPartitionMetrics(claim.topic, claim.partition))
+	return tracker, session, reg.GetRegistry("test")
+}
+
+func trackMessages(tracker *partitionTracker, offsets ...int64) []*trackedMessage {
+	var messages []*trackedMessage
+	for _, offset := range offsets {
+		messages = append(messages, tracker.track(&sarama.ConsumerMessage{Offset: offset}, 1))
+	}
+	return messages
+}
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *testSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.marked = append(s.marked, offset)
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	topic         string
+	partition     int32
+	initialOffset int64
+	highWaterMark int64
+}
+
+func (c *testClaim) Topic() string              { return c.topic }
+func (c *testClaim) Partition() int32           { return c.partition }
+func (c *testClaim) InitialOffset() int64       { return c.initialOffset }
+func (c *testClaim) HighWaterMarkOffset() int64 { return c.highWaterMark }
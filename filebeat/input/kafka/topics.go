@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+)
+
+// topicSubscription resolves the topics consumed by the input from the
+// configured topic names and topic patterns.
+type topicSubscription struct {
+	topics   []string
+	patterns []match.Matcher
+}
+
+// dynamic reports whether the subscribed topics can change while the input
+// is running, because topics matching a pattern can be created and deleted.
+func (s topicSubscription) dynamic() bool {
+	return len(s.patterns) > 0
+}
+
+// resolve returns the sorted list of the configured topics and the available
+// topics matching a pattern. Internal topics never match a pattern.
+func (s topicSubscription) resolve(available []string) []string {
+	var topics []string
+	for _, topic := range s.topics {
+		if !contains(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	for _, topic := range available {
+		if strings.HasPrefix(topic, "__") || contains(topics, topic) {
+			continue
+		}
+		for _, pattern := range s.patterns {
+			if pattern.MatchString(topic) {
+				topics = append(topics, topic)
+				break
+			}
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// fetch refreshes the cluster metadata if the subscription is dynamic and
+// returns the subscribed topics.
+func (s topicSubscription) fetch(client sarama.Client) ([]string, error) {
+	if !s.dynamic() {
+		return s.resolve(nil), nil
+	}
+	if err := client.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+	available, err := client.Topics()
+	if err != nil {
+		return nil, err
+	}
+	return s.resolve(available), nil
+}
+
+func equalTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
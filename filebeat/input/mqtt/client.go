@@ -18,18 +18,48 @@
 package mqtt
 
 import (
+	"time"
+
 	libmqtt "github.com/eclipse/paho.mqtt.golang"
 
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 )
 
-func createClientOptions(config mqttInputConfig, onConnectHandler func(client libmqtt.Client)) (*libmqtt.ClientOptions, error) {
+// mqttClient controls the connection of the MQTT 3.1.1 or MQTT 5 client.
+type mqttClient interface {
+	connect()
+	disconnect(timeout time.Duration)
+}
+
+// v3Client adapts the MQTT 3.1.1 client to mqttClient.
+type v3Client struct {
+	libmqtt.Client
+}
+
+func (c v3Client) connect() {
+	c.Client.Connect()
+}
+
+func (c v3Client) disconnect(timeout time.Duration) {
+	c.Client.Disconnect(uint(timeout.Milliseconds()))
+}
+
+func createClientOptions(config mqttInputConfig, sessions *ackSessions, onConnectHandler func(client libmqtt.Client), onMessageHandler libmqtt.MessageHandler) (*libmqtt.ClientOptions, error) {
+	// Messages are only acknowledged once the pipeline has acknowledged the
+	// resulting events. Messages queued by the broker for a persistent session
+	// can arrive before the subscriptions are restored, so they are routed
+	// through the default handler.
 	clientOptions := libmqtt.NewClientOptions().
 		SetClientID(config.ClientID).
 		SetUsername(config.Username).
 		SetPassword(config.Password).
+		SetProtocolVersion(config.ProtocolVersion).
+		SetCleanSession(config.CleanSession).
+		SetAutoAckDisabled(true).
 		SetConnectRetry(true).
-		SetOnConnectHandler(onConnectHandler)
+		SetDefaultPublishHandler(onMessageHandler).
+		SetOnConnectHandler(onConnectHandler).
+		SetConnectionAttemptHandler(sessions.onConnectAttempt)
 
 	for _, host := range config.Hosts {
 		clientOptions.AddBroker(host)
@@ -48,7 +78,7 @@ func createClientOptions(config mqttInputConfig, onConnectHandler func(client li
 func createClientSubscriptions(config mqttInputConfig) map[string]byte {
 	subscriptions := map[string]byte{}
 	for _, topic := range config.Topics {
-		subscriptions[topic] = byte(config.QoS)
+		subscriptions[topic.Topic] = config.qos(topic)
 	}
 	return subscriptions
 }
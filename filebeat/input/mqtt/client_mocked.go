@@ -65,7 +65,7 @@ func (m *mockedMessage) Payload() []byte {
 }
 
 func (m *mockedMessage) Ack() {
-	panic("implement me")
+	m.ack()
 }
 
 type mockedBackoff struct {
@@ -101,11 +101,17 @@ func (m *mockedToken) WaitTimeout(time.Duration) bool {
 	return m.timeout
 }
 
+func (m *mockedToken) Done() <-chan struct{} {
+	panic("implement me")
+}
+
 func (m *mockedToken) Error() error {
 	return nil
 }
 
 type mockedClient struct {
+	connectionLost bool
+
 	connectCount           int
 	disconnectCount        int
 	subscribeMultipleCount int
@@ -127,7 +133,7 @@ func (m *mockedClient) IsConnected() bool {
 }
 
 func (m *mockedClient) IsConnectionOpen() bool {
-	panic("implement me")
+	return !m.connectionLost
 }
 
 func (m *mockedClient) Connect() libmqtt.Token {
@@ -186,6 +192,7 @@ func (m *mockedClient) OptionsReader() libmqtt.ClientOptionsReader {
 type mockedConnector struct {
 	connectWithError error
 	outlet           channel.Outleter
+	clientConfig     beat.ClientConfig
 }
 
 var _ channel.Connector = new(mockedConnector)
@@ -194,7 +201,8 @@ func (m *mockedConnector) Connect(c *common.Config) (channel.Outleter, error) {
 	return m.ConnectWith(c, beat.ClientConfig{})
 }
 
-func (m *mockedConnector) ConnectWith(*common.Config, beat.ClientConfig) (channel.Outleter, error) {
+func (m *mockedConnector) ConnectWith(_ *common.Config, clientConfig beat.ClientConfig) (channel.Outleter, error) {
+	m.clientConfig = clientConfig
 	if m.connectWithError != nil {
 		return nil, m.connectWithError
 	}
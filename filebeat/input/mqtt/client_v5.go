@@ -0,0 +1,238 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const (
+	connectTimeout      = 30 * time.Second
+	reconnectRetryDelay = 1 * time.Second
+)
+
+// v5Client maintains an MQTT 5 connection to one of the configured brokers.
+// It reconnects and subscribes again whenever the connection is lost.
+type v5Client struct {
+	logger     *logp.Logger
+	config     mqttInputConfig
+	tlsConfig  *tlscommon.TLSConfig
+	onPublish  func(publish *paho.Publish, ack func() error)
+	newBackoff func(done <-chan struct{}, init, max time.Duration) backoff.Backoff
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ mqttClient = new(v5Client)
+
+func newV5Client(
+	logger *logp.Logger,
+	config mqttInputConfig,
+	onPublish func(publish *paho.Publish, ack func() error),
+	newBackoff func(done <-chan struct{}, init, max time.Duration) backoff.Backoff,
+) (*v5Client, error) {
+	var tlsConfig *tlscommon.TLSConfig
+	if config.TLS != nil {
+		var err error
+		tlsConfig, err = tlscommon.LoadTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &v5Client{
+		logger:     logger,
+		config:     config,
+		tlsConfig:  tlsConfig,
+		onPublish:  onPublish,
+		newBackoff: newBackoff,
+		ctx:        ctx,
+		cancel:     cancel,
+	}, nil
+}
+
+func (c *v5Client) connect() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run()
+	}()
+}
+
+func (c *v5Client) disconnect(timeout time.Duration) {
+	c.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		c.logger.Warn("Timed out waiting for the MQTT connection to close.")
+	}
+}
+
+// run connects to the brokers in turn until the client is disconnected.
+func (c *v5Client) run() {
+	backoff := c.newBackoff(c.ctx.Done(), reconnectRetryDelay, 30*reconnectRetryDelay)
+	for i := 0; c.ctx.Err() == nil; i++ {
+		host := c.config.Hosts[i%len(c.config.Hosts)]
+		err := c.serve(host, backoff.Reset)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.logger.Warnf("MQTT connection to %s failed: %v", host, err)
+		}
+		backoff.Wait()
+	}
+}
+
+// serve connects to a broker, subscribes to the configured topics and blocks
+// until the connection is lost or the client is disconnected. onConnected is
+// called once the broker accepted the connection.
+func (c *v5Client) serve(host string, onConnected func()) error {
+	conn, err := c.dial(host)
+	if err != nil {
+		return err
+	}
+
+	connLost := make(chan error, 1)
+	notifyConnLost := func(err error) {
+		select {
+		case connLost <- err:
+		default:
+		}
+	}
+
+	var client *paho.Client
+	client = paho.NewClient(paho.ClientConfig{
+		Conn: conn,
+		Router: paho.NewSingleHandlerRouter(func(publish *paho.Publish) {
+			c.onPublish(publish, func() error {
+				return client.Ack(publish)
+			})
+		}),
+		EnableManualAcknowledgment: true,
+		OnClientError:              notifyConnLost,
+		OnServerDisconnect: func(disconnect *paho.Disconnect) {
+			notifyConnLost(fmt.Errorf("disconnected by the broker with reason code %d", disconnect.ReasonCode))
+		},
+	})
+	client.SetDebugLogger(&debugLogger{log: c.logger})
+	client.SetErrorLogger(&errorLogger{log: c.logger})
+
+	connack, err := client.Connect(c.ctx, c.connectPacket())
+	if err != nil {
+		return err
+	}
+	c.logger.Infof("Connected to MQTT broker %s (session present: %v)", host, connack.SessionPresent)
+	onConnected()
+
+	if err := c.subscribe(client); err != nil {
+		_ = client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+		return err
+	}
+
+	select {
+	case err := <-connLost:
+		return err
+	case <-c.ctx.Done():
+		return client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+}
+
+func (c *v5Client) dial(host string) (net.Conn, error) {
+	address, useTLS, err := parseBrokerURL(host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, connectTimeout)
+	defer cancel()
+
+	if !useTLS && c.tlsConfig == nil {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+
+	serverName, _, _ := net.SplitHostPort(address)
+	var config *tls.Config
+	if c.tlsConfig != nil {
+		config = c.tlsConfig.BuildModuleClientConfig(serverName)
+	} else {
+		config = &tls.Config{ServerName: serverName}
+	}
+	dialer := tls.Dialer{Config: config}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+func (c *v5Client) connectPacket() *paho.Connect {
+	connect := &paho.Connect{
+		ClientID:   c.config.ClientID,
+		KeepAlive:  30,
+		CleanStart: c.config.CleanSession,
+		Properties: &paho.ConnectProperties{},
+	}
+	if c.config.Username != "" {
+		connect.UsernameFlag = true
+		connect.Username = c.config.Username
+	}
+	if c.config.Password != "" {
+		connect.PasswordFlag = true
+		connect.Password = []byte(c.config.Password)
+	}
+	if !c.config.CleanSession {
+		expiry := uint32(c.config.SessionExpiryInterval.Seconds())
+		connect.Properties.SessionExpiryInterval = &expiry
+	}
+	return connect
+}
+
+// subscribe subscribes to every topic separately, so that a topic rejected by
+// the broker can be reported on its own.
+func (c *v5Client) subscribe(client *paho.Client) error {
+	for _, topic := range c.config.Topics {
+		c.logger.Debugf("Try subscribe to topic: %v", topic.Topic)
+		_, err := client.Subscribe(c.ctx, &paho.Subscribe{
+			Subscriptions: map[string]paho.SubscribeOptions{
+				topic.Topic: {QoS: c.config.qos(topic)},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("subscribing to topic %s failed: %w", topic.Topic, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	libmqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/require"
+
+	finput "github.com/elastic/beats/v7/filebeat/input"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
+)
+
+func TestNewInput_MQTT5(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	config := common.MustNewConfigFrom(common.MapStr{
+		"hosts":            "tcp://" + listener.Addr().String(),
+		"protocol_version": 5,
+		"topics": []interface{}{
+			"$share/filebeat/telemetry/#",
+			common.MapStr{"topic": "alerts", "qos": 2},
+		},
+		"qos":                     1,
+		"clean_session":           false,
+		"session_expiry_interval": "1h",
+	})
+
+	eventsCh := make(chan beat.Event, 1)
+	outlet := &mockedOutleter{
+		onEventHandler: func(event beat.Event) bool {
+			eventsCh <- event
+			return true
+		},
+	}
+	connector := &mockedConnector{
+		outlet: outlet,
+	}
+	var inputContext finput.Context
+
+	input, err := newInput(config, connector, inputContext, libmqtt.NewClient, backoff.NewEqualJitterBackoff)
+	require.NoError(t, err)
+	input.Run()
+	defer input.Stop()
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Second)))
+
+	connect := readPacket(t, conn, packets.CONNECT).Content.(*packets.Connect)
+	require.Equal(t, "filebeat", connect.ClientID)
+	require.False(t, connect.CleanStart)
+	require.Equal(t, uint32(3600), *connect.Properties.SessionExpiryInterval)
+	writePacket(t, conn, &packets.Connack{Properties: &packets.Properties{}})
+
+	subscriptions := map[string]byte{}
+	for i := 0; i < 2; i++ {
+		subscribe := readPacket(t, conn, packets.SUBSCRIBE).Content.(*packets.Subscribe)
+		var reasons []byte
+		for topic, options := range subscribe.Subscriptions {
+			subscriptions[topic] = options.QoS
+			reasons = append(reasons, options.QoS)
+		}
+		writePacket(t, conn, &packets.Suback{
+			PacketID:   subscribe.PacketID,
+			Reasons:    reasons,
+			Properties: &packets.Properties{},
+		})
+	}
+	require.Equal(t, map[string]byte{"$share/filebeat/telemetry/#": 1, "alerts": 2}, subscriptions)
+
+	writePacket(t, conn, &packets.Publish{
+		PacketID: 7,
+		QoS:      1,
+		Topic:    "telemetry/vehicle-1",
+		Payload:  []byte(`{"speed":42}`),
+		Properties: &packets.Properties{
+			ContentType: "application/json",
+			User: []packets.User{
+				{Key: "vin", Value: "WVW123"},
+				{Key: "fw", Value: "1.2"},
+			},
+		},
+	})
+
+	var event beat.Event
+	select {
+	case event = <-eventsCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event received")
+	}
+	require.Equal(t, common.MapStr{
+		"message_id":   uint16(7),
+		"qos":          byte(1),
+		"retained":     false,
+		"topic":        "telemetry/vehicle-1",
+		"content_type": "application/json",
+		"user_properties": common.MapStr{
+			"vin": "WVW123",
+			"fw":  "1.2",
+		},
+	}, event.Fields["mqtt"])
+	require.Equal(t, `{"speed":42}`, event.Fields["message"])
+
+	// The message must not be acknowledged before the event is.
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = packets.ReadPacket(conn)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	require.True(t, netErr.Timeout())
+
+	ackHandler := connector.clientConfig.ACKHandler
+	ackHandler.AddEvent(event, true)
+	ackHandler.ACKEvents(1)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	puback := readPacket(t, conn, packets.PUBACK)
+	require.Equal(t, uint16(7), puback.PacketID())
+}
+
+func readPacket(t *testing.T, conn net.Conn, packetType byte) *packets.ControlPacket {
+	t.Helper()
+
+	cp, err := packets.ReadPacket(conn)
+	require.NoError(t, err)
+	require.Equal(t, packetType, cp.Type, "unexpected %s packet", cp.PacketType())
+	return cp
+}
+
+func writePacket(t *testing.T, conn net.Conn, packet io.WriterTo) {
+	t.Helper()
+
+	_, err := packet.WriteTo(conn)
+	require.NoError(t, err)
+}
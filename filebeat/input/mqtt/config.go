@@ -18,35 +18,159 @@
 package mqtt
 
 import (
-	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 )
 
+const (
+	protocolVersion31  = 3
+	protocolVersion311 = 4
+	protocolVersion5   = 5
+
+	sharedSubscriptionPrefix = "$share/"
+)
+
 type mqttInputConfig struct {
-	Hosts  []string `config:"hosts" validate:"required,min=1"`
-	Topics []string `config:"topics" validate:"required,min=1"`
-	QoS    int      `config:"qos" validate:"min=0,max=2"`
+	Hosts  []string      `config:"hosts" validate:"required,min=1"`
+	Topics []topicConfig `config:"topics" validate:"required,min=1"`
+	QoS    int           `config:"qos" validate:"min=0,max=2"`
 
 	ClientID string `config:"client_id" validate:"nonzero"`
 	Username string `config:"username"`
 	Password string `config:"password"`
 
+	// ProtocolVersion selects the MQTT protocol level: 3 (MQTT 3.1), 4 (MQTT 3.1.1)
+	// or 5 (MQTT 5). When unset, MQTT 3.1.1 is used with a fallback to MQTT 3.1.
+	ProtocolVersion uint `config:"protocol_version"`
+
+	// CleanSession set to false asks the broker to keep the session, including
+	// subscriptions and unacknowledged messages, across reconnects.
+	CleanSession bool `config:"clean_session"`
+
+	// SessionExpiryInterval is how long an MQTT 5 broker keeps a persistent
+	// session after the client disconnects.
+	SessionExpiryInterval time.Duration `config:"session_expiry_interval" validate:"min=0"`
+
 	TLS *tlscommon.Config `config:"ssl"`
 }
 
-// The default config for the mqtt input.
+// topicConfig is a topic filter and the QoS to subscribe with. It can be
+// configured as a plain topic filter string, in which case the input level
+// qos setting is used, or as an object with topic and qos fields.
+type topicConfig struct {
+	Topic string `config:"topic" validate:"required"`
+	QoS   *int   `config:"qos" validate:"min=0,max=2"`
+}
+
 func defaultConfig() mqttInputConfig {
 	return mqttInputConfig{
-		ClientID: "filebeat",
-		Topics:   []string{"#"},
+		ClientID:              "filebeat",
+		Topics:                []topicConfig{{Topic: "#"}},
+		CleanSession:          true,
+		SessionExpiryInterval: 24 * time.Hour,
 	}
 }
 
-// Validate validates the config.
 func (mic *mqttInputConfig) Validate() error {
 	if len(mic.ClientID) < 1 || len(mic.ClientID) > 23 {
 		return errors.New("ClientID must be between 1 and 23 characters long")
 	}
+
+	switch mic.ProtocolVersion {
+	case 0, protocolVersion31, protocolVersion311:
+	case protocolVersion5:
+		for _, host := range mic.Hosts {
+			if _, _, err := parseBrokerURL(host); err != nil {
+				return err
+			}
+		}
+		if mic.SessionExpiryInterval.Seconds() > math.MaxUint32 {
+			return fmt.Errorf("session_expiry_interval must not exceed %d seconds", uint32(math.MaxUint32))
+		}
+	default:
+		return fmt.Errorf("unsupported protocol_version %d, must be one of 3, 4 or 5", mic.ProtocolVersion)
+	}
+
+	for _, topic := range mic.Topics {
+		if err := validateTopicFilter(topic.Topic); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// qos returns the QoS to subscribe to the topic with.
+func (mic *mqttInputConfig) qos(topic topicConfig) byte {
+	if topic.QoS != nil {
+		return byte(*topic.QoS)
+	}
+	return byte(mic.QoS)
+}
+
+func (t *topicConfig) Unpack(in interface{}) error {
+	switch v := in.(type) {
+	case string:
+		*t = topicConfig{Topic: v}
+		return nil
+	case map[string]interface{}:
+		cfg, err := common.NewConfigFrom(v)
+		if err != nil {
+			return err
+		}
+		type topicObject topicConfig
+		var obj topicObject
+		if err := cfg.Unpack(&obj); err != nil {
+			return err
+		}
+		*t = topicConfig(obj)
+		return nil
+	default:
+		return fmt.Errorf("topic must be a string or an object with topic and qos fields, got %T", in)
+	}
+}
+
+// validateTopicFilter checks the syntax of shared subscription filters of the
+// form $share/<group>/<filter>.
+func validateTopicFilter(topic string) error {
+	if !strings.HasPrefix(topic, sharedSubscriptionPrefix) {
+		return nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(topic, sharedSubscriptionPrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid shared subscription %q, must be of the form $share/<group>/<topic>", topic)
+	}
+	if strings.ContainsAny(parts[0], "+#") {
+		return fmt.Errorf("invalid shared subscription %q, the group name must not contain wildcards", topic)
+	}
+	return nil
+}
+
+// parseBrokerURL returns the address and whether TLS must be used to connect
+// to an MQTT 5 broker.
+func parseBrokerURL(host string) (address string, useTLS bool, err error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "invalid broker URL %q", host)
+	}
+
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		port, useTLS = "8883", true
+	default:
+		return "", false, fmt.Errorf("unsupported scheme %q in broker URL %q for MQTT 5, must be one of tcp, mqtt, ssl, tls or mqtts", u.Scheme, host)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return u.Hostname() + ":" + port, useTLS, nil
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestConfig_Topics(t *testing.T) {
+	config := defaultConfig()
+	err := common.MustNewConfigFrom(common.MapStr{
+		"hosts": "tcp://localhost:1883",
+		"topics": []interface{}{
+			"plain/#",
+			common.MapStr{"topic": "$share/group/vehicles/+/telemetry", "qos": 2},
+		},
+		"qos": 1,
+	}).Unpack(&config)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]byte{
+		"plain/#":                           1,
+		"$share/group/vehicles/+/telemetry": 2,
+	}, createClientSubscriptions(config))
+}
+
+func TestConfig_SingleTopic(t *testing.T) {
+	config := defaultConfig()
+	err := common.MustNewConfigFrom(common.MapStr{
+		"hosts":  "tcp://localhost:1883",
+		"topics": "a/b",
+	}).Unpack(&config)
+	require.NoError(t, err)
+
+	require.Equal(t, []topicConfig{{Topic: "a/b"}}, config.Topics)
+}
+
+func TestConfig_Invalid(t *testing.T) {
+	tests := map[string]common.MapStr{
+		"topic qos out of range": {
+			"topics": []interface{}{common.MapStr{"topic": "a", "qos": 3}},
+		},
+		"topic without filter": {
+			"topics": []interface{}{common.MapStr{"qos": 1}},
+		},
+		"shared subscription without group": {
+			"topics": "$share//a",
+		},
+		"shared subscription without filter": {
+			"topics": "$share/group",
+		},
+		"shared subscription with wildcard group": {
+			"topics": "$share/+/a",
+		},
+		"unsupported protocol version": {
+			"protocol_version": 6,
+		},
+		"unsupported MQTT 5 scheme": {
+			"protocol_version": 5,
+			"hosts":            "ws://localhost:1883",
+		},
+	}
+
+	for name, settings := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(common.MapStr{
+				"hosts":  "tcp://localhost:1883",
+				"topics": "#",
+			})
+			require.NoError(t, cfg.Merge(settings))
+
+			config := defaultConfig()
+			require.Error(t, cfg.Unpack(&config))
+		})
+	}
+}
+
+func TestParseBrokerURL(t *testing.T) {
+	tests := []struct {
+		host    string
+		address string
+		useTLS  bool
+	}{
+		{host: "tcp://broker", address: "broker:1883"},
+		{host: "mqtt://broker:1884", address: "broker:1884"},
+		{host: "ssl://broker", address: "broker:8883", useTLS: true},
+		{host: "mqtts://broker:8884", address: "broker:8884", useTLS: true},
+	}
+
+	for _, test := range tests {
+		address, useTLS, err := parseBrokerURL(test.host)
+		require.NoError(t, err)
+		require.Equal(t, test.address, address, test.host)
+		require.Equal(t, test.useTLS, useTLS, test.host)
+	}
+}
@@ -18,10 +18,13 @@
 package mqtt
 
 import (
+	"crypto/tls"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/eclipse/paho.golang/paho"
 	libmqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/pkg/errors"
 
@@ -29,6 +32,7 @@ import (
 	"github.com/elastic/beats/v7/filebeat/input"
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
 	"github.com/elastic/beats/v7/libbeat/common/backoff"
 	"github.com/elastic/beats/v7/libbeat/logp"
 )
@@ -46,7 +50,7 @@ type mqttInput struct {
 
 	logger *logp.Logger
 
-	client             libmqtt.Client
+	client             mqttClient
 	clientDisconnected *sync.WaitGroup
 	inflightMessages   *sync.WaitGroup
 }
@@ -79,7 +83,9 @@ func newInput(
 		return nil, errors.Wrap(err, "reading mqtt input config")
 	}
 
-	out, err := connector.Connect(cfg)
+	out, err := connector.ConnectWith(cfg, beat.ClientConfig{
+		ACKHandler: newACKHandler(),
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -89,25 +95,100 @@ func newInput(
 
 	clientDisconnected := new(sync.WaitGroup)
 	inflightMessages := new(sync.WaitGroup)
-	clientSubscriptions := createClientSubscriptions(config)
-	onMessageHandler := createOnMessageHandler(logger, out, inflightMessages)
-	onConnectHandler := createOnConnectHandler(logger, &inputContext, onMessageHandler, clientSubscriptions, newBackoff)
-	clientOptions, err := createClientOptions(config, onConnectHandler)
-	if err != nil {
-		return nil, err
+
+	var client mqttClient
+	if config.ProtocolVersion == protocolVersion5 {
+		onPublishHandler := createOnPublishHandler(logger, out, inflightMessages)
+		client, err = newV5Client(logger, config, onPublishHandler, newBackoff)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		sessions := new(ackSessions)
+		clientSubscriptions := createClientSubscriptions(config)
+		onMessageHandler := createOnMessageHandler(logger, out, inflightMessages, sessions)
+		onConnectHandler := createOnConnectHandler(logger, &inputContext, onMessageHandler, clientSubscriptions, newBackoff)
+		clientOptions, err := createClientOptions(config, sessions, onConnectHandler, onMessageHandler)
+		if err != nil {
+			return nil, err
+		}
+		client = v3Client{newMqttClient(clientOptions)}
 	}
 
 	return &mqttInput{
-		client:             newMqttClient(clientOptions),
+		client:             client,
 		clientDisconnected: clientDisconnected,
 		inflightMessages:   inflightMessages,
 		logger:             logp.NewLogger("mqtt input").With("hosts", config.Hosts),
 	}, nil
 }
 
-func createOnMessageHandler(logger *logp.Logger, outlet channel.Outleter, inflightMessages *sync.WaitGroup) func(client libmqtt.Client, message libmqtt.Message) {
+// messageACK acknowledges an MQTT message to the broker. It is stored in the
+// event's Private field and called once the pipeline has acknowledged the event.
+type messageACK func()
+
+func newACKHandler() beat.ACKer {
+	return acker.ConnectionOnly(
+		acker.EventPrivateReporter(func(_ int, privates []interface{}) {
+			for _, private := range privates {
+				if ack, ok := private.(messageACK); ok {
+					ack()
+				}
+			}
+		}),
+	)
+}
+
+// ackSessions tracks the connection attempts of the MQTT 3.1.1 client. The
+// client sends acknowledgements through a channel that is closed when the
+// connection a message was received on is lost, so a message is only
+// acknowledged while that connection is still open. The broker redelivers
+// messages whose acknowledgement is dropped.
+type ackSessions struct {
+	mu      sync.RWMutex
+	current uint64
+}
+
+// onConnectAttempt starts a new session before the client (re)connects.
+func (s *ackSessions) onConnectAttempt(_ *url.URL, tlsCfg *tls.Config) *tls.Config {
+	s.mu.Lock()
+	s.current++
+	s.mu.Unlock()
+	return tlsCfg
+}
+
+// session returns the current session.
+func (s *ackSessions) session() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// ack acknowledges a message received in the given session. It returns false
+// if the connection the message was received on is no longer open.
+func (s *ackSessions) ack(session uint64, client libmqtt.Client, message libmqtt.Message) (acked bool) {
+	if session != s.session() || !client.IsConnectionOpen() {
+		return false
+	}
+
+	// The connection can still be lost between the check above and Ack. The
+	// client marks the connection as lost before it closes the acknowledgement
+	// channel and only calls OnConnectionLost afterwards, so there is no hook to
+	// synchronise with. Sending on the closed channel panics, in which case the
+	// acknowledgement is dropped like for any other lost connection.
+	defer func() {
+		if r := recover(); r != nil {
+			acked = false
+		}
+	}()
+	message.Ack()
+	return true
+}
+
+func createOnMessageHandler(logger *logp.Logger, outlet channel.Outleter, inflightMessages *sync.WaitGroup, sessions *ackSessions) func(client libmqtt.Client, message libmqtt.Message) {
 	return func(client libmqtt.Client, message libmqtt.Message) {
 		inflightMessages.Add(1)
+		session := sessions.session()
 
 		logger.Debugf("Received message on topic '%s', messageID: %d, size: %d", message.Topic(),
 			message.MessageID(), len(message.Payload()))
@@ -125,12 +206,77 @@ func createOnMessageHandler(logger *logp.Logger, outlet channel.Outleter, inflig
 				"message": string(message.Payload()),
 				"mqtt":    mqttFields,
 			},
+			Private: messageACK(func() {
+				if !sessions.ack(session, client, message) {
+					logger.Debugf("Dropped acknowledgement of message %d on topic '%s', the connection was lost",
+						message.MessageID(), message.Topic())
+				}
+			}),
 		})
 
 		inflightMessages.Done()
 	}
 }
 
+func createOnPublishHandler(logger *logp.Logger, outlet channel.Outleter, inflightMessages *sync.WaitGroup) func(publish *paho.Publish, ack func() error) {
+	return func(publish *paho.Publish, ack func() error) {
+		inflightMessages.Add(1)
+
+		logger.Debugf("Received message on topic '%s', messageID: %d, size: %d", publish.Topic,
+			publish.PacketID, len(publish.Payload))
+
+		mqttFields := common.MapStr{
+			"message_id": publish.PacketID,
+			"qos":        publish.QoS,
+			"retained":   publish.Retain,
+			"topic":      publish.Topic,
+		}
+		if props := publish.Properties; props != nil {
+			if props.ContentType != "" {
+				mqttFields["content_type"] = props.ContentType
+			}
+			if props.ResponseTopic != "" {
+				mqttFields["response_topic"] = props.ResponseTopic
+			}
+			if len(props.User) > 0 {
+				mqttFields["user_properties"] = userPropertiesToMapStr(props.User)
+			}
+		}
+		outlet.OnEvent(beat.Event{
+			Timestamp: time.Now(),
+			Fields: common.MapStr{
+				"message": string(publish.Payload),
+				"mqtt":    mqttFields,
+			},
+			Private: messageACK(func() {
+				if err := ack(); err != nil {
+					logger.Debugf("Dropped acknowledgement of message %d on topic '%s': %v",
+						publish.PacketID, publish.Topic, err)
+				}
+			}),
+		})
+
+		inflightMessages.Done()
+	}
+}
+
+// userPropertiesToMapStr converts MQTT 5 user properties to fields. A key
+// that occurs more than once is mapped to the list of its values.
+func userPropertiesToMapStr(properties paho.UserProperties) common.MapStr {
+	fields := common.MapStr{}
+	for _, property := range properties {
+		switch v := fields[property.Key].(type) {
+		case nil:
+			fields[property.Key] = property.Value
+		case string:
+			fields[property.Key] = []string{v, property.Value}
+		case []string:
+			fields[property.Key] = append(v, property.Value)
+		}
+	}
+	return fields
+}
+
 func createOnConnectHandler(logger *logp.Logger,
 	inputContext *input.Context,
 	onMessageHandler func(client libmqtt.Client, message libmqtt.Message),
@@ -175,7 +321,7 @@ func createOnConnectHandler(logger *logp.Logger,
 func (mi *mqttInput) Run() {
 	mi.once.Do(func() {
 		mi.logger.Debug("Run the input once.")
-		mi.client.Connect()
+		mi.client.connect()
 	})
 }
 
@@ -185,7 +331,7 @@ func (mi *mqttInput) Stop() {
 
 	mi.clientDisconnected.Add(1)
 	go func() {
-		mi.client.Disconnect(uint(disconnectTimeout.Milliseconds()))
+		mi.client.disconnect(disconnectTimeout)
 		mi.clientDisconnected.Done()
 	}()
 }
@@ -23,6 +23,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/eclipse/paho.golang/paho"
 	libmqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/stretchr/testify/require"
 
@@ -138,6 +139,109 @@ func TestNewInput_Run(t *testing.T) {
 	}
 }
 
+func TestNewInput_Run_DeferredAck(t *testing.T) {
+	config := common.MustNewConfigFrom(common.MapStr{
+		"hosts": "tcp://mocked:1234",
+		"topics": []interface{}{
+			"$share/filebeat/first",
+			common.MapStr{"topic": "second", "qos": 2},
+		},
+		"qos":           1,
+		"clean_session": false,
+	})
+
+	eventsCh := make(chan beat.Event, 1)
+	outlet := &mockedOutleter{
+		onEventHandler: func(event beat.Event) bool {
+			eventsCh <- event
+			return true
+		},
+	}
+	connector := &mockedConnector{
+		outlet: outlet,
+	}
+	var inputContext finput.Context
+
+	acked := make(chan struct{})
+	message := mockedMessage{
+		messageID: 1,
+		qos:       1,
+		topic:     "first",
+		payload:   []byte("first-message"),
+		ack:       func() { close(acked) },
+	}
+
+	var client *mockedClient
+	var options *libmqtt.ClientOptions
+	newMqttClient := func(o *libmqtt.ClientOptions) libmqtt.Client {
+		options = o
+		client = &mockedClient{
+			onConnectHandler: o.OnConnect,
+			messages:         []mockedMessage{message},
+			tokens: []libmqtt.Token{&mockedToken{
+				timeout: true,
+			}},
+		}
+		return client
+	}
+
+	input, err := newInput(config, connector, inputContext, newMqttClient, backoff.NewEqualJitterBackoff)
+	require.NoError(t, err)
+	require.False(t, options.CleanSession)
+	require.True(t, options.AutoAckDisabled)
+	require.NotNil(t, options.DefaultPublishHandler)
+
+	input.Run()
+	require.ElementsMatch(t, []string{"$share/filebeat/first", "second"}, client.subscriptions)
+
+	event := <-eventsCh
+	assertEventMatches(t, message, event)
+	select {
+	case <-acked:
+		t.Fatal("message acknowledged before the event was acknowledged")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ackHandler := connector.clientConfig.ACKHandler
+	ackHandler.AddEvent(event, true)
+	ackHandler.ACKEvents(1)
+
+	select {
+	case <-acked:
+	case <-time.After(time.Second):
+		t.Fatal("message not acknowledged after the event was acknowledged")
+	}
+}
+
+func TestAckSessions(t *testing.T) {
+	var acks int
+	message := &mockedMessage{ack: func() { acks++ }}
+	client := new(mockedClient)
+	sessions := new(ackSessions)
+
+	sessions.onConnectAttempt(nil, nil)
+	session := sessions.session()
+	require.True(t, sessions.ack(session, client, message))
+	require.Equal(t, 1, acks)
+
+	client.connectionLost = true
+	require.False(t, sessions.ack(session, client, message), "connection lost")
+	require.Equal(t, 1, acks)
+
+	client.connectionLost = false
+	sessions.onConnectAttempt(nil, nil)
+	require.False(t, sessions.ack(session, client, message), "message of a previous connection")
+	require.True(t, sessions.ack(sessions.session(), client, message))
+	require.Equal(t, 2, acks)
+
+	closed := &mockedMessage{ack: func() {
+		ch := make(chan struct{})
+		close(ch)
+		ch <- struct{}{}
+	}}
+	require.False(t, sessions.ack(sessions.session(), client, closed), "connection lost while acknowledging")
+}
+
 func TestNewInput_Run_Wait(t *testing.T) {
 	config := common.MustNewConfigFrom(common.MapStr{
 		"hosts":  "tcp://mocked:1234",
@@ -208,7 +312,7 @@ func TestNewInput_Run_Wait(t *testing.T) {
 func TestRun_Once(t *testing.T) {
 	client := new(mockedClient)
 	input := &mqttInput{
-		client: client,
+		client: v3Client{client},
 		logger: logger,
 	}
 
@@ -220,7 +324,7 @@ func TestRun_Once(t *testing.T) {
 func TestRun_Twice(t *testing.T) {
 	client := new(mockedClient)
 	input := &mqttInput{
-		client: client,
+		client: v3Client{client},
 		logger: logger,
 	}
 
@@ -235,7 +339,7 @@ func TestWait(t *testing.T) {
 	inflightMessages := new(sync.WaitGroup)
 	client := new(mockedClient)
 	input := &mqttInput{
-		client:             client,
+		client:             v3Client{client},
 		clientDisconnected: clientDisconnected,
 		logger:             logger,
 		inflightMessages:   inflightMessages,
@@ -250,7 +354,7 @@ func TestStop(t *testing.T) {
 	client := new(mockedClient)
 	clientDisconnected := new(sync.WaitGroup)
 	input := &mqttInput{
-		client:             client,
+		client:             v3Client{client},
 		clientDisconnected: clientDisconnected,
 		logger:             logger,
 	}
@@ -330,6 +434,20 @@ func TestNewInputDone(t *testing.T) {
 	inputtest.AssertNotStartedInputCanBeDone(t, NewInput, &config)
 }
 
+func TestUserPropertiesToMapStr(t *testing.T) {
+	properties := paho.UserProperties{
+		{Key: "vin", Value: "WVW123"},
+		{Key: "tag", Value: "a"},
+		{Key: "tag", Value: "b"},
+		{Key: "tag", Value: "c"},
+	}
+
+	require.Equal(t, common.MapStr{
+		"vin": "WVW123",
+		"tag": []string{"a", "b", "c"},
+	}, userPropertiesToMapStr(properties))
+}
+
 func assertEventMatches(t *testing.T, expected mockedMessage, got beat.Event) {
 	topic, err := got.GetValue("mqtt.topic")
 	require.NoError(t, err)
@@ -84,10 +84,20 @@ func (ec *eventCaptor) Done() <-chan struct{} {
 func TestInput(t *testing.T) {
 	logp.TestingSetup(logp.WithSelectors("mqtt input", "libmqtt"))
 
+	for _, protocolVersion := range []int{protocolVersion311, protocolVersion5} {
+		t.Run(fmt.Sprintf("protocol version %d", protocolVersion), func(t *testing.T) {
+			testInput(t, protocolVersion)
+		})
+	}
+}
+
+func testInput(t *testing.T, protocolVersion int) {
 	// Setup the input config.
 	config := common.MustNewConfigFrom(common.MapStr{
-		"hosts":  []string{hostPort},
-		"topics": []string{topic},
+		"hosts":            []string{hostPort},
+		"topics":           []string{topic},
+		"client_id":        fmt.Sprintf("filebeat-%d", protocolVersion),
+		"protocol_version": protocolVersion,
 	})
 
 	// Route input events through our captor instead of sending through ES.
@@ -114,6 +124,7 @@ func TestInput(t *testing.T) {
 
 	// Run the input.
 	input.Run()
+	defer input.Stop()
 
 	// Create Publisher
 	publisher := createPublisher(t)
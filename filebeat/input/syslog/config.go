@@ -18,6 +18,7 @@
 package syslog
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -31,6 +32,7 @@ import (
 	"github.com/elastic/beats/v7/filebeat/inputsource/unix"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 	"github.com/elastic/beats/v7/libbeat/logp"
 )
 
@@ -77,6 +79,39 @@ var defaultTCP = syslogTCP{
 		MaxMessageSize: 20 * humanize.MiByte,
 	},
 	LineDelimiter: "\n",
+	Framing:       streaming.FramingRFC6587,
+}
+
+// tlsName is the name of the TLS transport for syslog defined in RFC 5425.
+const tlsName = "tls"
+
+// syslogTLS configures the TLS transport for syslog. It is a TCP transport
+// that requires TLS 1.2 or later and uses octet counting framing.
+type syslogTLS struct {
+	tcp.Config `config:",inline"`
+}
+
+var defaultTLS = syslogTLS{
+	Config: tcp.Config{
+		Timeout:        time.Minute * 5,
+		MaxMessageSize: 20 * humanize.MiByte,
+	},
+}
+
+// Validate validates the TLS transport config.
+func (c *syslogTLS) Validate() error {
+	if err := c.Config.Validate(); err != nil {
+		return err
+	}
+	if !c.TLS.IsEnabled() {
+		return errors.New("the tls protocol requires ssl to be configured")
+	}
+	for _, version := range c.TLS.Versions {
+		if version < tlscommon.TLSVersion12 {
+			return fmt.Errorf("the tls protocol requires TLS 1.2 or later, %v is not supported", version)
+		}
+	}
+	return nil
 }
 
 type syslogUnix struct {
@@ -119,6 +154,26 @@ func factory(
 		logger := logp.NewLogger("input.syslog.tcp").With("address", config.Config.Host)
 		factory := streaming.SplitHandlerFactory(inputsource.FamilyTCP, logger, tcp.MetadataCallback, nf, splitFunc)
 
+		return tcp.New(&config.Config, factory)
+	case tlsName:
+		config := defaultTLS
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+		if len(config.TLS.Versions) == 0 {
+			config.TLS.Versions = []tlscommon.TLSVersion{tlscommon.TLSVersion12, tlscommon.TLSVersion13}
+		}
+
+		// Octet counting framing is required by RFC 5425, messages split
+		// on new lines are accepted for compatibility with older senders.
+		splitFunc, err := streaming.SplitFunc(streaming.FramingRFC6587, []byte("\n"))
+		if err != nil {
+			return nil, err
+		}
+
+		logger := logp.NewLogger("input.syslog.tls").With("address", config.Config.Host)
+		factory := streaming.SplitHandlerFactory(inputsource.FamilyTCP, logger, tcp.MetadataCallback, nf, splitFunc)
+
 		return tcp.New(&config.Config, factory)
 	case unix.Name:
 		config := defaultUnix()
@@ -137,7 +192,7 @@ func factory(
 		}
 		return udp.New(&config, nf), nil
 	default:
-		return nil, fmt.Errorf("you must choose between TCP or UDP")
+		return nil, fmt.Errorf("you must choose between TCP, TLS, UDP or Unix")
 	}
 }
 
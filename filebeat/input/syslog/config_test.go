@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/filebeat/inputsource"
+	"github.com/elastic/beats/v7/filebeat/inputsource/common/streaming"
+	"github.com/elastic/beats/v7/filebeat/inputsource/tcp"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const (
+	testCertificate = "../../../libbeat/common/transport/tlscommon/testdata/server.crt"
+	testKey         = "../../../libbeat/common/transport/tlscommon/testdata/server.key"
+)
+
+func TestDefaultTCPFraming(t *testing.T) {
+	cfg := common.MustNewConfigFrom(common.MapStr{"host": "localhost:0"})
+	config := defaultTCP
+	require.NoError(t, cfg.Unpack(&config))
+	assert.Equal(t, streaming.FramingType(streaming.FramingRFC6587), config.Framing)
+}
+
+func TestFactoryTLSInvalid(t *testing.T) {
+	for name, settings := range map[string]common.MapStr{
+		"ssl not configured": {},
+		"ssl disabled": {
+			"ssl.enabled":     false,
+			"ssl.certificate": testCertificate,
+			"ssl.key":         testKey,
+		},
+		"TLS 1.1": {
+			"ssl.certificate":         testCertificate,
+			"ssl.key":                 testKey,
+			"ssl.supported_protocols": []string{"TLSv1.1", "TLSv1.2"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			settings["host"] = "localhost:0"
+			protocol := common.MustNewConfigFrom(common.MapStr{"tls": settings})
+			var ns common.ConfigNamespace
+			require.NoError(t, protocol.Unpack(&ns))
+
+			_, err := factory(func([]byte, inputsource.NetworkMetadata) {}, ns)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFactoryTLS(t *testing.T) {
+	ch := make(chan string, 2)
+	nf := func(data []byte, _ inputsource.NetworkMetadata) {
+		ch <- string(data)
+	}
+
+	protocol := common.MustNewConfigFrom(common.MapStr{
+		"tls": common.MapStr{
+			"host":            "localhost:0",
+			"ssl.certificate": testCertificate,
+			"ssl.key":         testKey,
+		},
+	})
+	var ns common.ConfigNamespace
+	require.NoError(t, protocol.Unpack(&ns))
+
+	server, err := factory(nf, ns)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	addr := server.(*tcp.Server).Listener.Listener.Addr().String()
+
+	// TLS versions before 1.2 are rejected.
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS11,
+	})
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected handshake with TLS 1.1 to fail")
+	}
+
+	conn, err = tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	messages := []string{
+		"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - first line\nsecond line",
+		"<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 - message",
+	}
+	for _, message := range messages {
+		fmt.Fprintf(conn, "%d %s", len(message), message)
+	}
+	conn.Close()
+
+	for _, message := range messages {
+		select {
+		case received := <-ch:
+			assert.Equal(t, message, received)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+}
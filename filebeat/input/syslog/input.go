@@ -261,8 +261,8 @@ func createEvent(ev *event, metadata inputsource.NetworkMetadata, timezone *time
 		syslog["version"] = ev.Version()
 	}
 
-	if ev.data != nil && len(ev.data) > 0 {
-		syslog["data"] = ev.data
+	if !ev.IsDataEmpty() {
+		syslog["data"] = structuredData(ev.data)
 	}
 
 	f["syslog"] = syslog
@@ -313,9 +313,26 @@ func newBeatEvent(timestamp time.Time, metadata inputsource.NetworkMetadata, fie
 	if metadata.RemoteAddr != nil {
 		event.Fields.Put("log.source.address", metadata.RemoteAddr.String())
 	}
+	if client := metadata.TLS.ClientFields(); client != nil {
+		event.Fields.Put("tls.client", client)
+	}
 	return event
 }
 
+// structuredData maps the structured data elements of an RFC 5424 message
+// to nested fields, keyed by the SD-ID and the parameter names.
+func structuredData(data EventData) common.MapStr {
+	elements := make(common.MapStr, len(data))
+	for id, params := range data {
+		element := make(common.MapStr, len(params))
+		for name, value := range params {
+			element[name] = value
+		}
+		elements[id] = element
+	}
+	return elements
+}
+
 func mapValueToName(v int, m mapper) (string, error) {
 	if v < 0 || v >= len(m) {
 		return "", errors.Errorf("value out of bound: %d", v)
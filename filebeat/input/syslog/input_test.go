@@ -312,8 +312,8 @@ func TestParseAndCreateEvent5424(t *testing.T) {
 					"severity_label": "Notice",
 					"msgid":          "ID47",
 					"version":        1,
-					"data": EventData{
-						"exampleSDID@32473": {
+					"data": common.MapStr{
+						"exampleSDID@32473": common.MapStr{
 							"eventID":     "1011",
 							"eventSource": "Application",
 							"iut":         "3",
@@ -348,3 +348,18 @@ func TestParseAndCreateEvent5424(t *testing.T) {
 		})
 	}
 }
+
+func TestStructuredDataFields(t *testing.T) {
+	event := parseAndCreateEvent5424([]byte(RfcDoc65Example4), dummyMetadata(), time.Local, logp.NewLogger("syslog"))
+
+	for field, expected := range map[string]string{
+		"syslog.data.exampleSDID@32473.eventSource": "Application",
+		"syslog.data.exampleSDID@32473.eventID":     "1011",
+		"syslog.data.examplePriority@32473.class":   "high",
+	} {
+		value, err := event.Fields.GetValue(field)
+		if assert.NoError(t, err, field) {
+			assert.Equal(t, expected, value)
+		}
+	}
+}
@@ -128,7 +128,7 @@ func (p *Input) Wait() {
 }
 
 func createEvent(raw []byte, metadata inputsource.NetworkMetadata) beat.Event {
-	return beat.Event{
+	event := beat.Event{
 		Timestamp: time.Now(),
 		Fields: common.MapStr{
 			"message": string(raw),
@@ -139,4 +139,8 @@ func createEvent(raw []byte, metadata inputsource.NetworkMetadata) beat.Event {
 			},
 		},
 	}
+	if client := metadata.TLS.ClientFields(); client != nil {
+		event.Fields.Put("tls.client", client)
+	}
+	return event
 }
@@ -21,6 +21,7 @@ import (
 	"bufio"
 	"context"
 	"net"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -41,6 +42,9 @@ type MetadataFunc func(net.Conn) inputsource.NetworkMetadata
 func SplitHandlerFactory(family inputsource.Family, logger *logp.Logger, metadataCallback MetadataFunc, callback inputsource.NetworkFunc, splitFunc bufio.SplitFunc) HandlerFactory {
 	return func(config ListenerConfig) ConnectionHandler {
 		return ConnectionHandler(func(ctx context.Context, conn net.Conn) error {
+			// The metadata callback can read from the connection to complete
+			// a TLS handshake or read a PROXY protocol header.
+			conn.SetDeadline(time.Now().Add(config.Timeout))
 			metadata := metadataCallback(conn)
 			maxMessageSize := uint64(config.MaxMessageSize)
 
@@ -20,7 +20,6 @@ package streaming
 import (
 	"bufio"
 	"bytes"
-	"strconv"
 )
 
 // FactoryDelimiter return a function to split line using a custom delimiter supporting multibytes
@@ -51,30 +50,30 @@ func dropDelimiter(data []byte, delimiter []byte) []byte {
 // FactoryRFC6587Framing returns a function that splits based on octet
 // counting or non-transparent framing as defined in RFC6587.  Allows
 // for custom delimter for non-transparent framing.
+//
+// The framing is detected for each frame: a frame starting with a message
+// length followed by a space and the "<" opening the syslog priority uses
+// octet counting, any other frame is split on the delimiter.
 func FactoryRFC6587Framing(delimiter []byte) bufio.SplitFunc {
 	return func(data []byte, eof bool) (int, []byte, error) {
 		if eof && len(data) == 0 {
 			return 0, nil, nil
 		}
-		// need at least one character to see if octet or
-		// non transparent framing
-		if len(data) <= 1 {
+		length, start, more := octetCountingHeader(data)
+		if more && !eof {
+			// request more data
 			return 0, nil, nil
 		}
-		// It can be assumed that octet-counting framing is
-		// used if a syslog frame starts with a digit RFC6587
-		if bytes.ContainsAny(data[0:1], "0123456789") {
-			if i := bytes.IndexByte(data, ' '); i > 0 {
-				length, err := strconv.Atoi(string(data[0:i]))
-				if err != nil {
-					return 0, nil, err
-				}
-				end := length + i + 1
-				if len(data) >= end {
-					return end, data[i+1 : end], nil
-				}
+		if start > 0 {
+			end := start + length
+			if len(data) >= end {
+				return end, data[start:end], nil
+			}
+			if eof {
+				// The connection was closed before the frame was complete.
+				return len(data), data[start:], nil
 			}
-			//request more data
+			// request more data
 			return 0, nil, nil
 		}
 		if i := bytes.Index(data, delimiter); i >= 0 {
@@ -87,3 +86,41 @@ func FactoryRFC6587Framing(delimiter []byte) bufio.SplitFunc {
 		return 0, nil, nil
 	}
 }
+
+// maxOctetCountingDigits is the maximum number of digits of the message
+// length of an octet counted frame.
+const maxOctetCountingDigits = 9
+
+// octetCountingHeader parses the "MSG-LEN SP" header of an octet counted
+// frame. It returns the message length and the offset of the message, or
+// an offset of 0 if the frame does not use octet counting. more is set if
+// more data is required to detect the framing.
+func octetCountingHeader(data []byte) (length int, start int, more bool) {
+	if len(data) == 0 {
+		return 0, 0, true
+	}
+	// MSG-LEN = NONZERO-DIGIT 0*8DIGIT
+	if data[0] < '1' || data[0] > '9' {
+		return 0, 0, false
+	}
+	for i, b := range data {
+		switch {
+		case b >= '0' && b <= '9':
+			if i >= maxOctetCountingDigits {
+				return 0, 0, false
+			}
+			length = length*10 + int(b-'0')
+		case b == ' ':
+			if i+1 >= len(data) {
+				return 0, 0, true
+			}
+			if data[i+1] != '<' {
+				return 0, 0, false
+			}
+			return length, i + 1, false
+		default:
+			return 0, 0, false
+		}
+	}
+	return 0, 0, true
+}
@@ -164,6 +164,33 @@ func TestOctetCounting(t *testing.T) {
 			},
 			delimiter: []byte("\n"),
 		},
+		{
+			name:  "non-transparent starting with digits",
+			input: "2021-10-11 message 0\n12 message 1\n12a <3> message 2",
+			expected: []string{
+				"2021-10-11 message 0",
+				"12 message 1",
+				"12a <3> message 2",
+			},
+			delimiter: []byte("\n"),
+		},
+		{
+			name:  "non-transparent with too long message length",
+			input: "1234567890 <9> message 0\n",
+			expected: []string{
+				"1234567890 <9> message 0",
+			},
+			delimiter: []byte("\n"),
+		},
+		{
+			name:  "octet counting, truncated",
+			input: "13 <9> message 020 <6> msg 1",
+			expected: []string{
+				"<9> message 0",
+				"<6> msg 1",
+			},
+			delimiter: []byte("\n"),
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -19,6 +19,8 @@ package inputsource
 
 import (
 	"net"
+
+	"github.com/elastic/beats/v7/libbeat/common"
 )
 
 // Network interface implemented by TCP and UDP input source.
@@ -40,6 +42,34 @@ type TLSMetadata struct {
 	CipherSuite      string
 	ServerName       string
 	PeerCertificates []string
+
+	// Identity of the client, from the verified client certificate.
+	ClientSubject    string
+	ClientCommonName string
+	ClientSANs       []string
+}
+
+// ClientFields returns the ECS `tls.client` fields identifying the client with
+// its verified certificate, or nil if the client was not verified.
+func (m *TLSMetadata) ClientFields() common.MapStr {
+	if m == nil || m.ClientSubject == "" {
+		return nil
+	}
+	x509 := common.MapStr{
+		"subject": common.MapStr{
+			"distinguished_name": m.ClientSubject,
+		},
+	}
+	if m.ClientCommonName != "" {
+		x509.Put("subject.common_name", m.ClientCommonName)
+	}
+	if len(m.ClientSANs) > 0 {
+		x509["alternative_names"] = m.ClientSANs
+	}
+	return common.MapStr{
+		"subject": m.ClientSubject,
+		"x509":    x509,
+	}
 }
 
 // NetworkFunc defines callback executed when a new event is received from a network source.
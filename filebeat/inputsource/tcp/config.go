@@ -35,6 +35,7 @@ type Config struct {
 	MaxMessageSize cfgtype.ByteSize        `config:"max_message_size" validate:"nonzero,positive"`
 	MaxConnections int                     `config:"max_connections"`
 	TLS            *tlscommon.ServerConfig `config:"ssl"`
+	ProxyProtocol  ProxyProtocolConfig     `config:"proxy_protocol"`
 }
 
 // Validate validates the Config option for the tcp input.
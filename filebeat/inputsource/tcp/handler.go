@@ -36,17 +36,45 @@ func MetadataCallback(conn net.Conn) inputsource.NetworkMetadata {
 
 func extractSSLInformation(c net.Conn) *inputsource.TLSMetadata {
 	if tls, ok := c.(*tls.Conn); ok {
+		// The handshake is otherwise done by the first read, the connection
+		// state is empty before.
+		if err := tls.Handshake(); err != nil {
+			return nil
+		}
 		state := tls.ConnectionState()
-		return &inputsource.TLSMetadata{
+		metadata := &inputsource.TLSMetadata{
 			TLSVersion:       tlscommon.ResolveTLSVersion(state.Version),
 			CipherSuite:      tlscommon.ResolveCipherSuite(state.CipherSuite),
 			ServerName:       state.ServerName,
 			PeerCertificates: extractCertificate(state.PeerCertificates),
 		}
+		// Only a client certificate verified against the certificate
+		// authorities identifies the client.
+		if len(state.VerifiedChains) > 0 {
+			cert := state.VerifiedChains[0][0]
+			metadata.ClientSubject = cert.Subject.String()
+			metadata.ClientCommonName = cert.Subject.CommonName
+			metadata.ClientSANs = extractSANs(cert)
+		}
+		return metadata
 	}
 	return nil
 }
 
+// extractSANs returns the subject alternative names of a certificate.
+func extractSANs(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
 func extractCertificate(certificates []*x509.Certificate) []string {
 	strCertificate := make([]string, len(certificates))
 	for idx, c := range certificates {
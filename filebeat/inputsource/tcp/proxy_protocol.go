@@ -0,0 +1,318 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyProtocolConfig configures the PROXY protocol, used by load balancers to
+// send the address of the client before the data of a connection.
+type ProxyProtocolConfig struct {
+	Enabled        bool     `config:"enabled"`
+	TrustedProxies []string `config:"trusted_proxies"`
+}
+
+// Validate validates the PROXY protocol config.
+func (c *ProxyProtocolConfig) Validate() error {
+	_, err := c.trustedNetworks()
+	return err
+}
+
+// trustedNetworks parses the addresses and CIDR ranges of the trusted proxies.
+func (c *ProxyProtocolConfig) trustedNetworks() ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range c.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address '%s'", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range '%s': %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+var (
+	// proxyV1Prefix starts the human readable header of version 1.
+	proxyV1Prefix = []byte("PROXY ")
+	// proxyV2Signature starts the binary header of version 2.
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	errProxyHeaderMissing = errors.New("missing PROXY protocol header")
+	errUntrustedProxy     = errors.New("PROXY protocol header from untrusted address")
+)
+
+const (
+	// proxyV1MaxLength is the maximum length of a version 1 header, including
+	// the CRLF.
+	proxyV1MaxLength = 107
+
+	proxyV2CommandLocal = 0x0
+	proxyV2CommandProxy = 0x1
+
+	proxyV2FamilyTCP4 = 0x11
+	proxyV2FamilyTCP6 = 0x21
+)
+
+// proxyListener reads the PROXY protocol header of the accepted connections.
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+func newProxyListener(l net.Listener, config ProxyProtocolConfig, timeout time.Duration) (net.Listener, error) {
+	trusted, err := config.trustedNetworks()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyListener{Listener: l, trusted: trusted, timeout: timeout}, nil
+}
+
+// Accept returns the next connection. The header is read by the first call to
+// Read or RemoteAddr, so that a slow client does not block other connections.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		trusted: l.trusted,
+		timeout: l.timeout,
+	}, nil
+}
+
+// proxyConn is a connection whose remote address is the address of the client
+// sent in the PROXY protocol header.
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	trusted []*net.IPNet
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+
+	// deadlineMutex protects readDeadline, the read deadline set by the user
+	// of the connection. It is restored after the header is read.
+	deadlineMutex sync.Mutex
+	readDeadline  time.Time
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr returns the address of the client, or the address of the proxy
+// if the header does not contain the address of the client.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.deadlineMutex.Lock()
+	defer c.deadlineMutex.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMutex.Lock()
+	defer c.deadlineMutex.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) readHeader() {
+	if !c.isTrusted() {
+		c.err = errUntrustedProxy
+		return
+	}
+
+	c.deadlineMutex.Lock()
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	c.deadlineMutex.Unlock()
+	defer func() {
+		c.deadlineMutex.Lock()
+		c.Conn.SetReadDeadline(c.readDeadline)
+		c.deadlineMutex.Unlock()
+	}()
+
+	c.remoteAddr, c.err = readProxyHeader(c.reader)
+	if c.err != nil {
+		c.err = fmt.Errorf("reading PROXY protocol header from %v: %w", c.Conn.RemoteAddr(), c.err)
+	}
+}
+
+func (c *proxyConn) isTrusted() bool {
+	if len(c.trusted) == 0 {
+		return true
+	}
+	addr, ok := c.Conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range c.trusted {
+		if network.Contains(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// readProxyHeader reads a version 1 or version 2 PROXY protocol header and
+// returns the source address it contains. The address is nil if the header
+// does not contain an address, for example for health checks of the proxy.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case proxyV1Prefix[0]:
+		return readProxyV1Header(r)
+	case proxyV2Signature[0]:
+		return readProxyV2Header(r)
+	default:
+		return nil, errProxyHeaderMissing
+	}
+}
+
+// readProxyV1Header reads a header in the form
+// "PROXY TCP4 <src ip> <dst ip> <src port> <dst port>\r\n".
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLength {
+			return nil, errors.New("PROXY protocol v1 header too long")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+	if !bytes.HasPrefix(line, proxyV1Prefix) {
+		return nil, errProxyHeaderMissing
+	}
+
+	parts := strings.Split(string(line[len(proxyV1Prefix):len(line)-2]), " ")
+	switch parts[0] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol v1 protocol '%s'", parts[0])
+	}
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 header '%s'", strings.TrimSpace(string(line)))
+	}
+
+	ip := net.ParseIP(parts[1])
+	if ip == nil || (parts[0] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 source address '%s'", parts[1])
+	}
+	port, err := strconv.ParseUint(parts[3], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 source port '%s'", parts[3])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2Header reads a binary header, made of the signature, the version
+// and command, the address family, the length of the addresses and the
+// addresses followed by optional TLVs.
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(proxyV2Signature)], proxyV2Signature) {
+		return nil, errProxyHeaderMissing
+	}
+
+	versionCommand, family := header[12], header[13]
+	length := binary.BigEndian.Uint16(header[14:])
+	if versionCommand>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", versionCommand>>4)
+	}
+
+	addresses := make([]byte, length)
+	if _, err := io.ReadFull(r, addresses); err != nil {
+		return nil, err
+	}
+
+	switch versionCommand & 0xf {
+	case proxyV2CommandLocal:
+		return nil, nil
+	case proxyV2CommandProxy:
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol v2 command %d", versionCommand&0xf)
+	}
+
+	var ipLen int
+	switch family {
+	case proxyV2FamilyTCP4:
+		ipLen = net.IPv4len
+	case proxyV2FamilyTCP6:
+		ipLen = net.IPv6len
+	default:
+		// Addresses of other families are not TCP addresses.
+		return nil, nil
+	}
+	if len(addresses) < 2*ipLen+4 {
+		return nil, errors.New("PROXY protocol v2 addresses too short")
+	}
+	ip := make(net.IP, ipLen)
+	copy(ip, addresses[:ipLen])
+	port := binary.BigEndian.Uint16(addresses[2*ipLen:])
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,295 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/filebeat/inputsource"
+	"github.com/elastic/beats/v7/filebeat/inputsource/common/streaming"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const testdata = "../../../libbeat/common/transport/tlscommon/testdata/"
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := map[string]struct {
+		header   []byte
+		expected string
+		err      bool
+	}{
+		"v1 TCP4": {
+			header:   []byte("PROXY TCP4 192.168.1.10 10.0.0.1 56324 514\r\n"),
+			expected: "192.168.1.10:56324",
+		},
+		"v1 TCP6": {
+			header:   []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 514\r\n"),
+			expected: "[2001:db8::1]:56324",
+		},
+		"v1 UNKNOWN": {
+			header: []byte("PROXY UNKNOWN\r\n"),
+		},
+		"v1 address family mismatch": {
+			header: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 56324 514\r\n"),
+			err:    true,
+		},
+		"v1 invalid port": {
+			header: []byte("PROXY TCP4 192.168.1.10 10.0.0.1 port 514\r\n"),
+			err:    true,
+		},
+		"v1 too long": {
+			header: []byte("PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n"),
+			err:    true,
+		},
+		"v2 TCP4": {
+			header:   proxyV2Header(proxyV2CommandProxy, proxyV2FamilyTCP4, net.ParseIP("192.168.1.10").To4(), 56324),
+			expected: "192.168.1.10:56324",
+		},
+		"v2 TCP6": {
+			header:   proxyV2Header(proxyV2CommandProxy, proxyV2FamilyTCP6, net.ParseIP("2001:db8::1"), 56324),
+			expected: "[2001:db8::1]:56324",
+		},
+		"v2 LOCAL": {
+			header: proxyV2Header(proxyV2CommandLocal, 0, nil, 0),
+		},
+		"missing header": {
+			header: []byte("<13>Oct 11 22:14:15 host message\n"),
+			err:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(append(test.header, "message\n"...)))
+			addr, err := readProxyHeader(r)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if test.expected == "" {
+				assert.Nil(t, addr)
+			} else {
+				assert.Equal(t, test.expected, addr.String())
+			}
+
+			// The data after the header is left unread.
+			rest, err := r.ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, "message\n", rest)
+		})
+	}
+}
+
+func TestProxyProtocolConfig(t *testing.T) {
+	config := ProxyProtocolConfig{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::1"}}
+	networks, err := config.trustedNetworks()
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+	assert.True(t, networks[0].Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, networks[1].Contains(net.ParseIP("192.168.1.1")))
+	assert.False(t, networks[1].Contains(net.ParseIP("192.168.1.2")))
+	assert.True(t, networks[2].Contains(net.ParseIP("2001:db8::1")))
+
+	for _, invalid := range []string{"10.0.0.0/33", "localhost"} {
+		config := ProxyProtocolConfig{TrustedProxies: []string{invalid}}
+		assert.Error(t, config.Validate(), invalid)
+	}
+}
+
+func TestReceiveWithProxyProtocol(t *testing.T) {
+	tests := map[string]struct {
+		cfg      map[string]interface{}
+		sent     string
+		expected string
+		received bool
+	}{
+		"v1 header": {
+			cfg:      map[string]interface{}{"proxy_protocol.enabled": true},
+			sent:     "PROXY TCP4 192.168.1.10 10.0.0.1 56324 514\r\nmessage\n",
+			expected: "192.168.1.10:56324",
+			received: true,
+		},
+		"trusted proxy": {
+			cfg: map[string]interface{}{
+				"proxy_protocol.enabled":         true,
+				"proxy_protocol.trusted_proxies": []string{"127.0.0.0/8"},
+			},
+			sent:     string(proxyV2Header(proxyV2CommandProxy, proxyV2FamilyTCP4, net.ParseIP("192.168.1.10").To4(), 56324)) + "message\n",
+			expected: "192.168.1.10:56324",
+			received: true,
+		},
+		"untrusted proxy": {
+			cfg: map[string]interface{}{
+				"proxy_protocol.enabled":         true,
+				"proxy_protocol.trusted_proxies": []string{"10.0.0.0/8"},
+			},
+			sent: "PROXY TCP4 192.168.1.10 10.0.0.1 56324 514\r\nmessage\n",
+		},
+		"missing header": {
+			cfg:  map[string]interface{}{"proxy_protocol.enabled": true},
+			sent: "message\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ch := make(chan *info, 1)
+			server := startTestServer(t, test.cfg, ch)
+			defer server.Stop()
+
+			conn, err := net.Dial("tcp", server.Listener.Listener.Addr().String())
+			require.NoError(t, err)
+			fmt.Fprint(conn, test.sent)
+			defer conn.Close()
+
+			select {
+			case event := <-ch:
+				require.True(t, test.received, "unexpected event")
+				assert.Equal(t, "message", event.message)
+				assert.Equal(t, test.expected, event.mt.RemoteAddr.String())
+			case <-time.After(time.Second):
+				require.False(t, test.received, "timeout waiting for event")
+			}
+		})
+	}
+}
+
+func TestReceiveWithClientCertificate(t *testing.T) {
+	ch := make(chan *info, 1)
+	server := startTestServer(t, map[string]interface{}{
+		"proxy_protocol.enabled":      true,
+		"ssl.certificate":             testdata + "server.crt",
+		"ssl.key":                     testdata + "server.key",
+		"ssl.certificate_authorities": []string{testdata + "cacert.crt"},
+	}, ch)
+	defer server.Stop()
+
+	cert, err := tls.LoadX509KeyPair(testdata+"client1.crt", testdata+"client1.key")
+	require.NoError(t, err)
+
+	raw, err := net.Dial("tcp", server.Listener.Listener.Addr().String())
+	require.NoError(t, err)
+	defer raw.Close()
+	// The PROXY protocol header is sent before the TLS handshake.
+	fmt.Fprint(raw, "PROXY TCP4 192.168.1.10 10.0.0.1 56324 514\r\n")
+	conn := tls.Client(raw, &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{cert},
+	})
+	fmt.Fprint(conn, "message\n")
+
+	select {
+	case event := <-ch:
+		assert.Equal(t, "message", event.message)
+		assert.Equal(t, "192.168.1.10:56324", event.mt.RemoteAddr.String())
+		require.NotNil(t, event.mt.TLS)
+		assert.Equal(t, "CN=localhost,OU=server,O=beats,L=Montreal,ST=Quebec,C=CA", event.mt.TLS.ClientSubject)
+		assert.Equal(t, common.MapStr{
+			"subject": "CN=localhost,OU=server,O=beats,L=Montreal,ST=Quebec,C=CA",
+			"x509": common.MapStr{
+				"subject": common.MapStr{
+					"distinguished_name": "CN=localhost,OU=server,O=beats,L=Montreal,ST=Quebec,C=CA",
+					"common_name":        "localhost",
+				},
+			},
+		}, event.mt.TLS.ClientFields())
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestProxyConnRestoresReadDeadline(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	pl, err := newProxyListener(l, ProxyProtocolConfig{Enabled: true}, time.Minute)
+	require.NoError(t, err)
+	defer pl.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	fmt.Fprint(client, "PROXY TCP4 192.168.1.10 10.0.0.1 56324 514\r\n")
+
+	conn, err := pl.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The deadline of the connection, e.g. for the TLS handshake, must still
+	// apply after the header is read.
+	require.NoError(t, conn.SetDeadline(time.Now().Add(50*time.Millisecond)))
+	assert.Equal(t, "192.168.1.10:56324", conn.RemoteAddr().String())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read deadline was cleared after reading the header")
+	}
+}
+
+func startTestServer(t *testing.T, settings map[string]interface{}, ch chan *info) *Server {
+	settings["host"] = "localhost:0"
+	config := defaultConfig
+	require.NoError(t, common.MustNewConfigFrom(settings).Unpack(&config))
+
+	to := func(message []byte, mt inputsource.NetworkMetadata) {
+		ch <- &info{message: string(message), mt: mt}
+	}
+	splitFunc, err := streaming.SplitFunc(streaming.FramingDelimiter, []byte("\n"))
+	require.NoError(t, err)
+
+	factory := streaming.SplitHandlerFactory(inputsource.FamilyTCP, logp.NewLogger("test"), MetadataCallback, to, splitFunc)
+	server, err := New(&config, factory)
+	require.NoError(t, err)
+	require.NoError(t, server.Start())
+	return server
+}
+
+func proxyV2Header(command, family byte, ip net.IP, port uint16) []byte {
+	var addresses []byte
+	if ip != nil {
+		addresses = append(addresses, ip...)
+		addresses = append(addresses, make([]byte, len(ip))...)
+		addresses = binary.BigEndian.AppendUint16(addresses, port)
+		addresses = binary.BigEndian.AppendUint16(addresses, 514)
+	}
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
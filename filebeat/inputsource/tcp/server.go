@@ -65,19 +65,24 @@ func New(
 }
 
 func (s *Server) createServer() (net.Listener, error) {
-	var l net.Listener
-	var err error
-	if s.tlsConfig != nil {
-		t := s.tlsConfig.BuildServerConfig(s.config.Host)
-		l, err = tls.Listen("tcp", s.config.Host, t)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		l, err = net.Listen("tcp", s.config.Host)
+	l, err := net.Listen("tcp", s.config.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// The PROXY protocol header is sent before the TLS handshake.
+	if s.config.ProxyProtocol.Enabled {
+		proxyListener, err := newProxyListener(l, s.config.ProxyProtocol, s.config.Timeout)
 		if err != nil {
+			l.Close()
 			return nil, err
 		}
+		l = proxyListener
+	}
+
+	if s.tlsConfig != nil {
+		t := s.tlsConfig.BuildServerConfig(s.config.Host)
+		l = tls.NewListener(l, t)
 	}
 
 	if s.config.MaxConnections > 0 {
@@ -0,0 +1,173 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package udp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/elastic/beats/v7/filebeat/inputsource"
+	"github.com/elastic/beats/v7/filebeat/inputsource/common/dgram"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const batchSupported = true
+
+// mmsghdr is the message header used by recvmmsg.
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// batchReaderFactory returns a handler reading up to batchSize datagrams with
+// a single recvmmsg system call.
+func batchReaderFactory(logger *logp.Logger, callback inputsource.NetworkFunc, batchSize int) dgram.HandlerFactory {
+	return func(config dgram.ListenerConfig) dgram.ConnectionHandler {
+		return dgram.ConnectionHandler(func(ctx context.Context, conn net.PacketConn) error {
+			udpConn, ok := conn.(*net.UDPConn)
+			if !ok {
+				return errors.New("batch reads require an UDP connection")
+			}
+			raw, err := udpConn.SyscallConn()
+			if err != nil {
+				return err
+			}
+
+			batch := newBatchReader(batchSize, int(config.MaxMessageSize))
+			for ctx.Err() == nil {
+				n, err := batch.read(raw)
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						logger.Info("Connection has been closed")
+						return nil
+					}
+					logger.Errorf("Error reading from the socket %s", err)
+					continue
+				}
+				for i := 0; i < n; i++ {
+					data, metadata := batch.message(i)
+					callback(data, metadata)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// batchReader reads datagrams into a batch of buffers. The buffer of a
+// message is handed over to the callback, a new buffer is allocated for the
+// next read.
+type batchReader struct {
+	size    int
+	msgs    []mmsghdr
+	iovs    []unix.Iovec
+	addrs   []unix.RawSockaddrAny
+	buffers [][]byte
+}
+
+func newBatchReader(batchSize, maxMessageSize int) *batchReader {
+	return &batchReader{
+		size:    maxMessageSize,
+		msgs:    make([]mmsghdr, batchSize),
+		iovs:    make([]unix.Iovec, batchSize),
+		addrs:   make([]unix.RawSockaddrAny, batchSize),
+		buffers: make([][]byte, batchSize),
+	}
+}
+
+// read blocks until at least one datagram is received and returns the number
+// of datagrams read.
+func (b *batchReader) read(raw syscall.RawConn) (int, error) {
+	for i := range b.msgs {
+		if b.buffers[i] == nil {
+			b.buffers[i] = make([]byte, b.size)
+			b.iovs[i].Base = &b.buffers[i][0]
+			b.iovs[i].SetLen(b.size)
+		}
+		b.msgs[i] = mmsghdr{}
+		b.msgs[i].hdr.Name = (*byte)(unsafe.Pointer(&b.addrs[i]))
+		b.msgs[i].hdr.Namelen = unix.SizeofSockaddrAny
+		b.msgs[i].hdr.Iov = &b.iovs[i]
+		b.msgs[i].hdr.SetIovlen(1)
+	}
+
+	var n int
+	var errno syscall.Errno
+	err := raw.Read(func(fd uintptr) bool {
+		r, _, e := unix.Syscall6(unix.SYS_RECVMMSG, fd, uintptr(unsafe.Pointer(&b.msgs[0])), uintptr(len(b.msgs)), 0, 0, 0)
+		if e == unix.EAGAIN || e == unix.EWOULDBLOCK {
+			// Wait until the socket is readable.
+			return false
+		}
+		n, errno = int(r), e
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return n, nil
+}
+
+// message returns the data and metadata of the i-th datagram of the last
+// read.
+func (b *batchReader) message(i int) ([]byte, inputsource.NetworkMetadata) {
+	msg := b.msgs[i]
+	data := b.buffers[i][:msg.len]
+	b.buffers[i] = nil
+
+	metadata := inputsource.NetworkMetadata{
+		Truncated: msg.hdr.Flags&unix.MSG_TRUNC != 0,
+	}
+	if addr := sockaddrToUDPAddr(&b.addrs[i]); addr != nil {
+		metadata.RemoteAddr = addr
+	}
+	return data, metadata
+}
+
+func sockaddrToUDPAddr(rsa *unix.RawSockaddrAny) *net.UDPAddr {
+	switch rsa.Addr.Family {
+	case unix.AF_INET:
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, sa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: networkPort(sa.Port)}
+	case unix.AF_INET6:
+		sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, sa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: networkPort(sa.Port)}
+	}
+	return nil
+}
+
+// networkPort converts a port in network byte order.
+func networkPort(port uint16) int {
+	p := (*[2]byte)(unsafe.Pointer(&port))
+	return int(p[0])<<8 | int(p[1])
+}
@@ -18,6 +18,7 @@
 package udp
 
 import (
+	"errors"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
@@ -29,4 +30,22 @@ type Config struct {
 	MaxMessageSize cfgtype.ByteSize `config:"max_message_size" validate:"positive,nonzero"`
 	Timeout        time.Duration    `config:"timeout"`
 	ReadBuffer     cfgtype.ByteSize `config:"read_buffer" validate:"positive"`
+	Sockets        int              `config:"sockets" validate:"min=0"`
+	BatchSize      int              `config:"batch_size" validate:"min=0"`
+}
+
+// Validate validates the Config option for the udp input.
+func (c *Config) Validate() error {
+	if c.Sockets > 1 && !reusePortSupported {
+		return errors.New("sockets can only be greater than 1 on Linux")
+	}
+	return nil
+}
+
+// sockets returns the number of sockets bound to the host.
+func (c *Config) sockets() int {
+	if c.Sockets < 1 {
+		return 1
+	}
+	return c.Sockets
 }
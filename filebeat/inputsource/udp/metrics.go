@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package udp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// registryMu serializes replacing and removing the registries of the servers,
+// so a server only removes its registry if it wasn't replaced yet.
+var registryMu sync.Mutex
+
+// inputMetrics holds the metrics of a UDP server. The metrics are registered
+// in the dataset namespace, keyed by the address of the server.
+type inputMetrics struct {
+	id     string               // ID of the server's registry.
+	parent *monitoring.Registry // Parent registry holding the server's ID as a key.
+	reg    *monitoring.Registry // Registry of the server.
+
+	receivedPacketsTotal *monitoring.Uint // Number of datagrams received.
+	receivedBytesTotal   *monitoring.Uint // Number of bytes received.
+
+	mu     sync.Mutex
+	inodes []uint64 // Inodes of the server's sockets.
+}
+
+// socketStats are the kernel statistics of a set of UDP sockets.
+type socketStats struct {
+	receiveQueue uint64 // Number of bytes in the receive queues.
+	drops        uint64 // Number of datagrams dropped, because the receive queues were full.
+}
+
+func newInputMetrics(host string) *inputMetrics {
+	// Registry names are split on dots, which are part of IP addresses.
+	id := Name + "-" + strings.ReplaceAll(host, ".", "_")
+	parent := monitoring.GetNamespace("dataset").GetRegistry()
+
+	// A server restarted with the same host can start before the previous
+	// run removed its metrics. The registry of the previous run is replaced,
+	// and the previous run leaves the new registry in place when it is closed.
+	registryMu.Lock()
+	parent.Remove(id)
+	reg := parent.NewRegistry(id)
+	registryMu.Unlock()
+
+	monitoring.NewString(reg, "input").Set(Name)
+	monitoring.NewString(reg, "id").Set(id)
+	monitoring.NewString(reg, "host").Set(host)
+
+	m := &inputMetrics{
+		id:                   id,
+		parent:               parent,
+		reg:                  reg,
+		receivedPacketsTotal: monitoring.NewUint(reg, "received_packets_total"),
+		receivedBytesTotal:   monitoring.NewUint(reg, "received_bytes_total"),
+	}
+	if socketStatsSupported {
+		monitoring.NewFunc(reg, "system_packet_drops_total", m.socketStat(func(s socketStats) uint64 { return s.drops }))
+		monitoring.NewFunc(reg, "receive_queue_bytes_gauge", m.socketStat(func(s socketStats) uint64 { return s.receiveQueue }))
+	}
+	return m
+}
+
+// Close removes the metrics from the registry, unless they were already
+// replaced by the metrics of another run of the server.
+func (m *inputMetrics) Close() {
+	if m == nil {
+		return
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if m.parent.GetRegistry(m.id) == m.reg {
+		m.parent.Remove(m.id)
+	}
+}
+
+// addSocket adds a socket to the sockets whose kernel statistics are reported.
+func (m *inputMetrics) addSocket(conn *net.UDPConn) {
+	if !socketStatsSupported {
+		return
+	}
+	inode, err := socketInode(conn)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inodes = append(m.inodes, inode)
+}
+
+// socketStat returns a function reporting a statistic of the server's
+// sockets. The statistics are read when the metrics are collected.
+func (m *inputMetrics) socketStat(get func(socketStats) uint64) func(monitoring.Mode, monitoring.Visitor) {
+	return func(_ monitoring.Mode, v monitoring.Visitor) {
+		m.mu.Lock()
+		inodes := m.inodes
+		m.mu.Unlock()
+
+		stats, err := readSocketStats(inodes)
+		if err != nil {
+			v.OnInt(0)
+			return
+		}
+		v.OnInt(int64(get(stats)))
+	}
+}
+
+// readSocketStats reads the statistics of the sockets with the given inodes
+// from /proc/net/udp and /proc/net/udp6.
+func readSocketStats(inodes []uint64) (socketStats, error) {
+	var stats socketStats
+	for _, path := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return stats, err
+		}
+		err = parseProcNetUDP(f, inodes, &stats)
+		f.Close()
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// parseProcNetUDP adds the statistics of the sockets with the given inodes
+// from a /proc/net/udp table, where each socket is a line in the form:
+//
+//	sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ref pointer drops
+func parseProcNetUDP(r io.Reader, inodes []uint64, stats *socketStats) error {
+	scanner := bufio.NewScanner(r)
+	// Skip the header.
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil || !containsInode(inodes, inode) {
+			continue
+		}
+		if i := strings.IndexByte(fields[4], ':'); i >= 0 {
+			if queue, err := strconv.ParseUint(fields[4][i+1:], 16, 64); err == nil {
+				stats.receiveQueue += queue
+			}
+		}
+		if drops, err := strconv.ParseUint(fields[12], 10, 64); err == nil {
+			stats.drops += drops
+		}
+	}
+	return scanner.Err()
+}
+
+func containsInode(inodes []uint64, inode uint64) bool {
+	for _, i := range inodes {
+		if i == inode {
+			return true
+		}
+	}
+	return false
+}
@@ -18,9 +18,9 @@
 package udp
 
 import (
+	"context"
 	"net"
-
-	"github.com/dustin/go-humanize"
+	"sync"
 
 	"github.com/elastic/beats/v7/filebeat/inputsource"
 	"github.com/elastic/beats/v7/filebeat/inputsource/common/dgram"
@@ -31,43 +31,93 @@ import (
 const Name = "udp"
 
 // Server creates a simple UDP Server and listen to a specific host:port and will send any
-// event received to the callback method.
+// event received to the callback method. With more than one socket, the sockets are bound
+// to the same host:port with SO_REUSEPORT and each socket has its own reader.
 type Server struct {
-	*dgram.Listener
-	config *Config
+	config    *Config
+	callback  inputsource.NetworkFunc
+	listeners []*dgram.Listener
+	metrics   *inputMetrics
 
+	mu           sync.Mutex
 	localaddress string
 }
 
 // New returns a new UDPServer instance.
 func New(config *Config, callback inputsource.NetworkFunc) *Server {
-	server := &Server{config: config}
+	server := &Server{config: config, callback: callback}
 	log := logp.NewLogger("udp").With("address", config.Host)
-	factory := dgram.DatagramReaderFactory(inputsource.FamilyUDP, log, callback)
-	server.Listener = dgram.NewListener(inputsource.FamilyUDP, config.Host, factory, server.createConn, &dgram.ListenerConfig{
-		Timeout:        config.Timeout,
-		MaxMessageSize: config.MaxMessageSize,
-	})
+
+	factory := dgram.DatagramReaderFactory(inputsource.FamilyUDP, log, server.receive)
+	if config.BatchSize > 1 && batchSupported {
+		factory = batchReaderFactory(log, server.receive, config.BatchSize)
+	}
+	for i := 0; i < config.sockets(); i++ {
+		server.listeners = append(server.listeners, dgram.NewListener(inputsource.FamilyUDP, config.Host, factory, server.createConn, &dgram.ListenerConfig{
+			Timeout:        config.Timeout,
+			MaxMessageSize: config.MaxMessageSize,
+		}))
+	}
 	return server
 }
 
+// Start binds the sockets and starts reading from them.
+func (u *Server) Start() error {
+	u.metrics = newInputMetrics(u.config.Host)
+	for i, l := range u.listeners {
+		if err := l.Start(); err != nil {
+			for _, started := range u.listeners[:i] {
+				started.Stop()
+			}
+			u.metrics.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops reading and closes the sockets.
+func (u *Server) Stop() {
+	for _, l := range u.listeners {
+		l.Stop()
+	}
+	u.metrics.Close()
+}
+
+func (u *Server) receive(data []byte, metadata inputsource.NetworkMetadata) {
+	u.metrics.receivedPacketsTotal.Inc()
+	u.metrics.receivedBytesTotal.Add(uint64(len(data)))
+	u.callback(data, metadata)
+}
+
 func (u *Server) createConn() (net.PacketConn, error) {
-	var err error
-	udpAdddr, err := net.ResolveUDPAddr("udp", u.config.Host)
-	if err != nil {
-		return nil, err
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var lc net.ListenConfig
+	address := u.config.Host
+	if u.config.sockets() > 1 {
+		lc.Control = reusePortControl
+		// The sockets are bound to the address of the first socket, which
+		// has the port chosen by the system if the configured port is 0.
+		if u.localaddress != "" {
+			address = u.localaddress
+		}
 	}
-	listener, err := net.ListenUDP("udp", udpAdddr)
+	conn, err := lc.ListenPacket(context.Background(), "udp", address)
 	if err != nil {
 		return nil, err
 	}
-	socketSize := int(u.config.ReadBuffer) * humanize.KiByte
-	if socketSize != 0 {
+	listener := conn.(*net.UDPConn)
+
+	if u.config.ReadBuffer != 0 {
 		if err := listener.SetReadBuffer(int(u.config.ReadBuffer)); err != nil {
+			listener.Close()
 			return nil, err
 		}
 	}
 	u.localaddress = listener.LocalAddr().String()
+	u.metrics.addSocket(listener)
 
-	return listener, err
+	return listener, nil
 }
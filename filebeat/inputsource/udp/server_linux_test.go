@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package udp
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/filebeat/inputsource"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+func TestReceiveEventsWithReusePortAndBatches(t *testing.T) {
+	const senders, messages = 8, 20
+
+	ch := make(chan info, senders*messages)
+	config := &Config{
+		Host:           "localhost:0",
+		MaxMessageSize: maxMessageSize,
+		Timeout:        timeout,
+		ReadBuffer:     1 << 20,
+		Sockets:        4,
+		BatchSize:      16,
+	}
+	require.NoError(t, config.Validate())
+	s := New(config, func(message []byte, metadata inputsource.NetworkMetadata) {
+		ch <- info{message: message, mt: metadata}
+	})
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	// Datagrams of different senders are distributed between the sockets.
+	for i := 0; i < senders; i++ {
+		conn, err := net.Dial("udp", s.localaddress)
+		require.NoError(t, err)
+		defer conn.Close()
+		for j := 0; j < messages; j++ {
+			_, err := fmt.Fprintf(conn, "message %d-%d", i, j)
+			require.NoError(t, err)
+		}
+	}
+	// Datagrams larger than the buffer are truncated.
+	conn, err := net.Dial("udp", s.localaddress)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("Hello world not so nice"))
+	require.NoError(t, err)
+
+	received := map[string]bool{}
+	var truncated info
+	for len(received) < senders*messages || truncated.message == nil {
+		select {
+		case info := <-ch:
+			require.NotNil(t, info.mt.RemoteAddr)
+			if info.mt.Truncated {
+				truncated = info
+			} else {
+				received[string(info.message)] = true
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for messages, received %d", len(received))
+		}
+	}
+	assert.Equal(t, "Hello world not so n", string(truncated.message))
+	assert.Equal(t, conn.LocalAddr().String(), truncated.mt.RemoteAddr.String())
+
+	snapshot := monitoring.CollectFlatSnapshot(
+		monitoring.GetNamespace("dataset").GetRegistry().GetRegistry("udp-localhost:0"),
+		monitoring.Full, false)
+	assert.Equal(t, int64(senders*messages+1), snapshot.Ints["received_packets_total"])
+	assert.Contains(t, snapshot.Ints, "system_packet_drops_total")
+	assert.Contains(t, snapshot.Ints, "receive_queue_bytes_gauge")
+
+	inodes := s.metrics.inodes
+	assert.Len(t, inodes, config.Sockets)
+	_, err = readSocketStats(inodes)
+	assert.NoError(t, err)
+}
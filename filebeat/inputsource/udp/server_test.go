@@ -20,6 +20,7 @@ package udp
 import (
 	"net"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -102,3 +103,28 @@ func TestReceiveEventFromUDP(t *testing.T) {
 		})
 	}
 }
+
+func TestParseProcNetUDP(t *testing.T) {
+	table := `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  123: 00000000:0202 00000000:0000 07 00000000:00000A00 00:00000000 00000000     0        0 1001 2 0000000000000000 42
+  124: 00000000:0202 00000000:0000 07 00000000:00000100 00:00000000 00000000     0        0 1002 2 0000000000000000 8
+  125: 0100007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 2001 2 0000000000000000 100
+`
+	var stats socketStats
+	err := parseProcNetUDP(strings.NewReader(table), []uint64{1001, 1002}, &stats)
+	assert.NoError(t, err)
+	assert.Equal(t, socketStats{receiveQueue: 0xa00 + 0x100, drops: 50}, stats)
+}
+
+func TestInputMetricsRestart(t *testing.T) {
+	const host = "127.0.0.1:5514"
+	previous := newInputMetrics(host)
+	current := newInputMetrics(host)
+
+	previous.Close()
+	assert.Same(t, current.reg, current.parent.GetRegistry(current.id),
+		"the previous run must not remove the metrics of the current run")
+
+	current.Close()
+	assert.Nil(t, current.parent.GetRegistry(current.id))
+}
@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package udp
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	reusePortSupported   = true
+	socketStatsSupported = true
+)
+
+// reusePortControl sets SO_REUSEPORT on a socket before it is bound, so that
+// several sockets can be bound to the same address. The kernel distributes
+// the datagrams between the sockets by the address of the sender.
+func reusePortControl(_, _ string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// socketInode returns the inode of a socket, which identifies the socket in
+// /proc/net/udp.
+func socketInode(conn *net.UDPConn) (uint64, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var stat unix.Stat_t
+	var statErr error
+	err = raw.Control(func(fd uintptr) {
+		statErr = unix.Fstat(int(fd), &stat)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return stat.Ino, statErr
+}
@@ -0,0 +1,51 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !linux
+// +build !linux
+
+package udp
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/elastic/beats/v7/filebeat/inputsource"
+	"github.com/elastic/beats/v7/filebeat/inputsource/common/dgram"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const (
+	reusePortSupported   = false
+	socketStatsSupported = false
+	batchSupported       = false
+)
+
+var errNotSupported = errors.New("not supported on this platform")
+
+func reusePortControl(_, _ string, _ syscall.RawConn) error {
+	return errNotSupported
+}
+
+func socketInode(_ *net.UDPConn) (uint64, error) {
+	return 0, errNotSupported
+}
+
+func batchReaderFactory(_ *logp.Logger, _ inputsource.NetworkFunc, _ int) dgram.HandlerFactory {
+	return nil
+}
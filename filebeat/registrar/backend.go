@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registrar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/beats/v7/filebeat/config"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/paths"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/boltdb"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+)
+
+// NewBackend creates the statestore backend configured for the registry.
+// If the boltdb backend is used and a memlog store with the given name
+// exists, the memlog store is migrated into the boltdb store the first time
+// the store is accessed.
+func NewBackend(logger *logp.Logger, cfg config.Registry, storeName string) (backend.Registry, error) {
+	root := paths.Resolve(paths.Data, cfg.Path)
+
+	newMemlog := func() (*memlog.Registry, error) {
+		return memlog.New(logger, memlog.Settings{
+			Root:     root,
+			FileMode: cfg.Permissions,
+		})
+	}
+
+	switch cfg.Backend {
+	case "", "memlog":
+		return newMemlog()
+	case "boltdb":
+		settings := boltdb.Settings{
+			Root:     root,
+			FileMode: cfg.Permissions,
+		}
+
+		if _, err := os.Stat(filepath.Join(root, storeName, "meta.json")); err == nil {
+			settings.MigrateFrom, err = newMemlog()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return boltdb.New(logger, settings)
+	default:
+		return nil, fmt.Errorf("unknown registry backend: %s", cfg.Backend)
+	}
+}
@@ -0,0 +1,291 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registrar
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elastic/beats/v7/filebeat/config"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+)
+
+// filestreamPrefix is the prefix of the registry keys of the filestream input.
+// The keys have the format `filestream::<input ID>::<source name>`.
+const filestreamPrefix = "filestream::"
+
+// Editor provides offline access to the filebeat registry. It must only be
+// used while no filebeat instance is running on the same data path.
+type Editor struct {
+	registry backend.Registry
+	store    backend.Store
+}
+
+// Entry is a single key-value pair in the registry.
+type Entry struct {
+	Key   string        `json:"key"`
+	Value common.MapStr `json:"value"`
+}
+
+// EntryFilter selects registry entries by filestream input ID and by a glob
+// pattern matched against the path of the file.
+type EntryFilter struct {
+	InputID string
+	Path    string
+}
+
+// OpenEditor opens the registry store with the given name, the store name of
+// filebeat is the name of the beat.
+func OpenEditor(cfg config.Registry, storeName string) (*Editor, error) {
+	registry, err := NewBackend(logp.NewLogger("registry"), cfg, storeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry: %w", err)
+	}
+
+	store, err := registry.Access(storeName)
+	if err != nil {
+		registry.Close()
+		return nil, fmt.Errorf("failed to open registry store '%s': %w", storeName, err)
+	}
+
+	return &Editor{registry: registry, store: store}, nil
+}
+
+// Close closes the registry.
+func (e *Editor) Close() error {
+	if err := e.store.Close(); err != nil {
+		e.registry.Close()
+		return err
+	}
+	return e.registry.Close()
+}
+
+// List returns all entries matching the filter ordered by key.
+func (e *Editor) List(filter EntryFilter) ([]Entry, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	err := e.store.Each(func(key string, dec backend.ValueDecoder) (bool, error) {
+		var value common.MapStr
+		if err := dec.Decode(&value); err != nil {
+			return false, fmt.Errorf("failed to decode registry entry '%s': %w", key, err)
+		}
+
+		entry := Entry{Key: key, Value: value}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Export writes all entries matching the filter as NDJSON to w and returns
+// the number of entries written.
+func (e *Editor) Export(w io.Writer, filter EntryFilter) (int, error) {
+	entries, err := e.List(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	enc := json.NewEncoder(w)
+	for i, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return i, fmt.Errorf("failed to export registry entry '%s': %w", entry.Key, err)
+		}
+	}
+	return len(entries), nil
+}
+
+// Import reads NDJSON encoded entries from r and adds them to the registry.
+// Existing entries with the same key are overwritten. Import returns the
+// number of entries imported.
+func (e *Editor) Import(r io.Reader) (int, error) {
+	var entries []Entry
+
+	// decode all entries before modifying the registry, such that a broken
+	// file does not leave the registry partially imported.
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return 0, fmt.Errorf("failed to decode line %d: %w", line, err)
+		}
+		if entry.Key == "" {
+			return 0, fmt.Errorf("missing key on line %d", line)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read import file: %w", err)
+	}
+
+	for i, entry := range entries {
+		if err := e.store.Set(entry.Key, entry.Value); err != nil {
+			return i, fmt.Errorf("failed to import registry entry '%s': %w", entry.Key, err)
+		}
+	}
+	return len(entries), nil
+}
+
+// SetOffset sets the read offset of all file entries matching the filter
+// and returns the keys of the updated entries. An offset of 0 makes the
+// input read the files from the beginning again.
+func (e *Editor) SetOffset(filter EntryFilter, offset int64) ([]string, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative: %d", offset)
+	}
+
+	entries, err := e.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []string
+	for _, entry := range entries {
+		if !entry.setOffset(offset) {
+			continue
+		}
+		if err := e.store.Set(entry.Key, entry.Value); err != nil {
+			return updated, fmt.Errorf("failed to update registry entry '%s': %w", entry.Key, err)
+		}
+		updated = append(updated, entry.Key)
+	}
+	return updated, nil
+}
+
+// Compact writes a new checkpoint of the registry and removes the
+// operations log.
+func (e *Editor) Compact() error {
+	checkpointer, ok := e.store.(interface{ Checkpoint() error })
+	if !ok {
+		return fmt.Errorf("the registry backend does not support compaction")
+	}
+	return checkpointer.Checkpoint()
+}
+
+// Validate checks that the path pattern of the filter is valid.
+func (f EntryFilter) Validate() error {
+	if f.Path == "" {
+		return nil
+	}
+	if _, err := filepath.Match(f.Path, ""); err != nil {
+		return fmt.Errorf("invalid path pattern '%s': %w", f.Path, err)
+	}
+	return nil
+}
+
+// Match returns true if the entry matches all conditions of the filter.
+func (f EntryFilter) Match(entry Entry) bool {
+	if f.InputID != "" && entry.InputID() != f.InputID {
+		return false
+	}
+	if f.Path != "" {
+		ok, _ := filepath.Match(f.Path, entry.Path())
+		return ok
+	}
+	return true
+}
+
+// InputID returns the ID of the filestream input that owns the entry. The
+// ID is empty for entries of other inputs.
+func (e Entry) InputID() string {
+	if !strings.HasPrefix(e.Key, filestreamPrefix) {
+		return ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(e.Key, filestreamPrefix), "::", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+// Path returns the path of the file the entry belongs to. Entries of the
+// filestream input store it in the metadata, the log input stores it in
+// the state itself.
+func (e Entry) Path() string {
+	for _, key := range []string{"meta.source", "source"} {
+		if v, err := e.Value.GetValue(key); err == nil {
+			if s, ok := v.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Offset returns the read offset of the file the entry belongs to.
+func (e Entry) Offset() (int64, bool) {
+	key := e.offsetKey()
+	if key == "" {
+		return 0, false
+	}
+	v, _ := e.Value.GetValue(key)
+	switch offset := v.(type) {
+	case int:
+		return int64(offset), true
+	case int64:
+		return offset, true
+	case uint64:
+		return int64(offset), true
+	case float64:
+		return int64(offset), true
+	case json.Number:
+		n, err := offset.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func (e Entry) setOffset(offset int64) bool {
+	key := e.offsetKey()
+	if key == "" {
+		return false
+	}
+	_, err := e.Value.Put(key, offset)
+	return err == nil
+}
+
+func (e Entry) offsetKey() string {
+	for _, key := range []string{"cursor.offset", "offset"} {
+		if ok, _ := e.Value.HasKey(key); ok {
+			return key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registrar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/filebeat/config"
+)
+
+func TestEditor(t *testing.T) {
+	for _, backend := range []string{"memlog", "boltdb"} {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			testEditor(t, backend)
+		})
+	}
+}
+
+func testEditor(t *testing.T, backend string) {
+	cfg := config.DefaultConfig.Registry
+	cfg.Path = t.TempDir()
+	cfg.Backend = backend
+
+	editor, err := OpenEditor(cfg, "filebeat")
+	require.NoError(t, err)
+
+	imported, err := editor.Import(strings.NewReader(`
+{"key":"filestream::my-id::native::1-2","value":{"ttl":-1,"cursor":{"offset":42},"meta":{"source":"/var/log/app/a.log","identifier_name":"native"}}}
+{"key":"filestream::other::native::3-4","value":{"ttl":-1,"cursor":{"offset":7},"meta":{"source":"/var/log/app/b.log","identifier_name":"native"}}}
+{"key":"filebeat::logs::native::5-6","value":{"source":"/var/log/syslog","offset":100}}
+`))
+	require.NoError(t, err)
+	require.Equal(t, 3, imported)
+
+	t.Run("list filtered by input ID", func(t *testing.T) {
+		entries, err := editor.List(EntryFilter{InputID: "my-id"})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "my-id", entries[0].InputID())
+		require.Equal(t, "/var/log/app/a.log", entries[0].Path())
+		offset, ok := entries[0].Offset()
+		require.True(t, ok)
+		require.EqualValues(t, 42, offset)
+	})
+
+	t.Run("list filtered by path", func(t *testing.T) {
+		entries, err := editor.List(EntryFilter{Path: "/var/log/*"})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "filebeat::logs::native::5-6", entries[0].Key)
+		require.Equal(t, "", entries[0].InputID())
+	})
+
+	t.Run("set offset", func(t *testing.T) {
+		keys, err := editor.SetOffset(EntryFilter{Path: "/var/log/app/*.log"}, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"filestream::my-id::native::1-2", "filestream::other::native::3-4"}, keys)
+
+		entries, err := editor.List(EntryFilter{Path: "/var/log/app/*.log"})
+		require.NoError(t, err)
+		for _, entry := range entries {
+			offset, ok := entry.Offset()
+			require.True(t, ok)
+			require.EqualValues(t, 0, offset)
+		}
+	})
+
+	t.Run("invalid import keeps registry unchanged", func(t *testing.T) {
+		_, err := editor.Import(strings.NewReader(`{"key":"new","value":{}}` + "\n{broken"))
+		require.Error(t, err)
+
+		entries, err := editor.List(EntryFilter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+	})
+
+	if backend == "memlog" {
+		require.NoError(t, editor.Compact())
+	}
+	require.NoError(t, editor.Close())
+
+	// the changes must survive reopening the registry
+	editor, err = OpenEditor(cfg, "filebeat")
+	require.NoError(t, err)
+	defer editor.Close()
+
+	var buf bytes.Buffer
+	n, err := editor.Export(&buf, EntryFilter{InputID: "other"})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	exported, err := editor.List(EntryFilter{InputID: "other"})
+	require.NoError(t, err)
+	offset, ok := exported[0].Offset()
+	require.True(t, ok)
+	require.EqualValues(t, 0, offset)
+	require.Contains(t, buf.String(), `"key":"filestream::other::native::3-4"`)
+}
@@ -28,18 +28,23 @@ import (
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_locale"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_observer_metadata"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_process_metadata"
+	_ "github.com/elastic/beats/v7/libbeat/processors/aggregate"
 	_ "github.com/elastic/beats/v7/libbeat/processors/communityid"
 	_ "github.com/elastic/beats/v7/libbeat/processors/convert"
 	_ "github.com/elastic/beats/v7/libbeat/processors/decode_xml"
 	_ "github.com/elastic/beats/v7/libbeat/processors/decode_xml_wineventlog"
 	_ "github.com/elastic/beats/v7/libbeat/processors/dissect"
 	_ "github.com/elastic/beats/v7/libbeat/processors/dns"
+	_ "github.com/elastic/beats/v7/libbeat/processors/enrich"
 	_ "github.com/elastic/beats/v7/libbeat/processors/extract_array"
 	_ "github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	_ "github.com/elastic/beats/v7/libbeat/processors/grok"
+	_ "github.com/elastic/beats/v7/libbeat/processors/join_traces"
 	_ "github.com/elastic/beats/v7/libbeat/processors/parse_filebeat_log"
 	_ "github.com/elastic/beats/v7/libbeat/processors/parse_serverlog"
 	_ "github.com/elastic/beats/v7/libbeat/processors/parse_vehicle_trace2trace"
 	_ "github.com/elastic/beats/v7/libbeat/processors/ratelimit"
+	_ "github.com/elastic/beats/v7/libbeat/processors/redact"
 	_ "github.com/elastic/beats/v7/libbeat/processors/registered_domain"
 	_ "github.com/elastic/beats/v7/libbeat/processors/translate_sid"
 	_ "github.com/elastic/beats/v7/libbeat/processors/urldecode"
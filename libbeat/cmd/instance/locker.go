@@ -44,6 +44,17 @@ func newLocker(b *Beat) *locker {
 	}
 }
 
+// LockDataPath acquires the lock on the data path of the Beat, such that
+// commands modifying the data path can not run next to a Beat instance using
+// the same data path. The returned function releases the lock.
+func LockDataPath(b *Beat) (func() error, error) {
+	l := newLocker(b)
+	if err := l.lock(); err != nil {
+		return nil, err
+	}
+	return l.unlock, nil
+}
+
 // lock attempts to acquire a lock on the data path for the currently-running
 // Beat instance. If another Beats instance already has a lock on the same data path
 // an ErrAlreadyLocked error is returned.
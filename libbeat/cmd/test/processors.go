@@ -0,0 +1,249 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/testing"
+)
+
+// processorsFixture is a file of test cases for a list of processors. If the
+// fixture has no processors, the global processors of the configuration are
+// tested.
+type processorsFixture struct {
+	Processors processors.PluginConfig `config:"processors"`
+	Tests      []processorsTestCase    `config:"tests" validate:"required"`
+}
+
+type processorsTestCase struct {
+	Name     string        `config:"name"`
+	Input    common.MapStr `config:"input" validate:"required"`
+	Expected common.MapStr `config:"expected"`
+	Dropped  bool          `config:"dropped"`
+	Error    string        `config:"error"`
+}
+
+func (c *processorsTestCase) Validate() error {
+	if c.Dropped == (c.Expected != nil) {
+		return errors.New("one of expected or dropped must be set")
+	}
+	return nil
+}
+
+func GenTestProcessorsCmd(settings instance.Settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "processors [fixture files]",
+		Short: "Test the processors of the configuration",
+		Long: "Test the processors of the configuration. Loading the processors runs the test() " +
+			"function of script processors. Fixture files define input events and the events " +
+			"expected after processing, and optionally the processors to test.",
+		Run: func(cmd *cobra.Command, args []string) {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error initializing beat: %s\n", err)
+				os.Exit(1)
+			}
+
+			var config struct {
+				Processors processors.PluginConfig `config:"processors"`
+			}
+			if err := b.RawConfig.Unpack(&config); err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading processors: %s\n", err)
+				os.Exit(1)
+			}
+
+			if !testProcessors(testing.NewConsoleDriver(os.Stdout), config.Processors, args) {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// testProcessors loads the global processors and runs the test cases of the
+// fixture files. It returns false if any of the tests failed.
+func testProcessors(d testing.Driver, global processors.PluginConfig, files []string) bool {
+	passed := true
+	check := func(d testing.Driver, name string, err error) bool {
+		d.Error(name, err)
+		passed = passed && err == nil
+		return err == nil
+	}
+
+	d.Run("processors", func(d testing.Driver) {
+		procs, err := processors.New(global)
+		if check(d, "load", err) {
+			d.Info("count", strconv.Itoa(len(procs.List)))
+			procs.Close()
+		}
+	})
+
+	for _, file := range files {
+		d.Run(file, func(d testing.Driver) {
+			var fixture processorsFixture
+			cfg, err := common.LoadFile(file)
+			if err == nil {
+				err = cfg.Unpack(&fixture)
+			}
+			if !check(d, "load fixture", err) {
+				return
+			}
+
+			config := fixture.Processors
+			if config == nil {
+				config = global
+			}
+			procs, err := processors.New(config)
+			if !check(d, "load processors", err) {
+				return
+			}
+			defer procs.Close()
+
+			for i, tc := range fixture.Tests {
+				name := tc.Name
+				if name == "" {
+					name = "test " + strconv.Itoa(i+1)
+				}
+				check(d, name, runProcessorsTestCase(procs, tc))
+			}
+		})
+	}
+	return passed
+}
+
+func runProcessorsTestCase(procs *processors.Processors, tc processorsTestCase) error {
+	event, err := newFixtureEvent(tc.Input)
+	if err != nil {
+		return err
+	}
+
+	event, err = procs.Run(event)
+	switch {
+	case tc.Error == "" && err != nil:
+		return err
+	case tc.Error != "" && err == nil:
+		return errors.Errorf("expected error %q", tc.Error)
+	case tc.Error != "" && !strings.Contains(err.Error(), tc.Error):
+		return errors.Errorf("expected error %q, got %q", tc.Error, err)
+	}
+
+	if tc.Dropped {
+		if event != nil {
+			return errors.Errorf("expected event to be dropped, got %v", event.Fields.StringToPrint())
+		}
+		return nil
+	}
+	if event == nil {
+		return errors.New("event was dropped")
+	}
+
+	actual := event.Fields.Clone()
+	if _, found := tc.Expected["@timestamp"]; found {
+		actual["@timestamp"] = common.Time(event.Timestamp)
+	}
+	if _, found := tc.Expected["@metadata"]; found && event.Meta != nil {
+		actual["@metadata"] = event.Meta
+	}
+
+	equal, err := jsonEqual(tc.Expected, actual)
+	if err != nil {
+		return err
+	}
+	if !equal {
+		return errors.Errorf("unexpected event\nexpected: %v\nactual: %v",
+			tc.Expected.StringToPrint(), actual.StringToPrint())
+	}
+	return nil
+}
+
+// newFixtureEvent creates an event from the input of a test case. The
+// @timestamp and @metadata fields of the input are set as the timestamp and
+// metadata of the event.
+func newFixtureEvent(input common.MapStr) (*beat.Event, error) {
+	event := &beat.Event{Timestamp: time.Now(), Fields: input.Clone()}
+
+	if v, found := event.Fields["@timestamp"]; found {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("@timestamp must be a string, got %T", v)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse @timestamp")
+		}
+		event.Timestamp = ts
+		delete(event.Fields, "@timestamp")
+	}
+
+	if v, found := event.Fields["@metadata"]; found {
+		meta, ok := tryToMapStr(v)
+		if !ok {
+			return nil, errors.Errorf("@metadata must be an object, got %T", v)
+		}
+		event.Meta = meta
+		delete(event.Fields, "@metadata")
+	}
+	return event, nil
+}
+
+func tryToMapStr(v interface{}) (common.MapStr, bool) {
+	switch m := v.(type) {
+	case common.MapStr:
+		return m, true
+	case map[string]interface{}:
+		return common.MapStr(m), true
+	}
+	return nil, false
+}
+
+// jsonEqual compares the JSON encoding of the values, so that numbers of
+// different types and values of different map types are equal.
+func jsonEqual(a, b interface{}) (bool, error) {
+	normalize := func(v interface{}) (interface{}, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var out interface{}
+		err = json.Unmarshal(data, &out)
+		return out, err
+	}
+
+	na, err := normalize(a)
+	if err != nil {
+		return false, err
+	}
+	nb, err := normalize(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(na, nb), nil
+}
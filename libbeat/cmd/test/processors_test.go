@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	_ "github.com/elastic/beats/v7/libbeat/processors/script"
+	libtesting "github.com/elastic/beats/v7/libbeat/testing"
+)
+
+const processorsScript = `
+function process(evt) {
+	const level = evt.Get("level");
+	if (level === "debug") {
+		evt.Cancel();
+		return;
+	}
+	if (level === undefined || level === null) {
+		throw "missing level";
+	}
+	evt.Put("log.level", level.toUpperCase());
+	evt.Delete("level");
+}
+
+function test() {
+	const evt = new Event({level: "info"});
+	process(evt);
+	if (evt.Get("log.level") !== "INFO") {
+		throw "unexpected level " + evt.Get("log.level");
+	}
+}
+`
+
+const processorsFixtureYAML = `
+tests:
+  - name: uppercases level
+    input:
+      "@timestamp": "2021-02-03T04:05:06.789Z"
+      level: warn
+      count: 1
+    expected:
+      "@timestamp": "2021-02-03T04:05:06.789Z"
+      log.level: WARN
+      count: 1
+  - name: drops debug
+    input: {level: debug}
+    dropped: true
+  - name: fails without level
+    input: {message: hello}
+    expected: {message: hello, tags: [_js_exception], error.message: "missing level at process (inline.js:9:3(24))"}
+    error: missing level
+  - name: wrong expectation
+    input: {level: error}
+    expected: {log.level: error}
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func scriptProcessors(t *testing.T, source string) processors.PluginConfig {
+	t.Helper()
+	return processors.PluginConfig{common.MustNewConfigFrom(common.MapStr{
+		"script": common.MapStr{"lang": "javascript", "source": source},
+	})}
+}
+
+func runTestProcessors(global processors.PluginConfig, files ...string) (bool, string) {
+	var out bytes.Buffer
+	d := libtesting.NewConsoleDriverWithKiller(&out, func() {})
+	passed := testProcessors(d, global, files)
+	return passed, out.String()
+}
+
+func TestTestProcessorsFixtures(t *testing.T) {
+
+	fixture := writeFile(t, "fixture.yml", processorsFixtureYAML)
+	passed, out := runTestProcessors(scriptProcessors(t, processorsScript), fixture)
+
+	assert.False(t, passed, out)
+	assert.Contains(t, out, "uppercases level... OK")
+	assert.Contains(t, out, "drops debug... OK")
+	assert.Contains(t, out, "wrong expectation... ERROR unexpected event")
+}
+
+func TestTestProcessorsScriptTestFunction(t *testing.T) {
+	passed, out := runTestProcessors(scriptProcessors(t, processorsScript))
+	assert.True(t, passed, out)
+	assert.Contains(t, out, "load... OK")
+
+	broken := processorsScript + `test = function() { throw "broken"; };`
+	passed, out = runTestProcessors(scriptProcessors(t, broken))
+	assert.False(t, passed, out)
+	assert.Contains(t, out, "broken")
+}
+
+func TestTestProcessorsFixtureProcessors(t *testing.T) {
+
+	fixture := writeFile(t, "fixture.yml", `
+processors:
+  - script:
+      lang: javascript
+      source: "function process(evt) { evt.Put('greeting', 'hello ' + evt.Get('name')); }"
+tests:
+  - input: {name: world}
+    expected: {name: world, greeting: hello world}
+`)
+	passed, out := runTestProcessors(nil, fixture)
+	assert.True(t, passed, out)
+	assert.Contains(t, out, "test 1... OK")
+
+	invalid := writeFile(t, "invalid.yml", `
+tests:
+  - input: {name: world}
+`)
+	passed, out = runTestProcessors(nil, invalid)
+	assert.False(t, passed, out)
+	assert.Contains(t, out, "load fixture... ERROR")
+}
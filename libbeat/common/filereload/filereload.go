@@ -0,0 +1,122 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package filereload keeps a value loaded from a file up to date with the
+// file.
+package filereload
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadFunc loads the value from the file at path.
+type LoadFunc func(path string) (interface{}, error)
+
+// File holds the value loaded from a file. The file is checked for changes at
+// most once per reload period when the value is accessed, and reloaded in the
+// background if its size or modification time changed. The previous value is
+// kept if the file can not be loaded.
+type File struct {
+	path    string
+	period  time.Duration
+	load    LoadFunc
+	onError func(error)
+
+	value     atomic.Value
+	nextCheck int64 // Unix time in nanoseconds.
+	reloading int32 // 1 while a background reload is running.
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// New loads the file and returns the File holding its value. A period of 0
+// disables reloading. Errors of background reloads are passed to onError.
+func New(path string, period time.Duration, load LoadFunc, onError func(error)) (*File, error) {
+	f := &File{
+		path:    path,
+		period:  period,
+		load:    load,
+		onError: onError,
+	}
+	if _, err := f.check(); err != nil {
+		return nil, err
+	}
+	atomic.StoreInt64(&f.nextCheck, time.Now().Add(period).UnixNano())
+	return f, nil
+}
+
+// Get returns the current value. If the reload period passed, the file is
+// checked for changes in the background and the current value is returned
+// until the new one is loaded.
+func (f *File) Get() interface{} {
+	if f.period > 0 {
+		now := time.Now().UnixNano()
+		next := atomic.LoadInt64(&f.nextCheck)
+		if now >= next && atomic.CompareAndSwapInt64(&f.nextCheck, next, now+int64(f.period)) &&
+			atomic.CompareAndSwapInt32(&f.reloading, 0, 1) {
+			go func() {
+				defer atomic.StoreInt32(&f.reloading, 0)
+				f.Reload()
+			}()
+		}
+	}
+	return f.value.Load()
+}
+
+// Reload loads the file if it changed since it was last loaded. It reports
+// whether a new value was loaded. Errors are also passed to the error handler.
+func (f *File) Reload() (bool, error) {
+	loaded, err := f.check()
+	if err != nil && f.onError != nil {
+		f.onError(err)
+	}
+	return loaded, err
+}
+
+// check loads the file if it changed since it was last loaded.
+func (f *File) check() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat file %s: %w", f.path, err)
+	}
+	if f.value.Load() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	v, err := f.load(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	f.value.Store(v)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return true, nil
+}
+
+func (f *File) String() string {
+	return "file:" + f.path
+}
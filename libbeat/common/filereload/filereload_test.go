@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filereload
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile writes a file and moves its modification time forward, so a
+// change is detected on file systems with a coarse time resolution.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0o600))
+	mtime := time.Now().Add(time.Duration(len(content)) * time.Hour)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+}
+
+func readFile(path string) (interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, errors.New("empty file")
+	}
+	return string(content), nil
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "value.txt")
+	writeFile(t, path, "a")
+
+	var loads, errs int32
+	load := func(path string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return readFile(path)
+	}
+	f, err := New(path, time.Nanosecond, load, func(error) { atomic.AddInt32(&errs, 1) })
+	require.NoError(t, err)
+	assert.Equal(t, "a", f.Get())
+
+	writeFile(t, path, "bb")
+	assert.Eventually(t, func() bool { return f.Get() == "bb" }, time.Second, time.Millisecond,
+		"the file must be reloaded in the background")
+
+	loaded, err := f.Reload()
+	require.NoError(t, err)
+	assert.False(t, loaded, "unchanged files must not be reloaded")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+
+	writeFile(t, path, "")
+	assert.Eventually(t, func() bool {
+		f.Get()
+		return atomic.LoadInt32(&errs) > 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "bb", f.Get(), "the previous value must be kept")
+}
+
+func TestFileNoReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "value.txt")
+	writeFile(t, path, "a")
+
+	f, err := New(path, 0, readFile, nil)
+	require.NoError(t, err)
+
+	writeFile(t, path, "bb")
+	assert.Never(t, func() bool { return f.Get() != "a" }, 50*time.Millisecond, time.Millisecond)
+}
+
+func TestFileErrors(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.txt"), time.Second, readFile, nil)
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "value.txt")
+	writeFile(t, path, "")
+	_, err = New(path, time.Second, readFile, nil)
+	assert.Error(t, err)
+}
@@ -18,6 +18,10 @@
 package conditions
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -112,3 +116,101 @@ func BenchmarkCombinedCondition(b *testing.B) {
 		cond.Check(event)
 	}
 }
+
+func BenchmarkExprCondition(b *testing.B) {
+	// Same logic as BenchmarkCombinedCondition.
+	config := Config{
+		Expr: `(http.code >= 100 and http.code < 300) or (status == 200 and type == "http")`,
+	}
+
+	benchmarkCondition(b, &config, httpResponseTestEvent)
+}
+
+func BenchmarkRangeNumericStringCondition(b *testing.B) {
+	config := Config{
+		Range: &Fields{fields: map[string]interface{}{
+			"duration_ms.gte": 100,
+			"duration_ms.lt":  300,
+		}},
+	}
+
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: common.MapStr{
+			"duration_ms": "231.7",
+		},
+	}
+
+	benchmarkCondition(b, &config, event)
+}
+
+func BenchmarkInCondition(b *testing.B) {
+	config := Config{
+		In: map[string]interface{}{
+			"method": []interface{}{"POST", "PUT", "PATCH", "DELETE", "GET"},
+			"http": map[string]interface{}{
+				"code": []interface{}{200, 201, 204},
+			},
+		},
+	}
+
+	benchmarkCondition(b, &config, httpResponseTestEvent)
+}
+
+func BenchmarkInFileCondition(b *testing.B) {
+	var values []string
+	for i := 0; i < 100000; i++ {
+		values = append(values, fmt.Sprintf("host-%d.example.com", i))
+	}
+	values = append(values, "mar.local")
+
+	config := Config{
+		In: map[string]interface{}{
+			"server": map[string]interface{}{"file": benchmarkListFile(b, values)},
+		},
+	}
+
+	benchmarkCondition(b, &config, httpResponseTestEvent)
+}
+
+func BenchmarkNetworkFileCondition(b *testing.B) {
+	var networks []string
+	for i := 0; i < 65536; i++ {
+		networks = append(networks, fmt.Sprintf("10.%d.%d.0/24", i/256, i%256))
+	}
+	for i := 0; i < 256; i++ {
+		networks = append(networks, fmt.Sprintf("172.%d.0.0/16", i))
+	}
+	networks = append(networks, "127.0.0.1")
+
+	config := Config{
+		Network: map[string]interface{}{
+			"ip": map[string]interface{}{"file": benchmarkListFile(b, networks)},
+		},
+	}
+
+	benchmarkCondition(b, &config, httpResponseTestEvent)
+}
+
+func benchmarkCondition(b *testing.B, config *Config, event *beat.Event) {
+	cond, err := NewCondition(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if !cond.Check(event) {
+		b.Fatalf("condition %v does not match", cond)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cond.Check(event)
+	}
+}
+
+func benchmarkListFile(b *testing.B, lines []string) string {
+	path := filepath.Join(b.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"fmt"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// Expr is a Condition that evaluates an expression written in the expr
+// language (https://github.com/antonmedv/expr). Expressions can not modify the
+// event or access anything outside of it. Event fields are referenced by
+// their name, like `log.level` or `http.response.status_code`, and keep their
+// type. The condition matches if the expression evaluates to true.
+// Expressions referencing missing fields or failing to evaluate do not match.
+type Expr struct {
+	expr    string
+	program *vm.Program
+	log     *logp.Logger
+}
+
+// NewExprCondition compiles the expression into a new Expr condition.
+func NewExprCondition(input string) (*Expr, error) {
+	// No environment is given to the compiler, as the fields are only known
+	// when an event is evaluated.
+	program, err := expr.Compile(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile expression %q: %w", input, err)
+	}
+
+	return &Expr{
+		expr:    input,
+		program: program,
+		log:     logp.NewLogger(logName),
+	}, nil
+}
+
+// Check determines whether the given event matches this condition.
+func (c *Expr) Check(event ValuesMap) bool {
+	out, err := expr.Run(c.program, exprEnv{event})
+	if err != nil {
+		c.log.Debugf("Failed to evaluate expression %q: %v", c.expr, err)
+		return false
+	}
+
+	matches, ok := out.(bool)
+	if !ok {
+		c.log.Debugf("Expression %q evaluated to %v, expected a bool", c.expr, out)
+		return false
+	}
+	return matches
+}
+
+func (c *Expr) String() string {
+	return "expr: " + c.expr
+}
+
+// exprEnv resolves the identifiers of an expression to event fields.
+type exprEnv struct {
+	event ValuesMap
+}
+
+func (e exprEnv) Fetch(name interface{}) interface{} {
+	key, ok := name.(string)
+	if !ok {
+		return nil
+	}
+	v, err := e.event.GetValue(key)
+	if err != nil {
+		return nil
+	}
+	return v
+}
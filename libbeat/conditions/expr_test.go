@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExprCondition(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`type == "http" and http.code == 200`, true},
+		{`http.code >= 200 && http.code < 300`, true},
+		{`method in ["GET", "HEAD"] and responsetime > 20`, true},
+		{`method in ["POST", "PUT"]`, false},
+		{`responsetime > 29.5`, true},
+		{`path matches "\\.js$" and not (status == "ERROR")`, true},
+		{`path startsWith "/css"`, false},
+		{`missing.field > 10`, false},
+		{`http.missing == nil`, true},
+		{`http.code`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			testConfig(t, test.expected, httpResponseTestEvent, &Config{
+				Expr: test.expr,
+			})
+		})
+	}
+}
+
+func TestExprInvalid(t *testing.T) {
+	_, err := NewCondition(&Config{Expr: `type == `})
+	assert.Error(t, err)
+}
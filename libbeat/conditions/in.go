@@ -0,0 +1,165 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// In is a Condition that checks if the value of a field is one of a list of
+// values. The values are either configured or loaded from a file. Values are
+// compared by their string representation. If the field contains an array, any
+// of its elements must be in the list.
+type In map[string]valueSet
+
+type valueSet interface {
+	fmt.Stringer
+	contains(value string) bool
+}
+
+type staticValueSet map[string]struct{}
+
+func (s staticValueSet) contains(value string) bool {
+	_, found := s[value]
+	return found
+}
+
+func (s staticValueSet) String() string {
+	values := make([]string, 0, len(s))
+	for v := range s {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+type fileValueSet struct {
+	*listFile
+}
+
+func (s fileValueSet) contains(value string) bool {
+	return s.Get().(staticValueSet).contains(value)
+}
+
+// NewInCondition builds a new In condition from a map of fields to lists of
+// values or list file configurations.
+func NewInCondition(fields map[string]interface{}) (In, error) {
+	c := In{}
+
+	err := walkListFields(fields, func(field string, value interface{}) error {
+		switch v := value.(type) {
+		case []interface{}:
+			set := make(staticValueSet, len(v))
+			for _, ifc := range v {
+				s, ok := inValue(ifc)
+				if !ok {
+					return fmt.Errorf("in condition on field '%v' contains unexpected type '%T', "+
+						"only strings, numbers and booleans are allowed", field, ifc)
+				}
+				set[s] = struct{}{}
+			}
+			c[field] = set
+		case map[string]interface{}:
+			cfg, err := common.NewConfigFrom(v)
+			if err != nil {
+				return err
+			}
+			f, err := newListFile(cfg, func(lines []string) (interface{}, error) {
+				set := make(staticValueSet, len(lines))
+				for _, line := range lines {
+					set[line] = struct{}{}
+				}
+				return set, nil
+			})
+			if err != nil {
+				return fmt.Errorf("in condition on field '%v': %w", field, err)
+			}
+			c[field] = fileValueSet{f}
+		default:
+			return fmt.Errorf("in condition attempted to set '%v' -> '%v' and encountered "+
+				"unexpected type '%T', only lists of values or a file are allowed", field, value, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Check determines whether the given event matches this condition.
+func (c In) Check(event ValuesMap) bool {
+	for field, set := range c {
+		value, err := event.GetValue(field)
+		if err != nil {
+			return false
+		}
+
+		if !inContains(set, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func inContains(set valueSet, value interface{}) bool {
+	switch v := value.(type) {
+	case []string:
+		for _, s := range v {
+			if set.contains(s) {
+				return true
+			}
+		}
+		return false
+	case []interface{}:
+		for _, elem := range v {
+			if s, ok := inValue(elem); ok && set.contains(s) {
+				return true
+			}
+		}
+		return false
+	default:
+		s, ok := inValue(value)
+		return ok && set.contains(s)
+	}
+}
+
+// inValue returns the string representation of scalar values.
+func inValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, common.Float:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+func (c In) String() string {
+	fields := make([]string, 0, len(c))
+	for field, set := range c {
+		fields = append(fields, field+": "+set.String())
+	}
+	sort.Strings(fields)
+	return "in: {" + strings.Join(fields, ", ") + "}"
+}
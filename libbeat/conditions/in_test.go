@@ -0,0 +1,161 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestInConfigUnpack(t *testing.T) {
+	testYAMLConfig := func(t *testing.T, expected bool, evt *beat.Event, yml string) {
+		c, err := common.NewConfigWithYAML([]byte(yml), "test")
+		require.NoError(t, err)
+
+		var config Config
+		require.NoError(t, c.Unpack(&config))
+
+		testConfig(t, expected, evt, &config)
+	}
+
+	t.Run("string values", func(t *testing.T) {
+		testYAMLConfig(t, true, httpResponseTestEvent, `
+in:
+  type: [http, dns]
+  http.phrase: [OK, Created]
+`)
+	})
+
+	t.Run("numeric values", func(t *testing.T) {
+		testYAMLConfig(t, true, httpResponseTestEvent, `
+in:
+  http.code: [200, 201, 204]
+`)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		testYAMLConfig(t, false, httpResponseTestEvent, `
+in:
+  type: [http]
+  http.code: [500, 503]
+`)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		testYAMLConfig(t, false, httpResponseTestEvent, `
+in:
+  log.level: [ERROR]
+`)
+	})
+}
+
+func TestInArrayValues(t *testing.T) {
+	cond, err := NewInCondition(map[string]interface{}{
+		"tags": []interface{}{"production", "staging"},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, cond.Check(&beat.Event{Fields: common.MapStr{"tags": []string{"web", "staging"}}}))
+	assert.True(t, cond.Check(&beat.Event{Fields: common.MapStr{"tags": []interface{}{"production"}}}))
+	assert.False(t, cond.Check(&beat.Event{Fields: common.MapStr{"tags": []string{"web"}}}))
+}
+
+func TestInInvalidConfig(t *testing.T) {
+	for name, fields := range map[string]map[string]interface{}{
+		"single value": {"type": "http"},
+		"nested list":  {"type": []interface{}{[]interface{}{"http"}}},
+		"missing file": {"type": map[string]interface{}{"file": filepath.Join(t.TempDir(), "missing.txt")}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewInCondition(fields)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	writeListFile(t, path, "# blocked users\nalice\n\n  bob  \n")
+
+	cond, err := NewInCondition(map[string]interface{}{
+		"user": map[string]interface{}{
+			"name": map[string]interface{}{
+				"file":          path,
+				"reload.period": "1ns",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	event := func(name string) *beat.Event {
+		return &beat.Event{Fields: common.MapStr{"user": common.MapStr{"name": name}}}
+	}
+	assert.True(t, cond.Check(event("alice")))
+	assert.True(t, cond.Check(event("bob")))
+	assert.False(t, cond.Check(event("carol")))
+	assert.False(t, cond.Check(event("# blocked users")))
+
+	// The file is reloaded in the background.
+	writeListFile(t, path, "carol\n")
+	assert.Eventually(t, func() bool { return cond.Check(event("carol")) }, time.Second, time.Millisecond)
+	assert.False(t, cond.Check(event("alice")))
+
+	// The previous list is kept if the file can not be read.
+	require.NoError(t, os.Remove(path))
+	assert.Never(t, func() bool { return !cond.Check(event("carol")) }, 50*time.Millisecond, time.Millisecond)
+}
+
+func TestInFileNoReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	writeListFile(t, path, "alice\n")
+
+	cond, err := NewInCondition(map[string]interface{}{
+		"user.name": map[string]interface{}{
+			"file":          path,
+			"reload.period": 0,
+		},
+	})
+	require.NoError(t, err)
+
+	event := &beat.Event{Fields: common.MapStr{"user": common.MapStr{"name": "alice"}}}
+	assert.True(t, cond.Check(event))
+
+	writeListFile(t, path, "bob\n")
+	assert.True(t, cond.Check(event))
+}
+
+// writeListFile writes a list file and moves its modification time forward,
+// so a change is detected on file systems with a coarse time resolution.
+func writeListFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
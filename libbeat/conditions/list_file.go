@@ -0,0 +1,147 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/filereload"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const defaultListReloadPeriod = 10 * time.Second
+
+// listFileConfig configures a list of values loaded from a file. The file
+// contains one value per line, empty lines and lines starting with # are
+// ignored.
+type listFileConfig struct {
+	File   string `config:"file" validate:"required"`
+	Reload struct {
+		Period time.Duration `config:"period" validate:"min=0"`
+	} `config:"reload"`
+}
+
+// listFile holds the parsed content of a list file. The file is checked for
+// changes at most once per reload period when the list is accessed, and
+// reloaded in the background if its size or modification time changed. The
+// previous list is kept if the file can not be read or parsed.
+type listFile struct {
+	*filereload.File
+}
+
+// newListFile unpacks the file configuration and loads the file.
+func newListFile(cfg *common.Config, parse func(lines []string) (interface{}, error)) (*listFile, error) {
+	var config listFileConfig
+	config.Reload.Period = defaultListReloadPeriod
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	log := logp.NewLogger(logName)
+	load := func(path string) (interface{}, error) {
+		lines, err := readListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		list, err := parse(lines)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list file %s: %w", path, err)
+		}
+		log.Debugf("Loaded %d entries from list file %s", len(lines), path)
+		return list, nil
+	}
+	onError := func(err error) {
+		log.Errorf("Failed to reload list file, keeping the previous list: %v", err)
+	}
+
+	f, err := filereload.New(config.File, config.Reload.Period, load, onError)
+	if err != nil {
+		return nil, err
+	}
+	return &listFile{f}, nil
+}
+
+func readListFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open list file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read list file %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+// walkListFields calls fn for each field of a condition whose value is either
+// a list of values or a list file configuration. The field names can be
+// nested or use dot notation.
+func walkListFields(fields map[string]interface{}, fn func(field string, value interface{}) error) error {
+	var walk func(prefix string, m map[string]interface{}) error
+	walk = func(prefix string, m map[string]interface{}) error {
+		for k, v := range m {
+			field := k
+			if prefix != "" {
+				field = prefix + "." + k
+			}
+
+			switch v := v.(type) {
+			case map[string]interface{}:
+				if isListFileConfig(v) {
+					if err := fn(field, v); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := walk(field, v); err != nil {
+					return err
+				}
+			case common.MapStr:
+				if err := walk(prefix, map[string]interface{}{k: map[string]interface{}(v)}); err != nil {
+					return err
+				}
+			default:
+				if err := fn(field, v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk("", fields)
+}
+
+func isListFileConfig(m map[string]interface{}) bool {
+	_, ok := m["file"].(string)
+	return ok
+}
@@ -96,6 +96,88 @@ func (m multiNetworkMatcher) String() string {
 	return strings.Join(names, " OR ")
 }
 
+// networkSet matches IP addresses against a large list of networks. The
+// networks are grouped by prefix length, so a lookup costs one map access per
+// distinct prefix length instead of one comparison per network.
+type networkSet struct {
+	named    multiNetworkMatcher
+	prefixes []networkPrefix
+	size     int
+}
+
+type networkPrefix struct {
+	mask     net.IPMask
+	networks map[string]struct{}
+}
+
+// newNetworkSet builds a networkSet from a list of named networks, CIDRs and
+// IP addresses.
+func newNetworkSet(networks []string) (*networkSet, error) {
+	s := &networkSet{size: len(networks)}
+	byMask := map[string]*networkPrefix{}
+	for _, network := range networks {
+		if contains, found := namedNetworks[network]; found {
+			s.named = append(s.named, singleNetworkMatcher{name: network, netContainsFunc: contains})
+			continue
+		}
+
+		var subnet *net.IPNet
+		if ip := net.ParseIP(network); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				subnet = &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+			} else {
+				subnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+			}
+		} else {
+			var err error
+			if subnet, err = parseCIDR(network); err != nil {
+				return nil, err
+			}
+		}
+
+		prefix, found := byMask[string(subnet.Mask)]
+		if !found {
+			prefix = &networkPrefix{mask: subnet.Mask, networks: map[string]struct{}{}}
+			byMask[string(subnet.Mask)] = prefix
+		}
+		prefix.networks[string(subnet.IP.Mask(subnet.Mask))] = struct{}{}
+	}
+
+	for _, prefix := range byMask {
+		s.prefixes = append(s.prefixes, *prefix)
+	}
+	return s, nil
+}
+
+func (s *networkSet) Contains(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, prefix := range s.prefixes {
+		if len(prefix.mask) != len(ip) {
+			continue
+		}
+		if _, found := prefix.networks[string(ip.Mask(prefix.mask))]; found {
+			return true
+		}
+	}
+	return s.named.Contains(ip)
+}
+
+func (s *networkSet) String() string {
+	return fmt.Sprintf("%d networks", s.size)
+}
+
+// fileNetworkMatcher matches IP addresses against the networks listed in a
+// file.
+type fileNetworkMatcher struct {
+	*listFile
+}
+
+func (m fileNetworkMatcher) Contains(ip net.IP) bool {
+	return m.Get().(*networkSet).Contains(ip)
+}
+
 // NewNetworkCondition builds a new Network using the given configuration.
 func NewNetworkCondition(fields map[string]interface{}) (*Network, error) {
 	cond := &Network{
@@ -118,15 +200,15 @@ func NewNetworkCondition(fields map[string]interface{}) (*Network, error) {
 	invalidTypeError := func(field string, value interface{}) error {
 		return fmt.Errorf("network condition attempted to set "+
 			"'%v' -> '%v' and encountered unexpected type '%T', only "+
-			"strings or []strings are allowed", field, value, value)
+			"strings, []strings or a file are allowed", field, value, value)
 	}
 
-	for field, value := range common.MapStr(fields).Flatten() {
+	err := walkListFields(fields, func(field string, value interface{}) error {
 		switch v := value.(type) {
 		case string:
 			m, err := makeMatcher(v)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			cond.fields[field] = m
 		case []interface{}:
@@ -134,18 +216,34 @@ func NewNetworkCondition(fields map[string]interface{}) (*Network, error) {
 			for _, networkIfc := range v {
 				network, ok := networkIfc.(string)
 				if !ok {
-					return nil, invalidTypeError(field, networkIfc)
+					return invalidTypeError(field, networkIfc)
 				}
 				m, err := makeMatcher(network)
 				if err != nil {
-					return nil, err
+					return err
 				}
 				matchers = append(matchers, m)
 			}
 			cond.fields[field] = matchers
+		case map[string]interface{}:
+			cfg, err := common.NewConfigFrom(v)
+			if err != nil {
+				return err
+			}
+			f, err := newListFile(cfg, func(lines []string) (interface{}, error) {
+				return newNetworkSet(lines)
+			})
+			if err != nil {
+				return fmt.Errorf("network condition on field '%v': %w", field, err)
+			}
+			cond.fields[field] = fileNetworkMatcher{f}
 		default:
-			return nil, invalidTypeError(field, value)
+			return invalidTypeError(field, value)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return cond, nil
@@ -19,10 +19,12 @@ package conditions
 
 import (
 	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
@@ -78,6 +80,18 @@ network:
 
 		testYAMLConfig(t, true, evt, yaml)
 	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "networks.txt")
+		writeListFile(t, path, "# internal networks\n10.0.0.0/8\n127.0.0.1\n")
+
+		yaml := `
+network:
+  client_ip:
+    file: ` + path + `
+`
+		testYAMLConfig(t, true, httpResponseTestEvent, yaml)
+	})
 }
 
 func TestNetworkCreate(t *testing.T) {
@@ -243,6 +257,64 @@ func TestNetworkContains(t *testing.T) {
 	assert.True(t, contains)
 }
 
+func TestNetworkSet(t *testing.T) {
+	set, err := newNetworkSet([]string{
+		"10.0.0.0/8",
+		"192.168.1.0/24",
+		"192.0.2.17",
+		"2001:db8::/32",
+		"loopback",
+	})
+	require.NoError(t, err)
+
+	for ip, expected := range map[string]bool{
+		"10.1.2.3":          true,
+		"192.168.1.200":     true,
+		"192.168.2.1":       false,
+		"192.0.2.17":        true,
+		"192.0.2.18":        false,
+		"::ffff:10.0.0.1":   true,
+		"2001:db8:1::1":     true,
+		"2001:db9::1":       false,
+		"127.0.0.1":         true,
+		"::1":               true,
+		"172.16.0.1":        false,
+		"fd00::1":           false,
+		"::ffff:192.0.2.17": true,
+	} {
+		assert.Equal(t, expected, set.Contains(net.ParseIP(ip)), ip)
+	}
+
+	_, err = newNetworkSet([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+func TestNetworkFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "networks.txt")
+	writeListFile(t, path, "10.0.0.0/8\n")
+
+	c, err := NewNetworkCondition(map[string]interface{}{
+		"ip": map[string]interface{}{
+			"file":          path,
+			"reload.period": "1ns",
+		},
+	})
+	require.NoError(t, err)
+
+	event := &beat.Event{Fields: common.MapStr{"ip": "10.1.1.1"}}
+	assert.True(t, c.Check(event))
+
+	// The file is reloaded in the background.
+	writeListFile(t, path, "192.168.0.0/16\n")
+	other := &beat.Event{Fields: common.MapStr{"ip": "192.168.3.4"}}
+	assert.Eventually(t, func() bool { return c.Check(other) }, time.Second, time.Millisecond)
+	assert.False(t, c.Check(event))
+
+	// Invalid networks are not loaded.
+	writeListFile(t, path, "192.168.0.0/16\nnot-a-network\n")
+	assert.Never(t, func() bool { return !c.Check(other) }, 50*time.Millisecond, time.Millisecond)
+}
+
 func BenchmarkNetworkCondition(b *testing.B) {
 	c, err := NewCondition(&Config{
 		Network: map[string]interface{}{
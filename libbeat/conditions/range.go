@@ -20,6 +20,7 @@ package conditions
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/elastic/beats/v7/libbeat/common"
@@ -136,6 +137,17 @@ func (c Range) Check(event ValuesMap) bool {
 				return false
 			}
 
+		case string:
+			floatValue, err := strconv.ParseFloat(value.(string), 64)
+			if err != nil {
+				logp.L().Named(logName).Warnf("non-numeric string %q in range condition.", value)
+				return false
+			}
+
+			if !checkValue(floatValue, rangeValue) {
+				return false
+			}
+
 		default:
 			logp.L().Named(logName).Warnf("unexpected type %T in range condition.", value)
 			return false
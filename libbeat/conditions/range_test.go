@@ -116,3 +116,29 @@ func TestOpenGteRangeConditionPositiveMatch(t *testing.T) {
 func TestOpenGteRangeConditionNegativeMatch(t *testing.T) {
 	testConfig(t, false, httpResponseTestEvent, procCPURangeConfig)
 }
+
+func TestRangeNumericString(t *testing.T) {
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: common.MapStr{
+			"duration_ms": "512.5",
+			"status":      "OK",
+		},
+	}
+
+	testConfig(t, true, event, &Config{
+		Range: &Fields{fields: map[string]interface{}{
+			"duration_ms.gt": 500,
+		}},
+	})
+	testConfig(t, false, event, &Config{
+		Range: &Fields{fields: map[string]interface{}{
+			"duration_ms.lt": 500,
+		}},
+	})
+	testConfig(t, false, event, &Config{
+		Range: &Fields{fields: map[string]interface{}{
+			"status.gt": 0,
+		}},
+	})
+}
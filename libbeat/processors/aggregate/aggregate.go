@@ -0,0 +1,383 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const processorName = "aggregate"
+const logName = "processor." + processorName
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type metrics struct {
+	groups    *monitoring.Int
+	events    *monitoring.Uint
+	summaries *monitoring.Uint
+	evicted   *monitoring.Uint
+	dropped   *monitoring.Uint
+}
+
+type aggregate struct {
+	config config
+	log    *logp.Logger
+	clock  clockwork.Clock
+	rand   *rand.Rand
+
+	metrics metrics
+
+	mutex   sync.Mutex
+	groups  map[string]*group
+	order   *list.List // groups ordered by creation, oldest first
+	flusher *util.Flusher
+}
+
+// group holds the state of the events of a window having the same values in
+// the group_by fields.
+type group struct {
+	key     string
+	start   time.Time
+	values  []interface{}
+	count   uint64
+	metrics []metricState
+	elem    *list.Element
+}
+
+// metricState holds the statistics of a metric of a group. The samples are a
+// uniform random sample of the values used to compute the percentiles.
+type metricState struct {
+	count    uint64
+	sum      float64
+	min, max float64
+	samples  []float64
+}
+
+// New constructs a new aggregate processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the aggregate configuration")
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	p := &aggregate{
+		config: config,
+		log:    log,
+		clock:  clockwork.NewRealClock(),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		metrics: metrics{
+			groups:    monitoring.NewInt(reg, "groups"),
+			events:    monitoring.NewUint(reg, "events"),
+			summaries: monitoring.NewUint(reg, "summaries"),
+			evicted:   monitoring.NewUint(reg, "evicted"),
+			dropped:   monitoring.NewUint(reg, "dropped"),
+		},
+		groups: map[string]*group{},
+		order:  list.New(),
+	}
+	p.flusher = util.NewFlusher(log, config.Window, config.MaxGroups, func(all bool) {
+		p.flush(p.clock.Now(), all)
+	}, p.metrics.summaries, p.metrics.dropped)
+	return p, nil
+}
+
+// Run adds the event to the group of its window and returns it, unless
+// drop_events is set.
+func (p *aggregate) Run(event *beat.Event) (*beat.Event, error) {
+	ts := event.Timestamp
+	if ts.IsZero() {
+		ts = p.clock.Now()
+	}
+	start := ts.Truncate(p.config.Window)
+
+	values := make([]interface{}, len(p.config.GroupBy))
+	for i, field := range p.config.GroupBy {
+		if v, err := event.GetValue(field); err == nil {
+			values[i] = v
+		}
+	}
+	key := groupKey(start, values)
+
+	p.mutex.Lock()
+	g, exists := p.groups[key]
+	if !exists {
+		if len(p.groups) >= p.config.MaxGroups {
+			p.evictOldest()
+		}
+		g = &group{
+			key:     key,
+			start:   start,
+			values:  values,
+			metrics: make([]metricState, len(p.config.Metrics)),
+		}
+		g.elem = p.order.PushBack(g)
+		p.groups[key] = g
+		p.metrics.groups.Set(int64(len(p.groups)))
+	}
+	g.count++
+	for i, m := range p.config.Metrics {
+		if v, err := event.GetValue(m.Field); err == nil {
+			if f, ok := toFloat(v); ok {
+				p.add(&g.metrics[i], f, len(m.Percentiles) > 0)
+			}
+		}
+	}
+	p.mutex.Unlock()
+
+	p.metrics.events.Inc()
+	if p.config.DropEvents {
+		return nil, nil
+	}
+	return event, nil
+}
+
+// add adds a value to the state of a metric. If sample is set, the value is
+// sampled with reservoir sampling, so the samples are bounded by max_samples.
+func (p *aggregate) add(m *metricState, v float64, sample bool) {
+	m.count++
+	m.sum += v
+	if m.count == 1 || v < m.min {
+		m.min = v
+	}
+	if m.count == 1 || v > m.max {
+		m.max = v
+	}
+
+	if !sample {
+		return
+	}
+	if len(m.samples) < p.config.MaxSamples {
+		m.samples = append(m.samples, v)
+	} else if i := p.rand.Int63n(int64(m.count)); i < int64(len(m.samples)) {
+		m.samples[i] = v
+	}
+}
+
+// evictOldest removes the oldest group to make room for a new one. Its summary
+// is queued and emitted by the flush loop. Must be called with the mutex held.
+func (p *aggregate) evictOldest() {
+	elem := p.order.Front()
+	if elem == nil {
+		return
+	}
+	g := elem.Value.(*group)
+	p.remove(g)
+	p.metrics.evicted.Inc()
+
+	if !p.flusher.Queue(p.summary(g, true)) {
+		p.log.Debugf("Dropping summary of evicted group %v, too many pending summaries", g.values)
+	}
+}
+
+// remove removes a group. Must be called with the mutex held.
+func (p *aggregate) remove(g *group) {
+	delete(p.groups, g.key)
+	p.order.Remove(g.elem)
+	p.metrics.groups.Set(int64(len(p.groups)))
+}
+
+// SetEmitter sets the function used to publish the summary events and starts
+// the loop closing the windows.
+func (p *aggregate) SetEmitter(emit func(beat.Event)) {
+	p.flusher.SetEmitter(emit)
+	p.flusher.Start()
+}
+
+// flush emits the summaries of the evicted groups and of the groups whose
+// window closed before now, taking the configured delay into account. If all
+// is set, the summaries of all groups are emitted.
+func (p *aggregate) flush(now time.Time, all bool) {
+	var events []beat.Event
+	p.mutex.Lock()
+	for elem := p.order.Front(); elem != nil; {
+		g := elem.Value.(*group)
+		elem = elem.Next()
+		if all || !now.Before(g.start.Add(p.config.Window+p.config.Delay)) {
+			p.remove(g)
+			events = append(events, p.summary(g, false))
+		}
+	}
+	p.mutex.Unlock()
+
+	p.flusher.Emit(events)
+}
+
+// summary creates the summary event of a group.
+func (p *aggregate) summary(g *group, evicted bool) beat.Event {
+	fields := common.MapStr{}
+	for i, field := range p.config.GroupBy {
+		if g.values[i] != nil {
+			fields.Put(field, g.values[i])
+		}
+	}
+
+	agg := common.MapStr{
+		"window": common.MapStr{
+			"start": g.start,
+			"end":   g.start.Add(p.config.Window),
+		},
+		"count": g.count,
+	}
+	if evicted {
+		agg["evicted"] = true
+	}
+	for i, m := range p.config.Metrics {
+		agg.Put(m.Name, g.metrics[i].summary(m))
+	}
+	fields.Put(p.config.Target, agg)
+
+	return beat.Event{
+		Timestamp: g.start,
+		Fields:    fields,
+	}
+}
+
+func (m *metricState) summary(config metricConfig) common.MapStr {
+	out := common.MapStr{}
+	for _, s := range config.Stats {
+		switch s {
+		case statCount:
+			out["count"] = m.count
+		case statSum:
+			out["sum"] = m.sum
+		}
+		if m.count == 0 {
+			continue
+		}
+		switch s {
+		case statMin:
+			out["min"] = m.min
+		case statMax:
+			out["max"] = m.max
+		case statAvg:
+			out["avg"] = m.sum / float64(m.count)
+		}
+	}
+	if len(config.Percentiles) > 0 && len(m.samples) > 0 {
+		sorted := make([]float64, len(m.samples))
+		copy(sorted, m.samples)
+		sort.Float64s(sorted)
+		for _, pct := range config.Percentiles {
+			out[percentileName(pct)] = percentile(sorted, pct)
+		}
+	}
+	return out
+}
+
+// Close stops the flush loop and emits the summaries of all groups.
+func (p *aggregate) Close() error {
+	p.flusher.Close()
+	return nil
+}
+
+func (p *aggregate) String() string {
+	metrics := make([]string, len(p.config.Metrics))
+	for i, m := range p.config.Metrics {
+		metrics[i] = m.Name
+	}
+	return fmt.Sprintf("%v=[group_by=%v, window=%v, metrics=[%v]]",
+		processorName, p.config.GroupBy, p.config.Window, strings.Join(metrics, ", "))
+}
+
+// groupKey returns the key of the group of the window starting at start with
+// the given group_by values.
+func groupKey(start time.Time, values []interface{}) string {
+	var b strings.Builder
+	b.WriteString(strconv.FormatInt(start.UnixNano(), 10))
+	for _, v := range values {
+		b.WriteByte(0)
+		if v != nil {
+			fmt.Fprintf(&b, "%T:%v", v, v)
+		}
+	}
+	return b.String()
+}
+
+// percentile returns the p-th percentile of the sorted values, interpolating
+// linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case common.Float:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
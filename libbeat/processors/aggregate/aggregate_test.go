@@ -0,0 +1,282 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/processortest"
+)
+
+var testStart = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func newTestAggregate(t *testing.T, cfg common.MapStr) (*aggregate, *processortest.Collector) {
+	t.Helper()
+	agg := processortest.New(t, New, cfg).(*aggregate)
+	agg.clock = clockwork.NewFakeClockAt(testStart)
+
+	// The flush loop is not started, the tests flush explicitly.
+	c := &processortest.Collector{}
+	agg.flusher.SetEmitter(c.Emit)
+	return agg, c
+}
+
+func testEvent(offset time.Duration, fields common.MapStr) *beat.Event {
+	return &beat.Event{Timestamp: testStart.Add(offset), Fields: fields}
+}
+
+func TestAggregateStats(t *testing.T) {
+	p, c := newTestAggregate(t, common.MapStr{
+		"group_by": []string{"host.name"},
+		"window":   "1m",
+		"delay":    "0s",
+		"metrics": []common.MapStr{
+			{"field": "duration", "stats": []string{"count", "sum", "min", "max", "avg"}, "percentiles": []float64{50, 99.9}},
+			{"field": "bytes", "name": "size", "stats": []string{"sum"}},
+		},
+	})
+
+	for i, v := range []interface{}{10, 20.0, "30", common.Float(40), "invalid"} {
+		event, err := p.Run(testEvent(time.Duration(i)*time.Second, common.MapStr{
+			"host":     common.MapStr{"name": "a"},
+			"duration": v,
+			"bytes":    uint64(100),
+		}))
+		require.NoError(t, err)
+		require.NotNil(t, event)
+	}
+	_, err := p.Run(testEvent(0, common.MapStr{"host": common.MapStr{"name": "b"}, "duration": 5}))
+	require.NoError(t, err)
+
+	p.flush(testStart.Add(59*time.Second), false)
+	assert.Empty(t, c.Events())
+
+	p.flush(testStart.Add(time.Minute), false)
+	require.Len(t, c.Events(), 2)
+	assert.Empty(t, p.groups)
+
+	byHost := map[interface{}]beat.Event{}
+	for _, event := range c.Events() {
+		host, err := event.GetValue("host.name")
+		require.NoError(t, err)
+		byHost[host] = event
+		assert.Equal(t, testStart, event.Timestamp)
+	}
+
+	assert.Equal(t, common.MapStr{
+		"host": common.MapStr{"name": "a"},
+		"aggregate": common.MapStr{
+			"window": common.MapStr{
+				"start": testStart,
+				"end":   testStart.Add(time.Minute),
+			},
+			"count": uint64(5),
+			"duration": common.MapStr{
+				"count": uint64(4),
+				"sum":   100.0,
+				"min":   10.0,
+				"max":   40.0,
+				"avg":   25.0,
+				"p50":   25.0,
+				"p99_9": 39.97,
+			},
+			"size": common.MapStr{"sum": 500.0},
+		},
+	}, roundFloats(byHost["a"].Fields))
+	assert.Equal(t, uint64(1), byHost["b"].Fields["aggregate"].(common.MapStr)["count"])
+}
+
+func TestAggregateWindows(t *testing.T) {
+	p, c := newTestAggregate(t, common.MapStr{
+		"window": "10s",
+		"delay":  "2s",
+		"metrics": []common.MapStr{
+			{"field": "value", "stats": []string{"sum"}},
+		},
+	})
+
+	for _, offset := range []time.Duration{0, 5 * time.Second, 12 * time.Second} {
+		_, err := p.Run(testEvent(offset, common.MapStr{"value": 1}))
+		require.NoError(t, err)
+	}
+
+	p.flush(testStart.Add(11*time.Second), false)
+	assert.Empty(t, c.Events())
+
+	p.flush(testStart.Add(12*time.Second), false)
+	require.Len(t, c.Events(), 1)
+	assert.Equal(t, testStart, c.Events()[0].Timestamp)
+	assert.Equal(t, 2.0, c.Events()[0].Fields["aggregate"].(common.MapStr)["value"].(common.MapStr)["sum"])
+
+	p.flush(testStart.Add(22*time.Second), false)
+	require.Len(t, c.Events(), 2)
+	assert.Equal(t, testStart.Add(10*time.Second), c.Events()[1].Timestamp)
+}
+
+func TestAggregateDropEvents(t *testing.T) {
+	p, _ := newTestAggregate(t, common.MapStr{
+		"drop_events": true,
+	})
+
+	event, err := p.Run(testEvent(0, common.MapStr{"message": "hello"}))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	assert.Len(t, p.groups, 1)
+}
+
+func TestAggregateMaxGroups(t *testing.T) {
+	p, c := newTestAggregate(t, common.MapStr{
+		"group_by":   []string{"user"},
+		"max_groups": 2,
+	})
+
+	for _, user := range []string{"a", "b", "a", "c"} {
+		_, err := p.Run(testEvent(0, common.MapStr{"user": user}))
+		require.NoError(t, err)
+	}
+	assert.Len(t, p.groups, 2)
+	assert.Equal(t, uint64(1), p.metrics.evicted.Get())
+
+	p.flush(testStart, false)
+	require.Len(t, c.Events(), 1)
+	assert.Equal(t, "a", c.Events()[0].Fields["user"])
+	agg := c.Events()[0].Fields["aggregate"].(common.MapStr)
+	assert.Equal(t, uint64(2), agg["count"])
+	assert.Equal(t, true, agg["evicted"])
+}
+
+func TestAggregateMaxSamples(t *testing.T) {
+	p, c := newTestAggregate(t, common.MapStr{
+		"max_samples": 10,
+		"metrics": []common.MapStr{
+			{"field": "value", "percentiles": []float64{100}},
+		},
+	})
+
+	for i := 0; i < 1000; i++ {
+		_, err := p.Run(testEvent(0, common.MapStr{"value": i}))
+		require.NoError(t, err)
+	}
+	g := p.order.Front().Value.(*group)
+	assert.Len(t, g.metrics[0].samples, 10)
+
+	require.NoError(t, p.Close())
+	require.Len(t, c.Events(), 1)
+	value := c.Events()[0].Fields["aggregate"].(common.MapStr)["value"].(common.MapStr)
+	assert.Contains(t, value, "p100")
+	assert.NotContains(t, value, "sum")
+}
+
+func TestAggregateClose(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"window": "1h",
+		"metrics": []common.MapStr{
+			{"field": "value"},
+		},
+	}))
+	require.NoError(t, err)
+
+	c := &processortest.Collector{}
+	processors.SetEmitter(p, c.Emit)
+
+	_, err = p.Run(&beat.Event{Timestamp: time.Now(), Fields: common.MapStr{"value": 1}})
+	require.NoError(t, err)
+
+	require.NoError(t, processors.Close(p))
+	require.Len(t, c.Events(), 1)
+	assert.Equal(t, uint64(1), c.Events()[0].Fields["aggregate"].(common.MapStr)["count"])
+
+	require.NoError(t, processors.Close(p))
+	assert.Len(t, c.Events(), 1)
+}
+
+func TestAggregateWithoutEmitter(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{}))
+	require.NoError(t, err)
+
+	_, err = p.Run(testEvent(0, common.MapStr{}))
+	require.NoError(t, err)
+
+	require.NoError(t, processors.Close(p))
+	assert.Equal(t, uint64(1), p.(*aggregate).metrics.dropped.Get())
+}
+
+func TestAggregateConfig(t *testing.T) {
+	tests := map[string]common.MapStr{
+		"negative window": {"window": "-1s"},
+		"zero window":     {"window": 0},
+		"zero max_groups": {"max_groups": 0},
+		"invalid stat": {"metrics": []common.MapStr{
+			{"field": "value", "stats": []string{"median"}},
+		}},
+		"invalid percentile": {"metrics": []common.MapStr{
+			{"field": "value", "percentiles": []float64{0}},
+		}},
+		"duplicate name": {"metrics": []common.MapStr{
+			{"field": "value"},
+			{"field": "other", "name": "value"},
+		}},
+		"reserved name": {"metrics": []common.MapStr{
+			{"field": "count"},
+		}},
+		"missing field": {"metrics": []common.MapStr{
+			{"name": "value"},
+		}},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(cfg))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4}
+	assert.Equal(t, 1.0, percentile(values, 0))
+	assert.Equal(t, 2.5, percentile(values, 50))
+	assert.Equal(t, 4.0, percentile(values, 100))
+	assert.Equal(t, 5.0, percentile([]float64{5}, 99))
+}
+
+// roundFloats rounds the float values, so interpolated percentiles can be
+// compared.
+func roundFloats(m common.MapStr) common.MapStr {
+	out := common.MapStr{}
+	for k, v := range m {
+		switch v := v.(type) {
+		case common.MapStr:
+			out[k] = roundFloats(v)
+		case float64:
+			out[k] = math.Round(v*1000) / 1000
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type config struct {
+	GroupBy    []string       `config:"group_by"`
+	Window     time.Duration  `config:"window" validate:"positive,nonzero"`
+	Delay      time.Duration  `config:"delay" validate:"min=0"`
+	Metrics    []metricConfig `config:"metrics"`
+	Target     string         `config:"target"`
+	DropEvents bool           `config:"drop_events"`
+	MaxGroups  int            `config:"max_groups" validate:"min=1"`
+	MaxSamples int            `config:"max_samples" validate:"min=1"`
+}
+
+type metricConfig struct {
+	Field       string    `config:"field" validate:"required"`
+	Name        string    `config:"name"`
+	Stats       []stat    `config:"stats"`
+	Percentiles []float64 `config:"percentiles"`
+}
+
+var defaultConfig = config{
+	Window:     time.Minute,
+	Delay:      5 * time.Second,
+	Target:     "aggregate",
+	MaxGroups:  10000,
+	MaxSamples: 1000,
+}
+
+var defaultStats = []stat{statCount, statSum, statMin, statMax, statAvg}
+
+func (c *config) Validate() error {
+	names := map[string]struct{}{}
+	for i := range c.Metrics {
+		m := &c.Metrics[i]
+		if m.Name == "" {
+			m.Name = m.Field
+		}
+		if _, exists := names[m.Name]; exists {
+			return fmt.Errorf("duplicate metric name %q", m.Name)
+		}
+		names[m.Name] = struct{}{}
+
+		switch strings.SplitN(m.Name, ".", 2)[0] {
+		case "count", "window", "evicted":
+			return fmt.Errorf("metric name %q is reserved", m.Name)
+		}
+		for _, p := range m.Percentiles {
+			if p <= 0 || p > 100 {
+				return fmt.Errorf("percentile %v of metric %q must be in the range (0, 100]", p, m.Name)
+			}
+		}
+		if len(m.Stats) == 0 && len(m.Percentiles) == 0 {
+			m.Stats = defaultStats
+		}
+	}
+	return nil
+}
+
+// stat is a statistic computed for the values of a metric.
+type stat uint8
+
+const (
+	statCount stat = iota
+	statSum
+	statMin
+	statMax
+	statAvg
+)
+
+var statNames = map[stat]string{
+	statCount: "count",
+	statSum:   "sum",
+	statMin:   "min",
+	statMax:   "max",
+	statAvg:   "avg",
+}
+
+func (s *stat) Unpack(v string) error {
+	for k, name := range statNames {
+		if strings.EqualFold(v, name) {
+			*s = k
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid stat %q, must be one of count, sum, min, max or avg", v)
+}
+
+func (s stat) String() string {
+	return statNames[s]
+}
+
+// percentileName returns the field name of a percentile, like p99 or p99_9.
+func percentileName(p float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+}
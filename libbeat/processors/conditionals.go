@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/joeshaw/multierror"
 	"github.com/pkg/errors"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
@@ -86,6 +87,16 @@ func (r *WhenProcessor) Run(event *beat.Event) (*beat.Event, error) {
 	return r.p.Run(event)
 }
 
+// SetEmitter passes the emit function to the processor.
+func (r *WhenProcessor) SetEmitter(emit func(beat.Event)) {
+	SetEmitter(r.p, emit)
+}
+
+// Close closes the processor.
+func (r *WhenProcessor) Close() error {
+	return Close(r.p)
+}
+
 func (r *WhenProcessor) String() string {
 	return fmt.Sprintf("%v, condition=%v", r.p.String(), r.condition.String())
 }
@@ -136,32 +147,34 @@ func NewIfElseThenProcessor(cfg *common.Config) (*IfThenElseProcessor, error) {
 		return nil, err
 	}
 
-	newProcessors := func(c *common.Config) (*Processors, error) {
-		if c == nil {
-			return nil, nil
-		}
-		if !c.IsArray() {
-			return New([]*common.Config{c})
-		}
-
-		var pc PluginConfig
-		if err := c.Unpack(&pc); err != nil {
-			return nil, err
-		}
-		return New(pc)
-	}
-
 	var ifProcessors, elseProcessors *Processors
-	if ifProcessors, err = newProcessors(config.Then); err != nil {
+	if ifProcessors, err = newSubProcessors(config.Then); err != nil {
 		return nil, err
 	}
-	if elseProcessors, err = newProcessors(config.Else); err != nil {
+	if elseProcessors, err = newSubProcessors(config.Else); err != nil {
 		return nil, err
 	}
 
 	return &IfThenElseProcessor{cond, ifProcessors, elseProcessors}, nil
 }
 
+// newSubProcessors creates the processors of a branch, which can be either a
+// single processor or a list of processors.
+func newSubProcessors(c *common.Config) (*Processors, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if !c.IsArray() {
+		return New([]*common.Config{c})
+	}
+
+	var pc PluginConfig
+	if err := c.Unpack(&pc); err != nil {
+		return nil, err
+	}
+	return New(pc)
+}
+
 // Run checks the if condition and executes the processors attached to the
 // then statement or the else statement based on the condition.
 func (p *IfThenElseProcessor) Run(event *beat.Event) (*beat.Event, error) {
@@ -173,6 +186,28 @@ func (p *IfThenElseProcessor) Run(event *beat.Event) (*beat.Event, error) {
 	return event, nil
 }
 
+// SetEmitter passes the emit function to the processors of both branches.
+func (p *IfThenElseProcessor) SetEmitter(emit func(beat.Event)) {
+	p.then.SetEmitter(emit)
+	if p.els != nil {
+		p.els.SetEmitter(emit)
+	}
+}
+
+// Close closes the processors of both branches.
+func (p *IfThenElseProcessor) Close() error {
+	var errs multierror.Errors
+	if err := p.then.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if p.els != nil {
+		if err := p.els.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
+}
+
 func (p *IfThenElseProcessor) String() string {
 	var sb strings.Builder
 	sb.WriteString("if ")
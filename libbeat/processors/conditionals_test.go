@@ -113,6 +113,46 @@ func TestWhenProcessor(t *testing.T) {
 	}
 }
 
+type emitterFilter struct {
+	countFilter
+	emit   func(beat.Event)
+	closed bool
+}
+
+func (f *emitterFilter) SetEmitter(emit func(beat.Event)) { f.emit = emit }
+
+func (f *emitterFilter) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestWhenProcessorForwardsEmitterAndClose(t *testing.T) {
+	config, err := common.NewConfigFrom(map[string]interface{}{
+		"when.equals.i": 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &emitterFilter{}
+	filter, err := NewConditional(func(_ *common.Config) (Processor, error) {
+		return f, nil
+	})(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var emitted int
+	SetEmitter(filter, func(beat.Event) { emitted++ })
+	if assert.NotNil(t, f.emit) {
+		f.emit(beat.Event{})
+		assert.Equal(t, 1, emitted)
+	}
+
+	assert.NoError(t, Close(filter))
+	assert.True(t, f.closed)
+}
+
 func TestConditionRuleInitErrorPropagates(t *testing.T) {
 	testErr := errors.New("test")
 	filter, err := NewConditional(func(_ *common.Config) (Processor, error) {
@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type config struct {
+	File          string                 `config:"file" validate:"required"`
+	Format        format                 `config:"format"`
+	CSV           csvConfig              `config:"csv"`
+	Table         string                 `config:"table"`
+	Query         string                 `config:"query"`
+	Fields        []string               `config:"fields" validate:"required"`
+	KeyColumns    []string               `config:"key_columns" validate:"required"`
+	Columns       []string               `config:"columns"`
+	Target        string                 `config:"target"`
+	Default       map[string]interface{} `config:"default"`
+	OverwriteKeys bool                   `config:"overwrite_keys"`
+	IgnoreMissing bool                   `config:"ignore_missing"`
+	Reload        struct {
+		Period time.Duration `config:"period" validate:"min=0"`
+	} `config:"reload"`
+}
+
+type csvConfig struct {
+	Separator string `config:"separator"`
+}
+
+func defaultConfig() config {
+	c := config{
+		CSV:           csvConfig{Separator: ","},
+		OverwriteKeys: true,
+	}
+	c.Reload.Period = 10 * time.Second
+	return c
+}
+
+func (c *config) Validate() error {
+	if len(c.Fields) != len(c.KeyColumns) {
+		return fmt.Errorf("fields and key_columns must have the same length, got %d fields and %d key columns",
+			len(c.Fields), len(c.KeyColumns))
+	}
+	if c.Format == formatAuto {
+		f, err := formatFromExtension(c.File)
+		if err != nil {
+			return err
+		}
+		c.Format = f
+	}
+	switch c.Format {
+	case formatCSV:
+		if len([]rune(c.CSV.Separator)) != 1 {
+			return errors.New("csv.separator must be a single character")
+		}
+	case formatSQLite:
+		if (c.Table == "") == (c.Query == "") {
+			return errors.New("either table or query must be set for sqlite files")
+		}
+	}
+	if c.Format != formatSQLite && (c.Table != "" || c.Query != "") {
+		return errors.New("table and query can only be used with sqlite files")
+	}
+	return nil
+}
+
+// format is the format of the table file.
+type format uint8
+
+const (
+	formatAuto format = iota
+	formatCSV
+	formatNDJSON
+	formatSQLite
+)
+
+var formatNames = map[format]string{
+	formatCSV:    "csv",
+	formatNDJSON: "ndjson",
+	formatSQLite: "sqlite",
+}
+
+func (f *format) Unpack(v string) error {
+	for k, name := range formatNames {
+		if strings.EqualFold(v, name) {
+			*f = k
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid format %q, must be one of csv, ndjson or sqlite", v)
+}
+
+func (f format) String() string {
+	return formatNames[f]
+}
+
+func formatFromExtension(path string) (format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return formatCSV, nil
+	case ".ndjson", ".jsonl", ".json":
+		return formatNDJSON, nil
+	case ".db", ".sqlite", ".sqlite3":
+		return formatSQLite, nil
+	}
+	return formatAuto, fmt.Errorf("can not detect the format of %s, set format to csv, ndjson or sqlite", path)
+}
@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package enrich
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/common/filereload"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const processorName = "enrich"
+const logName = "processor." + processorName
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type metrics struct {
+	entries      *monitoring.Int
+	hits         *monitoring.Uint
+	misses       *monitoring.Uint
+	reloads      *monitoring.Uint
+	reloadErrors *monitoring.Uint
+}
+
+type enrich struct {
+	config   config
+	defaults []field
+	log      *logp.Logger
+	regName  string
+	metrics  metrics
+
+	file *filereload.File // holds a *table
+}
+
+// New constructs a new enrich processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the enrich configuration")
+	}
+
+	var (
+		id      = int(instanceID.Inc())
+		log     = logp.NewLogger(logName).With("instance_id", id)
+		regName = logName + "." + strconv.Itoa(id)
+		reg     = monitoring.Default.NewRegistry(regName, monitoring.DoNotReport)
+	)
+
+	p := &enrich{
+		config:   config,
+		defaults: flatten(config.Target, common.MapStr(config.Default)),
+		log:      log,
+		regName:  regName,
+		metrics: metrics{
+			entries:      monitoring.NewInt(reg, "table.entries"),
+			hits:         monitoring.NewUint(reg, "lookup.hits"),
+			misses:       monitoring.NewUint(reg, "lookup.misses"),
+			reloads:      monitoring.NewUint(reg, "reload.count"),
+			reloadErrors: monitoring.NewUint(reg, "reload.errors"),
+		},
+	}
+
+	file, err := filereload.New(config.File, config.Reload.Period, p.loadTable, p.reloadFailed)
+	if err != nil {
+		p.Close()
+		return nil, errors.Wrapf(err, "failed to load enrich table %v", config.File)
+	}
+	p.file = file
+	monitoring.NewFunc(reg, "reload.last", p.reportLastReload)
+	return p, nil
+}
+
+// Run adds the fields of the table row matching the values of the event
+// fields, or the default fields if no row matches.
+func (p *enrich) Run(event *beat.Event) (*beat.Event, error) {
+	values := make([]interface{}, len(p.config.Fields))
+	for i, f := range p.config.Fields {
+		v, err := event.GetValue(f)
+		if err != nil {
+			if p.config.IgnoreMissing {
+				return event, nil
+			}
+			return event, errors.Wrapf(err, "failed to get enrich key field %v", f)
+		}
+		values[i] = v
+	}
+
+	fields, found := p.getTable().rows[tableKey(values)]
+	if found {
+		p.metrics.hits.Inc()
+	} else {
+		p.metrics.misses.Inc()
+		fields = p.defaults
+	}
+
+	for _, f := range fields {
+		if !p.config.OverwriteKeys {
+			if exists, _ := event.Fields.HasKey(f.path); exists {
+				continue
+			}
+		}
+		if _, err := event.PutValue(f.path, cloneValue(f.value)); err != nil {
+			return event, errors.Wrapf(err, "failed to put enrich field %v", f.path)
+		}
+	}
+	return event, nil
+}
+
+// getTable returns the current table. The file is reloaded in the background
+// if it changed.
+func (p *enrich) getTable() *table {
+	return p.file.Get().(*table)
+}
+
+// loadTable loads the table file.
+func (p *enrich) loadTable(_ string) (interface{}, error) {
+	t, err := loadTable(&p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.metrics.entries.Set(int64(len(t.rows)))
+	p.metrics.reloads.Inc()
+	if t.skipped > 0 {
+		p.log.Warnf("Skipped %d rows of enrich table %v missing a key column", t.skipped, p.config.File)
+	}
+	p.log.Debugf("Loaded %d entries from enrich table %v", len(t.rows), p.config.File)
+	return t, nil
+}
+
+func (p *enrich) reloadFailed(err error) {
+	p.metrics.reloadErrors.Inc()
+	p.log.Errorf("Failed to reload enrich table %v, keeping the previous table: %v", p.config.File, err)
+}
+
+func (p *enrich) reportLastReload(_ monitoring.Mode, V monitoring.Visitor) {
+	V.OnRegistryStart()
+	defer V.OnRegistryFinished()
+
+	monitoring.ReportInt(V, "age_ms", time.Since(p.getTable().loaded).Milliseconds())
+}
+
+// Close removes the metrics of the processor. The metrics reference the
+// processor, so they would keep the table in memory.
+func (p *enrich) Close() error {
+	monitoring.Default.Remove(p.regName)
+	return nil
+}
+
+func (p *enrich) String() string {
+	return fmt.Sprintf("%v=[file=%v, format=%v, fields=%v, key_columns=%v, target=%v]",
+		processorName, p.config.File, p.config.Format, p.config.Fields, p.config.KeyColumns, p.config.Target)
+}
+
+// cloneValue copies slices, so events don't share them with the table.
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return append([]interface{}(nil), v...)
+	case []string:
+		return append([]string(nil), v...)
+	}
+	return v
+}
@@ -0,0 +1,277 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package enrich
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors/processortest"
+)
+
+const servicesCSV = `# service owners
+jiduservicename,region,owner.team,owner.email
+checkout,eu,payments,payments@example.com
+checkout,us,payments-us,
+search,eu,discovery,discovery@example.com
+`
+
+const vehiclesNDJSON = `{"vid": "V001", "model": "ROBO-01", "specs": {"battery": 100, "seats": [1, 2]}}
+
+{"vid": 2, "model": "ROBO-02"}
+{"model": "no key"}
+`
+
+func writeTable(t testing.TB, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func newTestEnrich(t testing.TB, cfg common.MapStr) *enrich {
+	t.Helper()
+	return processortest.New(t, New, cfg).(*enrich)
+}
+
+func TestEnrichCSV(t *testing.T) {
+	p := newTestEnrich(t, common.MapStr{
+		"file":        writeTable(t, "services.csv", servicesCSV),
+		"fields":      []string{"jiduservicename", "cloud.region"},
+		"key_columns": []string{"jiduservicename", "region"},
+		"target":      "service",
+		"default":     common.MapStr{"owner": common.MapStr{"team": "unknown", "email": "ops@example.com"}},
+	})
+
+	assert.Equal(t, common.MapStr{
+		"jiduservicename": "checkout",
+		"cloud":           common.MapStr{"region": "eu"},
+		"service": common.MapStr{
+			"owner": common.MapStr{"team": "payments", "email": "payments@example.com"},
+		},
+	}, processortest.RunFields(t, p, common.MapStr{"jiduservicename": "checkout", "cloud": common.MapStr{"region": "eu"}}))
+
+	assert.Equal(t, common.MapStr{
+		"owner": common.MapStr{"team": "payments-us", "email": "ops@example.com"},
+	}, processortest.RunFields(t, p, common.MapStr{"jiduservicename": "checkout", "cloud": common.MapStr{"region": "us"}})["service"],
+		"empty cells must be filled with the defaults")
+
+	assert.Equal(t, common.MapStr{
+		"owner": common.MapStr{"team": "unknown", "email": "ops@example.com"},
+	}, processortest.RunFields(t, p, common.MapStr{"jiduservicename": "search", "cloud": common.MapStr{"region": "us"}})["service"])
+
+	assert.Equal(t, uint64(2), p.metrics.hits.Get())
+	assert.Equal(t, uint64(1), p.metrics.misses.Get())
+	assert.Equal(t, int64(3), p.metrics.entries.Get())
+}
+
+func TestEnrichNDJSON(t *testing.T) {
+	p := newTestEnrich(t, common.MapStr{
+		"file":        writeTable(t, "vehicles.ndjson", vehiclesNDJSON),
+		"fields":      []string{"x-header_vid"},
+		"key_columns": []string{"vid"},
+		"target":      "vehicle",
+	})
+
+	fields := processortest.RunFields(t, p, common.MapStr{"x-header_vid": "V001"})
+	assert.Equal(t, common.MapStr{
+		"model": "ROBO-01",
+		"specs": common.MapStr{"battery": float64(100), "seats": []interface{}{float64(1), float64(2)}},
+	}, fields["vehicle"])
+
+	fields = processortest.RunFields(t, p, common.MapStr{"x-header_vid": 2})
+	assert.Equal(t, common.MapStr{"model": "ROBO-02"}, fields["vehicle"], "keys must match regardless of the type")
+
+	fields = processortest.RunFields(t, p, common.MapStr{"x-header_vid": "V003"})
+	assert.NotContains(t, fields, "vehicle")
+
+	assert.Equal(t, int64(2), p.metrics.entries.Get())
+}
+
+func TestEnrichSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vehicles.db")
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`CREATE TABLE vehicles (vid TEXT, model TEXT, year INTEGER, note TEXT)`,
+		`INSERT INTO vehicles VALUES ('V001', 'ROBO-01', 2021, NULL), ('V002', 'ROBO-02', 2022, 'test fleet')`,
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	p := newTestEnrich(t, common.MapStr{
+		"file":        path,
+		"table":       "vehicles",
+		"fields":      []string{"x-header_vid"},
+		"key_columns": []string{"vid"},
+		"columns":     []string{"model", "year", "note"},
+		"target":      "vehicle",
+	})
+	assert.Equal(t, common.MapStr{"model": "ROBO-01", "year": int64(2021)},
+		processortest.RunFields(t, p, common.MapStr{"x-header_vid": "V001"})["vehicle"])
+
+	p = newTestEnrich(t, common.MapStr{
+		"file":        path,
+		"query":       "SELECT vid AS id, upper(note) AS note FROM vehicles WHERE note IS NOT NULL",
+		"fields":      []string{"x-header_vid"},
+		"key_columns": []string{"id"},
+	})
+	assert.Equal(t, common.MapStr{"x-header_vid": "V002", "note": "TEST FLEET"},
+		processortest.RunFields(t, p, common.MapStr{"x-header_vid": "V002"}))
+	assert.Equal(t, int64(1), p.metrics.entries.Get())
+}
+
+func TestEnrichOptions(t *testing.T) {
+	path := writeTable(t, "services.csv", servicesCSV)
+
+	t.Run("overwrite_keys", func(t *testing.T) {
+		p := newTestEnrich(t, common.MapStr{
+			"file":           path,
+			"fields":         []string{"name", "region"},
+			"key_columns":    []string{"jiduservicename", "region"},
+			"overwrite_keys": false,
+		})
+		fields := processortest.RunFields(t, p, common.MapStr{"name": "search", "region": "eu", "owner": common.MapStr{"team": "search"}})
+		assert.Equal(t, common.MapStr{"team": "search", "email": "discovery@example.com"}, fields["owner"])
+	})
+
+	t.Run("ignore_missing", func(t *testing.T) {
+		cfg := common.MapStr{
+			"file":        path,
+			"fields":      []string{"name", "region"},
+			"key_columns": []string{"jiduservicename", "region"},
+		}
+		p := newTestEnrich(t, cfg)
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{"name": "search"}})
+		assert.Error(t, err)
+		assert.NotNil(t, event)
+
+		cfg["ignore_missing"] = true
+		p = newTestEnrich(t, cfg)
+		assert.Equal(t, common.MapStr{"name": "search"}, processortest.RunFields(t, p, common.MapStr{"name": "search"}))
+	})
+
+	t.Run("separator", func(t *testing.T) {
+		p := newTestEnrich(t, common.MapStr{
+			"file":          writeTable(t, "services.txt", "name;team\ncheckout;payments\n"),
+			"format":        "csv",
+			"csv.separator": ";",
+			"fields":        []string{"name"},
+			"key_columns":   []string{"name"},
+		})
+		assert.Equal(t, "payments", processortest.RunFields(t, p, common.MapStr{"name": "checkout"})["team"])
+	})
+}
+
+func TestEnrichReload(t *testing.T) {
+	path := writeTable(t, "services.csv", "name,team\ncheckout,payments\n")
+	p := newTestEnrich(t, common.MapStr{
+		"file":          path,
+		"fields":        []string{"name"},
+		"key_columns":   []string{"name"},
+		"reload.period": "1h",
+	})
+	assert.Equal(t, "payments", processortest.RunFields(t, p, common.MapStr{"name": "checkout"})["team"])
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("name,team\ncheckout,checkout\nsearch,discovery\n"), 0o600))
+	assert.Equal(t, "payments", processortest.RunFields(t, p, common.MapStr{"name": "checkout"})["team"],
+		"the file must not be checked before the reload period")
+
+	loaded, err := p.file.Reload()
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, "checkout", processortest.RunFields(t, p, common.MapStr{"name": "checkout"})["team"])
+	assert.Equal(t, int64(2), p.metrics.entries.Get())
+	assert.Equal(t, uint64(2), p.metrics.reloads.Get())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("name,team\n\"broken\n"), 0o600))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+	_, err = p.file.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "discovery", processortest.RunFields(t, p, common.MapStr{"name": "search"})["team"],
+		"the previous table must be kept if the file is invalid")
+	assert.Equal(t, uint64(1), p.metrics.reloadErrors.Get())
+
+	reg := monitoring.NewRegistry()
+	monitoring.NewFunc(reg, "last", p.reportLastReload)
+	snapshot := monitoring.CollectStructSnapshot(reg, monitoring.Full, false)
+	assert.Contains(t, snapshot["last"], "age_ms")
+}
+
+func TestEnrichClose(t *testing.T) {
+	p := newTestEnrich(t, common.MapStr{
+		"file":        writeTable(t, "services.csv", servicesCSV),
+		"fields":      []string{"jiduservicename"},
+		"key_columns": []string{"jiduservicename"},
+	})
+	require.NotNil(t, monitoring.Default.Get(p.regName))
+
+	require.NoError(t, p.Close())
+	assert.Nil(t, monitoring.Default.Get(p.regName), "the metrics must be removed")
+}
+
+func TestEnrichConfig(t *testing.T) {
+	csvFile := writeTable(t, "services.csv", servicesCSV)
+
+	tests := map[string]common.MapStr{
+		"missing file":         {"file": filepath.Join(t.TempDir(), "missing.csv"), "fields": []string{"a"}, "key_columns": []string{"a"}},
+		"unknown extension":    {"file": "table.txt", "fields": []string{"a"}, "key_columns": []string{"a"}},
+		"key length mismatch":  {"file": csvFile, "fields": []string{"a", "b"}, "key_columns": []string{"a"}},
+		"unknown key column":   {"file": csvFile, "fields": []string{"a"}, "key_columns": []string{"a"}},
+		"table for csv":        {"file": csvFile, "table": "t", "fields": []string{"a"}, "key_columns": []string{"region"}},
+		"sqlite without table": {"file": "table.db", "fields": []string{"a"}, "key_columns": []string{"a"}},
+		"invalid separator":    {"file": csvFile, "csv.separator": ";;", "fields": []string{"a"}, "key_columns": []string{"region"}},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(cfg))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func BenchmarkEnrich(b *testing.B) {
+	p := newTestEnrich(b, common.MapStr{
+		"file":        writeTable(b, "services.csv", servicesCSV),
+		"fields":      []string{"jiduservicename", "region"},
+		"key_columns": []string{"jiduservicename", "region"},
+		"target":      "service",
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := p.Run(&beat.Event{Fields: common.MapStr{"jiduservicename": "search", "region": "eu"}})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package enrich
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	_ "modernc.org/sqlite" // Register the pure Go SQLite driver.
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// table maps the keys of the rows to the fields added to the events.
+type table struct {
+	rows    map[string][]field
+	skipped int
+	loaded  time.Time
+}
+
+// field is a leaf field added to the events, the path includes the target.
+type field struct {
+	path  string
+	value interface{}
+}
+
+// tableBuilder creates the table entries from the rows of a table file.
+type tableBuilder struct {
+	config   *config
+	defaults common.MapStr
+	table    *table
+}
+
+func newTableBuilder(c *config) *tableBuilder {
+	return &tableBuilder{
+		config:   c,
+		defaults: common.MapStr(c.Default).Clone(),
+		table:    &table{rows: map[string][]field{}},
+	}
+}
+
+// add adds a row to the table. Rows missing a key column are skipped, later
+// rows replace earlier rows with the same key.
+func (b *tableBuilder) add(row common.MapStr) {
+	values := make([]interface{}, len(b.config.KeyColumns))
+	for i, column := range b.config.KeyColumns {
+		v, err := row.GetValue(column)
+		if err != nil || v == nil {
+			b.table.skipped++
+			return
+		}
+		values[i] = v
+	}
+
+	fields := common.MapStr{}
+	if len(b.config.Columns) > 0 {
+		for _, column := range b.config.Columns {
+			if v, err := row.GetValue(column); err == nil {
+				fields.Put(column, v)
+			}
+		}
+	} else {
+		fields = row.Clone()
+		for _, column := range b.config.KeyColumns {
+			fields.Delete(column)
+		}
+	}
+
+	entry := b.defaults.Clone()
+	entry.DeepUpdate(fields)
+	b.table.rows[tableKey(values)] = flatten(b.config.Target, entry)
+}
+
+// flatten returns the leaf fields of m, prefixed with the target.
+func flatten(target string, m common.MapStr) []field {
+	flat := m.Flatten()
+	fields := make([]field, 0, len(flat))
+	for k, v := range flat {
+		if target != "" {
+			k = target + "." + k
+		}
+		fields = append(fields, field{path: k, value: v})
+	}
+	return fields
+}
+
+// tableKey returns the key of the values of the key columns or event fields.
+func tableKey(values []interface{}) string {
+	var b strings.Builder
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		if s, ok := v.(string); ok {
+			b.WriteString(s)
+		} else {
+			fmt.Fprint(&b, v)
+		}
+	}
+	return b.String()
+}
+
+// loadTable reads the table file.
+func loadTable(c *config) (*table, error) {
+	b := newTableBuilder(c)
+
+	var err error
+	switch c.Format {
+	case formatCSV:
+		err = loadCSV(c, b)
+	case formatNDJSON:
+		err = loadNDJSON(c, b)
+	case formatSQLite:
+		err = loadSQLite(c, b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.table.loaded = time.Now()
+	return b.table, nil
+}
+
+// loadCSV reads a CSV file with a header row. Empty cells are treated as
+// missing values.
+func loadCSV(c *config, b *tableBuilder) error {
+	f, err := os.Open(c.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(bufio.NewReader(f))
+	r.Comma = []rune(c.CSV.Separator)[0]
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = strings.TrimSpace(name)
+	}
+	for _, column := range c.KeyColumns {
+		if !contains(columns, column) {
+			return fmt.Errorf("key column %q not found in CSV header", column)
+		}
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV record: %w", err)
+		}
+
+		row := common.MapStr{}
+		for i, v := range record {
+			if i < len(columns) && v != "" {
+				row.Put(columns[i], v)
+			}
+		}
+		b.add(row)
+	}
+}
+
+// loadNDJSON reads a file with a JSON object per line. Empty lines are
+// ignored.
+func loadNDJSON(c *config, b *tableBuilder) error {
+	f, err := os.Open(c.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for line := 1; ; line++ {
+		var row common.MapStr
+		err := dec.Decode(&row)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode JSON object %d: %w", line, err)
+		}
+		b.add(row)
+	}
+}
+
+// loadSQLite reads the rows of a table, or the rows returned by a query, from
+// a SQLite database opened read-only. NULL values are treated as missing.
+func loadSQLite(c *config, b *tableBuilder) error {
+	if _, err := os.Stat(c.File); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", "file:"+c.File+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := c.Query
+	if query == "" {
+		query = `SELECT * FROM "` + strings.ReplaceAll(c.Table, `"`, `""`) + `"`
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query SQLite database: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("failed to read SQLite row: %w", err)
+		}
+		row := common.MapStr{}
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+			case []byte:
+				row.Put(columns[i], string(v))
+			default:
+				row.Put(columns[i], v)
+			}
+		}
+		b.add(row)
+	}
+	return rows.Err()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"fmt"
+)
+
+type config struct {
+	Field              string            `config:"field"`
+	Patterns           []string          `config:"patterns" validate:"required"`
+	PatternDefinitions map[string]string `config:"pattern_definitions"`
+	PatternFiles       []string          `config:"pattern_files"`
+	TargetPrefix       string            `config:"target_prefix"`
+	IgnoreMissing      bool              `config:"ignore_missing"`
+	IgnoreFailure      bool              `config:"ignore_failure"`
+	OverwriteKeys      bool              `config:"overwrite_keys"`
+}
+
+var defaultConfig = config{
+	Field:         "message",
+	OverwriteKeys: true,
+}
+
+// definitions returns the pattern definitions available to the patterns. The
+// core patterns are overridden by the pattern files, in the order they are
+// configured, and the pattern files by pattern_definitions.
+func (c *config) definitions() (map[string]string, error) {
+	definitions := make(map[string]string, len(builtinPatterns))
+	for name, pattern := range builtinPatterns {
+		definitions[name] = pattern
+	}
+
+	for _, path := range c.PatternFiles {
+		patterns, err := loadPatternFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pattern file: %w", err)
+		}
+		for name, pattern := range patterns {
+			definitions[name] = pattern
+		}
+	}
+
+	for name, pattern := range c.PatternDefinitions {
+		definitions[name] = pattern
+	}
+	return definitions, nil
+}
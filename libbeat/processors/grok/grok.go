@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// grokReference matches pattern references like %{NAME}, %{NAME:field} and
+// %{NAME:field:type}.
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([^:}]+)(?::(\w+))?)?\}`)
+
+// namedGroup matches named capture groups in regular expressions, (?<name>...)
+// and (?P<name>...), but not lookbehind assertions.
+var namedGroup = regexp.MustCompile(`\(\?P?<([^>=!][^>]*)>`)
+
+// maxNesting limits the depth of pattern references, to detect recursive
+// pattern definitions.
+const maxNesting = 64
+
+// dataType is the type a captured value is converted to.
+type dataType uint8
+
+const (
+	typeString dataType = iota
+	typeInteger
+	typeFloat
+	typeBoolean
+)
+
+var dataTypes = map[string]dataType{
+	"string":  typeString,
+	"int":     typeInteger,
+	"long":    typeInteger,
+	"float":   typeFloat,
+	"double":  typeFloat,
+	"boolean": typeBoolean,
+}
+
+// capture maps a capture group of a compiled pattern to an event field.
+type capture struct {
+	group int
+	field string
+	typ   dataType
+}
+
+// expression is a compiled grok pattern.
+type expression struct {
+	pattern  string
+	re       *regexp.Regexp
+	captures []capture
+}
+
+// compiled caches the compiled regular expressions by their source, so
+// processors using the same patterns share them.
+var compiled = struct {
+	sync.Mutex
+	regexps map[string]*regexp.Regexp
+}{regexps: map[string]*regexp.Regexp{}}
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	compiled.Lock()
+	defer compiled.Unlock()
+
+	if re, ok := compiled.regexps[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	compiled.regexps[expr] = re
+	return re, nil
+}
+
+// compile expands the pattern references in pattern with the given pattern
+// definitions and compiles the resulting regular expression.
+func compile(pattern string, definitions map[string]string) (*expression, error) {
+	c := compiler{definitions: definitions}
+	expanded, err := c.expand(pattern, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := compileRegexp(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile pattern '%s': %w", pattern, err)
+	}
+
+	expr := &expression{pattern: pattern, re: re}
+	for _, f := range c.fields {
+		expr.captures = append(expr.captures, capture{
+			group: re.SubexpIndex(f.group),
+			field: f.field,
+			typ:   f.typ,
+		})
+	}
+	return expr, nil
+}
+
+type compiler struct {
+	definitions map[string]string
+	fields      []namedField
+}
+
+type namedField struct {
+	group string
+	field string
+	typ   dataType
+}
+
+// expand replaces the pattern references and named groups in pattern.
+// References with a field name become named capture groups, the names of the
+// groups are generated, as field names are not valid group names.
+func (c *compiler) expand(pattern string, stack []string) (string, error) {
+	if len(stack) > maxNesting {
+		return "", fmt.Errorf("pattern references nested too deeply: %s", strings.Join(stack, " -> "))
+	}
+
+	pattern = namedGroup.ReplaceAllStringFunc(pattern, func(group string) string {
+		name := namedGroup.FindStringSubmatch(group)[1]
+		return "(?P<" + c.addField(name, typeString) + ">"
+	})
+
+	var err error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+
+		m := grokReference.FindStringSubmatch(ref)
+		name, field, typeName := m[1], m[2], m[3]
+		for _, s := range stack {
+			if s == name {
+				err = fmt.Errorf("recursive pattern reference: %s -> %s", strings.Join(stack, " -> "), name)
+				return ""
+			}
+		}
+		definition, ok := c.definitions[name]
+		if !ok {
+			err = fmt.Errorf("pattern '%s' is not defined", name)
+			return ""
+		}
+
+		var inner string
+		inner, err = c.expand(definition, append(stack, name))
+		if err != nil {
+			return ""
+		}
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+
+		typ := typeString
+		if typeName != "" {
+			if typ, ok = dataTypes[typeName]; !ok {
+				err = fmt.Errorf("unsupported type '%s' for field '%s'", typeName, field)
+				return ""
+			}
+		}
+		return "(?P<" + c.addField(field, typ) + ">" + inner + ")"
+	})
+	return expanded, err
+}
+
+func (c *compiler) addField(name string, typ dataType) string {
+	group := "g" + strconv.Itoa(len(c.fields))
+	c.fields = append(c.fields, namedField{group: group, field: fieldName(name), typ: typ})
+	return group
+}
+
+// fieldName converts field names in Logstash notation, like [source][ip], to
+// dotted field names.
+func fieldName(name string) string {
+	if !strings.HasPrefix(name, "[") {
+		return name
+	}
+	return strings.ReplaceAll(strings.Trim(name, "[]"), "][", ".")
+}
+
+// match applies the expression to s and returns the captured fields, or nil if
+// the expression does not match. Captures that did not participate in the
+// match are omitted. If a field is captured multiple times, the first value
+// is used.
+func (e *expression) match(s string) (map[string]interface{}, error) {
+	loc := e.re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+
+	fields := make(map[string]interface{}, len(e.captures))
+	for _, c := range e.captures {
+		start, end := loc[2*c.group], loc[2*c.group+1]
+		if start < 0 {
+			continue
+		}
+		if _, exists := fields[c.field]; exists {
+			continue
+		}
+
+		value, err := convert(s[start:end], c.typ)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert field '%s': %w", c.field, err)
+		}
+		fields[c.field] = value
+	}
+	return fields, nil
+}
+
+func convert(s string, typ dataType) (interface{}, error) {
+	switch typ {
+	case typeInteger:
+		return strconv.ParseInt(s, 10, 64)
+	case typeFloat:
+		return strconv.ParseFloat(s, 64)
+	case typeBoolean:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorePatterns(t *testing.T) {
+	cases := map[string]struct {
+		pattern string
+		input   string
+		want    map[string]interface{}
+	}{
+		"syslog": {
+			pattern: `%{SYSLOGBASE} %{GREEDYDATA:message}`,
+			input:   `Mar  1 10:20:30 gateway sshd[4242]: Accepted publickey for root`,
+			want: map[string]interface{}{
+				"timestamp": "Mar  1 10:20:30",
+				"logsource": "gateway",
+				"program":   "sshd",
+				"pid":       "4242",
+				"message":   "Accepted publickey for root",
+			},
+		},
+		"apache combined log": {
+			pattern: `%{COMBINEDAPACHELOG}`,
+			input:   `10.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			want: map[string]interface{}{
+				"clientip":    "10.0.0.1",
+				"ident":       "-",
+				"auth":        "frank",
+				"timestamp":   "10/Oct/2000:13:55:36 -0700",
+				"verb":        "GET",
+				"request":     "/apache_pb.gif",
+				"httpversion": "1.0",
+				"response":    "200",
+				"bytes":       "2326",
+				"referrer":    `"http://www.example.com/start.html"`,
+				"agent":       `"Mozilla/4.08"`,
+			},
+		},
+		"ip addresses": {
+			pattern: `%{IP:source.ip} -> %{IP:destination.ip}`,
+			input:   `192.168.1.255 -> 2001:db8::8a2e:370:7334`,
+			want: map[string]interface{}{
+				"source.ip":      "192.168.1.255",
+				"destination.ip": "2001:db8::8a2e:370:7334",
+			},
+		},
+		"iso8601 timestamp and log level": {
+			pattern: `^%{TIMESTAMP_ISO8601:timestamp} %{LOGLEVEL:log.level} %{UUID:trace.id}`,
+			input:   `2022-03-01T10:20:30.123+01:00 WARN 0f8fad5b-d9cb-469f-a165-70867728950e`,
+			want: map[string]interface{}{
+				"timestamp": "2022-03-01T10:20:30.123+01:00",
+				"log.level": "WARN",
+				"trace.id":  "0f8fad5b-d9cb-469f-a165-70867728950e",
+			},
+		},
+		"uri and quoted string": {
+			pattern: `%{URI:url.original} %{QS:quoted}`,
+			input:   `https://user@example.com:8443/path/to?q=1&r=2 "say \"hi\""`,
+			want: map[string]interface{}{
+				"url.original": "https://user@example.com:8443/path/to?q=1&r=2",
+				"port":         "8443",
+				"quoted":       `"say \"hi\""`,
+			},
+		},
+		"mac and email": {
+			pattern: `%{MAC:mac} %{EMAILADDRESS:email}`,
+			input:   `00:1a:2b:3c:4d:5e jane.doe+logs@mail.example.com`,
+			want: map[string]interface{}{
+				"mac":   "00:1a:2b:3c:4d:5e",
+				"email": "jane.doe+logs@mail.example.com",
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			expr, err := compile(c.pattern, builtinPatterns)
+			require.NoError(t, err)
+			fields, err := expr.match(c.input)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, fields)
+		})
+	}
+}
+
+func TestCompileAllCorePatterns(t *testing.T) {
+	for name := range builtinPatterns {
+		_, err := compile("%{"+name+"}", builtinPatterns)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestTypedCaptures(t *testing.T) {
+	expr, err := compile(`%{NUMBER:pid:int} %{NUMBER:load:float} %{WORD:ok:boolean} %{NUMBER:raw}`, builtinPatterns)
+	require.NoError(t, err)
+
+	fields, err := expr.match("4242 0.75 true 12")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"pid":  int64(4242),
+		"load": 0.75,
+		"ok":   true,
+		"raw":  "12",
+	}, fields)
+
+	_, err = expr.match("4242 0.75 maybe 12")
+	assert.Error(t, err)
+
+	_, err = compile(`%{NUMBER:pid:uuid}`, builtinPatterns)
+	assert.Error(t, err)
+}
+
+func TestCaptures(t *testing.T) {
+	definitions := map[string]string{
+		"KV":         `(?<key>\w+)=(?P<value>\w+)`,
+		"LOOP":       `%{LOOP_AGAIN}`,
+		"LOOP_AGAIN": `%{LOOP}`,
+		"WORD":       builtinPatterns["WORD"],
+	}
+
+	t.Run("raw named groups and logstash field names", func(t *testing.T) {
+		expr, err := compile(`%{KV} (?<[event][action]>\w+)(?: %{WORD:[event][outcome]})?`, definitions)
+		require.NoError(t, err)
+		fields, err := expr.match("user=alice login")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"key":          "user",
+			"value":        "alice",
+			"event.action": "login",
+		}, fields)
+	})
+
+	t.Run("first capture of a field wins", func(t *testing.T) {
+		expr, err := compile(`(?:%{INT:n}|%{WORD:n}) %{WORD:n}`, builtinPatterns)
+		require.NoError(t, err)
+		fields, err := expr.match("abc def")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"n": "abc"}, fields)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		expr, err := compile(`^%{INT:n}$`, builtinPatterns)
+		require.NoError(t, err)
+		fields, err := expr.match("abc")
+		require.NoError(t, err)
+		assert.Nil(t, fields)
+	})
+
+	t.Run("undefined pattern", func(t *testing.T) {
+		_, err := compile(`%{MISSING:x}`, definitions)
+		assert.EqualError(t, err, "pattern 'MISSING' is not defined")
+	})
+
+	t.Run("recursive pattern", func(t *testing.T) {
+		_, err := compile(`%{LOOP}`, definitions)
+		assert.EqualError(t, err, "recursive pattern reference: LOOP -> LOOP_AGAIN -> LOOP")
+	})
+
+	t.Run("invalid regular expression", func(t *testing.T) {
+		_, err := compile(`(?=lookahead)`, definitions)
+		assert.Error(t, err)
+	})
+}
+
+func TestCompiledRegexpsAreCached(t *testing.T) {
+	a, err := compile(`%{SYSLOGBASE} %{GREEDYDATA:message}`, builtinPatterns)
+	require.NoError(t, err)
+	b, err := compile(`%{SYSLOGBASE} %{GREEDYDATA:message}`, builtinPatterns)
+	require.NoError(t, err)
+	assert.Same(t, a.re, b.re)
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const (
+	processorName    = "grok"
+	logName          = "processor.grok"
+	flagParsingError = "grok_parsing_error"
+)
+
+var errNoMatch = errors.New("no pattern matched")
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+type processor struct {
+	config      config
+	expressions []*expression
+	metrics     []patternMetrics
+	failures    *monitoring.Int
+	log         *logp.Logger
+}
+
+// patternMetrics counts how often a pattern was tried and matched or missed.
+type patternMetrics struct {
+	matched *monitoring.Int
+	missed  *monitoring.Int
+}
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+	jsprocessor.RegisterPlugin("Grok", New)
+}
+
+// New constructs a new grok processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	definitions, err := config.definitions()
+	if err != nil {
+		return nil, err
+	}
+
+	expressions := make([]*expression, len(config.Patterns))
+	for i, pattern := range config.Patterns {
+		if expressions[i], err = compile(pattern, definitions); err != nil {
+			return nil, err
+		}
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	p := &processor{
+		config:      config,
+		expressions: expressions,
+		metrics:     make([]patternMetrics, len(expressions)),
+		failures:    monitoring.NewInt(reg, "failures"),
+		log:         log,
+	}
+	patternsReg := reg.NewRegistry("patterns")
+	for i, expr := range expressions {
+		patternReg := patternsReg.NewRegistry(strconv.Itoa(i))
+		monitoring.NewString(patternReg, "pattern").Set(expr.pattern)
+		p.metrics[i] = patternMetrics{
+			matched: monitoring.NewInt(patternReg, "matched"),
+			missed:  monitoring.NewInt(patternReg, "missed"),
+		}
+	}
+	return p, nil
+}
+
+// Run applies the patterns in order to the configured field and stores the
+// captures of the first matching pattern in the event.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, common.ErrKeyNotFound) {
+			return event, nil
+		}
+		return p.fail(event, fmt.Errorf("could not fetch value for key: %s, Error: %w", p.config.Field, err))
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return p.fail(event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field))
+	}
+
+	for i, expr := range p.expressions {
+		fields, err := expr.match(s)
+		if err != nil {
+			p.metrics[i].matched.Inc()
+			return p.fail(event, err)
+		}
+		if fields == nil {
+			p.metrics[i].missed.Inc()
+			continue
+		}
+
+		p.metrics[i].matched.Inc()
+		if err := p.write(event, fields); err != nil {
+			return p.fail(event, err)
+		}
+		return event, nil
+	}
+
+	return p.fail(event, fmt.Errorf("%w in field `%s`", errNoMatch, p.config.Field))
+}
+
+// write stores the captured fields in the event. No field is modified if a
+// field can not be written.
+func (p *processor) write(event *beat.Event, fields map[string]interface{}) error {
+	backup := event.Fields.Clone()
+
+	prefix := ""
+	if p.config.TargetPrefix != "" {
+		prefix = p.config.TargetPrefix + "."
+	}
+	for field, value := range fields {
+		key := prefix + field
+		if !p.config.OverwriteKeys {
+			if _, err := event.GetValue(key); err != common.ErrKeyNotFound {
+				event.Fields = backup
+				return fmt.Errorf("cannot override existing key with `%s`", key)
+			}
+		}
+		if _, err := event.PutValue(key, value); err != nil {
+			event.Fields = backup
+			return fmt.Errorf("failed to write field `%s`: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (p *processor) fail(event *beat.Event, err error) (*beat.Event, error) {
+	p.failures.Inc()
+	p.log.Debugf("grok failed: %v", err)
+	if err := common.AddTagsWithKey(event.Fields, beat.FlagField, []string{flagParsingError}); err != nil {
+		p.log.Debugf("failed to add %s flag: %v", flagParsingError, err)
+	}
+	if p.config.IgnoreFailure {
+		return event, nil
+	}
+	return event, err
+}
+
+func (p *processor) String() string {
+	return processorName + "=[patterns=[" + strings.Join(p.config.Patterns, ", ") +
+		"], field=" + p.config.Field + ", target_prefix=" + p.config.TargetPrefix + "]"
+}
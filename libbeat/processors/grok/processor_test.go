@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func newTestProcessor(t *testing.T, settings common.MapStr) *processor {
+	t.Helper()
+	p, err := New(common.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	return p.(*processor)
+}
+
+func TestProcessorPatternsInOrder(t *testing.T) {
+	p := newTestProcessor(t, common.MapStr{
+		"patterns": []string{
+			`^%{TIMESTAMP_ISO8601:timestamp} %{LOGLEVEL:log.level} \[%{SERVICE:service.name}\] %{GREEDYDATA:message}$`,
+			`^%{SYSLOGTIMESTAMP:timestamp} %{SYSLOGPROG}: %{GREEDYDATA:message}$`,
+		},
+		"pattern_definitions": map[string]string{
+			"SERVICE": `[a-z-]+`,
+		},
+	})
+
+	event := &beat.Event{Fields: common.MapStr{
+		"message": "Mar  1 10:20:30 sshd[42]: Accepted publickey for root",
+	}}
+	event, err := p.Run(event)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"message":   "Accepted publickey for root",
+		"timestamp": "Mar  1 10:20:30",
+		"program":   "sshd",
+		"pid":       "42",
+	}, event.Fields)
+
+	event = &beat.Event{Fields: common.MapStr{
+		"message": "2022-03-01T10:20:30Z ERROR [billing-api] payment failed",
+	}}
+	event, err = p.Run(event)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"message":   "payment failed",
+		"timestamp": "2022-03-01T10:20:30Z",
+		"log":       common.MapStr{"level": "ERROR"},
+		"service":   common.MapStr{"name": "billing-api"},
+	}, event.Fields)
+
+	_, err = p.Run(&beat.Event{Fields: common.MapStr{"message": "unstructured"}})
+	assert.ErrorIs(t, err, errNoMatch)
+
+	assert.Equal(t, int64(1), p.failures.Get())
+	assert.Equal(t, int64(1), p.metrics[0].matched.Get())
+	assert.Equal(t, int64(2), p.metrics[0].missed.Get())
+	assert.Equal(t, int64(1), p.metrics[1].matched.Get())
+	assert.Equal(t, int64(1), p.metrics[1].missed.Get())
+}
+
+func TestProcessorPatternFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	require.NoError(t, os.WriteFile(first, []byte("# vehicle patterns\nVIN [A-HJ-NPR-Z0-9]{17}\nSPEED %{INT}\n"), 0o644))
+	require.NoError(t, os.WriteFile(second, []byte("\nSPEED %{NUMBER}\n"), 0o644))
+
+	p := newTestProcessor(t, common.MapStr{
+		"field":         "event.original",
+		"target_prefix": "vehicle",
+		"patterns":      []string{`%{VIN:id} speed=%{SPEED:speed:float}`},
+		"pattern_files": []string{first, second},
+	})
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{
+		"event": common.MapStr{"original": "WP0ZZZ99ZTS392124 speed=88.5"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"id":    "WP0ZZZ99ZTS392124",
+		"speed": 88.5,
+	}, event.Fields["vehicle"])
+}
+
+func TestProcessorFailures(t *testing.T) {
+	t.Run("failure is flagged", func(t *testing.T) {
+		p := newTestProcessor(t, common.MapStr{"patterns": []string{`^%{INT:code:int}$`}})
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{"message": "abc"}})
+		assert.Error(t, err)
+		flags, _ := event.GetValue(beat.FlagField)
+		assert.Equal(t, []string{flagParsingError}, flags)
+	})
+
+	t.Run("ignore failure", func(t *testing.T) {
+		p := newTestProcessor(t, common.MapStr{"patterns": []string{`^%{INT:code:int}$`}, "ignore_failure": true})
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{"message": 42}})
+		assert.NoError(t, err)
+		flags, _ := event.GetValue(beat.FlagField)
+		assert.Equal(t, []string{flagParsingError}, flags)
+	})
+
+	t.Run("ignore missing", func(t *testing.T) {
+		p := newTestProcessor(t, common.MapStr{"patterns": []string{`%{INT:code}`}, "ignore_missing": true})
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{"other": "1"}})
+		assert.NoError(t, err)
+		assert.Equal(t, common.MapStr{"other": "1"}, event.Fields)
+	})
+
+	t.Run("existing keys are kept", func(t *testing.T) {
+		p := newTestProcessor(t, common.MapStr{
+			"patterns":       []string{`%{INT:code} %{WORD:status}`},
+			"overwrite_keys": false,
+		})
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{"message": "1 ok", "status": "pending"}})
+		assert.Error(t, err)
+		assert.Equal(t, common.MapStr{
+			"message": "1 ok",
+			"status":  "pending",
+			"log":     common.MapStr{"flags": []string{flagParsingError}},
+		}, event.Fields)
+	})
+}
+
+func TestProcessorInvalidConfig(t *testing.T) {
+	cases := map[string]common.MapStr{
+		"no patterns":          {},
+		"undefined pattern":    {"patterns": []string{`%{NOPE}`}},
+		"missing pattern file": {"patterns": []string{`%{INT}`}, "pattern_files": []string{"/does/not/exist"}},
+	}
+	for name, settings := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(settings))
+			assert.Error(t, err)
+		})
+	}
+}
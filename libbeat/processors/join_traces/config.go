@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package join_traces
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+)
+
+type config struct {
+	TraceIDField      string             `config:"trace_id_field" validate:"required"`
+	SpanIDField       string             `config:"span_id_field" validate:"required"`
+	ParentSpanIDField string             `config:"parent_span_id_field" validate:"required"`
+	NameField         string             `config:"name_field"`
+	TimestampField    string             `config:"timestamp_field"`
+	TimestampLayout   string             `config:"timestamp_layout"`
+	ErrorWhen         *conditions.Config `config:"error_when"`
+	IdleTimeout       time.Duration      `config:"idle_timeout" validate:"positive,nonzero"`
+	MaxDuration       time.Duration      `config:"max_duration" validate:"positive,nonzero"`
+	MaxTraces         int                `config:"max_traces" validate:"min=1"`
+	MaxSpans          int                `config:"max_spans" validate:"min=1"`
+	Target            string             `config:"target"`
+	DropEvents        bool               `config:"drop_events"`
+	LateSpans         lateSpansConfig    `config:"late_spans"`
+}
+
+type lateSpansConfig struct {
+	Action lateAction    `config:"action"`
+	Window time.Duration `config:"window" validate:"min=0"`
+}
+
+func defaultConfig() config {
+	return config{
+		TraceIDField:      "trace_id",
+		SpanIDField:       "span_id",
+		ParentSpanIDField: "parent_span_id",
+		TimestampLayout:   "2006-01-02 15:04:05.000",
+		IdleTimeout:       30 * time.Second,
+		MaxDuration:       5 * time.Minute,
+		MaxTraces:         10000,
+		MaxSpans:          1000,
+		Target:            "trace",
+		LateSpans: lateSpansConfig{
+			Action: lateSummarize,
+			Window: 5 * time.Minute,
+		},
+	}
+}
+
+// defaultErrorWhen marks spans with events logged at the ERROR or FATAL level
+// as failed.
+func defaultErrorWhen() *conditions.Config {
+	return &conditions.Config{
+		In: map[string]interface{}{
+			"level": []interface{}{"ERROR", "FATAL"},
+		},
+	}
+}
+
+// lateAction is the action applied to spans of traces that were already
+// summarized.
+type lateAction uint8
+
+const (
+	lateSummarize lateAction = iota
+	lateForward
+	lateDrop
+)
+
+var lateActionNames = map[lateAction]string{
+	lateSummarize: "summarize",
+	lateForward:   "forward",
+	lateDrop:      "drop",
+}
+
+func (a *lateAction) Unpack(v string) error {
+	for k, name := range lateActionNames {
+		if strings.EqualFold(v, name) {
+			*a = k
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid late_spans.action %q, must be one of summarize, forward or drop", v)
+}
+
+func (a lateAction) String() string {
+	return lateActionNames[a]
+}
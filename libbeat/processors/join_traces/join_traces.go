@@ -0,0 +1,488 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package join_traces
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const processorName = "join_traces"
+const logName = "processor." + processorName
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type metrics struct {
+	traces    *monitoring.Int
+	events    *monitoring.Uint
+	summaries *monitoring.Uint
+	evicted   *monitoring.Uint
+	truncated *monitoring.Uint
+	late      *monitoring.Uint
+	dropped   *monitoring.Uint
+}
+
+type joinTraces struct {
+	config    config
+	errorWhen conditions.Condition
+	log       *logp.Logger
+	clock     clockwork.Clock
+
+	metrics metrics
+
+	mutex       sync.Mutex
+	traces      map[string]*trace
+	order       *list.List // open traces ordered by last activity, least recent first
+	closed      map[string]*list.Element
+	closedOrder *list.List // summarized trace IDs ordered by expiration
+	flusher     *util.Flusher
+}
+
+// trace holds the spans of a trace until the trace is summarized. The created
+// and updated times are the times the first and last events were processed,
+// while start and end are the earliest and latest event timestamps.
+type trace struct {
+	id          string
+	late        bool
+	created     time.Time
+	updated     time.Time
+	start, end  time.Time
+	events      uint64
+	errorEvents uint64
+	spans       map[string]*span
+	spanOrder   []*span
+	truncated   bool
+	elem        *list.Element
+}
+
+type span struct {
+	id, parent, name string
+	start, end       time.Time
+	failed           bool
+}
+
+// closedTrace is the ID of a summarized trace, remembered to detect late spans.
+type closedTrace struct {
+	id      string
+	expires time.Time
+}
+
+// New constructs a new join_traces processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the join_traces configuration")
+	}
+	if config.ErrorWhen == nil {
+		config.ErrorWhen = defaultErrorWhen()
+	}
+	errorWhen, err := conditions.NewCondition(config.ErrorWhen)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid error_when condition")
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	p := &joinTraces{
+		config:    config,
+		errorWhen: errorWhen,
+		log:       log,
+		clock:     clockwork.NewRealClock(),
+		metrics: metrics{
+			traces:    monitoring.NewInt(reg, "traces"),
+			events:    monitoring.NewUint(reg, "events"),
+			summaries: monitoring.NewUint(reg, "summaries"),
+			evicted:   monitoring.NewUint(reg, "evicted"),
+			truncated: monitoring.NewUint(reg, "truncated"),
+			late:      monitoring.NewUint(reg, "late"),
+			dropped:   monitoring.NewUint(reg, "dropped"),
+		},
+		traces:      map[string]*trace{},
+		order:       list.New(),
+		closed:      map[string]*list.Element{},
+		closedOrder: list.New(),
+	}
+	p.flusher = util.NewFlusher(log, config.IdleTimeout, config.MaxTraces, func(all bool) {
+		p.flush(p.clock.Now(), all)
+	}, p.metrics.summaries, p.metrics.dropped)
+	return p, nil
+}
+
+// Run adds the event to the span of its trace. Events without a trace ID are
+// returned unchanged.
+func (p *joinTraces) Run(event *beat.Event) (*beat.Event, error) {
+	traceID := p.stringValue(event, p.config.TraceIDField)
+	if traceID == "" {
+		return event, nil
+	}
+	var (
+		now    = p.clock.Now()
+		ts     = p.timestamp(event, now)
+		failed = p.errorWhen.Check(event)
+	)
+
+	p.mutex.Lock()
+	p.expireClosed(now)
+	t, open := p.traces[traceID]
+	if !open {
+		late := false
+		if _, closed := p.closed[traceID]; closed {
+			p.metrics.late.Inc()
+			switch p.config.LateSpans.Action {
+			case lateDrop:
+				p.mutex.Unlock()
+				return nil, nil
+			case lateForward:
+				p.mutex.Unlock()
+				return event, nil
+			}
+			late = true
+		}
+		t = p.open(traceID, late, now)
+	}
+
+	t.updated = now
+	p.order.MoveToBack(t.elem)
+	p.add(t, event, ts, failed)
+	p.mutex.Unlock()
+
+	p.metrics.events.Inc()
+	if p.config.DropEvents {
+		return nil, nil
+	}
+	return event, nil
+}
+
+// open creates a new trace, evicting the least recently active trace if the
+// maximum number of traces is reached. Must be called with the mutex held.
+func (p *joinTraces) open(id string, late bool, now time.Time) *trace {
+	if len(p.traces) >= p.config.MaxTraces {
+		p.evictOldest(now)
+	}
+	t := &trace{
+		id:      id,
+		late:    late,
+		created: now,
+		spans:   map[string]*span{},
+	}
+	t.elem = p.order.PushBack(t)
+	p.traces[id] = t
+	p.metrics.traces.Set(int64(len(p.traces)))
+	return t
+}
+
+// add adds an event to its span. Must be called with the mutex held.
+func (p *joinTraces) add(t *trace, event *beat.Event, ts time.Time, failed bool) {
+	t.events++
+	if failed {
+		t.errorEvents++
+	}
+	if t.start.IsZero() || ts.Before(t.start) {
+		t.start = ts
+	}
+	if ts.After(t.end) {
+		t.end = ts
+	}
+
+	spanID := p.stringValue(event, p.config.SpanIDField)
+	if spanID == "" {
+		return
+	}
+	s, exists := t.spans[spanID]
+	if !exists {
+		if len(t.spans) >= p.config.MaxSpans {
+			if !t.truncated {
+				t.truncated = true
+				p.metrics.truncated.Inc()
+			}
+			return
+		}
+		s = &span{
+			id:    spanID,
+			start: ts,
+			end:   ts,
+		}
+		t.spans[spanID] = s
+		t.spanOrder = append(t.spanOrder, s)
+	}
+
+	if ts.Before(s.start) {
+		s.start = ts
+	}
+	if ts.After(s.end) {
+		s.end = ts
+	}
+	if s.parent == "" {
+		s.parent = p.stringValue(event, p.config.ParentSpanIDField)
+	}
+	if s.name == "" && p.config.NameField != "" {
+		s.name = p.stringValue(event, p.config.NameField)
+	}
+	s.failed = s.failed || failed
+}
+
+// evictOldest summarizes the least recently active trace early. The summary is
+// queued and emitted by the flush loop. Must be called with the mutex held.
+func (p *joinTraces) evictOldest(now time.Time) {
+	elem := p.order.Front()
+	if elem == nil {
+		return
+	}
+	t := elem.Value.(*trace)
+	p.metrics.evicted.Inc()
+
+	if !p.flusher.Queue(p.closeTrace(t, now, true)) {
+		p.log.Debugf("Dropping summary of evicted trace %v, too many pending summaries", t.id)
+	}
+}
+
+// closeTrace removes a trace, remembers its ID to detect late spans and returns
+// its summary. Must be called with the mutex held.
+func (p *joinTraces) closeTrace(t *trace, now time.Time, evicted bool) beat.Event {
+	delete(p.traces, t.id)
+	p.order.Remove(t.elem)
+	p.metrics.traces.Set(int64(len(p.traces)))
+
+	if window := p.config.LateSpans.Window; window > 0 {
+		if elem, exists := p.closed[t.id]; exists {
+			p.closedOrder.Remove(elem)
+		} else if len(p.closed) >= p.config.MaxTraces {
+			p.removeClosed(p.closedOrder.Front())
+		}
+		p.closed[t.id] = p.closedOrder.PushBack(&closedTrace{id: t.id, expires: now.Add(window)})
+	}
+
+	return p.summary(t, evicted)
+}
+
+// expireClosed forgets the IDs of summarized traces after the late spans
+// window. Must be called with the mutex held.
+func (p *joinTraces) expireClosed(now time.Time) {
+	for elem := p.closedOrder.Front(); elem != nil; elem = p.closedOrder.Front() {
+		if now.Before(elem.Value.(*closedTrace).expires) {
+			return
+		}
+		p.removeClosed(elem)
+	}
+}
+
+func (p *joinTraces) removeClosed(elem *list.Element) {
+	delete(p.closed, elem.Value.(*closedTrace).id)
+	p.closedOrder.Remove(elem)
+}
+
+// SetEmitter sets the function used to publish the summary events and starts
+// the loop closing idle traces.
+func (p *joinTraces) SetEmitter(emit func(beat.Event)) {
+	p.flusher.SetEmitter(emit)
+	p.flusher.Start()
+}
+
+// flush emits the summaries of the evicted traces and of the traces that were
+// idle for idle_timeout or open for max_duration. If all is set, the summaries
+// of all traces are emitted.
+func (p *joinTraces) flush(now time.Time, all bool) {
+	var events []beat.Event
+	p.mutex.Lock()
+	for elem := p.order.Front(); elem != nil; {
+		t := elem.Value.(*trace)
+		elem = elem.Next()
+		if all || now.Sub(t.updated) >= p.config.IdleTimeout || now.Sub(t.created) >= p.config.MaxDuration {
+			events = append(events, p.closeTrace(t, now, false))
+		}
+	}
+	p.mutex.Unlock()
+
+	p.flusher.Emit(events)
+}
+
+// summary creates the summary event of a trace.
+func (p *joinTraces) summary(t *trace, evicted bool) beat.Event {
+	failedSpans := 0
+	orphans := 0
+	children := map[string][]*span{}
+	var root *span
+	for _, s := range t.spanOrder {
+		if s.failed {
+			failedSpans++
+		}
+		if _, found := t.spans[s.parent]; found && s.parent != s.id {
+			children[s.parent] = append(children[s.parent], s)
+			continue
+		}
+		if s.parent != "" {
+			orphans++
+		}
+		if root == nil || betterRoot(s, root) {
+			root = s
+		}
+	}
+
+	info := common.MapStr{
+		"id":    t.id,
+		"start": t.start,
+		"end":   t.end,
+		"duration": common.MapStr{
+			"us": t.end.Sub(t.start).Microseconds(),
+		},
+		"span_count":        len(t.spans),
+		"event_count":       t.events,
+		"error":             t.errorEvents > 0,
+		"error_count":       t.errorEvents,
+		"failed_span_count": failedSpans,
+		"orphan_span_count": orphans,
+	}
+	if root != nil {
+		info["root"] = spanInfo(root)
+		info["critical_path"] = criticalPath(root, children)
+	}
+	if t.truncated {
+		info["truncated"] = true
+	}
+	if evicted {
+		info["evicted"] = true
+	}
+	if t.late {
+		info["late"] = true
+	}
+
+	fields := common.MapStr{}
+	fields.Put(p.config.Target, info)
+	return beat.Event{
+		Timestamp: t.start,
+		Fields:    fields,
+	}
+}
+
+// betterRoot reports whether s is a better root span than root. Spans without
+// parent are preferred, then the earliest span.
+func betterRoot(s, root *span) bool {
+	if (s.parent == "") != (root.parent == "") {
+		return s.parent == ""
+	}
+	return s.start.Before(root.start)
+}
+
+// criticalPath returns the spans from the root to a leaf, following the child
+// ending last at every level. The child ending last is the one the parent
+// waited for the longest.
+func criticalPath(root *span, children map[string][]*span) []common.MapStr {
+	var path []common.MapStr
+	visited := map[string]bool{}
+	for s := root; s != nil && !visited[s.id]; {
+		visited[s.id] = true
+		path = append(path, spanInfo(s))
+
+		var next *span
+		for _, c := range children[s.id] {
+			if next == nil || c.end.After(next.end) {
+				next = c
+			}
+		}
+		s = next
+	}
+	return path
+}
+
+func spanInfo(s *span) common.MapStr {
+	info := common.MapStr{
+		"id": s.id,
+		"duration": common.MapStr{
+			"us": s.end.Sub(s.start).Microseconds(),
+		},
+	}
+	if s.name != "" {
+		info["name"] = s.name
+	}
+	if s.parent != "" {
+		info["parent_id"] = s.parent
+	}
+	if s.failed {
+		info["error"] = true
+	}
+	return info
+}
+
+// Close stops the flush loop and emits the summaries of all traces.
+func (p *joinTraces) Close() error {
+	p.flusher.Close()
+	return nil
+}
+
+func (p *joinTraces) String() string {
+	return fmt.Sprintf("%v=[trace_id_field=%v, span_id_field=%v, parent_span_id_field=%v, idle_timeout=%v]",
+		processorName, p.config.TraceIDField, p.config.SpanIDField, p.config.ParentSpanIDField, p.config.IdleTimeout)
+}
+
+// timestamp returns the time of the event from the timestamp field, or the
+// event timestamp if the field is not set or can't be parsed.
+func (p *joinTraces) timestamp(event *beat.Event, now time.Time) time.Time {
+	if p.config.TimestampField != "" {
+		if v, err := event.GetValue(p.config.TimestampField); err == nil {
+			switch ts := v.(type) {
+			case time.Time:
+				return ts
+			case common.Time:
+				return time.Time(ts)
+			case string:
+				if t, err := time.ParseInLocation(p.config.TimestampLayout, ts, time.Local); err == nil {
+					return t
+				}
+			}
+		}
+	}
+	if event.Timestamp.IsZero() {
+		return now
+	}
+	return event.Timestamp
+}
+
+func (p *joinTraces) stringValue(event *beat.Event, field string) string {
+	v, err := event.GetValue(field)
+	if err != nil || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
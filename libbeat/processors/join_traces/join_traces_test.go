@@ -0,0 +1,298 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package join_traces
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/processortest"
+)
+
+var testStart = time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func newTestJoinTraces(t *testing.T, cfg common.MapStr) (*joinTraces, clockwork.FakeClock, *processortest.Collector) {
+	t.Helper()
+	clock := clockwork.NewFakeClockAt(testStart)
+	jt := processortest.New(t, New, cfg).(*joinTraces)
+	jt.clock = clock
+
+	// The flush loop is not started, the tests flush explicitly.
+	c := &processortest.Collector{}
+	jt.flusher.SetEmitter(c.Emit)
+	return jt, clock, c
+}
+
+func spanEvent(offset time.Duration, traceID, spanID, parentID string, fields common.MapStr) *beat.Event {
+	event := &beat.Event{
+		Timestamp: testStart.Add(offset),
+		Fields: common.MapStr{
+			"trace_id":       traceID,
+			"span_id":        spanID,
+			"parent_span_id": parentID,
+		},
+	}
+	event.Fields.DeepUpdate(fields)
+	return event
+}
+
+func runAll(t *testing.T, p *joinTraces, events ...*beat.Event) {
+	t.Helper()
+	for _, event := range events {
+		_, err := p.Run(event)
+		require.NoError(t, err)
+	}
+}
+
+func traceInfo(t *testing.T, event beat.Event) common.MapStr {
+	t.Helper()
+	info, err := event.GetValue("trace")
+	require.NoError(t, err)
+	return info.(common.MapStr)
+}
+
+func TestJoinTracesSummary(t *testing.T) {
+	p, clock, c := newTestJoinTraces(t, common.MapStr{
+		"name_field":   "tag",
+		"idle_timeout": "10s",
+	})
+
+	ms := time.Millisecond
+	runAll(t, p,
+		spanEvent(0, "t1", "a", "", common.MapStr{"tag": "request"}),
+		spanEvent(10*ms, "t1", "b", "a", common.MapStr{"tag": "auth"}),
+		spanEvent(20*ms, "t1", "b", "a", nil),
+		spanEvent(15*ms, "t1", "c", "a", common.MapStr{"tag": "query"}),
+		spanEvent(70*ms, "t1", "c", "a", nil),
+		spanEvent(30*ms, "t1", "d", "c", common.MapStr{"tag": "db", "level": "ERROR"}),
+		spanEvent(60*ms, "t1", "d", "c", nil),
+		spanEvent(40*ms, "t1", "e", "x", nil),
+		spanEvent(100*ms, "t1", "a", "", nil),
+		&beat.Event{Timestamp: testStart, Fields: common.MapStr{"message": "no trace"}},
+	)
+	assert.Len(t, p.traces, 1)
+
+	clock.Advance(9 * time.Second)
+	p.flush(clock.Now(), false)
+	assert.Empty(t, c.Events())
+
+	clock.Advance(time.Second)
+	p.flush(clock.Now(), false)
+	require.Len(t, c.Events(), 1)
+	assert.Empty(t, p.traces)
+
+	event := c.Events()[0]
+	assert.Equal(t, testStart, event.Timestamp)
+	assert.Equal(t, common.MapStr{
+		"id":                "t1",
+		"start":             testStart,
+		"end":               testStart.Add(100 * ms),
+		"duration":          common.MapStr{"us": int64(100000)},
+		"span_count":        5,
+		"event_count":       uint64(9),
+		"error":             true,
+		"error_count":       uint64(1),
+		"failed_span_count": 1,
+		"orphan_span_count": 1,
+		"root": common.MapStr{
+			"id":       "a",
+			"name":     "request",
+			"duration": common.MapStr{"us": int64(100000)},
+		},
+		"critical_path": []common.MapStr{
+			{"id": "a", "name": "request", "duration": common.MapStr{"us": int64(100000)}},
+			{"id": "c", "name": "query", "parent_id": "a", "duration": common.MapStr{"us": int64(55000)}},
+			{"id": "d", "name": "db", "parent_id": "c", "duration": common.MapStr{"us": int64(30000)}, "error": true},
+		},
+	}, traceInfo(t, event))
+}
+
+func TestJoinTracesMaxDuration(t *testing.T) {
+	p, clock, c := newTestJoinTraces(t, common.MapStr{
+		"idle_timeout": "10s",
+		"max_duration": "30s",
+	})
+
+	for i := 0; i < 4; i++ {
+		runAll(t, p, spanEvent(0, "t1", "a", "", nil))
+		clock.Advance(9 * time.Second)
+		p.flush(clock.Now(), false)
+	}
+	require.Len(t, c.Events(), 1, "traces must be summarized after max_duration even if active")
+	assert.Equal(t, uint64(4), traceInfo(t, c.Events()[0])["event_count"])
+}
+
+func TestJoinTracesLateSpans(t *testing.T) {
+	tests := map[string]struct {
+		action    string
+		event     bool
+		summaries int
+	}{
+		"summarize": {"summarize", true, 2},
+		"forward":   {"forward", true, 1},
+		"drop":      {"drop", false, 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, clock, c := newTestJoinTraces(t, common.MapStr{
+				"idle_timeout":      "10s",
+				"drop_events":       true,
+				"late_spans.action": test.action,
+				"late_spans.window": "1m",
+			})
+
+			runAll(t, p, spanEvent(0, "t1", "a", "", nil))
+			clock.Advance(10 * time.Second)
+			p.flush(clock.Now(), false)
+			require.Len(t, c.Events(), 1)
+
+			event, err := p.Run(spanEvent(time.Second, "t1", "b", "a", nil))
+			require.NoError(t, err)
+			if test.action == "summarize" {
+				assert.Nil(t, event, "late spans are buffered and dropped with drop_events")
+			} else {
+				assert.Equal(t, test.event, event != nil)
+			}
+			assert.Equal(t, uint64(1), p.metrics.late.Get())
+
+			require.NoError(t, p.Close())
+			require.Len(t, c.Events(), test.summaries)
+			if test.summaries == 2 {
+				assert.Equal(t, true, traceInfo(t, c.Events()[1])["late"])
+			}
+		})
+	}
+
+	t.Run("after window", func(t *testing.T) {
+		p, clock, c := newTestJoinTraces(t, common.MapStr{
+			"idle_timeout":      "10s",
+			"late_spans.action": "drop",
+			"late_spans.window": "1m",
+		})
+
+		runAll(t, p, spanEvent(0, "t1", "a", "", nil))
+		clock.Advance(10 * time.Second)
+		p.flush(clock.Now(), false)
+
+		clock.Advance(time.Minute)
+		event, err := p.Run(spanEvent(0, "t1", "a", "", nil))
+		require.NoError(t, err)
+		assert.NotNil(t, event)
+		assert.Zero(t, p.metrics.late.Get())
+
+		require.NoError(t, p.Close())
+		require.Len(t, c.Events(), 2)
+		assert.NotContains(t, traceInfo(t, c.Events()[1]), "late")
+	})
+}
+
+func TestJoinTracesLimits(t *testing.T) {
+	p, _, c := newTestJoinTraces(t, common.MapStr{
+		"max_traces": 2,
+		"max_spans":  2,
+	})
+
+	runAll(t, p,
+		spanEvent(0, "t1", "a", "", nil),
+		spanEvent(0, "t1", "b", "a", nil),
+		spanEvent(0, "t1", "c", "a", nil),
+		spanEvent(0, "t2", "a", "", nil),
+		spanEvent(0, "t1", "a", "", nil),
+		spanEvent(0, "t3", "a", "", nil),
+	)
+	assert.Len(t, p.traces, 2)
+	assert.Contains(t, p.traces, "t1", "the least recently active trace must be evicted")
+	assert.Equal(t, uint64(1), p.metrics.evicted.Get())
+	assert.Equal(t, uint64(1), p.metrics.truncated.Get())
+
+	require.NoError(t, p.Close())
+	require.Len(t, c.Events(), 3)
+
+	evicted := traceInfo(t, c.Events()[0])
+	assert.Equal(t, "t2", evicted["id"])
+	assert.Equal(t, true, evicted["evicted"])
+
+	summaries := map[interface{}]common.MapStr{}
+	for _, event := range c.Events()[1:] {
+		info := traceInfo(t, event)
+		summaries[info["id"]] = info
+	}
+	assert.Equal(t, true, summaries["t1"]["truncated"])
+	assert.Equal(t, 2, summaries["t1"]["span_count"])
+	assert.Equal(t, uint64(4), summaries["t1"]["event_count"])
+}
+
+func TestJoinTracesTimestampField(t *testing.T) {
+	p, _, c := newTestJoinTraces(t, common.MapStr{
+		"timestamp_field": "time",
+		"error_when":      common.MapStr{"equals.status": "failed"},
+	})
+
+	runAll(t, p,
+		spanEvent(0, "t1", "a", "", common.MapStr{"time": "2021-03-01 12:00:00.000", "level": "ERROR"}),
+		spanEvent(0, "t1", "a", "", common.MapStr{"time": "2021-03-01 12:00:01.500", "status": "failed"}),
+	)
+
+	require.NoError(t, p.Close())
+	require.Len(t, c.Events(), 1)
+	info := traceInfo(t, c.Events()[0])
+	assert.Equal(t, common.MapStr{"us": int64(1500000)}, info["duration"])
+	assert.Equal(t, uint64(1), info["error_count"], "error_when replaces the default condition")
+}
+
+func TestJoinTracesClose(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{}))
+	require.NoError(t, err)
+
+	c := &processortest.Collector{}
+	processors.SetEmitter(p, c.Emit)
+
+	_, err = p.Run(spanEvent(0, "t1", "a", "", nil))
+	require.NoError(t, err)
+
+	require.NoError(t, processors.Close(p))
+	require.Len(t, c.Events(), 1)
+
+	require.NoError(t, processors.Close(p))
+	assert.Len(t, c.Events(), 1)
+}
+
+func TestJoinTracesConfig(t *testing.T) {
+	tests := map[string]common.MapStr{
+		"zero idle_timeout":  {"idle_timeout": 0},
+		"zero max_traces":    {"max_traces": 0},
+		"empty trace field":  {"trace_id_field": ""},
+		"invalid late":       {"late_spans.action": "ignore"},
+		"invalid error_when": {"error_when": common.MapStr{"unknown": "x"}},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(cfg))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -59,6 +59,29 @@ func Close(p Processor) error {
 	return nil
 }
 
+// Emitter defines the interface for processors publishing events of their own,
+// in addition to the events they process, like summaries of the processed
+// events.
+// The publisher pipeline calls SetEmitter before the first event is processed.
+// The emit function publishes an event through the pipeline. Events emitted by
+// the processors of a client are processed by the global processors, events
+// emitted by a global processor only by the global processors following it.
+// The emit function blocks while the queue is full, events the queue doesn't
+// accept within a bounded time are dropped. It must not be called from Run, and
+// it can be called until Close returned, so buffered events can be flushed on
+// Close.
+type Emitter interface {
+	SetEmitter(emit func(beat.Event))
+}
+
+// SetEmitter sets the emit function of a processor if it implements the
+// Emitter interface.
+func SetEmitter(p Processor, emit func(beat.Event)) {
+	if emitter, ok := p.(Emitter); ok {
+		emitter.SetEmitter(emit)
+	}
+}
+
 // NewList creates a new empty processor list.
 // Additional processors can be added to the List field.
 func NewList(log *logp.Logger) *Processors {
@@ -183,6 +206,14 @@ func (procs *Processors) Close() error {
 	return errs.Err()
 }
 
+// SetEmitter sets the emit function of all processors in the list implementing
+// the Emitter interface.
+func (procs *Processors) SetEmitter(emit func(beat.Event)) {
+	for _, p := range procs.List {
+		SetEmitter(p, emit)
+	}
+}
+
 // Run executes the all processors serially and returns the event and possibly
 // an error. If the event has been dropped (canceled) by a processor in the
 // list then a nil event is returned.
@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package processortest provides helpers to test processors.
+package processortest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// New creates a processor with the given settings. The processor is closed
+// when the test finishes.
+func New(t testing.TB, constructor processors.Constructor, settings common.MapStr) processors.Processor {
+	t.Helper()
+	p, err := constructor(common.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	t.Cleanup(func() { processors.Close(p) })
+	return p
+}
+
+// Run processes an event with the given fields and returns the result, which
+// is nil if the event was dropped.
+func Run(t testing.TB, p processors.Processor, fields common.MapStr) *beat.Event {
+	t.Helper()
+	event, err := p.Run(&beat.Event{Fields: fields})
+	require.NoError(t, err)
+	return event
+}
+
+// RunFields processes an event with the given fields and returns the fields of
+// the result. The event must not be dropped.
+func RunFields(t testing.TB, p processors.Processor, fields common.MapStr) common.MapStr {
+	t.Helper()
+	event := Run(t, p, fields)
+	require.NotNil(t, event, "the event was dropped")
+	return event.Fields
+}
+
+// Collector collects the events emitted by a processor.
+type Collector struct {
+	mutex  sync.Mutex
+	events []beat.Event
+}
+
+// Emit is the emit function to pass to the processor.
+func (c *Collector) Emit(event beat.Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.events = append(c.events, event)
+}
+
+// Events returns the events emitted so far.
+func (c *Collector) Events() []beat.Event {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]beat.Event(nil), c.events...)
+}
@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type config struct {
+	Fields    []string         `config:"fields" validate:"required"`
+	Detectors []detectorConfig `config:"detectors" validate:"required"`
+	HMACKey   string           `config:"hmac_key"`
+	Target    string           `config:"target"`
+}
+
+type detectorConfig struct {
+	Type      detectorType `config:"type" validate:"required"`
+	Name      string       `config:"name"`
+	Pattern   string       `config:"pattern"`
+	Action    action       `config:"action"`
+	KeepStart int          `config:"keep_start" validate:"min=0"`
+	KeepEnd   *int         `config:"keep_end" validate:"min=0"`
+	MaskChar  string       `config:"mask_char"`
+	Validate  *bool        `config:"validate"`
+}
+
+func defaultConfig() config {
+	return config{
+		Target: "redaction",
+	}
+}
+
+func (c *config) Validate() error {
+	names := map[string]struct{}{}
+	for i := range c.Detectors {
+		d := &c.Detectors[i]
+		if d.Name == "" {
+			if d.Type == typeRegex {
+				return errors.New("name must be set for regex detectors")
+			}
+			d.Name = d.Type.String()
+		}
+		if _, exists := names[d.Name]; exists {
+			return fmt.Errorf("duplicate detector name %q", d.Name)
+		}
+		names[d.Name] = struct{}{}
+
+		if (d.Type == typeRegex) != (d.Pattern != "") {
+			return fmt.Errorf("detector %q: pattern must be set for regex detectors only", d.Name)
+		}
+		if d.MaskChar == "" {
+			d.MaskChar = "*"
+		}
+		if utf8.RuneCountInString(d.MaskChar) != 1 {
+			return fmt.Errorf("detector %q: mask_char must be a single character", d.Name)
+		}
+		if d.Action != actionMask && c.HMACKey == "" {
+			return fmt.Errorf("detector %q: hmac_key must be set to %v values", d.Name, d.Action)
+		}
+	}
+	return nil
+}
+
+// detectorType is the kind of sensitive data a detector finds.
+type detectorType uint8
+
+const (
+	typeCreditCard detectorType = iota + 1
+	typeEmail
+	typeIPv4
+	typeIPv6
+	typeJWT
+	typePhone
+	typeVIN
+	typeRegex
+)
+
+var detectorTypeNames = map[detectorType]string{
+	typeCreditCard: "credit_card",
+	typeEmail:      "email",
+	typeIPv4:       "ipv4",
+	typeIPv6:       "ipv6",
+	typeJWT:        "jwt",
+	typePhone:      "phone",
+	typeVIN:        "vin",
+	typeRegex:      "regex",
+}
+
+func (t *detectorType) Unpack(v string) error {
+	for k, name := range detectorTypeNames {
+		if strings.EqualFold(v, name) {
+			*t = k
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid detector type %q, must be one of credit_card, email, ipv4, ipv6, jwt, phone, vin or regex", v)
+}
+
+func (t detectorType) String() string {
+	return detectorTypeNames[t]
+}
+
+// action is the way matches of a detector are replaced.
+type action uint8
+
+const (
+	actionMask action = iota
+	actionHash
+	actionTokenize
+)
+
+var actionNames = map[action]string{
+	actionMask:     "mask",
+	actionHash:     "hash",
+	actionTokenize: "tokenize",
+}
+
+func (a *action) Unpack(v string) error {
+	for k, name := range actionNames {
+		if strings.EqualFold(v, name) {
+			*a = k
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid action %q, must be one of mask, hash or tokenize", v)
+}
+
+func (a action) String() string {
+	return actionNames[a]
+}
@@ -0,0 +1,388 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// builtin describes a built-in detector. Candidates found by the pattern must
+// not be surrounded by letters, digits or dotted numbers, and must pass the
+// validation if set. If shrink is set, candidates failing the validation are
+// shortened to the previous separator and validated again.
+type builtin struct {
+	pattern  string
+	validate func(string) bool
+	shrink   bool
+	keepEnd  int
+}
+
+var builtins = map[detectorType]builtin{
+	typeCreditCard: {
+		pattern:  `\d(?:[ -]?\d){12,18}`,
+		validate: luhn,
+		keepEnd:  4,
+	},
+	typeEmail: {
+		pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`,
+	},
+	typeIPv4: {
+		pattern:  `(?:\d{1,3}\.){3}\d{1,3}`,
+		validate: isIPv4,
+	},
+	typeIPv6: {
+		pattern:  `(?i)(?:[0-9a-f]{1,4})?(?::[0-9a-f]{0,4}){2,7}(?:\.\d{1,3}){0,3}`,
+		validate: isIPv6,
+	},
+	typeJWT: {
+		pattern: `eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+	},
+	typePhone: {
+		pattern:  `\+?\(?\d[\d ().-]{5,20}\d`,
+		validate: isPhone,
+		shrink:   true,
+	},
+	typeVIN: {
+		pattern:  `[A-HJ-NPR-Z0-9]{17}`,
+		validate: isVIN,
+	},
+}
+
+// detector finds sensitive data of one type in strings and replaces it.
+type detector struct {
+	name      string
+	re        *regexp.Regexp
+	bounded   bool
+	validate  func(string) bool
+	shrink    bool
+	action    action
+	keepStart int
+	keepEnd   int
+	maskChar  rune
+	key       []byte
+
+	matches *monitoring.Uint
+}
+
+func newDetector(c detectorConfig, key []byte, reg *monitoring.Registry) (*detector, error) {
+	d := &detector{
+		name:      c.Name,
+		action:    c.Action,
+		keepStart: c.KeepStart,
+		key:       key,
+		matches:   monitoring.NewUint(reg, "detectors."+c.Name+".matches"),
+	}
+	d.maskChar, _ = utf8.DecodeRuneInString(c.MaskChar)
+
+	pattern := c.Pattern
+	if c.Type != typeRegex {
+		b := builtins[c.Type]
+		pattern = b.pattern
+		d.bounded = true
+		d.shrink = b.shrink
+		d.keepEnd = b.keepEnd
+		if c.Validate == nil || *c.Validate {
+			d.validate = b.validate
+		}
+		if c.Type == typeVIN && c.Validate != nil && *c.Validate {
+			d.validate = isVINWithCheckDigit
+		}
+	}
+	if c.KeepEnd != nil {
+		d.keepEnd = *c.KeepEnd
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern of detector %v", c.Name)
+	}
+	d.re = re
+	return d, nil
+}
+
+// redact replaces all matches in s. It returns the new string and the number
+// of matches.
+func (d *detector) redact(s string) (string, int) {
+	var b strings.Builder
+	count, last, pos := 0, 0, 0
+	for pos < len(s) {
+		loc := d.re.FindStringIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if end == start {
+			pos = end + 1
+			continue
+		}
+
+		end, ok := d.accept(s, start, end)
+		if !ok {
+			_, size := utf8.DecodeRuneInString(s[start:])
+			pos = start + size
+			continue
+		}
+
+		b.WriteString(s[last:start])
+		b.WriteString(d.replace(s[start:end]))
+		count++
+		last, pos = end, end
+	}
+	if count == 0 {
+		return s, 0
+	}
+	b.WriteString(s[last:])
+	d.matches.Add(uint64(count))
+	return b.String(), count
+}
+
+// accept checks a candidate match and returns its possibly shortened end.
+func (d *detector) accept(s string, start, end int) (int, bool) {
+	for end > start {
+		if d.checkBounds(s, start, end) && (d.validate == nil || d.validate(s[start:end])) {
+			return end, true
+		}
+		if !d.shrink {
+			break
+		}
+		end = shrinkEnd(s, start, end)
+	}
+	return 0, false
+}
+
+func (d *detector) checkBounds(s string, start, end int) bool {
+	if !d.bounded {
+		return true
+	}
+	before, after := s[:start], s[end:]
+	if r, size := utf8.DecodeLastRuneInString(before); size > 0 && (isAlnum(r) || r == '.' && endsWithDigit(before[:len(before)-size])) {
+		return false
+	}
+	if r, size := utf8.DecodeRuneInString(after); size > 0 && (isAlnum(r) || r == '.' && startsWithDigit(after[size:])) {
+		return false
+	}
+	return true
+}
+
+// startsWithDigit and endsWithDigit are used to reject matches that are part
+// of dotted numbers, like versions.
+func startsWithDigit(s string) bool {
+	return len(s) > 0 && s[0] >= '0' && s[0] <= '9'
+}
+
+func endsWithDigit(s string) bool {
+	return len(s) > 0 && s[len(s)-1] >= '0' && s[len(s)-1] <= '9'
+}
+
+// shrinkEnd removes the last group of digits and the separators before it.
+func shrinkEnd(s string, start, end int) int {
+	end = strings.LastIndexFunc(s[start:end], func(r rune) bool { return !unicode.IsDigit(r) })
+	if end < 0 {
+		return start
+	}
+	end = start + end
+	for end > start && !unicode.IsDigit(rune(s[end-1])) {
+		end--
+	}
+	return end
+}
+
+func (d *detector) replace(m string) string {
+	switch d.action {
+	case actionHash:
+		mac := hmac.New(sha256.New, d.key)
+		mac.Write([]byte(m))
+		return hex.EncodeToString(mac.Sum(nil))
+	case actionTokenize:
+		return d.tokenize(m)
+	}
+	return d.mask(m)
+}
+
+// mask replaces the letters and digits with the mask character, keeping the
+// separators and the first keep_start and last keep_end letters and digits.
+func (d *detector) mask(m string) string {
+	return d.mapAlnum(m, func(i int, r rune) rune { return d.maskChar })
+}
+
+// tokenize replaces the letters and digits with pseudo-random letters and
+// digits derived from the HMAC of the match, keeping the separators, the case
+// of the letters and the first keep_start and last keep_end letters and
+// digits. The same value always gets the same token.
+func (d *detector) tokenize(m string) string {
+	mac := hmac.New(sha256.New, d.key)
+	var stream []byte
+	return d.mapAlnum(m, func(i int, r rune) rune {
+		for len(stream) <= i {
+			var counter [4]byte
+			binary.BigEndian.PutUint32(counter[:], uint32(len(stream)/sha256.Size))
+			mac.Reset()
+			mac.Write(counter[:])
+			mac.Write([]byte(m))
+			stream = mac.Sum(stream)
+		}
+		b := stream[i]
+		switch {
+		case unicode.IsDigit(r):
+			return '0' + rune(b%10)
+		case unicode.IsUpper(r):
+			return 'A' + rune(b%26)
+		}
+		return 'a' + rune(b%26)
+	})
+}
+
+// mapAlnum calls fn for the letters and digits that are not kept, with their
+// index among the letters and digits.
+func (d *detector) mapAlnum(m string, fn func(i int, r rune) rune) string {
+	total := 0
+	for _, r := range m {
+		if isAlnum(r) {
+			total++
+		}
+	}
+
+	var b strings.Builder
+	b.Grow(len(m))
+	i := 0
+	for _, r := range m {
+		if isAlnum(r) {
+			if i >= d.keepStart && i < total-d.keepEnd {
+				r = fn(i, r)
+			}
+			i++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func digits(s string) []int {
+	var out []int
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			out = append(out, int(r-'0'))
+		}
+	}
+	return out
+}
+
+// luhn validates the check digit of payment card numbers.
+func luhn(s string) bool {
+	ds := digits(s)
+	if len(ds) < 13 || len(ds) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range ds {
+		d := ds[len(ds)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func isIPv4(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil
+}
+
+func isIPv6(s string) bool {
+	return strings.Contains(s, ":") && net.ParseIP(s) != nil && strings.IndexFunc(s, isHexDigit) >= 0
+}
+
+func isHexDigit(r rune) bool {
+	return unicode.Is(unicode.ASCII_Hex_Digit, r)
+}
+
+var (
+	phoneInternational = regexp.MustCompile(`^\+\d{1,3}(?:[ .-]?\(?\d{1,5}\)?)+$`)
+	phoneCNMobile      = regexp.MustCompile(`^1[3-9]\d(?:[ -]?\d{4}){2}$`)
+	phoneNANP          = regexp.MustCompile(`^(?:\(\d{3}\) ?|\d{3}[-.])\d{3}[-.]\d{4}$`)
+)
+
+// isPhone accepts international numbers starting with +, Chinese mobile
+// numbers and North American numbers with separators. Other digit sequences,
+// like timestamps and dates, are not accepted.
+func isPhone(s string) bool {
+	switch {
+	case phoneInternational.MatchString(s):
+		n := len(digits(s))
+		return n >= 8 && n <= 15
+	case phoneCNMobile.MatchString(s), phoneNANP.MatchString(s):
+		return true
+	}
+	return false
+}
+
+// isVIN requires VINs to contain letters and digits, so that numbers and words
+// are not matched.
+func isVIN(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0 && strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
+
+var (
+	vinTransliteration = map[rune]int{
+		'A': 1, 'B': 2, 'C': 3, 'D': 4, 'E': 5, 'F': 6, 'G': 7, 'H': 8,
+		'J': 1, 'K': 2, 'L': 3, 'M': 4, 'N': 5, 'P': 7, 'R': 9,
+		'S': 2, 'T': 3, 'U': 4, 'V': 5, 'W': 6, 'X': 7, 'Y': 8, 'Z': 9,
+	}
+	vinWeights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+)
+
+// isVINWithCheckDigit validates the check digit at the 9th position, used by
+// VINs of North America and China.
+func isVINWithCheckDigit(s string) bool {
+	if len(s) != 17 || !isVIN(s) {
+		return false
+	}
+	sum := 0
+	for i, r := range s {
+		v, ok := vinTransliteration[r]
+		if !ok {
+			v = int(r - '0')
+		}
+		sum += v * vinWeights[i]
+	}
+	check := byte('0' + sum%11)
+	if sum%11 == 10 {
+		check = 'X'
+	}
+	return s[8] == check
+}
@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const processorName = "redact"
+const logName = "processor." + processorName
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type redact struct {
+	config    config
+	detectors []*detector
+	events    *monitoring.Uint
+}
+
+// New constructs a new redact processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the redact configuration")
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	p := &redact{
+		config: config,
+		events: monitoring.NewUint(reg, "events"),
+	}
+	for _, c := range config.Detectors {
+		d, err := newDetector(c, []byte(config.HMACKey), reg)
+		if err != nil {
+			return nil, err
+		}
+		p.detectors = append(p.detectors, d)
+	}
+	return p, nil
+}
+
+// Run redacts the sensitive data found in the configured fields and records
+// the detectors that matched and the redacted fields under the target field.
+func (p *redact) Run(event *beat.Event) (*beat.Event, error) {
+	fired := map[string]struct{}{}
+	var fields []string
+	for _, f := range p.config.Fields {
+		v, err := event.GetValue(f)
+		if err != nil {
+			continue
+		}
+		v, changed := p.redactValue(v, fired)
+		if !changed {
+			continue
+		}
+		if _, err := event.PutValue(f, v); err != nil {
+			return event, errors.Wrapf(err, "failed to put redacted field %v", f)
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return event, nil
+	}
+	p.events.Inc()
+
+	if p.config.Target == "" {
+		return event, nil
+	}
+	detectors := make([]string, 0, len(fired))
+	for name := range fired {
+		detectors = append(detectors, name)
+	}
+	if err := p.appendAudit(event, "detectors", detectors); err != nil {
+		return event, err
+	}
+	if err := p.appendAudit(event, "fields", fields); err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+// redactValue redacts strings, and the strings nested in objects and arrays.
+// Objects and arrays are updated in place.
+func (p *redact) redactValue(v interface{}, fired map[string]struct{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case string:
+		return p.redactString(v, fired)
+	case []string:
+		changed := false
+		for i, s := range v {
+			if r, ok := p.redactString(s, fired); ok {
+				v[i], changed = r.(string), true
+			}
+		}
+		return v, changed
+	case []interface{}:
+		changed := false
+		for i, e := range v {
+			if r, ok := p.redactValue(e, fired); ok {
+				v[i], changed = r, true
+			}
+		}
+		return v, changed
+	case common.MapStr:
+		return v, p.redactMap(v, fired)
+	case map[string]interface{}:
+		return v, p.redactMap(v, fired)
+	}
+	return v, false
+}
+
+func (p *redact) redactMap(m map[string]interface{}, fired map[string]struct{}) bool {
+	changed := false
+	for k, e := range m {
+		if r, ok := p.redactValue(e, fired); ok {
+			m[k], changed = r, true
+		}
+	}
+	return changed
+}
+
+func (p *redact) redactString(s string, fired map[string]struct{}) (interface{}, bool) {
+	changed := false
+	for _, d := range p.detectors {
+		var n int
+		if s, n = d.redact(s); n > 0 {
+			fired[d.name] = struct{}{}
+			changed = true
+		}
+	}
+	return s, changed
+}
+
+// appendAudit merges values into the sorted list of unique values stored at
+// the given key of the target field.
+func (p *redact) appendAudit(event *beat.Event, key string, values []string) error {
+	key = p.config.Target + "." + key
+	seen := map[string]struct{}{}
+	if v, err := event.GetValue(key); err == nil {
+		switch v := v.(type) {
+		case []string:
+			values = append(values, v...)
+		case []interface{}:
+			for _, e := range v {
+				if s, ok := e.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+
+	unique := values[:0]
+	for _, v := range values {
+		if _, exists := seen[v]; !exists {
+			seen[v] = struct{}{}
+			unique = append(unique, v)
+		}
+	}
+	sort.Strings(unique)
+
+	if _, err := event.PutValue(key, unique); err != nil {
+		return errors.Wrapf(err, "failed to put redaction audit field %v", key)
+	}
+	return nil
+}
+
+func (p *redact) String() string {
+	names := make([]string, len(p.detectors))
+	for i, d := range p.detectors {
+		names[i] = d.name
+	}
+	return fmt.Sprintf("%v=[fields=%v, detectors=%v, target=%v]",
+		processorName, p.config.Fields, names, p.config.Target)
+}
@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors/processortest"
+)
+
+func newTestRedact(t testing.TB, cfg common.MapStr) *redact {
+	t.Helper()
+	return processortest.New(t, New, cfg).(*redact)
+}
+
+func TestDetectors(t *testing.T) {
+	tests := []struct {
+		typ   string
+		extra common.MapStr
+		in    string
+		out   string
+	}{
+		{"credit_card", nil, "card 4111 1111 1111 1111 paid", "card **** **** **** 1111 paid"},
+		{"credit_card", nil, "card 4111-1111-1111-1112 paid", "card 4111-1111-1111-1112 paid"},
+		{"credit_card", common.MapStr{"validate": false}, "id 4111111111111112", "id ************1112"},
+		{"credit_card", nil, "order 94111111111111111", "order 94111111111111111"},
+		{"email", nil, "from <jane.doe+ops@mail.example.com>", "from <****.***+***@****.*******.***>"},
+		{"ipv4", nil, "client 10.0.12.7:443 and 999.1.1.1", "client **.*.**.*:443 and 999.1.1.1"},
+		{"ipv4", nil, "version 1.2.3.4.5", "version 1.2.3.4.5"},
+		{"ipv6", nil, "peer fe80::1ff:fe23:4567:890a up", "peer ****::***:****:****:**** up"},
+		{"ipv6", nil, "at 12:30:45 done", "at 12:30:45 done"},
+		{"jwt", nil, "Bearer eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln-_x", "Bearer ********************.***************.****-_*"},
+		{"phone", nil, "call +86 138 0013 8000 now", "call +** *** **** **** now"},
+		{"phone", nil, "call 13800138000, 138-0013-8000", "call ***********, ***-****-****"},
+		{"phone", nil, "call (555) 123-4567", "call (***) ***-****"},
+		{"phone", nil, "at 2021-03-04 12:00:00.123 took 1234567890", "at 2021-03-04 12:00:00.123 took 1234567890"},
+		{"phone", nil, "call +1 555 123 4567 12345678", "call +* *** *** **** 12345678"},
+		{"vin", nil, "vehicle LSGJA52U47S123456 and ABCDEFGHJKLMNPRST", "vehicle ***************** and ABCDEFGHJKLMNPRST"},
+		{"vin", common.MapStr{"validate": true}, "1M8GDM9AXKP042788 1M8GDM9A1KP042788", "***************** 1M8GDM9A1KP042788"},
+		{"regex", common.MapStr{"name": "order", "pattern": `ORD-\d+`}, "order ORD-1234", "order ***-****"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.typ+" "+test.in, func(t *testing.T) {
+			detector := common.MapStr{"type": test.typ}
+			detector.Update(test.extra)
+			p := newTestRedact(t, common.MapStr{
+				"fields":    []string{"message"},
+				"detectors": []common.MapStr{detector},
+			})
+			fields := processortest.RunFields(t, p, common.MapStr{"message": test.in})
+			assert.Equal(t, test.out, fields["message"])
+			if test.in == test.out {
+				assert.NotContains(t, fields, "redaction")
+			}
+		})
+	}
+}
+
+func TestMaskOptions(t *testing.T) {
+	p := newTestRedact(t, common.MapStr{
+		"fields": []string{"message"},
+		"detectors": []common.MapStr{
+			{"type": "phone", "keep_start": 3, "keep_end": 4, "mask_char": "#"},
+			{"type": "credit_card", "keep_end": 0},
+		},
+	})
+	fields := processortest.RunFields(t, p, common.MapStr{"message": "13800138000 4111111111111111"})
+	assert.Equal(t, "138####8000 ****************", fields["message"])
+}
+
+func TestHashAndTokenize(t *testing.T) {
+	newProcessor := func(key string) *redact {
+		return newTestRedact(t, common.MapStr{
+			"fields":   []string{"message", "vin"},
+			"hmac_key": key,
+			"detectors": []common.MapStr{
+				{"type": "vin", "action": "tokenize", "keep_start": 3},
+				{"type": "email", "action": "hash"},
+			},
+		})
+	}
+	event := func() common.MapStr {
+		return common.MapStr{"message": "owner jane@example.com", "vin": "LSGJA52U47S123456"}
+	}
+
+	p := newProcessor("secret")
+	first := processortest.RunFields(t, p, event())
+	second := processortest.RunFields(t, p, event())
+	assert.Equal(t, first, second, "replacements must be deterministic")
+
+	assert.Regexp(t, `^owner [0-9a-f]{64}$`, first["message"])
+	assert.Regexp(t, `^LSG[A-Z]{2}\d{2}[A-Z]\d{2}[A-Z]\d{6}$`, first["vin"])
+	assert.NotEqual(t, "LSGJA52U47S123456", first["vin"])
+
+	other := processortest.RunFields(t, newProcessor("other"), event())
+	assert.NotEqual(t, first["message"], other["message"])
+	assert.NotEqual(t, first["vin"], other["vin"])
+}
+
+func TestNestedFields(t *testing.T) {
+	p := newTestRedact(t, common.MapStr{
+		"fields":    []string{"json", "message", "missing"},
+		"detectors": []common.MapStr{{"type": "email"}, {"type": "ipv4"}},
+		"target":    "audit",
+	})
+
+	fields := processortest.RunFields(t, p, common.MapStr{
+		"message": "no data",
+		"json": map[string]interface{}{
+			"user":  map[string]interface{}{"email": "a@example.org", "age": 42},
+			"peers": []interface{}{"10.1.1.1", map[string]interface{}{"ip": "10.2.2.2"}},
+			"tags":  []string{"b@example.org", "plain"},
+		},
+		"audit": common.MapStr{"detectors": []string{"jwt"}},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"user":  map[string]interface{}{"email": "*@*******.***", "age": 42},
+		"peers": []interface{}{"**.*.*.*", map[string]interface{}{"ip": "**.*.*.*"}},
+		"tags":  []string{"*@*******.***", "plain"},
+	}, fields["json"])
+	assert.Equal(t, "no data", fields["message"])
+	assert.Equal(t, common.MapStr{
+		"detectors": []string{"email", "ipv4", "jwt"},
+		"fields":    []string{"json"},
+	}, fields["audit"])
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := map[string]common.MapStr{
+		"missing fields":    {"detectors": []common.MapStr{{"type": "email"}}},
+		"missing detectors": {"fields": []string{"message"}},
+		"unknown type":      {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "ssn"}}},
+		"unknown action":    {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "email", "action": "drop"}}},
+		"regex no name":     {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "regex", "pattern": "x"}}},
+		"regex no pattern":  {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "regex", "name": "x"}}},
+		"pattern builtin":   {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "email", "pattern": "x"}}},
+		"invalid pattern":   {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "regex", "name": "x", "pattern": "("}}},
+		"duplicate name":    {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "email"}, {"type": "email"}}},
+		"mask_char":         {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "email", "mask_char": "**"}}},
+		"negative keep":     {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "email", "keep_start": -1}}},
+		"hash without key":  {"fields": []string{"message"}, "detectors": []common.MapStr{{"type": "email", "action": "hash"}}},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(cfg))
+			assert.Error(t, err)
+		})
+	}
+}
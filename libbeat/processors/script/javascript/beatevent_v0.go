@@ -53,7 +53,7 @@ func newBeatEventV0Constructor(s Session) func(call goja.ConstructorCall) *goja.
 			panic(errors.New("Event constructor requires one argument"))
 		}
 
-		a0 := call.Argument(0).Export()
+		a0 := Export(call.Argument(0))
 
 		var fields common.MapStr
 		switch v := a0.(type) {
@@ -91,7 +91,7 @@ func (e *beatEventV0) reset(b *beat.Event) error {
 	e.inner = b
 	e.cancelled = false
 	e.obj.Set("_private", e)
-	e.obj.Set("fields", e.vm.ToValue(e.inner.Fields))
+	e.obj.Set("fields", ToValue(e.vm, e.inner.Fields))
 	return nil
 }
 
@@ -115,7 +115,7 @@ func (e *beatEventV0) get(call goja.FunctionCall) goja.Value {
 	a0 := call.Argument(0)
 	if goja.IsUndefined(a0) {
 		// event.Get() is the same as event.fields (but slower).
-		return e.vm.ToValue(e.inner.Fields)
+		return ToValue(e.vm, e.inner.Fields)
 	}
 
 	v, err := e.inner.GetValue(a0.String())
@@ -123,7 +123,7 @@ func (e *beatEventV0) get(call goja.FunctionCall) goja.Value {
 		return goja.Null()
 	}
 
-	return e.vm.ToValue(v)
+	return ToValue(e.vm, v)
 }
 
 // put writes a value to the event. If there was a previous value assigned to
@@ -140,13 +140,13 @@ func (e *beatEventV0) put(call goja.FunctionCall) goja.Value {
 	}
 
 	key := call.Argument(0).String()
-	value := call.Argument(1).Export()
+	value := Export(call.Argument(1))
 
 	old, err := e.inner.PutValue(key, value)
 	if err != nil {
 		panic(err)
 	}
-	return e.vm.ToValue(old)
+	return ToValue(e.vm, old)
 }
 
 // rename moves a value from one key to another. It returns true on success.
@@ -33,6 +33,7 @@ type Config struct {
 	Timeout           time.Duration          `config:"timeout" validate:"min=0"`             // Execution timeout.
 	TagOnException    string                 `config:"tag_on_exception"`                     // Tag to add to events when an exception happens.
 	MaxCachedSessions int                    `config:"max_cached_sessions" validate:"min=0"` // Max. number of cached VM sessions.
+	State             StateConfig            `config:"state"`                                // Limits of the state shared by sessions.
 }
 
 // Validate returns an error if one (and only one) option is not set.
@@ -60,5 +61,8 @@ func defaultConfig() Config {
 	return Config{
 		TagOnException:    "_js_exception",
 		MaxCachedSessions: 4,
+		State: StateConfig{
+			MaxEntries: defaultStateMaxEntries,
+		},
 	}
 }
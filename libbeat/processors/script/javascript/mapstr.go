@@ -0,0 +1,170 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package javascript
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/dop251/goja"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// ToValue converts a Go value to a Javascript value. Objects and arrays,
+// including common.MapStr values that the runtime would otherwise treat as Go
+// structs because of their methods, are wrapped so that they can be read and
+// modified in place like plain Javascript objects and arrays.
+func ToValue(vm *goja.Runtime, v interface{}) goja.Value {
+	switch v := v.(type) {
+	case common.MapStr:
+		if v == nil {
+			return goja.Null()
+		}
+		return vm.NewDynamicObject(&mapObject{vm: vm, m: v})
+	case map[string]interface{}:
+		if v == nil {
+			return goja.Null()
+		}
+		return vm.NewDynamicObject(&mapObject{vm: vm, m: v})
+	case []interface{}, []common.MapStr, []map[string]interface{}:
+		// The array uses its own copy of the slice header, like the arrays
+		// created by the runtime. Elements are shared with the Go value, but
+		// appended elements are only visible to the script.
+		slice := reflect.New(reflect.TypeOf(v)).Elem()
+		slice.Set(reflect.ValueOf(v))
+		return vm.NewDynamicArray(&arrayObject{vm: vm, slice: slice})
+	}
+	return vm.ToValue(v)
+}
+
+// Export converts a Javascript value to a Go value, unwrapping the objects and
+// arrays created by ToValue.
+func Export(v goja.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	return unwrap(v.Export())
+}
+
+func unwrap(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *mapObject:
+		return v.m
+	case *arrayObject:
+		return v.slice.Interface()
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = unwrap(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = unwrap(e)
+		}
+	}
+	return v
+}
+
+// mapObject exposes a map to Javascript.
+type mapObject struct {
+	vm *goja.Runtime
+	m  common.MapStr
+}
+
+func (o *mapObject) Get(key string) goja.Value {
+	v, found := o.m[key]
+	if !found {
+		return nil
+	}
+	return ToValue(o.vm, v)
+}
+
+func (o *mapObject) Set(key string, val goja.Value) bool {
+	o.m[key] = Export(val)
+	return true
+}
+
+func (o *mapObject) Has(key string) bool {
+	_, found := o.m[key]
+	return found
+}
+
+func (o *mapObject) Delete(key string) bool {
+	delete(o.m, key)
+	return true
+}
+
+func (o *mapObject) Keys() []string {
+	keys := make([]string, 0, len(o.m))
+	for k := range o.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// arrayObject exposes a slice to Javascript.
+type arrayObject struct {
+	vm    *goja.Runtime
+	slice reflect.Value
+}
+
+func (a *arrayObject) Len() int {
+	return a.slice.Len()
+}
+
+func (a *arrayObject) Get(idx int) goja.Value {
+	if idx < 0 || idx >= a.slice.Len() {
+		return nil
+	}
+	return ToValue(a.vm, a.slice.Index(idx).Interface())
+}
+
+func (a *arrayObject) Set(idx int, val goja.Value) bool {
+	if idx < 0 {
+		return false
+	}
+	elem := reflect.ValueOf(Export(val))
+	elemType := a.slice.Type().Elem()
+	switch {
+	case !elem.IsValid():
+		elem = reflect.Zero(elemType)
+	case elem.Type().ConvertibleTo(elemType):
+		elem = elem.Convert(elemType)
+	default:
+		return false
+	}
+	if idx >= a.slice.Len() {
+		a.SetLen(idx + 1)
+	}
+	a.slice.Index(idx).Set(elem)
+	return true
+}
+
+func (a *arrayObject) SetLen(n int) bool {
+	switch {
+	case n < 0:
+		return false
+	case n <= a.slice.Len():
+		a.slice.SetLen(n)
+	default:
+		grow := reflect.MakeSlice(a.slice.Type(), n-a.slice.Len(), n-a.slice.Len())
+		a.slice.Set(reflect.AppendSlice(a.slice, grow))
+	}
+	return true
+}
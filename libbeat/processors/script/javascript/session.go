@@ -79,9 +79,10 @@ type session struct {
 	processFunc    goja.Callable
 	timeout        time.Duration
 	tagOnException string
+	state          *stateStore
 }
 
-func newSession(p *goja.Program, conf Config, test bool) (*session, error) {
+func newSession(p *goja.Program, conf Config, state *stateStore, test bool) (*session, error) {
 	// Create a logger
 	logger := logp.NewLogger(logName)
 	if conf.Tag != "" {
@@ -100,6 +101,7 @@ func newSession(p *goja.Program, conf Config, test bool) (*session, error) {
 		makeEvent:      newBeatEventV0,
 		timeout:        conf.Timeout,
 		tagOnException: conf.TagOnException,
+		state:          state,
 	}
 
 	// Register modules.
@@ -110,6 +112,9 @@ func newSession(p *goja.Program, conf Config, test bool) (*session, error) {
 	// Register constructor for 'new Event' to enable test() to create events.
 	s.vm.Set("Event", newBeatEventV0Constructor(s))
 
+	// Register the state shared by all sessions of the processor.
+	s.vm.Set(stateObject, newStateObject(s))
+
 	_, err := s.vm.RunProgram(p)
 	if err != nil {
 		return nil, err
@@ -126,9 +131,13 @@ func newSession(p *goja.Program, conf Config, test bool) (*session, error) {
 	}
 
 	if test {
+		// The test function gets its own state so that it does not affect
+		// the processing of events.
+		s.state = newStateStore(conf.State)
 		if err = s.executeTestFunction(); err != nil {
 			return nil, err
 		}
+		s.state = state
 	}
 
 	return s, nil
@@ -163,7 +172,7 @@ func (s *session) registerScriptParams(params map[string]interface{}) error {
 	if err := s.vm.ExportTo(registerFunc, &register); err != nil {
 		return errors.Wrap(err, "failed to export register function")
 	}
-	if _, err := register(goja.Undefined(), s.Runtime().ToValue(params)); err != nil {
+	if _, err := register(goja.Undefined(), ToValue(s.vm, params)); err != nil {
 		return errors.Wrap(err, "failed to register script_params")
 	}
 	s.log.Debug("Registered params with processor")
@@ -260,32 +269,21 @@ func (s *session) Event() Event {
 	return s.evt
 }
 
-func init() {
-	// Register common.MapStr as being a simple map[string]interface{} for
-	// treatment within the JS VM.
-	AddSessionHook("_type_mapstr", func(s Session) {
-		s.Runtime().RegisterSimpleMapType(reflect.TypeOf(common.MapStr(nil)),
-			func(i interface{}) map[string]interface{} {
-				return map[string]interface{}(i.(common.MapStr))
-			},
-		)
-	})
-}
-
 type sessionPool struct {
 	New func() *session
 	C   chan *session
 }
 
 func newSessionPool(p *goja.Program, c Config) (*sessionPool, error) {
-	s, err := newSession(p, c, true)
+	state := newStateStore(c.State)
+	s, err := newSession(p, c, state, true)
 	if err != nil {
 		return nil, err
 	}
 
 	pool := sessionPool{
 		New: func() *session {
-			s, _ := newSession(p, c, false)
+			s, _ := newSession(p, c, state, false)
 			return s
 		},
 		C: make(chan *session, c.MaxCachedSessions),
@@ -88,6 +88,27 @@ func TestSessionScriptParams(t *testing.T) {
 		}, nil)
 		assert.NoError(t, err)
 	})
+	t.Run("register common.MapStr params", func(t *testing.T) {
+		const script = `
+			function register(params) {
+				if (params.limits.threshold !== 42 || Object.keys(params.limits).length !== 1) {
+					throw "invalid limits";
+				}
+				params.limits.checked = true;
+			}
+
+			function process(event) {}
+		`
+		limits := common.MapStr{"threshold": 42}
+		_, err := NewFromConfig(Config{
+			Source: script,
+			Params: map[string]interface{}{
+				"limits": limits,
+			},
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, common.MapStr{"threshold": 42, "checked": true}, limits)
+	})
 }
 
 func TestSessionTestFunction(t *testing.T) {
@@ -224,3 +245,106 @@ func TestSessionParallel(t *testing.T) {
 	time.AfterFunc(time.Second, cancel)
 	wg.Wait()
 }
+
+func TestSessionES2015(t *testing.T) {
+	const script = `
+		class Parser {
+			constructor(separator = "=") {
+				this.separator = separator;
+			}
+
+			parse(message) {
+				const fields = {};
+				for (const pair of message.split(" ")) {
+					let [key, ...value] = pair.split(this.separator);
+					fields[key] = value.join(this.separator);
+				}
+				return fields;
+			}
+		}
+
+		const parser = new Parser();
+
+		function process(evt) {
+			const {user, level = "info"} = parser.parse(evt.Get("message"));
+			evt.Put("user.name", user);
+			evt.Put("log.level", level);
+			evt.Put("greeting", ` + "`hello ${user}`" + `);
+			evt.Put("tags", evt.Get("tags").map(tag => tag.toUpperCase()));
+		}
+	`
+
+	p, err := NewFromConfig(Config{Source: script}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt, err := p.Run(&beat.Event{Fields: common.MapStr{
+		"message": "user=alice id=a=b",
+		"tags":    []string{"a", "b"},
+	}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, common.MapStr{
+			"message":  "user=alice id=a=b",
+			"user":     common.MapStr{"name": "alice"},
+			"log":      common.MapStr{"level": "info"},
+			"greeting": "hello alice",
+			"tags":     []interface{}{"A", "B"},
+		}, evt.Fields)
+	}
+}
+
+func TestSessionState(t *testing.T) {
+	const script = `
+		function process(evt) {
+			const host = evt.Get("host.name");
+			evt.Put("count", state.Increment("count." + host));
+
+			const last = state.Put("last." + host, {message: evt.Get("message")});
+			if (last !== null) {
+				evt.Put("previous", last.message);
+			}
+		}
+
+		function test() {
+			const evt = new Event({host: {name: "test"}, message: "test"});
+			process(evt);
+			if (evt.Get("count") !== 1) {
+				throw "unexpected count " + evt.Get("count");
+			}
+		}
+	`
+
+	p, err := NewFromConfig(Config{
+		Source:            script,
+		MaxCachedSessions: 0,
+		State:             StateConfig{MaxEntries: 3},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(host, message string) common.MapStr {
+		t.Helper()
+		evt, err := p.Run(&beat.Event{Fields: common.MapStr{
+			"host":    common.MapStr{"name": host},
+			"message": message,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return evt.Fields
+	}
+
+	// Sessions are not cached, so each event gets a new session. The state
+	// of the test function is not visible.
+	assert.Equal(t, int64(1), run("a", "first")["count"])
+	fields := run("a", "second")
+	assert.Equal(t, int64(2), fields["count"])
+	assert.Equal(t, "first", fields["previous"])
+
+	// Keys of host a are evicted by keys of host b and c.
+	run("b", "first")
+	run("c", "first")
+	assert.Equal(t, int64(1), run("a", "third")["count"])
+}
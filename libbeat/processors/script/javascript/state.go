@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package javascript
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const (
+	stateObject = "state"
+
+	defaultStateMaxEntries = 10000
+)
+
+// StateConfig defines the limits of the state shared by the sessions of a
+// processor.
+type StateConfig struct {
+	MaxEntries int           `config:"max_entries" validate:"min=0"` // Max. number of keys, the least recently used keys are evicted.
+	TTL        time.Duration `config:"ttl" validate:"min=0"`         // Time after which keys expire if they are not updated.
+}
+
+// stateStore is a bounded key-value store shared by all sessions of a
+// processor. Values are copied when they are stored and loaded so that
+// sessions never share objects.
+type stateStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	entries map[string]*list.Element
+	lru     *list.List // Front is the most recently used entry.
+}
+
+type stateEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newStateStore(c StateConfig) *stateStore {
+	maxEntries := c.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = defaultStateMaxEntries
+	}
+	return &stateStore{
+		maxEntries: maxEntries,
+		ttl:        c.TTL,
+		now:        time.Now,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// get returns the value of the key, or nil if the key is not set.
+func (s *stateStore) get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.lookup(key); e != nil {
+		return cloneValue(e.value)
+	}
+	return nil
+}
+
+// put sets the value of the key and returns the previous value.
+func (s *stateStore) put(key string, value interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var old interface{}
+	if e := s.lookup(key); e != nil {
+		old = e.value
+	}
+	s.store(key, cloneValue(value))
+	return old
+}
+
+// increment adds delta to the numeric value of the key, and returns the new
+// value. Keys that are not set are treated as 0.
+func (s *stateStore) increment(key string, delta float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current float64
+	if e := s.lookup(key); e != nil {
+		switch v := e.value.(type) {
+		case int64:
+			current = float64(v)
+		case float64:
+			current = v
+		default:
+			return 0, errors.Errorf("cannot increment state key %v of type %T", key, e.value)
+		}
+	}
+	current += delta
+	s.store(key, current)
+	return current, nil
+}
+
+// delete removes the key and reports whether it was set.
+func (s *stateStore) delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, found := s.entries[key]
+	if found {
+		s.remove(elem)
+	}
+	return found
+}
+
+// size returns the number of keys, including expired keys that were not yet
+// removed.
+func (s *stateStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// lookup returns the entry of the key if it is set and not expired, and marks
+// it as recently used.
+func (s *stateStore) lookup(key string) *stateEntry {
+	elem, found := s.entries[key]
+	if !found {
+		return nil
+	}
+	e := elem.Value.(*stateEntry)
+	if s.ttl > 0 && !s.now().Before(e.expires) {
+		s.remove(elem)
+		return nil
+	}
+	s.lru.MoveToFront(elem)
+	return e
+}
+
+func (s *stateStore) store(key string, value interface{}) {
+	var expires time.Time
+	if s.ttl > 0 {
+		expires = s.now().Add(s.ttl)
+	}
+
+	if elem, found := s.entries[key]; found {
+		e := elem.Value.(*stateEntry)
+		e.value, e.expires = value, expires
+		s.lru.MoveToFront(elem)
+		return
+	}
+
+	s.entries[key] = s.lru.PushFront(&stateEntry{key: key, value: value, expires: expires})
+	for len(s.entries) > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *stateStore) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*stateEntry).key)
+}
+
+// cloneValue deep copies objects and arrays.
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case common.MapStr:
+		return cloneMap(v)
+	case map[string]interface{}:
+		return cloneMap(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = cloneValue(e)
+		}
+		return out
+	case []string:
+		return append([]string(nil), v...)
+	}
+	return v
+}
+
+func cloneMap(m map[string]interface{}) common.MapStr {
+	out := make(common.MapStr, len(m))
+	for k, e := range m {
+		out[k] = cloneValue(e)
+	}
+	return out
+}
+
+// newStateObject creates the state object of a session. It accesses the store
+// of the session, which is replaced while the test function runs.
+//
+//	// javascript
+//	var count = state.Increment("events." + evt.Get("host.name"));
+func newStateObject(s *session) *goja.Object {
+	obj := s.vm.NewObject()
+	obj.Set("Get", func(call goja.FunctionCall) goja.Value {
+		return ToValue(s.vm, s.state.get(stateKey(call)))
+	})
+	obj.Set("Put", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) != 2 {
+			panic(errors.New("Put requires two arguments (key and value)"))
+		}
+		return ToValue(s.vm, s.state.put(stateKey(call), Export(call.Argument(1))))
+	})
+	obj.Set("Increment", func(call goja.FunctionCall) goja.Value {
+		delta := 1.0
+		if len(call.Arguments) > 1 {
+			delta = call.Argument(1).ToFloat()
+		}
+		v, err := s.state.increment(stateKey(call), delta)
+		if err != nil {
+			panic(err)
+		}
+		return s.vm.ToValue(v)
+	})
+	obj.Set("Delete", func(call goja.FunctionCall) goja.Value {
+		return s.vm.ToValue(s.state.delete(stateKey(call)))
+	})
+	obj.Set("Size", func(call goja.FunctionCall) goja.Value {
+		return s.vm.ToValue(s.state.size())
+	})
+	return obj
+}
+
+func stateKey(call goja.FunctionCall) string {
+	if goja.IsUndefined(call.Argument(0)) {
+		panic(errors.New("a state key is required"))
+	}
+	return call.Argument(0).String()
+}
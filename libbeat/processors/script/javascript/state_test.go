@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package javascript
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestStateStoreEviction(t *testing.T) {
+	s := newStateStore(StateConfig{MaxEntries: 2})
+
+	s.put("a", int64(1))
+	s.put("b", int64(2))
+	assert.Equal(t, int64(1), s.get("a"))
+
+	// b is the least recently used key.
+	s.put("c", int64(3))
+	assert.Equal(t, 2, s.size())
+	assert.Nil(t, s.get("b"))
+	assert.Equal(t, int64(1), s.get("a"))
+	assert.Equal(t, int64(3), s.get("c"))
+
+	assert.True(t, s.delete("a"))
+	assert.False(t, s.delete("a"))
+	assert.Equal(t, 1, s.size())
+}
+
+func TestStateStoreTTL(t *testing.T) {
+	now := time.Now()
+	s := newStateStore(StateConfig{TTL: time.Minute})
+	s.now = func() time.Time { return now }
+
+	s.put("a", "x")
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, "x", s.get("a"))
+
+	// Updates extend the expiration, reads don't.
+	v, err := s.increment("n", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, v)
+
+	now = now.Add(31 * time.Second)
+	assert.Nil(t, s.get("a"))
+	assert.Equal(t, 2.0, s.get("n"))
+
+	now = now.Add(time.Minute)
+	v, err = s.increment("n", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, v)
+}
+
+func TestStateStoreCopiesValues(t *testing.T) {
+	s := newStateStore(StateConfig{})
+
+	value := common.MapStr{"list": []interface{}{common.MapStr{"a": 1}}}
+	s.put("k", value)
+	value.Put("list", nil)
+
+	got := s.get("k").(common.MapStr)
+	assert.Equal(t, common.MapStr{"list": []interface{}{common.MapStr{"a": 1}}}, got)
+	got["list"] = nil
+	assert.NotNil(t, s.get("k").(common.MapStr)["list"])
+
+	_, err := s.increment("k", 1)
+	assert.Error(t, err)
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/processors/script/javascript"
+	"github.com/elastic/beats/v7/libbeat/processors/script/wasm"
 
 	// Register javascript modules with the processor.
 	_ "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module"
@@ -46,7 +47,9 @@ func New(c *common.Config) (processors.Processor, error) {
 	switch strings.ToLower(config.Lang) {
 	case "javascript", "js":
 		return javascript.New(c)
+	case "wasm", "webassembly":
+		return wasm.New(c)
 	default:
-		return nil, errors.Errorf("script type must be declared (e.g. type: javascript)")
+		return nil, errors.Errorf("script type must be declared (e.g. lang: javascript or lang: wasm)")
 	}
 }
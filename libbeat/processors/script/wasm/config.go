@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package wasm
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+)
+
+// pageSize is the size of a WebAssembly memory page.
+const pageSize = 64 * 1024
+
+// Config defines the WebAssembly module to use for the processor.
+type Config struct {
+	Tag               string                 `config:"tag"`                                  // Processor ID for debug and metrics.
+	File              string                 `config:"file" validate:"required"`             // WebAssembly module file.
+	Params            map[string]interface{} `config:"params"`                               // Parameters to pass to the module.
+	Timeout           time.Duration          `config:"timeout" validate:"min=0"`             // Execution timeout.
+	MaxMemory         cfgtype.ByteSize       `config:"max_memory"`                           // Max. memory of each module instance.
+	TagOnException    string                 `config:"tag_on_exception"`                     // Tag to add to events when the module fails.
+	MaxCachedSessions int                    `config:"max_cached_sessions" validate:"min=0"` // Max. number of cached module instances.
+}
+
+// Validate returns an error if the memory limit is out of range.
+func (c Config) Validate() error {
+	if c.MaxMemory < pageSize || c.MaxMemory > 65536*pageSize {
+		return errors.Errorf("max_memory must be between 64KiB and 4GiB")
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		MaxMemory:         16 * 1024 * 1024,
+		TagOnException:    "_wasm_exception",
+		MaxCachedSessions: 4,
+	}
+}
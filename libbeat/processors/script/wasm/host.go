@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// hostModuleName is the name of the module providing the host functions to
+// the guest.
+const hostModuleName = "beat"
+
+// Results of the host functions returning an int32. Non-negative values are
+// successes.
+const (
+	resultOK       int32 = 0
+	resultNotFound int32 = -1
+	resultError    int32 = -2
+)
+
+// Log levels of the log host function.
+const (
+	logDebug int32 = iota
+	logInfo
+	logWarn
+	logError
+)
+
+// instantiateHostModule defines the host ABI. Strings and values are passed as
+// pointer and length pairs into the memory of the guest, values are encoded
+// as JSON. Functions writing a value to the guest memory return the length of
+// the value, and only write it if it fits in the buffer, so the guest can
+// retry with a larger buffer.
+func instantiateHostModule(ctx context.Context, runtime wazero.Runtime) error {
+	_, err := runtime.NewHostModuleBuilder(hostModuleName).
+		// get_field(key_ptr, key_len, buf_ptr, buf_len) -> len | -1 | -2
+		NewFunctionBuilder().WithFunc(getField).Export("get_field").
+		// put_field(key_ptr, key_len, value_ptr, value_len) -> 0 | -2
+		NewFunctionBuilder().WithFunc(putField).Export("put_field").
+		// delete_field(key_ptr, key_len) -> 0 | -1
+		NewFunctionBuilder().WithFunc(deleteField).Export("delete_field").
+		// add_tag(tag_ptr, tag_len) -> 0 | -2
+		NewFunctionBuilder().WithFunc(addTag).Export("add_tag").
+		// drop()
+		NewFunctionBuilder().WithFunc(dropEvent).Export("drop").
+		// get_param(key_ptr, key_len, buf_ptr, buf_len) -> len | -1 | -2
+		NewFunctionBuilder().WithFunc(getParam).Export("get_param").
+		// set_error(msg_ptr, msg_len)
+		NewFunctionBuilder().WithFunc(setError).Export("set_error").
+		// log(level, msg_ptr, msg_len)
+		NewFunctionBuilder().WithFunc(logMessage).Export("log").
+		Instantiate(ctx)
+	return err
+}
+
+func getField(ctx context.Context, m api.Module, keyPtr, keyLen, bufPtr, bufLen uint32) int32 {
+	s := sessionFrom(ctx)
+	v, err := s.event.GetValue(readString(m, keyPtr, keyLen))
+	if err != nil {
+		return resultNotFound
+	}
+	return s.writeValue(m, v, bufPtr, bufLen)
+}
+
+func putField(ctx context.Context, m api.Module, keyPtr, keyLen, valuePtr, valueLen uint32) int32 {
+	s := sessionFrom(ctx)
+	key := readString(m, keyPtr, keyLen)
+	v, err := decodeValue(readBytes(m, valuePtr, valueLen))
+	if err != nil {
+		s.log.Debugf("Failed to decode value of field %v: %v", key, err)
+		return resultError
+	}
+	if ts, ok := v.(string); ok && key == "@timestamp" {
+		if v, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+			s.log.Debugf("Failed to parse @timestamp: %v", err)
+			return resultError
+		}
+	}
+	if _, err := s.event.PutValue(key, v); err != nil {
+		s.log.Debugf("Failed to put field %v: %v", key, err)
+		return resultError
+	}
+	return resultOK
+}
+
+func deleteField(ctx context.Context, m api.Module, keyPtr, keyLen uint32) int32 {
+	if err := sessionFrom(ctx).event.Delete(readString(m, keyPtr, keyLen)); err != nil {
+		return resultNotFound
+	}
+	return resultOK
+}
+
+func addTag(ctx context.Context, m api.Module, tagPtr, tagLen uint32) int32 {
+	s := sessionFrom(ctx)
+	if err := common.AddTags(s.event.Fields, []string{readString(m, tagPtr, tagLen)}); err != nil {
+		s.log.Debugf("Failed to add tag: %v", err)
+		return resultError
+	}
+	return resultOK
+}
+
+func dropEvent(ctx context.Context) {
+	sessionFrom(ctx).cancelled = true
+}
+
+func getParam(ctx context.Context, m api.Module, keyPtr, keyLen, bufPtr, bufLen uint32) int32 {
+	s := sessionFrom(ctx)
+	v, err := s.params.GetValue(readString(m, keyPtr, keyLen))
+	if err != nil {
+		return resultNotFound
+	}
+	return s.writeValue(m, v, bufPtr, bufLen)
+}
+
+func setError(ctx context.Context, m api.Module, msgPtr, msgLen uint32) {
+	sessionFrom(ctx).errorMsg = readString(m, msgPtr, msgLen)
+}
+
+func logMessage(ctx context.Context, m api.Module, level int32, msgPtr, msgLen uint32) {
+	log := sessionFrom(ctx).log
+	msg := readString(m, msgPtr, msgLen)
+	switch level {
+	case logDebug:
+		log.Debug(msg)
+	case logInfo:
+		log.Info(msg)
+	case logWarn:
+		log.Warn(msg)
+	default:
+		log.Error(msg)
+	}
+}
+
+func sessionFrom(ctx context.Context) *session {
+	s, _ := ctx.Value(sessionKey{}).(*session)
+	if s == nil || s.event == nil {
+		// Host functions are only available while processing an event.
+		panic(errors.New("no event is being processed"))
+	}
+	return s
+}
+
+// writeValue writes the JSON encoding of v to the buffer if it fits, and
+// returns its length.
+func (s *session) writeValue(m api.Module, v interface{}, bufPtr, bufLen uint32) int32 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.log.Debugf("Failed to encode value: %v", err)
+		return resultError
+	}
+	if uint32(len(data)) <= bufLen && !m.Memory().Write(bufPtr, data) {
+		panic(errors.Errorf("out of bounds memory access: offset=%d, length=%d", bufPtr, len(data)))
+	}
+	return int32(len(data))
+}
+
+// readBytes returns a view of the guest memory. Out of bounds accesses abort
+// the execution of the guest.
+func readBytes(m api.Module, ptr, size uint32) []byte {
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(errors.Errorf("out of bounds memory access: offset=%d, length=%d", ptr, size))
+	}
+	return data
+}
+
+func readString(m api.Module, ptr, size uint32) string {
+	return string(readBytes(m, ptr, size))
+}
@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const (
+	logName = "processor.wasm"
+
+	entryPointFunction = "process"
+	startFunction      = "_initialize"
+
+	timeoutError = "wasm processor execution timeout"
+)
+
+// sessionKey is the context key of the session calling the host functions.
+type sessionKey struct{}
+
+// session is an instance of the module used to process one event at a time.
+type session struct {
+	module         api.Module
+	process        api.Function
+	log            *logp.Logger
+	params         common.MapStr
+	timeout        time.Duration
+	tagOnException string
+
+	// State of the event being processed.
+	event     *beat.Event
+	cancelled bool
+	errorMsg  string
+
+	// broken is set when the instance must not be reused because the
+	// execution was aborted.
+	broken bool
+}
+
+func newSession(ctx context.Context, runtime wazero.Runtime, module wazero.CompiledModule, conf Config) (*session, error) {
+	logger := logp.NewLogger(logName)
+	if conf.Tag != "" {
+		logger = logger.With("instance_id", conf.Tag)
+	}
+
+	// Instances are anonymous so that the module can be instantiated many
+	// times. Reactor modules are initialized by their _initialize function.
+	instance, err := runtime.InstantiateModule(ctx, module,
+		wazero.NewModuleConfig().WithName("").WithStartFunctions(startFunction))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate module")
+	}
+
+	return &session{
+		module:         instance,
+		process:        instance.ExportedFunction(entryPointFunction),
+		log:            logger,
+		params:         common.MapStr(conf.Params),
+		timeout:        conf.Timeout,
+		tagOnException: conf.TagOnException,
+	}, nil
+}
+
+// runProcessFunc executes process() of the module. The function returns 0 on
+// success, any other value is reported as an error.
+func (s *session) runProcessFunc(b *beat.Event) (*beat.Event, error) {
+	if b.Fields == nil {
+		b.Fields = common.MapStr{}
+	}
+	s.event, s.cancelled, s.errorMsg = b, false, ""
+	defer func() { s.event = nil }()
+
+	ctx := context.WithValue(context.Background(), sessionKey{}, s)
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	results, err := s.process.Call(ctx)
+	if err != nil {
+		s.broken = true
+		if ctx.Err() == context.DeadlineExceeded {
+			err = errors.New(timeoutError)
+		}
+		return s.fail(b, errors.Wrap(err, "failed in process function"))
+	}
+
+	if code := int32(results[0]); code != 0 {
+		msg := s.errorMsg
+		if msg == "" {
+			msg = fmt.Sprintf("process function returned error code %d", code)
+		}
+		return s.fail(b, errors.New(msg))
+	}
+
+	if s.cancelled {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// fail tags the event and adds the error message to it. The event is always
+// returned, even if the module dropped it.
+func (s *session) fail(b *beat.Event, err error) (*beat.Event, error) {
+	if s.tagOnException != "" {
+		common.AddTags(b.Fields, []string{s.tagOnException})
+	}
+	appendString(b.Fields, "error.message", err.Error())
+	return b, err
+}
+
+func (s *session) close() {
+	s.module.Close(context.Background())
+}
+
+type sessionPool struct {
+	New func() (*session, error)
+	C   chan *session
+}
+
+func newSessionPool(ctx context.Context, runtime wazero.Runtime, code []byte, c Config) (*sessionPool, error) {
+	module, err := compileModule(ctx, runtime, code)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate that the module can be instantiated.
+	s, err := newSession(ctx, runtime, module, c)
+	if err != nil {
+		return nil, err
+	}
+	if s.process == nil {
+		return nil, errors.New("process function not found")
+	}
+
+	pool := sessionPool{
+		New: func() (*session, error) {
+			return newSession(context.Background(), runtime, module, c)
+		},
+		C: make(chan *session, c.MaxCachedSessions),
+	}
+	pool.Put(s)
+
+	return &pool, nil
+}
+
+func (p *sessionPool) Get() (*session, error) {
+	select {
+	case s := <-p.C:
+		return s, nil
+	default:
+		return p.New()
+	}
+}
+
+// Put caches the session for reuse, or releases its instance if the cache is
+// full or the session is broken.
+func (p *sessionPool) Put(s *session) {
+	if s == nil {
+		return
+	}
+	if !s.broken {
+		select {
+		case p.C <- s:
+			return
+		default:
+		}
+	}
+	s.close()
+}
+
+// decodeValue decodes a JSON value. Integer numbers are decoded as int64,
+// other numbers as float64.
+func decodeValue(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("invalid JSON value: unexpected data after value")
+	}
+	return convertNumbers(v), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertNumbers(e)
+		}
+		return common.MapStr(v)
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertNumbers(e)
+		}
+	}
+	return v
+}
+
+// appendString appends a value to a field, converting it to an array if it
+// already has a value.
+func appendString(m common.MapStr, field, value string) {
+	existing, _ := m.GetValue(field)
+	switch v := existing.(type) {
+	case nil:
+		m.Put(field, value)
+	case string:
+		m.Put(field, []string{v, value})
+	case []string:
+		m.Put(field, append(v, value))
+	case []interface{}:
+		m.Put(field, append(v, value))
+	}
+}
@@ -0,0 +1,71 @@
+;; Test module for the wasm processor. Build process.wasm with:
+;;
+;;   wat2wasm process.wat -o process.wasm
+;;
+;; The module copies "message" to "copy", puts the "suffix" param in "param",
+;; adds the "wasm" tag, deletes "remove" and counts its calls in "calls" (as a
+;; single digit). Events with the fields "drop", "loop", "trap" or "fail" are
+;; dropped, never finish, trap or return an error.
+(module
+  (type $t0 (func (param i32 i32 i32 i32) (result i32)))
+  (type $t1 (func (param i32 i32) (result i32)))
+  (type $t2 (func))
+  (type $t3 (func (param i32 i32)))
+  (type $t4 (func (result i32)))
+
+  (import "beat" "get_field" (func $get_field (type $t0)))
+  (import "beat" "put_field" (func $put_field (type $t0)))
+  (import "beat" "delete_field" (func $delete_field (type $t1)))
+  (import "beat" "add_tag" (func $add_tag (type $t1)))
+  (import "beat" "drop" (func $drop (type $t2)))
+  (import "beat" "get_param" (func $get_param (type $t0)))
+  (import "beat" "set_error" (func $set_error (type $t3)))
+
+  (memory (export "memory") 1)
+  (global $calls (mut i32) (i32.const 0))
+
+  (data (i32.const 0) "message")
+  (data (i32.const 16) "copy")
+  (data (i32.const 32) "drop")
+  (data (i32.const 48) "loop")
+  (data (i32.const 64) "fail")
+  (data (i32.const 80) "process failed")
+  (data (i32.const 96) "suffix")
+  (data (i32.const 112) "param")
+  (data (i32.const 128) "wasm")
+  (data (i32.const 144) "remove")
+  (data (i32.const 160) "calls")
+  (data (i32.const 192) "trap")
+
+  ;; Values are read into the 1024 bytes buffer at offset 1024.
+  (func (export "process") (type $t4) (local $n i32)
+    (global.set $calls (i32.rem_u (i32.add (global.get $calls) (i32.const 1)) (i32.const 10)))
+    (i32.store8 (i32.const 176) (i32.add (global.get $calls) (i32.const 48)))
+    (drop (call $put_field (i32.const 160) (i32.const 5) (i32.const 176) (i32.const 1)))
+
+    (local.set $n (call $get_field (i32.const 0) (i32.const 7) (i32.const 1024) (i32.const 1024)))
+    (if (i32.le_u (local.get $n) (i32.const 1024))
+      (then (drop (call $put_field (i32.const 16) (i32.const 4) (i32.const 1024) (local.get $n)))))
+
+    (if (i32.ge_s (call $get_field (i32.const 32) (i32.const 4) (i32.const 1024) (i32.const 1024)) (i32.const 0))
+      (then (call $drop)))
+
+    (if (i32.ge_s (call $get_field (i32.const 48) (i32.const 4) (i32.const 1024) (i32.const 1024)) (i32.const 0))
+      (then (loop $forever (br $forever))))
+
+    (if (i32.ge_s (call $get_field (i32.const 192) (i32.const 4) (i32.const 1024) (i32.const 1024)) (i32.const 0))
+      (then (unreachable)))
+
+    (if (i32.ge_s (call $get_field (i32.const 64) (i32.const 4) (i32.const 1024) (i32.const 1024)) (i32.const 0))
+      (then
+        (call $set_error (i32.const 80) (i32.const 14))
+        (return (i32.const 1))))
+
+    (local.set $n (call $get_param (i32.const 96) (i32.const 6) (i32.const 1024) (i32.const 1024)))
+    (if (i32.le_u (local.get $n) (i32.const 1024))
+      (then (drop (call $put_field (i32.const 112) (i32.const 5) (i32.const 1024) (local.get $n)))))
+
+    (drop (call $add_tag (i32.const 128) (i32.const 4)))
+    (drop (call $delete_field (i32.const 144) (i32.const 6)))
+    (i32.const 0))
+)
@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package wasm
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/monitoring/adapter"
+	"github.com/elastic/beats/v7/libbeat/paths"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// compilationCache is shared by all processors so that the same module is
+// compiled only once, even if the processor is reloaded.
+var compilationCache = wazero.NewCompilationCache()
+
+type wasmProcessor struct {
+	Config
+	runtime     wazero.Runtime
+	sessionPool *sessionPool
+	sourceFile  string
+	stats       *processorStats
+}
+
+// New constructs a new WebAssembly processor.
+func New(c *common.Config) (processors.Processor, error) {
+	conf := defaultConfig()
+	if err := c.Unpack(&conf); err != nil {
+		return nil, err
+	}
+
+	return NewFromConfig(conf, monitoring.Default)
+}
+
+// NewFromConfig constructs a new WebAssembly processor from the given config
+// object. It loads the module, compiles it, and validates the entry point.
+func NewFromConfig(c Config, reg *monitoring.Registry) (processors.Processor, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	sourceFile := paths.Resolve(paths.Config, c.File)
+	code, err := loadModule(sourceFile)
+	if err != nil {
+		return nil, annotateError(c.Tag, err)
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(compilationCache).
+		WithCloseOnContextDone(c.Timeout > 0).
+		WithMemoryLimitPages(uint32(c.MaxMemory/pageSize)))
+
+	pool, err := newSessionPool(ctx, runtime, code, c)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, annotateError(c.Tag, err)
+	}
+
+	return &wasmProcessor{
+		Config:      c,
+		runtime:     runtime,
+		sessionPool: pool,
+		sourceFile:  sourceFile,
+		stats:       getStats(c.Tag, reg),
+	}, nil
+}
+
+// loadModule reads a WebAssembly module file.
+func loadModule(path string) ([]byte, error) {
+	if common.IsStrictPerms() {
+		if err := common.OwnerHasExclusiveWritePerms(path); err != nil {
+			return nil, err
+		}
+	}
+
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read file %v", path)
+	}
+	return code, nil
+}
+
+// compileModule compiles the module and the host modules it can import. The
+// guest only gets access to the event through the beat module. WASI is
+// provided for modules built for it, but without arguments, environment
+// variables, file system or network access.
+func compileModule(ctx context.Context, runtime wazero.Runtime, code []byte) (wazero.CompiledModule, error) {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate WASI")
+	}
+	if err := instantiateHostModule(ctx, runtime); err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate host module")
+	}
+
+	module, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile module")
+	}
+	if _, found := module.ExportedFunctions()[entryPointFunction]; !found {
+		return nil, errors.New("process function not found")
+	}
+	return module, nil
+}
+
+func annotateError(id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if id != "" {
+		return errors.Wrapf(err, "failed in processor.wasm with id=%v", id)
+	}
+	return errors.Wrap(err, "failed in processor.wasm")
+}
+
+// Run executes the processor on the given event. It invokes the process
+// function exported by the module.
+func (p *wasmProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	s, err := p.sessionPool.Get()
+	if err != nil {
+		return event, annotateError(p.Tag, err)
+	}
+	defer p.sessionPool.Put(s)
+
+	var rtn *beat.Event
+	if p.stats == nil {
+		rtn, err = s.runProcessFunc(event)
+	} else {
+		rtn, err = p.runWithStats(s, event)
+	}
+	return rtn, annotateError(p.Tag, err)
+}
+
+func (p *wasmProcessor) runWithStats(s *session, event *beat.Event) (*beat.Event, error) {
+	start := time.Now()
+	event, err := s.runProcessFunc(event)
+	elapsed := time.Since(start)
+
+	p.stats.processTime.Update(int64(elapsed))
+	if err != nil {
+		p.stats.exceptions.Inc()
+	}
+	return event, err
+}
+
+// Close releases the module instances and the runtime.
+func (p *wasmProcessor) Close() error {
+	return p.runtime.Close(context.Background())
+}
+
+func (p *wasmProcessor) String() string {
+	return "script=[type=wasm, id=" + p.Tag + ", file=" + p.sourceFile + "]"
+}
+
+type processorStats struct {
+	exceptions  *monitoring.Int
+	processTime metrics.Sample
+}
+
+func getStats(id string, reg *monitoring.Registry) *processorStats {
+	if id == "" || reg == nil {
+		return nil
+	}
+
+	namespace := logName + "." + id
+	processorReg := reg.GetRegistry(namespace)
+	if processorReg != nil {
+		// If a module is reloaded then the namespace could already exist.
+		processorReg.Clear()
+	} else {
+		processorReg = reg.NewRegistry(namespace, monitoring.DoNotReport)
+	}
+
+	stats := &processorStats{
+		exceptions:  monitoring.NewInt(processorReg, "exceptions"),
+		processTime: metrics.NewUniformSample(2048),
+	}
+	adapter.NewGoMetrics(processorReg, "histogram", adapter.Accept).
+		Register("process_time", metrics.NewHistogram(stats.processTime))
+
+	return stats
+}
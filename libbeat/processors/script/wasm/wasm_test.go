@@ -0,0 +1,218 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package wasm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+const testModule = "testdata/process.wasm"
+
+func newTestProcessor(t testing.TB, modify func(*Config)) *wasmProcessor {
+	t.Helper()
+	c := defaultConfig()
+	c.File = testModule
+	if modify != nil {
+		modify(&c)
+	}
+	p, err := NewFromConfig(c, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { processors.Close(p) })
+	return p.(*wasmProcessor)
+}
+
+func testEvent(fields common.MapStr) *beat.Event {
+	return &beat.Event{Timestamp: time.Now(), Fields: fields}
+}
+
+func TestHostFunctions(t *testing.T) {
+	p := newTestProcessor(t, func(c *Config) {
+		c.Params = map[string]interface{}{"suffix": map[string]interface{}{"value": 42}}
+	})
+
+	evt, err := p.Run(testEvent(common.MapStr{
+		"message": common.MapStr{"text": "hello", "count": 3, "ratio": 0.5},
+		"remove":  true,
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, common.MapStr{
+		"message": common.MapStr{"text": "hello", "count": 3, "ratio": 0.5},
+		"copy":    common.MapStr{"text": "hello", "count": int64(3), "ratio": 0.5},
+		"param":   common.MapStr{"value": int64(42)},
+		"calls":   int64(1),
+		"tags":    []string{"wasm"},
+	}, evt.Fields)
+}
+
+func TestModuleInstanceReused(t *testing.T) {
+	p := newTestProcessor(t, nil)
+
+	for i := 1; i <= 3; i++ {
+		evt, err := p.Run(testEvent(common.MapStr{}))
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), evt.Fields["calls"])
+	}
+}
+
+func TestDrop(t *testing.T) {
+	p := newTestProcessor(t, nil)
+
+	evt, err := p.Run(testEvent(common.MapStr{"drop": true}))
+	assert.NoError(t, err)
+	assert.Nil(t, evt)
+}
+
+func TestErrorCode(t *testing.T) {
+	p := newTestProcessor(t, nil)
+
+	evt, err := p.Run(testEvent(common.MapStr{"fail": true}))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "process failed")
+	}
+	require.NotNil(t, evt)
+	assert.Equal(t, []string{"_wasm_exception"}, evt.Fields["tags"])
+	assert.Equal(t, "process failed", evt.Fields["error"].(common.MapStr)["message"])
+
+	// The instance is still usable after an error code.
+	evt, err = p.Run(testEvent(common.MapStr{}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), evt.Fields["calls"])
+}
+
+func TestTrap(t *testing.T) {
+	p := newTestProcessor(t, nil)
+
+	evt, err := p.Run(testEvent(common.MapStr{"trap": true}))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unreachable")
+	}
+	require.NotNil(t, evt)
+	assert.Equal(t, []string{"_wasm_exception"}, evt.Fields["tags"])
+
+	// The broken instance is replaced by a new one.
+	evt, err = p.Run(testEvent(common.MapStr{}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), evt.Fields["calls"])
+}
+
+func TestTimeout(t *testing.T) {
+	p := newTestProcessor(t, func(c *Config) {
+		c.Timeout = 100 * time.Millisecond
+	})
+
+	evt, err := p.Run(testEvent(common.MapStr{"loop": true}))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), timeoutError)
+	}
+	require.NotNil(t, evt)
+	assert.Equal(t, []string{"_wasm_exception"}, evt.Fields["tags"])
+
+	evt, err = p.Run(testEvent(common.MapStr{}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), evt.Fields["calls"])
+}
+
+func TestDecodeValue(t *testing.T) {
+	v, err := decodeValue([]byte(`{"a": [1, 2.5, "x", {"b": null}], "c": true}`))
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"a": []interface{}{int64(1), 2.5, "x", common.MapStr{"b": nil}},
+		"c": true,
+	}, v)
+
+	_, err = decodeValue([]byte(`1 2`))
+	assert.Error(t, err)
+
+	_, err = decodeValue([]byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.wasm")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte("not wasm"), 0o600))
+	noProcess := filepath.Join(dir, "empty.wasm")
+	require.NoError(t, ioutil.WriteFile(noProcess, []byte("\x00asm\x01\x00\x00\x00"), 0o600))
+
+	tests := map[string]struct {
+		file string
+		err  string
+	}{
+		"missing file":     {filepath.Join(dir, "missing.wasm"), "missing.wasm"},
+		"invalid module":   {invalid, "failed to compile module"},
+		"missing function": {noProcess, "process function not found"},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			c := defaultConfig()
+			c.File = test.file
+			_, err := NewFromConfig(c, nil)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"lang":       "wasm",
+		"file":       testModule,
+		"max_memory": "1MiB",
+	}))
+	require.NoError(t, err)
+	defer processors.Close(p)
+	assert.Equal(t, cfgtype.ByteSize(1024*1024), p.(*wasmProcessor).MaxMemory)
+
+	_, err = New(common.MustNewConfigFrom(common.MapStr{"file": testModule, "max_memory": "1KiB"}))
+	assert.Error(t, err)
+
+	_, err = New(common.MustNewConfigFrom(common.MapStr{"lang": "wasm"}))
+	assert.Error(t, err)
+}
+
+func TestMetrics(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	c := defaultConfig()
+	c.File = testModule
+	c.Tag = "test"
+	p, err := NewFromConfig(c, reg)
+	require.NoError(t, err)
+	defer processors.Close(p)
+
+	p.Run(testEvent(common.MapStr{}))
+	p.Run(testEvent(common.MapStr{"fail": true}))
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(1), snapshot.Ints["processor.wasm.test.exceptions"])
+	assert.Equal(t, int64(2), snapshot.Ints["processor.wasm.test.histogram.process_time.count"])
+}
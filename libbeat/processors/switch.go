@@ -0,0 +1,286 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/joeshaw/multierror"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+const switchLogName = "processor.switch"
+
+// switchInstanceID is used to assign each switch processor a unique
+// monitoring namespace.
+var switchInstanceID = atomic.MakeUint32(0)
+
+func init() {
+	RegisterPlugin("switch", NewConditional(NewSwitchProcessor))
+}
+
+type switchConfig struct {
+	Field   string             `config:"field"`
+	Cases   []switchCaseConfig `config:"cases"   validate:"required"`
+	Default *common.Config     `config:"default"`
+}
+
+type switchCaseConfig struct {
+	Name       string             `config:"name"`
+	Value      []string           `config:"value"`
+	When       *conditions.Config `config:"when"`
+	Processors *common.Config     `config:"processors" validate:"required"`
+	Continue   bool               `config:"continue"`
+}
+
+func (c *switchConfig) Validate() error {
+	names := map[string]struct{}{}
+	for i, sc := range c.Cases {
+		if c.Field != "" {
+			if len(sc.Value) == 0 {
+				return fmt.Errorf("case %d: value is required when switching on field %q", i, c.Field)
+			}
+			if sc.When != nil {
+				return fmt.Errorf("case %d: when can not be used when switching on field %q", i, c.Field)
+			}
+		} else {
+			if sc.When == nil {
+				return fmt.Errorf("case %d: when is required if no field is set", i)
+			}
+			if len(sc.Value) != 0 {
+				return fmt.Errorf("case %d: value requires a field to switch on", i)
+			}
+		}
+
+		name := sc.name(i)
+		if _, exists := names[name]; exists {
+			return fmt.Errorf("case %d: duplicate case name %q", i, name)
+		}
+		names[name] = struct{}{}
+	}
+	return nil
+}
+
+// name returns the configured name of the case or its index.
+func (c *switchCaseConfig) name(i int) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return strconv.Itoa(i)
+}
+
+// SwitchProcessor dispatches events to the processors of the matching case.
+// The cases either match the value of a field, which is read only once, or
+// are selected by a condition. Cases are evaluated in order and by default
+// processing stops at the first matching case. The processors of the default
+// branch are executed when no case matched.
+type SwitchProcessor struct {
+	field     string
+	cases     []*switchCase
+	byValue   map[string][]*switchCase
+	def       *switchCase
+	unmatched *monitoring.Int
+}
+
+type switchCase struct {
+	name       string
+	cond       conditions.Condition
+	processors *Processors
+	cont       bool
+	events     *monitoring.Int
+}
+
+// NewSwitchProcessor constructs a new SwitchProcessor.
+func NewSwitchProcessor(cfg *common.Config) (Processor, error) {
+	var config switchConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrap(err, "failed to unpack the switch configuration")
+	}
+
+	id := int(switchInstanceID.Inc())
+	reg := monitoring.Default.NewRegistry(switchLogName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	casesReg := reg.NewRegistry("cases")
+
+	p := &SwitchProcessor{
+		field:     config.Field,
+		unmatched: monitoring.NewInt(reg, "unmatched"),
+	}
+	if p.field != "" {
+		p.byValue = map[string][]*switchCase{}
+	}
+
+	for i, sc := range config.Cases {
+		name := sc.name(i)
+		procs, err := newSubProcessors(sc.Processors)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to make processors of case %q", name)
+		}
+
+		// Case names can contain dots, which the monitoring registry
+		// interprets as nested registries, so cases are keyed by index.
+		caseReg := casesReg.NewRegistry(strconv.Itoa(i))
+		monitoring.NewString(caseReg, "name").Set(name)
+		c := &switchCase{
+			name:       name,
+			processors: procs,
+			cont:       sc.Continue,
+			events:     monitoring.NewInt(caseReg, "events"),
+		}
+		if sc.When != nil {
+			if c.cond, err = conditions.NewCondition(sc.When); err != nil {
+				return nil, errors.Wrapf(err, "failed to initialize condition of case %q", name)
+			}
+		}
+		for _, v := range sc.Value {
+			p.byValue[v] = append(p.byValue[v], c)
+		}
+		p.cases = append(p.cases, c)
+	}
+
+	if config.Default != nil {
+		procs, err := newSubProcessors(config.Default)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to make processors of the default case")
+		}
+		p.def = &switchCase{
+			name:       "default",
+			processors: procs,
+			events:     monitoring.NewInt(reg.NewRegistry("default"), "events"),
+		}
+	}
+
+	return p, nil
+}
+
+// Run executes the processors of the cases matching the event. If no case
+// matches, the processors of the default branch are executed.
+func (p *SwitchProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	cases := p.cases
+	if p.field != "" {
+		cases = nil
+		if key, ok := switchKey(event, p.field); ok {
+			cases = p.byValue[key]
+		}
+	}
+
+	var err error
+	handled := false
+	for _, c := range cases {
+		if c.cond != nil && !c.cond.Check(event) {
+			continue
+		}
+
+		handled = true
+		c.events.Inc()
+		event, err = c.processors.Run(event)
+		if err != nil || event == nil || !c.cont {
+			return event, err
+		}
+	}
+	if handled {
+		return event, nil
+	}
+
+	p.unmatched.Inc()
+	if p.def == nil {
+		return event, nil
+	}
+	p.def.events.Inc()
+	return p.def.processors.Run(event)
+}
+
+// switchKey returns the string representation of a field used to look up the
+// matching cases. Only scalar values can be matched.
+func switchKey(event *beat.Event, field string) (string, bool) {
+	v, err := event.GetValue(field)
+	if err != nil {
+		return "", false
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+// SetEmitter passes the emit function to the processors of all cases.
+func (p *SwitchProcessor) SetEmitter(emit func(beat.Event)) {
+	for _, c := range p.cases {
+		c.processors.SetEmitter(emit)
+	}
+	if p.def != nil {
+		p.def.processors.SetEmitter(emit)
+	}
+}
+
+// Close closes the processors of all cases.
+func (p *SwitchProcessor) Close() error {
+	var errs multierror.Errors
+	for _, c := range p.cases {
+		if err := c.processors.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.def != nil {
+		if err := p.def.processors.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
+}
+
+func (p *SwitchProcessor) String() string {
+	var sb strings.Builder
+	sb.WriteString("switch=[")
+	if p.field != "" {
+		sb.WriteString("field=")
+		sb.WriteString(p.field)
+		sb.WriteString(", ")
+	}
+	sb.WriteString("cases=[")
+	for i, c := range p.cases {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(c.name)
+		if c.cond != nil {
+			sb.WriteString(" if ")
+			sb.WriteString(c.cond.String())
+		}
+		sb.WriteString(": ")
+		sb.WriteString(c.processors.String())
+	}
+	sb.WriteString("]")
+	if p.def != nil {
+		sb.WriteString(", default=")
+		sb.WriteString(p.def.processors.String())
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
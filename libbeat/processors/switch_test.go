@@ -0,0 +1,237 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestSwitchProcessor(t *testing.T) {
+	const switchField = `
+- switch:
+    field: event.dataset
+    cases:
+      - value: nginx.access
+        processors:
+          - add_fields: {target: "", fields: {type: access}}
+      - value: [nginx.error, apache.error]
+        processors:
+          - add_fields: {target: "", fields: {type: error}}
+      - value: 404
+        processors:
+          - add_fields: {target: "", fields: {type: not_found}}
+    default:
+      - add_fields: {target: "", fields: {type: unknown}}
+`
+
+	const switchConditions = `
+- switch:
+    cases:
+      - when.range.uid.lt: 500
+        processors:
+          add_fields: {target: "", fields: {uid_type: reserved}}
+        continue: true
+      - when.range.uid.lt: 1000
+        processors:
+          - add_fields: {target: "", fields: {uid_range: low}}
+      - when.range.uid.lt: 2000
+        processors:
+          - add_fields: {target: "", fields: {uid_range: mid}}
+`
+
+	const switchWhen = `
+- switch:
+    when.has_fields: [event.dataset]
+    field: event.dataset
+    cases:
+      - value: nginx.access
+        processors:
+          - add_fields: {target: "", fields: {type: access}}
+    default:
+      - add_fields: {target: "", fields: {type: unknown}}
+`
+
+	testProcessors(t, map[string]testCase{
+		"field-single-value": {
+			event: common.MapStr{"event": common.MapStr{"dataset": "nginx.access"}},
+			want:  common.MapStr{"event": common.MapStr{"dataset": "nginx.access"}, "type": "access"},
+			cfg:   switchField,
+		},
+		"field-value-list": {
+			event: common.MapStr{"event": common.MapStr{"dataset": "apache.error"}},
+			want:  common.MapStr{"event": common.MapStr{"dataset": "apache.error"}, "type": "error"},
+			cfg:   switchField,
+		},
+		"field-number": {
+			event: common.MapStr{"event": common.MapStr{"dataset": 404}},
+			want:  common.MapStr{"event": common.MapStr{"dataset": 404}, "type": "not_found"},
+			cfg:   switchField,
+		},
+		"field-default": {
+			event: common.MapStr{"event": common.MapStr{"dataset": "system.auth"}},
+			want:  common.MapStr{"event": common.MapStr{"dataset": "system.auth"}, "type": "unknown"},
+			cfg:   switchField,
+		},
+		"field-missing": {
+			event: common.MapStr{"message": "hello"},
+			want:  common.MapStr{"message": "hello", "type": "unknown"},
+			cfg:   switchField,
+		},
+		"conditions-continue": {
+			event: common.MapStr{"uid": 411},
+			want:  common.MapStr{"uid": 411, "uid_type": "reserved", "uid_range": "low"},
+			cfg:   switchConditions,
+		},
+		"conditions-stop": {
+			event: common.MapStr{"uid": 700},
+			want:  common.MapStr{"uid": 700, "uid_range": "low"},
+			cfg:   switchConditions,
+		},
+		"when-match": {
+			event: common.MapStr{"event": common.MapStr{"dataset": "system.auth"}},
+			want:  common.MapStr{"event": common.MapStr{"dataset": "system.auth"}, "type": "unknown"},
+			cfg:   switchWhen,
+		},
+		"when-no-match": {
+			event: common.MapStr{"message": "hello"},
+			want:  common.MapStr{"message": "hello"},
+			cfg:   switchWhen,
+		},
+		"conditions-no-match": {
+			event: common.MapStr{"uid": 3000},
+			want:  common.MapStr{"uid": 3000},
+			cfg:   switchConditions,
+		},
+	})
+}
+
+func TestSwitchProcessorMetrics(t *testing.T) {
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"field": "event.dataset",
+		"cases": []map[string]interface{}{
+			{
+				"name":       "access",
+				"value":      "nginx.access",
+				"processors": []map[string]interface{}{{"drop_fields": map[string]interface{}{"fields": []string{"message"}}}},
+			},
+			{
+				"value":      "nginx.error",
+				"processors": []map[string]interface{}{{"drop_event": nil}},
+			},
+		},
+	})
+	p, err := NewSwitchProcessor(cfg)
+	require.NoError(t, err)
+	sp := p.(*SwitchProcessor)
+
+	for _, dataset := range []string{"nginx.access", "nginx.access", "nginx.error", "system.auth"} {
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{
+			"event":   common.MapStr{"dataset": dataset},
+			"message": "hello",
+		}})
+		require.NoError(t, err)
+		if dataset == "nginx.error" {
+			assert.Nil(t, event)
+		} else {
+			assert.NotNil(t, event)
+		}
+	}
+
+	require.Len(t, sp.cases, 2)
+	assert.Equal(t, "access", sp.cases[0].name)
+	assert.EqualValues(t, 2, sp.cases[0].events.Get())
+	assert.Equal(t, "1", sp.cases[1].name)
+	assert.EqualValues(t, 1, sp.cases[1].events.Get())
+	assert.EqualValues(t, 1, sp.unmatched.Get())
+	assert.Nil(t, sp.def)
+}
+
+func TestSwitchProcessorDottedCaseNames(t *testing.T) {
+	processors := []map[string]interface{}{{"add_tags": map[string]interface{}{"tags": []string{"matched"}}}}
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"field": "event.dataset",
+		"cases": []map[string]interface{}{
+			{"name": "nginx.access", "value": "nginx.access", "processors": processors},
+			{"name": "nginx", "value": "nginx", "processors": processors},
+			{"name": "nginx.access.v2", "value": "nginx.access.v2", "processors": processors},
+		},
+	})
+	p, err := NewSwitchProcessor(cfg)
+	require.NoError(t, err)
+	sp := p.(*SwitchProcessor)
+
+	_, err = p.Run(&beat.Event{Fields: common.MapStr{"event": common.MapStr{"dataset": "nginx"}}})
+	require.NoError(t, err)
+
+	require.Len(t, sp.cases, 3)
+	assert.EqualValues(t, 0, sp.cases[0].events.Get())
+	assert.EqualValues(t, 1, sp.cases[1].events.Get())
+	assert.EqualValues(t, 0, sp.cases[2].events.Get())
+}
+
+func TestSwitchProcessorConfigErrors(t *testing.T) {
+	processors := []map[string]interface{}{{"drop_event": nil}}
+
+	tests := map[string]map[string]interface{}{
+		"no cases": {
+			"field": "event.dataset",
+		},
+		"value without field": {
+			"cases": []map[string]interface{}{
+				{"value": "a", "processors": processors},
+			},
+		},
+		"condition with field": {
+			"field": "event.dataset",
+			"cases": []map[string]interface{}{
+				{"value": "a", "when.equals.a": 1, "processors": processors},
+			},
+		},
+		"missing condition": {
+			"cases": []map[string]interface{}{
+				{"processors": processors},
+			},
+		},
+		"missing processors": {
+			"field": "event.dataset",
+			"cases": []map[string]interface{}{
+				{"value": "a"},
+			},
+		},
+		"duplicate names": {
+			"field": "event.dataset",
+			"cases": []map[string]interface{}{
+				{"name": "a", "value": "a", "processors": processors},
+				{"name": "a", "value": "b", "processors": processors},
+			},
+		},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSwitchProcessor(common.MustNewConfigFrom(cfg))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package util
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// maxFlushInterval is the maximum interval between two flushes.
+const maxFlushInterval = time.Second
+
+// Flusher emits the events of a processor publishing events of its own, like
+// summaries of time windows. Once started, a loop calls the flush function of
+// the processor every interval, capped to one second, and when events are
+// queued. Close stops the loop and flushes with all set, so the processor can
+// emit the events of the windows still open.
+type Flusher struct {
+	log        *logp.Logger
+	interval   time.Duration
+	maxPending int
+	flush      func(all bool)
+	emitted    *monitoring.Uint
+	dropped    *monitoring.Uint
+
+	mutex   sync.Mutex
+	pending []beat.Event
+	emit    func(beat.Event)
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	signal    chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewFlusher creates a Flusher calling flush every interval once started. At
+// most maxPending events are queued. The emitted and dropped events are counted
+// in the given metrics.
+func NewFlusher(
+	log *logp.Logger,
+	interval time.Duration,
+	maxPending int,
+	flush func(all bool),
+	emitted, dropped *monitoring.Uint,
+) *Flusher {
+	if interval > maxFlushInterval {
+		interval = maxFlushInterval
+	}
+	return &Flusher{
+		log:        log,
+		interval:   interval,
+		maxPending: maxPending,
+		flush:      flush,
+		emitted:    emitted,
+		dropped:    dropped,
+		signal:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// SetEmitter sets the function used to publish the events. It does not start
+// the flush loop.
+func (f *Flusher) SetEmitter(emit func(beat.Event)) {
+	f.mutex.Lock()
+	f.emit = emit
+	f.mutex.Unlock()
+}
+
+// Start starts the flush loop if it is not running yet.
+func (f *Flusher) Start() {
+	f.startOnce.Do(func() {
+		go f.run()
+	})
+}
+
+func (f *Flusher) run() {
+	defer close(f.stopped)
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		case <-f.signal:
+		}
+		f.flush(false)
+	}
+}
+
+// Queue queues an event to be emitted by the flush loop, like the summary of a
+// window closed early. It returns false if too many events are pending, the
+// event is not queued then.
+func (f *Flusher) Queue(event beat.Event) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.pending) >= f.maxPending {
+		f.dropped.Inc()
+		return false
+	}
+	f.pending = append(f.pending, event)
+
+	select {
+	case f.signal <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Emit emits the queued events followed by the given events. The events are
+// dropped if no emitter is set, as the processor can not publish events in
+// this context.
+func (f *Flusher) Emit(events []beat.Event) {
+	f.mutex.Lock()
+	events = append(f.pending, events...)
+	f.pending = nil
+	emit := f.emit
+	f.mutex.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	if emit == nil {
+		f.dropped.Add(uint64(len(events)))
+		f.log.Warnf("Dropping %d events, the processor can not publish events in this context", len(events))
+		return
+	}
+	for _, event := range events {
+		emit(event)
+		f.emitted.Inc()
+	}
+}
+
+// Close stops the flush loop and flushes the events of all windows.
+func (f *Flusher) Close() {
+	f.closeOnce.Do(func() {
+		close(f.done)
+		// Prevent the flush loop from being started if it wasn't yet.
+		f.startOnce.Do(func() { close(f.stopped) })
+		<-f.stopped
+		f.flush(true)
+	})
+}
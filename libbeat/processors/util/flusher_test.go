@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package util
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// windows is a processor closing one of its open windows on every flush.
+type windows struct {
+	mutex   sync.Mutex
+	open    int
+	emitted []beat.Event
+	flusher *Flusher
+}
+
+func newWindows(maxPending int) *windows {
+	reg := monitoring.NewRegistry()
+	w := &windows{}
+	w.flusher = NewFlusher(logp.NewLogger("test"), time.Millisecond, maxPending, w.flush,
+		monitoring.NewUint(reg, "emitted"), monitoring.NewUint(reg, "dropped"))
+	return w
+}
+
+func (w *windows) flush(all bool) {
+	w.mutex.Lock()
+	n := w.open
+	if !all && n > 1 {
+		n = 1
+	}
+	w.open -= n
+	w.mutex.Unlock()
+
+	w.flusher.Emit(make([]beat.Event, n))
+}
+
+func (w *windows) emit(event beat.Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.emitted = append(w.emitted, event)
+}
+
+func (w *windows) count() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.emitted)
+}
+
+func TestFlusher(t *testing.T) {
+	w := newWindows(10)
+	w.open = 2
+	w.flusher.SetEmitter(w.emit)
+	w.flusher.Start()
+
+	assert.Eventually(t, func() bool { return w.count() == 2 }, time.Second, time.Millisecond,
+		"the flush loop must run every interval")
+
+	assert.True(t, w.flusher.Queue(beat.Event{}))
+	assert.Eventually(t, func() bool { return w.count() == 3 }, time.Second, time.Millisecond,
+		"queued events must be emitted")
+
+	w.mutex.Lock()
+	w.open = 3
+	w.mutex.Unlock()
+	w.flusher.Close()
+	assert.Equal(t, 6, w.count(), "all windows must be flushed on close")
+	assert.Equal(t, uint64(6), w.flusher.emitted.Get())
+
+	w.flusher.Close()
+}
+
+func TestFlusherQueueFull(t *testing.T) {
+	w := newWindows(1)
+	w.flusher.SetEmitter(w.emit)
+
+	assert.True(t, w.flusher.Queue(beat.Event{}))
+	assert.False(t, w.flusher.Queue(beat.Event{}))
+	assert.Equal(t, uint64(1), w.flusher.dropped.Get())
+
+	w.flusher.Close()
+	assert.Equal(t, 1, w.count(), "the queued events must be emitted on close without a running loop")
+}
+
+func TestFlusherWithoutEmitter(t *testing.T) {
+	w := newWindows(10)
+	w.open = 2
+	w.flusher.Close()
+	assert.Equal(t, uint64(2), w.flusher.dropped.Get())
+}
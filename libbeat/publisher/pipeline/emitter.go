@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/publisher/processing"
+)
+
+// emitTimeout is how long an emitted event waits for the queue to accept it.
+const emitTimeout = 30 * time.Second
+
+// emitter publishes the events created by processors implementing the
+// processors.Emitter interface. The events are published by a client owned by
+// the pipeline, that is connected when the first event is emitted. The client
+// blocks while the queue is full, so emitted events are not lost under load.
+// The wait is bounded by the timeout, so processors emitting events on Close
+// can't block the shutdown of the Beat if the queue stays full.
+type emitter struct {
+	pipeline *Pipeline
+	timeout  time.Duration
+
+	mutex    sync.Mutex
+	client   beat.Client
+	requests chan emitRequest
+	done     chan struct{}
+	wg       sync.WaitGroup
+	closed   bool
+
+	// stalled is set once an event was dropped because the queue was full.
+	// Events emitted while the publish of an earlier event is still blocked
+	// are dropped without waiting.
+	stalled atomic.Bool
+}
+
+type emitRequest struct {
+	event     beat.Event
+	published chan struct{}
+}
+
+func newEmitter(pipeline *Pipeline) *emitter {
+	return &emitter{pipeline: pipeline, timeout: emitTimeout}
+}
+
+// attach passes the emit function to all processors implementing the
+// processors.Emitter interface.
+func (e *emitter) attach(p beat.Processor) {
+	if p != nil {
+		processors.SetEmitter(p, e.emit)
+	}
+}
+
+// attachGlobal passes the emit function to the global processors. They are
+// shared by all clients, so they get it only once.
+func (e *emitter) attachGlobal(s processing.Supporter) {
+	if em, ok := s.(processors.Emitter); ok {
+		em.SetEmitter(e.emit)
+	}
+}
+
+// emit publishes the event and returns once it was accepted by the queue, the
+// emitter was closed or the timeout passed. An event that is passed to the
+// publish loop before the timeout is published once the queue accepts it.
+func (e *emitter) emit(event beat.Event) {
+	requests, done := e.start()
+	if requests == nil {
+		return
+	}
+
+	log := e.pipeline.monitors.Logger
+	req := emitRequest{event: event, published: make(chan struct{})}
+	timer := time.NewTimer(e.timeout)
+	defer timer.Stop()
+
+	if e.stalled.Load() {
+		select {
+		case requests <- req:
+		default:
+			log.Debug("Dropping event emitted by a processor, the queue is full")
+			return
+		}
+	} else {
+		select {
+		case requests <- req:
+		case <-done:
+			log.Debug("Dropping event emitted by a processor after the pipeline was closed")
+			return
+		case <-timer.C:
+			e.stall()
+			return
+		}
+	}
+
+	select {
+	case <-req.published:
+	case <-done:
+	case <-timer.C:
+		e.stall()
+	}
+}
+
+// stall marks the publish loop as blocked by a full queue.
+func (e *emitter) stall() {
+	if e.stalled.CAS(false, true) {
+		e.pipeline.monitors.Logger.Errorf(
+			"The queue did not accept events emitted by processors for %v, dropping them until it does", e.timeout)
+	}
+}
+
+// start returns the channel the events are passed to the publish loop through,
+// connecting the client and starting the loop if required. It returns nil if
+// the emitter is closed or the client can not be connected.
+func (e *emitter) start() (chan<- emitRequest, <-chan struct{}) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	log := e.pipeline.monitors.Logger
+	if e.closed {
+		log.Debug("Dropping event emitted by a processor after the pipeline was closed")
+		return nil, nil
+	}
+	if e.client == nil {
+		client, err := e.pipeline.ConnectWith(beat.ClientConfig{})
+		if err != nil {
+			log.Errorf("Failed to connect client for events emitted by processors: %v", err)
+			return nil, nil
+		}
+		e.client = client
+		e.requests = make(chan emitRequest)
+		e.done = make(chan struct{})
+		e.wg.Add(1)
+		go e.run(client, e.requests, e.done)
+	}
+	return e.requests, e.done
+}
+
+// run publishes the emitted events one at a time. Publish blocks while the
+// queue is full, until the client is closed.
+func (e *emitter) run(client beat.Client, requests <-chan emitRequest, done <-chan struct{}) {
+	defer e.wg.Done()
+	for {
+		select {
+		case req := <-requests:
+			client.Publish(req.event)
+			e.stalled.Store(false)
+			close(req.published)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (e *emitter) close() {
+	e.mutex.Lock()
+	client := e.client
+	e.client = nil
+	e.closed = true
+	if e.done != nil {
+		close(e.done)
+	}
+	e.mutex.Unlock()
+
+	if client != nil {
+		// Closing the client cancels a blocked Publish.
+		client.Close()
+		e.wg.Wait()
+	}
+}
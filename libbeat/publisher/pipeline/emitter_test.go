@@ -0,0 +1,212 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/processors/aggregate"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/processing"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+type emitterSupporter struct {
+	emitterProcessor
+	local []*emitterProcessor
+}
+
+type emitterProcessor struct {
+	emit func(beat.Event)
+}
+
+func (s *emitterSupporter) Create(_ beat.ProcessingConfig, _ bool) (beat.Processor, error) {
+	p := &emitterProcessor{}
+	s.local = append(s.local, p)
+	return p, nil
+}
+
+func (s *emitterSupporter) Close() error { return nil }
+
+func (p *emitterProcessor) SetEmitter(emit func(beat.Event))           { p.emit = emit }
+func (p *emitterProcessor) Run(event *beat.Event) (*beat.Event, error) { return event, nil }
+func (p *emitterProcessor) String() string                             { return "emitter" }
+
+func TestEmitter(t *testing.T) {
+	var mutex sync.Mutex
+	var published []publisher.Event
+	var tries []bool
+	recordingProducer := func(_ queue.ProducerConfig) queue.Producer {
+		return &testProducer{
+			publish: func(try bool, event publisher.Event) bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				published = append(published, event)
+				tries = append(tries, try)
+				return true
+			},
+		}
+	}
+
+	supporter := &emitterSupporter{}
+	pipeline, err := New(beat.Info{},
+		Monitors{},
+		func(queue.ACKListener) (queue.Queue, error) {
+			return makeTestQueue(emptyConsumer, recordingProducer), nil
+		},
+		outputs.Group{},
+		Settings{Processors: supporter},
+	)
+	require.NoError(t, err)
+	require.NotNil(t, supporter.emit, "global processors must get the emit function")
+
+	client, err := pipeline.ConnectWith(beat.ClientConfig{})
+	require.NoError(t, err)
+
+	require.Len(t, supporter.local, 1)
+	local := supporter.local[0]
+	require.NotNil(t, local.emit, "client processors must get the emit function")
+
+	supporter.emit(beat.Event{Meta: map[string]interface{}{"source": "global"}})
+	local.emit(beat.Event{Meta: map[string]interface{}{"source": "local"}})
+
+	mutex.Lock()
+	require.Len(t, published, 2)
+	assert.Equal(t, "global", published[0].Content.Meta["source"])
+	assert.Equal(t, "local", published[1].Content.Meta["source"])
+	assert.Equal(t, []bool{false, false}, tries, "emitted events must wait for the queue")
+	mutex.Unlock()
+
+	// The emitter connects a single client, its processors are created too.
+	assert.Len(t, supporter.local, 2)
+
+	require.NoError(t, client.Close())
+	require.NoError(t, pipeline.Close())
+	local.emit(beat.Event{})
+
+	mutex.Lock()
+	assert.Len(t, published, 2, "events emitted after Close must be dropped")
+	mutex.Unlock()
+}
+
+func TestEmitterQueueFull(t *testing.T) {
+	var publishes atomic.Int
+	blockingProducer := func(_ queue.ProducerConfig) queue.Producer {
+		var once sync.Once
+		cancelled := make(chan struct{})
+		return &testProducer{
+			publish: func(_ bool, _ publisher.Event) bool {
+				publishes.Inc()
+				<-cancelled
+				return false
+			},
+			cancel: func() int {
+				once.Do(func() { close(cancelled) })
+				return 0
+			},
+		}
+	}
+
+	supporter := &emitterSupporter{}
+	pipeline, err := New(beat.Info{},
+		Monitors{},
+		func(queue.ACKListener) (queue.Queue, error) {
+			return makeTestQueue(emptyConsumer, blockingProducer), nil
+		},
+		outputs.Group{},
+		Settings{Processors: supporter},
+	)
+	require.NoError(t, err)
+	pipeline.emitter.timeout = 10 * time.Millisecond
+
+	start := time.Now()
+	supporter.emit(beat.Event{})
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond, "emit must wait for the queue")
+
+	// The first event is still blocked, so the next ones are dropped.
+	supporter.emit(beat.Event{})
+	supporter.emit(beat.Event{})
+	assert.Equal(t, 1, publishes.Load())
+
+	// Closing the pipeline cancels the blocked publish.
+	require.NoError(t, pipeline.Close())
+	supporter.emit(beat.Event{})
+	assert.Equal(t, 1, publishes.Load())
+}
+
+func TestEmitterGlobalAggregate(t *testing.T) {
+	var mutex sync.Mutex
+	var published []publisher.Event
+	recordingProducer := func(_ queue.ProducerConfig) queue.Producer {
+		return &testProducer{
+			publish: func(_ bool, event publisher.Event) bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				published = append(published, event)
+				return true
+			},
+		}
+	}
+
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"processors": []map[string]interface{}{
+			{"aggregate": map[string]interface{}{"window": "1h", "drop_events": true}},
+		},
+	})
+	supporter, err := processing.MakeDefaultSupport(true)(beat.Info{}, logp.NewLogger("test"), cfg)
+	require.NoError(t, err)
+
+	pipeline, err := New(beat.Info{},
+		Monitors{},
+		func(queue.ACKListener) (queue.Queue, error) {
+			return makeTestQueue(emptyConsumer, recordingProducer), nil
+		},
+		outputs.Group{},
+		Settings{Processors: supporter},
+	)
+	require.NoError(t, err)
+
+	client, err := pipeline.ConnectWith(beat.ClientConfig{})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		client.Publish(beat.Event{Timestamp: time.Now(), Fields: common.MapStr{"message": "hello"}})
+	}
+	require.NoError(t, client.Close())
+
+	// Closing the global processors flushes the summary, which passes through
+	// the global processors, including the aggregate processor itself.
+	require.NoError(t, supporter.Close())
+	require.NoError(t, pipeline.Close())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, published, 1, "the summary must not be aggregated again")
+	count, err := published[0].Content.GetValue("aggregate.count")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+}
@@ -78,6 +78,9 @@ type Pipeline struct {
 	sigNewClient             chan *client
 
 	processors processing.Supporter
+
+	// emitter publishes events created by processors.
+	emitter *emitter
 }
 
 // Settings is used to pass additional settings to a newly created pipeline instance.
@@ -159,6 +162,7 @@ func New(
 		waitCloseTimeout: settings.WaitClose,
 		processors:       settings.Processors,
 	}
+	p.emitter = newEmitter(p)
 
 	if monitors.Metrics != nil {
 		p.observer = newMetricsObserver(monitors.Metrics)
@@ -190,6 +194,8 @@ func New(
 	p.output = newOutputController(beat, monitors, p.observer, p.queue)
 	p.output.Set(out)
 
+	p.emitter.attachGlobal(settings.Processors)
+
 	return p, nil
 }
 
@@ -202,6 +208,8 @@ func (p *Pipeline) Close() error {
 
 	log.Debug("close pipeline")
 
+	p.emitter.close()
+
 	if p.waitCloser != nil {
 		ch := make(chan struct{})
 		go func() {
@@ -285,6 +293,7 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	p.emitter.attach(processors)
 
 	client := &client{
 		pipeline:     p,
@@ -364,6 +364,15 @@ func (b *builder) Create(cfg beat.ProcessingConfig, drop bool) (beat.Processor,
 	return processors, nil
 }
 
+// SetEmitter sets the emit function of the global processors. Events emitted
+// by a global processor are only processed by the global processors following
+// it.
+func (b *builder) SetEmitter(emit func(beat.Event)) {
+	if b.processors != nil {
+		b.processors.setMarkingEmitter(emit)
+	}
+}
+
 func (b *builder) Close() error {
 	if b.processors != nil {
 		return b.processors.Close()
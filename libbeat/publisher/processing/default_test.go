@@ -422,6 +422,40 @@ func TestProcessingClose(t *testing.T) {
 	assert.True(t, factoryProcessor.closed)
 }
 
+func TestProcessingEmitter(t *testing.T) {
+	factory, err := MakeDefaultSupport(true)(beat.Info{}, logp.L(), common.NewConfig())
+	require.NoError(t, err)
+
+	b := factory.(*builder)
+	b.processors = newGroup("global", logp.L())
+	first, emitting, last := &processorWithClose{}, &emittingProcessor{}, &processorWithClose{}
+	b.processors.add(first)
+	b.processors.add(emitting)
+	b.processors.add(last)
+
+	prog, err := factory.Create(beat.ProcessingConfig{}, false)
+	require.NoError(t, err)
+
+	var emitted []beat.Event
+	b.SetEmitter(func(event beat.Event) { emitted = append(emitted, event) })
+	emitting.emit(beat.Event{Fields: common.MapStr{"hello": "world"}})
+	require.Len(t, emitted, 1)
+
+	// Emitted events are only processed by the global processors following
+	// the emitting processor.
+	actual, err := prog.Run(&emitted[0])
+	require.NoError(t, err)
+	assert.Nil(t, actual.Private)
+	assert.False(t, first.called)
+	assert.False(t, emitting.called)
+	assert.True(t, last.called)
+
+	_, err = prog.Run(&beat.Event{Fields: common.MapStr{"hello": "world"}})
+	require.NoError(t, err)
+	assert.True(t, first.called)
+	assert.True(t, emitting.called)
+}
+
 func fromJSON(in string) common.MapStr {
 	var tmp common.MapStr
 	err := json.Unmarshal([]byte(in), &tmp)
@@ -449,3 +483,12 @@ func (p *processorWithClose) Close() error {
 func (p *processorWithClose) String() string {
 	return "processorWithClose"
 }
+
+type emittingProcessor struct {
+	processorWithClose
+	emit func(beat.Event)
+}
+
+func (p *emittingProcessor) SetEmitter(emit func(beat.Event)) {
+	p.emit = emit
+}
@@ -93,6 +93,39 @@ func (p *group) Close() error {
 	return errs.Err()
 }
 
+// emittedBy marks an event emitted by a processor of a group. The group only
+// runs the processors following the emitting processor on the event, so the
+// processor does not see its own events and processors closed before it are
+// not run.
+type emittedBy struct {
+	group *group
+	index int
+}
+
+func (p *group) SetEmitter(emit func(beat.Event)) {
+	if p == nil {
+		return
+	}
+	for _, processor := range p.list {
+		processors.SetEmitter(processor, emit)
+	}
+}
+
+// setMarkingEmitter sets the emit function of the processors in the group,
+// marking the emitted events with the emitting processor.
+func (p *group) setMarkingEmitter(emit func(beat.Event)) {
+	if p == nil {
+		return
+	}
+	for i, processor := range p.list {
+		mark := emittedBy{group: p, index: i}
+		processors.SetEmitter(processor, func(event beat.Event) {
+			event.Private = mark
+			emit(event)
+		})
+	}
+}
+
 func (p *group) String() string {
 	var s []string
 	for _, p := range p.list {
@@ -115,7 +148,13 @@ func (p *group) Run(event *beat.Event) (*beat.Event, error) {
 		return event, nil
 	}
 
-	for _, sub := range p.list {
+	list := p.list
+	if mark, ok := event.Private.(emittedBy); ok && mark.group == p {
+		event.Private = nil
+		list = list[mark.index+1:]
+	}
+
+	for _, sub := range list {
 		var err error
 
 		event, err = sub.Run(event)
@@ -0,0 +1,322 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package multiline
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+)
+
+// keyReader groups lines by a key extracted from every line using the first
+// capture group of key_pattern. Each key gets its own message buffer, so
+// multiline events written concurrently by multiple threads can be
+// interleaved in the input and still be combined into separate events.
+//
+// Finished events are returned in the order of their first line. Readers
+// tracking the file offset add up the Bytes of the returned messages, so the
+// Bytes of an event are set to the number of bytes from its first line to the
+// first line of the next event, instead of the size of its own lines. This way
+// the offset always points to the first line of an event not returned yet,
+// and reading can be resumed from there without losing any line.
+//
+// At most max_keys finished events are held back behind an unfinished event.
+// If more events of other keys are finished, for example because the key of
+// the oldest event went quiet and no timeout is configured, the oldest event
+// is finished early to keep the number of buffered events bounded.
+type keyReader struct {
+	reader       reader.Reader
+	keyPattern   *regexp.Regexp
+	pred         matcher
+	flushMatcher *match.Matcher
+	timeout      time.Duration
+	maxKeys      int
+	maxLines     int
+	newBuffer    func() *messageBuffer
+	logger       *logp.Logger
+
+	seq     uint64
+	offset  int64 // number of bytes read so far
+	buffers map[string]*keyBuffer
+	events  []*keyEvent      // events not returned yet, in the order of their first line
+	ready   []reader.Message // finished events not yet returned to the caller
+	err     error            // error to return once all finished events have been returned
+	closed  bool
+}
+
+type keyBuffer struct {
+	msgBuffer *messageBuffer
+	event     *keyEvent
+	last      uint64    // sequence number of the last line added to the buffer
+	updated   time.Time // time the last line was added to the buffer
+}
+
+type keyEvent struct {
+	key      string
+	start    int64 // offset of the first line of the event
+	message  reader.Message
+	finished bool
+}
+
+const (
+	// Default maximum number of keys buffered at the same time.
+	defaultMaxKeys = 100
+)
+
+func newMultilineKeyReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+) (reader.Reader, error) {
+	keyPattern, err := regexp.Compile(config.KeyPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multiline.key_pattern: %w", err)
+	}
+
+	matcher, err := setupPatternMatcher(config)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLines := defaultMaxLines
+	if config.MaxLines != nil {
+		maxLines = *config.MaxLines
+	}
+
+	maxKeys := defaultMaxKeys
+	if config.MaxKeys > 0 {
+		maxKeys = config.MaxKeys
+	}
+
+	tout := defaultMultilineTimeout
+	if config.Timeout != nil {
+		tout = *config.Timeout
+	}
+
+	if tout > 0 {
+		r = readfile.NewTimeoutReader(r, sigMultilineTimeout, tout)
+	}
+
+	kr := &keyReader{
+		reader:       r,
+		keyPattern:   keyPattern,
+		pred:         matcher,
+		flushMatcher: config.FlushPattern,
+		timeout:      tout,
+		maxKeys:      maxKeys,
+		maxLines:     maxLines,
+		newBuffer: func() *messageBuffer {
+			return newMessageBuffer(maxBytes, maxLines, []byte(separator), config.SkipNewLine)
+		},
+		buffers: map[string]*keyBuffer{},
+		logger:  logp.NewLogger("reader_multiline"),
+	}
+	return kr, nil
+}
+
+func (kr *keyReader) Next() (reader.Message, error) {
+	for {
+		if kr.closed {
+			return reader.Message{}, io.EOF
+		}
+
+		if len(kr.ready) > 0 {
+			msg := kr.ready[0]
+			kr.ready[0] = reader.Message{}
+			kr.ready = kr.ready[1:]
+			return msg, nil
+		}
+
+		if kr.err != nil {
+			err := kr.err
+			kr.err = nil
+			return reader.Message{}, err
+		}
+
+		message, err := kr.reader.Next()
+		if err != nil {
+			// No line has been read for the duration of the timeout, so
+			// every buffered event has been idle for at least that long.
+			if err == sigMultilineTimeout {
+				if len(kr.buffers) > 0 {
+					kr.logger.Debug("Multiline events flushed because timeout reached.")
+					kr.flushAll()
+				}
+				continue
+			}
+
+			// return all buffered events before passing the error
+			// to the caller (next layer) for handling
+			if message.Bytes > 0 {
+				kr.addLine(message, time.Now())
+			}
+			kr.flushAll()
+			kr.err = err
+			continue
+		}
+
+		if message.Bytes == 0 {
+			continue
+		}
+
+		now := time.Now()
+		kr.addLine(message, now)
+		if kr.timeout > 0 {
+			kr.flushExpired(now)
+		}
+	}
+}
+
+func (kr *keyReader) addLine(message reader.Message, now time.Time) {
+	key := kr.extractKey(message.Content)
+	flush := kr.flushMatcher != nil && kr.flushMatcher.Match(message.Content)
+
+	// if predicate does not match the event buffered for the key, finish the
+	// buffered event and start a new one with the current line
+	buf, exists := kr.buffers[key]
+	if exists && !flush && !kr.pred(buf.msgBuffer.last, message.Content) {
+		kr.flush(key)
+		exists = false
+	}
+
+	kr.seq++
+	if !exists {
+		if len(kr.buffers) >= kr.maxKeys {
+			kr.evictOldest()
+		}
+		buf = &keyBuffer{msgBuffer: kr.newBuffer(), event: &keyEvent{key: key, start: kr.offset}}
+		buf.msgBuffer.load(message)
+		kr.buffers[key] = buf
+		kr.events = append(kr.events, buf.event)
+	} else {
+		buf.msgBuffer.addLine(message)
+	}
+	buf.last = kr.seq
+	buf.updated = now
+	kr.offset += int64(message.Bytes)
+
+	if flush || (kr.maxLines > 0 && buf.msgBuffer.processedLines >= kr.maxLines) {
+		kr.flush(key)
+	}
+}
+
+// extractKey returns the first capture group of the key pattern. Lines not
+// matching the key pattern are grouped together under the empty key.
+func (kr *keyReader) extractKey(line []byte) string {
+	m := kr.keyPattern.FindSubmatch(line)
+	if len(m) < 2 {
+		return ""
+	}
+	return string(m[1])
+}
+
+func (kr *keyReader) flush(key string) {
+	buf, ok := kr.buffers[key]
+	if !ok {
+		return
+	}
+	delete(kr.buffers, key)
+	buf.event.message = buf.msgBuffer.finalize()
+	buf.event.finished = true
+	kr.release()
+}
+
+// release moves the finished events that are not preceded by an unfinished
+// event to the ready queue. The Bytes of every event are set to the distance
+// to the first line of the next event, or to the current offset if it is the
+// last one, so the sum of the Bytes of all returned events is the offset of
+// the first line that is not part of a returned event.
+func (kr *keyReader) release() {
+	for len(kr.events) > 0 && kr.events[0].finished {
+		event := kr.events[0]
+		kr.events[0] = nil
+		kr.events = kr.events[1:]
+
+		end := kr.offset
+		if len(kr.events) > 0 {
+			end = kr.events[0].start
+		}
+		event.message.Bytes = int(end - event.start)
+		kr.ready = append(kr.ready, event.message)
+	}
+
+	// Every buffered key has one unfinished event, the others are finished
+	// events held back by the unfinished event at the head of the queue.
+	if len(kr.events)-len(kr.buffers) > kr.maxKeys {
+		kr.logger.Debugf("Multiline event flushed because more than max_keys (%d) events are held back.", kr.maxKeys)
+		kr.flush(kr.events[0].key)
+	}
+}
+
+// evictOldest flushes the event of the key that has not been updated for the
+// longest time, to keep the number of buffered keys bounded.
+func (kr *keyReader) evictOldest() {
+	var (
+		oldestKey string
+		oldest    *keyBuffer
+	)
+	for key, buf := range kr.buffers {
+		if oldest == nil || buf.last < oldest.last {
+			oldestKey, oldest = key, buf
+		}
+	}
+	if oldest != nil {
+		kr.logger.Debugf("Multiline event flushed because max_keys (%d) reached.", kr.maxKeys)
+		kr.flush(oldestKey)
+	}
+}
+
+func (kr *keyReader) flushExpired(now time.Time) {
+	kr.flushWhere(func(buf *keyBuffer) bool {
+		return now.Sub(buf.updated) >= kr.timeout
+	})
+}
+
+func (kr *keyReader) flushAll() {
+	kr.flushWhere(func(*keyBuffer) bool { return true })
+}
+
+// flushWhere finishes all buffered events matching pred in the order their
+// first line has been read.
+func (kr *keyReader) flushWhere(pred func(*keyBuffer) bool) {
+	var keys []string
+	for key, buf := range kr.buffers {
+		if pred(buf) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return kr.buffers[keys[i]].event.start < kr.buffers[keys[j]].event.start
+	})
+	for _, key := range keys {
+		kr.flush(key)
+	}
+}
+
+func (kr *keyReader) Close() error {
+	kr.closed = true
+	return kr.reader.Close()
+}
@@ -35,6 +35,8 @@ func New(
 		return newMultilinePatternReader(r, separator, maxBytes, config)
 	} else if config.Type == countMode {
 		return newMultilineCountReader(r, separator, maxBytes, config)
+	} else if config.Type == keyMode {
+		return newMultilineKeyReader(r, separator, maxBytes, config)
 	}
 	return nil, fmt.Errorf("unknown multiline type %d", config.Type)
 }
@@ -20,6 +20,7 @@ package multiline
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common/match"
@@ -30,19 +31,23 @@ type multilineType uint8
 const (
 	patternMode multilineType = iota
 	countMode
+	keyMode
 
 	patternStr = "pattern"
 	countStr   = "count"
+	keyStr     = "key"
 )
 
 var (
 	multilineTypes = map[string]multilineType{
 		patternStr: patternMode,
 		countStr:   countMode,
+		keyStr:     keyMode,
 	}
 
 	ErrMissingPattern = errors.New("multiline.pattern cannot be empty when pattern based matching is selected")
 	ErrMissingCount   = errors.New("multiline.count cannot be empty when count based aggregation is selected")
+	ErrMissingKey     = errors.New("multiline.key_pattern cannot be empty when key based aggregation is selected")
 )
 
 // Config holds the options of multiline readers.
@@ -58,6 +63,9 @@ type Config struct {
 
 	LinesCount  int  `config:"count_lines" validate:"positive"`
 	SkipNewLine bool `config:"skip_newline"`
+
+	KeyPattern string `config:"key_pattern"`
+	MaxKeys    int    `config:"max_keys" validate:"positive"`
 }
 
 // Validate validates the Config option for multiline reader.
@@ -73,6 +81,23 @@ func (c *Config) Validate() error {
 		if c.LinesCount == 0 {
 			return ErrMissingCount
 		}
+	} else if c.Type == keyMode {
+		if c.Match != "after" && c.Match != "before" {
+			return fmt.Errorf("unknown matcher type: %s", c.Match)
+		}
+		if c.Pattern == nil {
+			return ErrMissingPattern
+		}
+		if c.KeyPattern == "" {
+			return ErrMissingKey
+		}
+		re, err := regexp.Compile(c.KeyPattern)
+		if err != nil {
+			return fmt.Errorf("invalid multiline.key_pattern: %w", err)
+		}
+		if re.NumSubexp() < 1 {
+			return fmt.Errorf("multiline.key_pattern must contain a capture group: %s", c.KeyPattern)
+		}
 	} else {
 		return fmt.Errorf("unknown multiline type %d", c.Type)
 	}
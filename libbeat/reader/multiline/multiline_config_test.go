@@ -49,6 +49,23 @@ func TestInvalidConfiguration(t *testing.T) {
 			},
 			expectedError: ErrMissingCount,
 		},
+		"missing multiline key pattern": {
+			config: map[string]interface{}{
+				"type":    "key",
+				"match":   "after",
+				"pattern": "^\\s",
+			},
+			expectedError: ErrMissingKey,
+		},
+		"multiline key pattern without capture group": {
+			config: map[string]interface{}{
+				"type":        "key",
+				"match":       "after",
+				"pattern":     "^\\s",
+				"key_pattern": "^\\S+",
+			},
+			expectedError: fmt.Errorf("multiline.key_pattern must contain a capture group"),
+		},
 		"missing multiline pattern when while_pattern type is selected": {
 			config: map[string]interface{}{
 				"type": "count",
@@ -86,6 +103,15 @@ func TestValidConfiguration(t *testing.T) {
 				"count_lines": 5,
 			},
 		},
+		"correct key based multiline": {
+			config: map[string]interface{}{
+				"type":        "key",
+				"match":       "after",
+				"pattern":     "^\\S+\\s+at ",
+				"key_pattern": "^\\[(\\w+)\\]",
+				"max_keys":    10,
+			},
+		},
 	}
 
 	for name, test := range testcases {
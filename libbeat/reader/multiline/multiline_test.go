@@ -243,6 +243,206 @@ func TestMultilineCount(t *testing.T) {
 	)
 }
 
+func TestMultilineKey(t *testing.T) {
+	pattern := match.MustCompile(`^\[[^\]]+\] \s+`) // continuation lines are indented after the thread column
+	_, buf := createLineBuffer(
+		"[main] Exception in thread main\n",
+		"[worker-1] Exception in thread worker-1\n",
+		"[main]   at foo.Main(Main.java:1)\n",
+		"[worker-1]   at foo.Worker(Worker.java:1)\n",
+		"[main] done\n",
+		"[worker-1]   at foo.Worker(Worker.java:2)\n",
+	)
+	r := createMultilineTestReader(t, buf, Config{
+		Type:       keyMode,
+		Pattern:    &pattern,
+		Match:      "after",
+		KeyPattern: `^\[([^\]]+)\]`,
+	})
+
+	assert.Equal(t, []string{
+		"[main] Exception in thread main\n[main]   at foo.Main(Main.java:1)",
+		"[worker-1] Exception in thread worker-1\n[worker-1]   at foo.Worker(Worker.java:1)\n[worker-1]   at foo.Worker(Worker.java:2)",
+		"[main] done",
+	}, readAllContents(r))
+}
+
+func TestMultilineKeyMaxLines(t *testing.T) {
+	pattern := match.MustCompile(`^\[[^\]]+\] \s+`)
+	maxLines := 2
+	_, buf := createLineBuffer(
+		"[a] first\n",
+		"[b] first\n",
+		"[a]   a.1\n",
+		"[a]   a.2\n",
+		"[b]   b.1\n",
+	)
+	r := createMultilineTestReader(t, buf, Config{
+		Type:       keyMode,
+		Pattern:    &pattern,
+		Match:      "after",
+		MaxLines:   &maxLines,
+		KeyPattern: `^\[([^\]]+)\]`,
+	})
+
+	assert.Equal(t, []string{
+		"[a] first\n[a]   a.1",
+		"[b] first\n[b]   b.1",
+		"[a]   a.2",
+	}, readAllContents(r))
+}
+
+func TestMultilineKeyMaxKeys(t *testing.T) {
+	pattern := match.MustCompile(`^\[[^\]]+\] \s+`)
+	_, buf := createLineBuffer(
+		"[a] first\n",
+		"[b] first\n",
+		"[c] first\n",
+		"[b]   b.1\n",
+		"[c]   c.1\n",
+	)
+	r := createMultilineTestReader(t, buf, Config{
+		Type:       keyMode,
+		Pattern:    &pattern,
+		Match:      "after",
+		MaxKeys:    2,
+		KeyPattern: `^\[([^\]]+)\]`,
+	})
+
+	assert.Equal(t, []string{
+		"[a] first",
+		"[b] first\n[b]   b.1",
+		"[c] first\n[c]   c.1",
+	}, readAllContents(r))
+}
+
+func TestMultilineKeyMaxHeldBack(t *testing.T) {
+	pattern := match.MustCompile(`^\[[^\]]+\] \s+`)
+	timeout := time.Duration(0)
+	_, buf := createLineBuffer(
+		"[a] first\n",
+		"[b] 1\n",
+		"[b] 2\n",
+		"[b] 3\n",
+		"[b] 4\n",
+		"[a]   a.1\n",
+	)
+	r := createMultilineTestReader(t, buf, Config{
+		Type:       keyMode,
+		Pattern:    &pattern,
+		Match:      "after",
+		MaxKeys:    2,
+		Timeout:    &timeout,
+		KeyPattern: `^\[([^\]]+)\]`,
+	})
+
+	// The event of a is finished once more than max_keys finished events of
+	// b are held back by it.
+	assert.Equal(t, []string{
+		"[a] first",
+		"[b] 1",
+		"[b] 2",
+		"[b] 3",
+		"[b] 4",
+		"[a]   a.1",
+	}, readAllContents(r))
+}
+
+func TestMultilineKeyFlushPattern(t *testing.T) {
+	pattern := match.MustCompile(`EventStart`)
+	flushMatcher := match.MustCompile(`EventEnd`)
+	_, buf := createLineBuffer(
+		"1 EventStart\n",
+		"2 EventStart\n",
+		"1 EventEnd\n",
+		"2 EventId: 2\n",
+		"2 EventEnd\n",
+	)
+	r := createMultilineTestReader(t, buf, Config{
+		Type:         keyMode,
+		Pattern:      &pattern,
+		Negate:       true,
+		Match:        "after",
+		FlushPattern: &flushMatcher,
+		KeyPattern:   `^(\d+) `,
+	})
+
+	assert.Equal(t, []string{
+		"1 EventStart\n1 EventEnd",
+		"2 EventStart\n2 EventId: 2\n2 EventEnd",
+	}, readAllContents(r))
+}
+
+func TestMultilineKeyOffsets(t *testing.T) {
+	pattern := match.MustCompile(`^\[[^\]]+\] \s+`)
+	lines := []string{
+		"[a] first\n",
+		"[b] first\n",
+		"[b]   b.1\n",
+		"[b] second\n",
+		"[a]   a.1\n",
+		"[a] second\n",
+	}
+	_, buf := createLineBuffer(lines...)
+	r := createMultilineTestReader(t, buf, Config{
+		Type:       keyMode,
+		Pattern:    &pattern,
+		Match:      "after",
+		KeyPattern: `^\[([^\]]+)\]`,
+	})
+
+	// offsetOf returns the offset of the first n lines.
+	offsetOf := func(n int) int {
+		offset := 0
+		for _, line := range lines[:n] {
+			offset += len(line)
+		}
+		return offset
+	}
+
+	var (
+		contents []string
+		offsets  []int
+		offset   int
+	)
+	for {
+		message, err := r.Next()
+		if err != nil {
+			break
+		}
+		offset += message.Bytes
+		contents = append(contents, string(message.Content))
+		offsets = append(offsets, offset)
+	}
+
+	// The first event of b is finished before the first event of a, but it
+	// is returned after it and the offsets always point to the first line of
+	// an event that has not been returned yet.
+	assert.Equal(t, []string{
+		"[a] first\n[a]   a.1",
+		"[b] first\n[b]   b.1",
+		"[b] second",
+		"[a] second",
+	}, contents)
+	assert.Equal(t, []int{
+		offsetOf(1),
+		offsetOf(3),
+		offsetOf(5),
+		offsetOf(6),
+	}, offsets)
+}
+
+func readAllContents(r reader.Reader) []string {
+	var contents []string
+	for {
+		message, err := r.Next()
+		if err != nil {
+			return contents
+		}
+		contents = append(contents, string(message.Content))
+	}
+}
+
 func testMultilineOK(t *testing.T, cfg Config, events int, expected ...string) {
 	_, buf := createLineBuffer(expected...)
 	r := createMultilineTestReader(t, buf, cfg)
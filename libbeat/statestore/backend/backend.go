@@ -69,3 +69,14 @@ type Store interface {
 	// The loop shall return if fn returns an error or false.
 	Each(fn func(string, ValueDecoder) (bool, error)) error
 }
+
+// Batcher is an optional interface of Store. Stores implementing Batcher can
+// write multiple updates in a single transaction, which is much cheaper than
+// one transaction per update for stores syncing every transaction to disk.
+type Batcher interface {
+	// Batch calls fn with a Store that collects all Set and Remove operations
+	// and writes them in a single transaction after fn returns. Reads are not
+	// affected by the operations of the batch until they have been written.
+	// No operation is written if fn returns an error.
+	Batch(fn func(Store) error) error
+}
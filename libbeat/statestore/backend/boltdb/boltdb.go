@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltdb
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+)
+
+// Registry configures access to bbolt based stores.
+type Registry struct {
+	log *logp.Logger
+
+	mu     sync.Mutex
+	active bool
+
+	settings Settings
+}
+
+// Settings configures a new Registry.
+type Settings struct {
+	// Registry root directory. Each store is a single database file in the
+	// root directory.
+	Root string
+
+	// FileMode is used to configure the file mode for new files generated by the
+	// registry.  File mode 0600 will be used if this field is not set.
+	FileMode os.FileMode
+
+	// Timeout configures how long to wait for the file lock of a database.
+	// Defaults to 5s if not set.
+	Timeout time.Duration
+
+	// MigrateFrom is an optional registry whose stores are copied into newly
+	// initialized stores of the same name.
+	MigrateFrom backend.Registry
+}
+
+const defaultFileMode os.FileMode = 0600
+
+const defaultTimeout = 5 * time.Second
+
+// New configures a bbolt Registry that can be used to open stores.
+func New(log *logp.Logger, settings Settings) (*Registry, error) {
+	if settings.FileMode == 0 {
+		settings.FileMode = defaultFileMode
+	}
+	if settings.Timeout == 0 {
+		settings.Timeout = defaultTimeout
+	}
+
+	root, err := filepath.Abs(settings.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Root = root
+	return &Registry{
+		log:      log,
+		active:   true,
+		settings: settings,
+	}, nil
+}
+
+// Access creates or opens the database file of a store. The root directory
+// is created if it does not exist.
+// Returns an error if any file access fails.
+func (r *Registry) Access(name string) (backend.Store, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return nil, errRegClosed
+	}
+
+	if err := os.MkdirAll(r.settings.Root, os.ModeDir|0770); err != nil {
+		return nil, err
+	}
+
+	logger := r.log.With("store", name)
+	path := filepath.Join(r.settings.Root, name+".db")
+	return openStore(logger, path, r.settings.FileMode, r.settings.Timeout, func() (backend.Store, error) {
+		if r.settings.MigrateFrom == nil {
+			return nil, nil
+		}
+		return r.settings.MigrateFrom.Access(name)
+	})
+}
+
+// Close closes the registry. No new store can be accessed after close.
+// The registry used for migrations is closed as well.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active = false
+	if r.settings.MigrateFrom != nil {
+		return r.settings.MigrateFrom.Close()
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/beats/v7/libbeat/statestore/internal/storecompliance"
+)
+
+func init() {
+	logp.DevelopmentSetup()
+}
+
+func TestCompliance(t *testing.T) {
+	storecompliance.TestBackendCompliance(t, func(testPath string) (backend.Registry, error) {
+		return New(logp.NewLogger("test"), Settings{Root: testPath})
+	})
+}
+
+func TestMigrateFromMemlog(t *testing.T) {
+	type state struct {
+		Offset int64
+		Source string
+	}
+
+	root := t.TempDir()
+	newMemlog := func() backend.Registry {
+		reg, err := memlog.New(logp.NewLogger("test"), memlog.Settings{Root: root})
+		require.NoError(t, err)
+		return reg
+	}
+
+	// populate memlog store
+	mem := newMemlog()
+	memStore, err := mem.Access("test")
+	require.NoError(t, err)
+	require.NoError(t, memStore.Set("a", state{Offset: 10, Source: "/a.log"}))
+	require.NoError(t, memStore.Set("b", state{Offset: 20, Source: "/b.log"}))
+	require.NoError(t, memStore.Close())
+	require.NoError(t, mem.Close())
+
+	openStore := func(migrateFrom backend.Registry) (*Registry, backend.Store) {
+		reg, err := New(logp.NewLogger("test"), Settings{Root: root, MigrateFrom: migrateFrom})
+		require.NoError(t, err)
+		store, err := reg.Access("test")
+		require.NoError(t, err)
+		return reg, store
+	}
+
+	reg, store := openStore(newMemlog())
+	var a state
+	require.NoError(t, store.Get("a", &a))
+	assert.Equal(t, state{Offset: 10, Source: "/a.log"}, a)
+
+	// updates after the migration must not be overwritten when the store is
+	// opened again
+	require.NoError(t, store.Set("a", state{Offset: 11, Source: "/a.log"}))
+	require.NoError(t, store.Remove("b"))
+	require.NoError(t, store.Close())
+	require.NoError(t, reg.Close())
+
+	reg, store = openStore(newMemlog())
+	defer reg.Close()
+	defer store.Close()
+
+	require.NoError(t, store.Get("a", &a))
+	assert.Equal(t, int64(11), a.Offset)
+	has, err := store.Has("b")
+	require.NoError(t, err)
+	assert.False(t, has)
+}
+
+func TestBatch(t *testing.T) {
+	type state struct {
+		Offset int64
+	}
+
+	reg, err := New(logp.NewLogger("test"), Settings{Root: t.TempDir()})
+	require.NoError(t, err)
+	defer reg.Close()
+	store, err := reg.Access("test")
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set("a", state{Offset: 1}))
+
+	batcher, ok := store.(backend.Batcher)
+	require.True(t, ok, "store must support batches")
+
+	err = batcher.Batch(func(b backend.Store) error {
+		require.NoError(t, b.Set("b", state{Offset: 2}))
+		require.NoError(t, b.Remove("a"))
+
+		// the batch is only written after fn returns
+		has, err := b.Has("b")
+		require.NoError(t, err)
+		assert.False(t, has)
+		return nil
+	})
+	require.NoError(t, err)
+
+	has, err := store.Has("a")
+	require.NoError(t, err)
+	assert.False(t, has)
+	var b state
+	require.NoError(t, store.Get("b", &b))
+	assert.Equal(t, int64(2), b.Offset)
+
+	t.Run("nothing is written if fn fails", func(t *testing.T) {
+		err := batcher.Batch(func(b backend.Store) error {
+			require.NoError(t, b.Set("c", state{Offset: 3}))
+			return errors.New("oops")
+		})
+		require.Error(t, err)
+
+		has, err := store.Has("c")
+		require.NoError(t, err)
+		assert.False(t, has)
+	})
+}
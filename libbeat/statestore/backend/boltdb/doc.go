@@ -0,0 +1,41 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package boltdb implements a statestore backend on top of the embedded
+// bbolt key-value database.
+//
+// Unlike memlog, the store does not keep the key-value pairs in memory.
+// Every store is written to its own database file `<root>/<name>.db`, that
+// is memory mapped by bbolt. Updates are applied in place within a write
+// transaction. No checkpoint operation rewriting all state is required, such
+// that the cost of an update does not depend on the number of entries in the
+// store.
+//
+// The database contains the `data` bucket holding the key-value pairs and the
+// `meta` bucket holding the version of the database layout.
+// Values are stored as JSON documents. Similar to memlog, values are converted
+// into map[string]interface{} before being written, and decoded from the JSON
+// document when read.
+//
+// Every call to Set and Remove is executed in its own write transaction,
+// which is synced to disk before the call returns.
+//
+// A store can be initialized once with the contents of a store of another
+// backend, like memlog, by configuring Settings.MigrateFrom. The copy is
+// executed in the same transaction that initializes the database, such that
+// an interrupted migration is restarted the next time the store is opened.
+package boltdb
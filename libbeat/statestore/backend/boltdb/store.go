@@ -0,0 +1,276 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltdb
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/goccy/go-json"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+)
+
+// store implements a bbolt based store. All key-value pairs are stored in
+// the data bucket of the database.
+type store struct {
+	db *bolt.DB
+}
+
+// rawValue is the JSON encoded value of a key-value pair. A rawValue read
+// from the database is only valid within the transaction it was read in.
+type rawValue []byte
+
+var (
+	dataBucket = []byte("data")
+	metaBucket = []byte("meta")
+	versionKey = []byte("version")
+)
+
+const storeVersion = "1"
+
+// openStore opens or creates the database file at path. If the database has
+// not been initialized yet, the buckets are created and all key-value pairs
+// of the store returned by migrateFrom are copied into the new database.
+func openStore(
+	log *logp.Logger,
+	path string,
+	mode os.FileMode,
+	timeout time.Duration,
+	migrateFrom func() (backend.Store, error),
+) (*store, error) {
+	db, err := bolt.Open(path, mode, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database '%v': %w", path, err)
+	}
+
+	s := &store{db: db}
+	if err := s.init(log, migrateFrom); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database '%v': %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *store) init(log *logp.Logger, migrateFrom func() (backend.Store, error)) error {
+	initialized := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil {
+			return nil
+		}
+
+		if version := meta.Get(versionKey); string(version) != storeVersion {
+			return fmt.Errorf("%w: unsupported version '%s'", errInvalidLayout, version)
+		}
+		if tx.Bucket(dataBucket) == nil {
+			return fmt.Errorf("%w: missing data bucket", errInvalidLayout)
+		}
+		initialized = true
+		return nil
+	})
+	if err != nil || initialized {
+		return err
+	}
+
+	src, err := migrateFrom()
+	if err != nil {
+		return fmt.Errorf("failed to open store to migrate from: %w", err)
+	}
+	if src != nil {
+		defer src.Close()
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := tx.CreateBucketIfNotExists(dataBucket)
+		if err != nil {
+			return err
+		}
+
+		if src != nil {
+			count := 0
+			err := src.Each(func(key string, dec backend.ValueDecoder) (bool, error) {
+				var value common.MapStr
+				if err := dec.Decode(&value); err != nil {
+					return false, fmt.Errorf("failed to decode '%v': %w", key, err)
+				}
+
+				raw, err := encodeValue(value)
+				if err != nil {
+					return false, err
+				}
+
+				count++
+				return true, data.Put([]byte(key), raw)
+			})
+			if err != nil {
+				return fmt.Errorf("migration failed: %w", err)
+			}
+			log.Infof("Migrated %d entries into the database.", count)
+		}
+
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		return meta.Put(versionKey, []byte(storeVersion))
+	})
+}
+
+// Close closes the database file.
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// Has checks if the key is known.
+func (s *store) Has(key string) (bool, error) {
+	var has bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		has = tx.Bucket(dataBucket).Get([]byte(key)) != nil
+		return nil
+	})
+	return has, err
+}
+
+// Get retrieves and decodes the key-value pair into to.
+func (s *store) Get(key string, to interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(dataBucket).Get([]byte(key))
+		if raw == nil {
+			return errKeyUnknown
+		}
+		return rawValue(raw).Decode(to)
+	})
+}
+
+// Set inserts or overwrites a key-value pair.
+func (s *store) Set(key string, value interface{}) error {
+	raw, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(dataBucket).Put([]byte(key), raw)
+	})
+}
+
+// Remove removes a key from the store. The operation does not check if the
+// key exists.
+func (s *store) Remove(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(dataBucket).Delete([]byte(key))
+	})
+}
+
+// Batch calls fn with a batch collecting all Set and Remove operations, and
+// writes them in a single transaction. Every write transaction syncs the
+// database file, so batching reduces the disk I/O when many keys are updated
+// at once. Reads by fn return the state before the batch.
+func (s *store) Batch(fn func(backend.Store) error) error {
+	b := &batch{store: s}
+	if err := fn(b); err != nil {
+		return err
+	}
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(dataBucket)
+		for _, op := range b.ops {
+			var err error
+			if op.raw == nil {
+				err = data.Delete([]byte(op.key))
+			} else {
+				err = data.Put([]byte(op.key), op.raw)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// batch collects the updates of a Batch call. Values are encoded when they
+// are added, so later changes to the values don't change the batch.
+type batch struct {
+	*store
+	ops []batchOp
+}
+
+type batchOp struct {
+	key string
+	raw []byte // nil removes the key
+}
+
+func (b *batch) Set(key string, value interface{}) error {
+	raw, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key: key, raw: raw})
+	return nil
+}
+
+func (b *batch) Remove(key string) error {
+	b.ops = append(b.ops, batchOp{key: key})
+	return nil
+}
+
+// Close does nothing, the batch does not own the store.
+func (b *batch) Close() error {
+	return nil
+}
+
+// Each iterates over all key-value pairs in the store in key order.
+// The store must not be modified by fn.
+func (s *store) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(dataBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			cont, err := fn(string(k), rawValue(v))
+			if !cont || err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func encodeValue(value interface{}) ([]byte, error) {
+	var tmp common.MapStr
+	if err := typeconv.Convert(&tmp, value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tmp)
+}
+
+func (v rawValue) Decode(to interface{}) error {
+	var tmp map[string]interface{}
+	if err := json.Unmarshal(v, &tmp); err != nil {
+		return err
+	}
+	return typeconv.Convert(to, tmp)
+}
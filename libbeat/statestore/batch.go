@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statestore
+
+import "github.com/elastic/beats/v7/libbeat/statestore/backend"
+
+// Batch collects updates to a Store. See Store.Batch.
+type Batch struct {
+	name    string
+	backend backend.Store
+
+	// deferred is set if the operations are written when the batch is
+	// committed. Functions to call after the commit are collected in onCommit.
+	deferred bool
+	onCommit []func()
+}
+
+// Set inserts or overwrites a key value pair.
+// Set returns an error if the value can not be encoded by the store, or the
+// storage backend failed.
+func (b *Batch) Set(key string, from interface{}) error {
+	if err := b.backend.Set(key, from); err != nil {
+		return &ErrorOperation{name: b.name, operation: "batch/set", cause: err}
+	}
+	return nil
+}
+
+// Remove removes a key value pair from the store. Remove does not error if
+// the key is unknown to the store.
+func (b *Batch) Remove(key string) error {
+	if err := b.backend.Remove(key); err != nil {
+		return &ErrorOperation{name: b.name, operation: "batch/remove", cause: err}
+	}
+	return nil
+}
+
+// OnCommit registers fn to be called once the operations of the batch have
+// been written. fn is not called if the batch fails. If the storage backend
+// does not support batches, the operations have been written already and fn is
+// called immediately.
+func (b *Batch) OnCommit(fn func()) {
+	if !b.deferred {
+		fn()
+		return
+	}
+	b.onCommit = append(b.onCommit, fn)
+}
@@ -150,6 +150,45 @@ func (s *Store) Each(fn func(string, ValueDecoder) (bool, error)) error {
 	return s.shared.backend.Each(fn)
 }
 
+// Batch calls fn with a Batch collecting Set and Remove operations. If the
+// storage backend supports it, all operations are written in a single
+// transaction after fn returns. Otherwise the operations are executed
+// immediately. The Batch must not be used after fn has returned.
+// Batch returns an error if the store has been closed, fn returned an error,
+// or the storage backend failed to write the batch. The functions registered
+// with OnCommit are called after the batch has been written successfully.
+func (s *Store) Batch(fn func(*Batch) error) error {
+	const operation = "store/batch"
+	if err := s.active.Add(1); err != nil {
+		return &ErrorClosed{operation: operation, name: s.shared.name}
+	}
+	defer s.active.Done()
+
+	batcher, ok := s.shared.backend.(backend.Batcher)
+	if !ok {
+		return fn(&Batch{name: s.shared.name, backend: s.shared.backend})
+	}
+
+	var fnErr error
+	batch := &Batch{name: s.shared.name, deferred: true}
+	err := batcher.Batch(func(store backend.Store) error {
+		batch.backend = store
+		fnErr = fn(batch)
+		return fnErr
+	})
+	if err != nil {
+		if err != fnErr {
+			return &ErrorOperation{name: s.shared.name, operation: operation, cause: err}
+		}
+		return err
+	}
+
+	for _, fn := range batch.onCommit {
+		fn()
+	}
+	return nil
+}
+
 func (s *sharedStore) Retain() {
 	s.refCount.Inc()
 }
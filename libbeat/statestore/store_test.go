@@ -24,6 +24,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
 	"github.com/elastic/beats/v7/libbeat/statestore/storetest"
 )
 
@@ -181,6 +182,118 @@ func TestStore_Each(t *testing.T) {
 	})
 }
 
+func TestStore_Batch(t *testing.T) {
+	t.Run("fails if store has been closed", func(t *testing.T) {
+		store := makeClosedTestStore(t)
+		assertClosed(t, store.Batch(func(*Batch) error { return nil }))
+	})
+	t.Run("error of fn is passed through", func(t *testing.T) {
+		store := makeTestStore(t, map[string]interface{}{})
+		defer store.Close()
+
+		errFn := errors.New("oops")
+		assert.Equal(t, errFn, store.Batch(func(*Batch) error { return errFn }))
+	})
+	t.Run("updates are executed without batch support", func(t *testing.T) {
+		data := map[string]interface{}{"old": "test"}
+		store := makeTestStore(t, data)
+		defer store.Close()
+
+		err := store.Batch(func(b *Batch) error {
+			if err := b.Set("new", map[string]interface{}{"field": "value"}); err != nil {
+				return err
+			}
+			return b.Remove("old")
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"new": map[string]interface{}{"field": "value"},
+		}, data)
+	})
+	t.Run("commit functions are called immediately without batch support", func(t *testing.T) {
+		store := makeTestStore(t, map[string]interface{}{})
+		defer store.Close()
+
+		var committed bool
+		err := store.Batch(func(b *Batch) error {
+			b.OnCommit(func() { committed = true })
+			assert.True(t, committed)
+			return nil
+		})
+		require.NoError(t, err)
+	})
+	t.Run("commit functions are called after a successful commit", func(t *testing.T) {
+		batcher := &batchMapStore{MapStore: storetest.MapStore{Table: map[string]interface{}{}}}
+		store := makeTestBatchStore(t, batcher)
+		defer store.Close()
+
+		var committed bool
+		err := store.Batch(func(b *Batch) error {
+			b.OnCommit(func() { committed = true })
+			assert.False(t, committed, "must not be called before the commit")
+			return b.Set("key", map[string]interface{}{"field": "value"})
+		})
+		require.NoError(t, err)
+		assert.True(t, committed)
+	})
+	t.Run("commit functions are not called if the commit fails", func(t *testing.T) {
+		batcher := &batchMapStore{
+			MapStore:  storetest.MapStore{Table: map[string]interface{}{}},
+			commitErr: errors.New("disk full"),
+		}
+		store := makeTestBatchStore(t, batcher)
+		defer store.Close()
+
+		var committed bool
+		err := store.Batch(func(b *Batch) error {
+			b.OnCommit(func() { committed = true })
+			return b.Set("key", map[string]interface{}{"field": "value"})
+		})
+		assert.Error(t, err)
+		assert.False(t, committed)
+	})
+	t.Run("commit functions are not called if fn fails", func(t *testing.T) {
+		store := makeTestBatchStore(t, &batchMapStore{MapStore: storetest.MapStore{Table: map[string]interface{}{}}})
+		defer store.Close()
+
+		var committed bool
+		err := store.Batch(func(b *Batch) error {
+			b.OnCommit(func() { committed = true })
+			return errors.New("oops")
+		})
+		assert.Error(t, err)
+		assert.False(t, committed)
+	})
+}
+
+// batchMapStore is a MapStore supporting batches. The batch fails with
+// commitErr after the operations have been applied.
+type batchMapStore struct {
+	storetest.MapStore
+	commitErr error
+}
+
+func (s *batchMapStore) Batch(fn func(backend.Store) error) error {
+	if err := fn(&s.MapStore); err != nil {
+		return err
+	}
+	return s.commitErr
+}
+
+func makeTestBatchStore(t *testing.T, store *batchMapStore) *Store {
+	reg := NewRegistry(&batchRegistry{store: store})
+	s, err := reg.Get("test")
+	require.NoError(t, err)
+	return s
+}
+
+type batchRegistry struct {
+	store *batchMapStore
+}
+
+func (r *batchRegistry) Access(string) (backend.Store, error) { return r.store, nil }
+func (r *batchRegistry) Close() error                         { return nil }
+
 func makeTestStore(t *testing.T, data map[string]interface{}) *Store {
 	memstore := &storetest.MapStore{Table: data}
 	reg := NewRegistry(&storetest.MemoryStore{
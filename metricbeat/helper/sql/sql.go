@@ -113,7 +113,49 @@ func (d *DbClient) fetchTableMode(rows sqlRow) ([]common.MapStr, error) {
 	return rr, nil
 }
 
-// fetchTableMode scan the rows and publishes the event for querys that return the response in a table format.
+// FetchRows runs the query with the given arguments and returns one map per
+// row with the lowercase column names as keys. Values returned as text by the
+// driver are converted according to the database type of their column, so
+// numbers, booleans and timestamps keep their type.
+func (d *DbClient) FetchRows(ctx context.Context, q string, args ...interface{}) ([]common.MapStr, error) {
+	rows, err := d.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting column types")
+	}
+
+	cols := make([]string, len(columnTypes))
+	vals := make([]interface{}, len(columnTypes))
+	for i, ct := range columnTypes {
+		cols[i] = strings.ToLower(ct.Name())
+		vals[i] = new(interface{})
+	}
+
+	rr := make([]common.MapStr, 0)
+	for rows.Next() {
+		if err := rows.Scan(vals...); err != nil {
+			return nil, errors.Wrap(err, "error trying to scan rows")
+		}
+
+		r := common.MapStr{}
+		for i, c := range cols {
+			r.Put(c, convertByType(columnTypes[i].DatabaseTypeName(), *vals[i].(*interface{})))
+		}
+		rr = append(rr, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error trying to read rows")
+	}
+
+	return rr, nil
+}
+
 func (d *DbClient) FetchVariableMode(ctx context.Context, q string) (common.MapStr, error) {
 	rows, err := d.QueryContext(ctx, q)
 	if err != nil {
@@ -205,3 +247,52 @@ func switchDriverName(d string) string {
 
 	return d
 }
+
+// timeLayouts are the layouts used to parse date and time values returned as
+// text by the driver. Values without time zone are in UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// convertByType converts values returned as text by the driver to the Go type
+// matching the database type of the column. Other values and values that fail
+// to parse are returned as is, with text converted to string.
+func convertByType(databaseType string, value interface{}) interface{} {
+	var text string
+	switch v := value.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return value
+	}
+
+	switch dbType := strings.TrimPrefix(strings.ToUpper(databaseType), "UNSIGNED "); dbType {
+	case "INT", "INTEGER", "INT2", "INT4", "INT8", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT", "SERIAL", "BIGSERIAL", "YEAR":
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return n
+		}
+	case "DECIMAL", "NUMERIC", "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "REAL", "MONEY":
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	case "BOOL", "BOOLEAN":
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	case "DATE", "DATETIME", "DATETIME2", "SMALLDATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, text); err == nil {
+				return t
+			}
+		}
+	}
+	return text
+}
@@ -245,3 +245,35 @@ func (c *dummyConnection) Ping(context.Context) error {
 	}
 	return nil
 }
+
+func TestConvertByType(t *testing.T) {
+	cases := []struct {
+		databaseType string
+		value        interface{}
+		expected     interface{}
+	}{
+		{"BIGINT", []byte("-42"), int64(-42)},
+		{"UNSIGNED BIGINT", []byte("18446744073709551615"), uint64(math.MaxUint64)},
+		{"INT4", int64(7), int64(7)},
+		{"DECIMAL", []byte("3.25"), 3.25},
+		{"BOOLEAN", "true", true},
+		{"DATETIME", []byte("2022-03-01 10:20:30.5"), time.Date(2022, 3, 1, 10, 20, 30, 500000000, time.UTC)},
+		{"TIMESTAMP", "2022-03-01T10:20:30+01:00", time.Date(2022, 3, 1, 9, 20, 30, 0, time.UTC)},
+		{"DATE", []byte("2022-03-01"), time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"VARCHAR", []byte("hello"), "hello"},
+		{"INT", []byte("not a number"), "not a number"},
+		{"JSON", []byte(`{"a":1}`), `{"a":1}`},
+		{"TEXT", nil, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.databaseType, func(t *testing.T) {
+			value := convertByType(c.databaseType, c.value)
+			if expected, ok := c.expected.(time.Time); ok {
+				require.True(t, expected.Equal(value.(time.Time)), "expected %v, got %v", expected, value)
+				return
+			}
+			require.Equal(t, c.expected, value)
+		})
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/processors/script/javascript"
 )
 
 const (
@@ -47,14 +48,6 @@ func newSession(p *goja.Program, conf scriptConfig, test bool) (*session, error)
 		timeout: conf.Timeout,
 	}
 
-	// Register common.MapStr as being a simple map[string]interface{} for
-	// treatment within the JS VM.
-	s.vm.RegisterSimpleMapType(reflect.TypeOf(common.MapStr(nil)),
-		func(i interface{}) map[string]interface{} {
-			return map[string]interface{}(i.(common.MapStr))
-		},
-	)
-
 	// Register constructors for 'new S3EventV2' to enable creating them from the JS code.
 	s.vm.Set("S3EventV2", newJSS3EventV2Constructor(s))
 	s.vm.Set("XMLDecoder", newXMLDecoderConstructor(s))
@@ -111,7 +104,9 @@ func (s *session) registerScriptParams(params map[string]interface{}) error {
 	if err := s.vm.ExportTo(registerFunc, &register); err != nil {
 		return errors.Wrap(err, "failed to export register function")
 	}
-	if _, err := register(goja.Undefined(), s.vm.ToValue(params)); err != nil {
+	// Params can contain common.MapStr values, they are converted to plain
+	// objects so that the script can read and modify their fields.
+	if _, err := register(goja.Undefined(), javascript.ToValue(s.vm, params)); err != nil {
 		return errors.Wrap(err, "failed to register script_params")
 	}
 	s.log.Debug("Registered params with script")
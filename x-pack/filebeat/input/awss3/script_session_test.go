@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/logp"
 
 	"github.com/stretchr/testify/assert"
@@ -56,6 +57,36 @@ func TestSessionScriptParams(t *testing.T) {
 	})
 }
 
+func TestSessionScriptParamsMapStr(t *testing.T) {
+	logp.TestingSetup()
+
+	const script = `
+		function register(params) {
+			if (params.fields.service !== "s3" || params.fields.labels.env !== "prod") {
+				throw "invalid fields: " + JSON.stringify(params.fields);
+			}
+			params.fields.region = "eu-west-1";
+			params.fields.labels.team = "obs";
+			delete params.fields.service;
+		}
+
+		function parse(n) {}
+	`
+	fields := common.MapStr{
+		"service": "s3",
+		"labels":  common.MapStr{"env": "prod"},
+	}
+	_, err := newScriptFromConfig(log, &scriptConfig{
+		Source: script,
+		Params: map[string]interface{}{"fields": fields},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"region": "eu-west-1",
+		"labels": common.MapStr{"env": "prod", "team": "obs"},
+	}, fields)
+}
+
 func TestSessionTestFunction(t *testing.T) {
 	logp.TestingSetup()
 
@@ -16,6 +16,8 @@ import (
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/http_endpoint"
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/httpjson"
 	"github.com/elastic/beats/v7/x-pack/filebeat/input/o365audit"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/otlp"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/sql"
 )
 
 func Init(info beat.Info, log *logp.Logger, store beater.StateStore) []v2.Plugin {
@@ -31,6 +33,8 @@ func xpackInputs(info beat.Info, log *logp.Logger, store beater.StateStore) []v2
 		http_endpoint.Plugin(),
 		httpjson.Plugin(log, store),
 		o365audit.Plugin(log, store),
+		otlp.Plugin(),
+		sql.Plugin(log, store),
 		awss3.Plugin(store),
 		awscloudwatch.Plugin(store),
 	}
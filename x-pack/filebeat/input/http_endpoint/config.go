@@ -8,7 +8,9 @@ import (
 	"errors"
 	"github.com/goccy/go-json"
 	"net/textproto"
+	"time"
 
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 )
 
@@ -33,6 +35,12 @@ type config struct {
 	HMACPrefix            string                  `config:"hmac.prefix"`
 	IncludeHeaders        []string                `config:"include_headers"`
 	PreserveOriginalEvent bool                    `config:"preserve_original_event"`
+	MaxBodySize           cfgtype.ByteSize        `config:"max_body_size" validate:"min=0"`
+	PublishTimeout        time.Duration           `config:"publish_timeout" validate:"positive"`
+	WaitForACK            bool                    `config:"wait_for_ack"`
+	ACKTimeout            time.Duration           `config:"ack_timeout" validate:"positive"`
+	MaxInFlightEvents     int                     `config:"max_in_flight_events" validate:"positive"`
+	RetryAfter            int                     `config:"retry_after" validate:"positive"`
 }
 
 func defaultConfig() config {
@@ -53,6 +61,11 @@ func defaultConfig() config {
 		HMACKey:       "",
 		HMACType:      "",
 		HMACPrefix:    "",
+
+		PublishTimeout:    5 * time.Second,
+		ACKTimeout:        30 * time.Second,
+		MaxInFlightEvents: 4096,
+		RetryAfter:        10,
 	}
 }
 
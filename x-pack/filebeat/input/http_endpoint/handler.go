@@ -5,10 +5,15 @@
 package http_endpoint
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"github.com/goccy/go-json"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,6 +23,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/batchack"
 )
 
 type httpHandler struct {
@@ -29,42 +35,201 @@ type httpHandler struct {
 	responseBody          string
 	includeHeaders        []string
 	preserveOriginalEvent bool
+	maxBodySize           int64
+
+	// publishing holds a token while the events of a request are published.
+	// Publishing blocks while the queue is full, so requests waiting longer
+	// than publishTimeout for the token are rejected.
+	publishing     chan struct{}
+	publishTimeout time.Duration
+
+	// waitForACK configures the handler to respond only after all events
+	// of a request have been acknowledged by the output.
+	waitForACK bool
+	ackTimeout time.Duration
+	inFlight   *batchack.Limiter
+	retryAfter int
+}
+
+// lineError reports a line of an NDJSON body that could not be decoded.
+type lineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
 }
 
+const ndjsonContentType = "application/x-ndjson"
+
 var (
 	errBodyEmpty       = errors.New("body cannot be empty")
 	errUnsupportedType = errors.New("only JSON objects are accepted")
+	errBodyTooLarge    = errors.New("request body too large")
+	errInvalidLines    = errors.New("request body contains invalid lines")
+	errTooManyEvents   = errors.New("request contains more events than max_in_flight_events")
+	errTooManyInFlight = errors.New("too many events waiting to be acknowledged")
+	errQueueFull       = errors.New("timeout waiting for the queue to accept events")
 )
 
 // Triggers if middleware validation returns successful
 func (h *httpHandler) apiResponse(w http.ResponseWriter, r *http.Request) {
-	var headers map[string]interface{}
-	objs, _, status, err := httpReadJSON(r.Body)
+	if r.Body == http.NoBody {
+		sendErrorResponse(w, http.StatusNotAcceptable, errBodyEmpty)
+		return
+	}
+
+	body, limits, status, err := h.requestBody(r)
 	if err != nil {
 		sendErrorResponse(w, status, err)
 		return
 	}
+
+	var (
+		objs     []common.MapStr
+		lineErrs []lineError
+	)
+	if isNDJSON(r) {
+		objs, lineErrs, status, err = httpReadNDJSON(body)
+	} else {
+		objs, _, status, err = httpReadJSON(body)
+	}
+	if limits.exceeded() {
+		sendErrorResponse(w, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, status, err)
+		return
+	}
+	if len(lineErrs) > 0 {
+		sendLineErrorsResponse(w, lineErrs)
+		return
+	}
+
+	var headers map[string]interface{}
 	if len(h.includeHeaders) > 0 {
 		headers = getIncludedHeaders(r, h.includeHeaders)
 	}
-	for _, obj := range objs {
-		h.publishEvent(obj, headers)
+
+	if h.waitForACK {
+		h.publishAndWait(w, r, objs, headers)
+		return
+	}
+
+	if err := h.publish(r.Context(), objs, headers, nil); err != nil {
+		h.sendPublishError(w, err)
+		return
 	}
 	h.sendResponse(w, h.responseCode, h.responseBody)
 }
 
+// publishAndWait publishes the events of a request and responds once all
+// events have been acknowledged. If too many events are waiting for
+// acknowledgement or the queue is full, the request is rejected with 503 and a
+// Retry-After header.
+func (h *httpHandler) publishAndWait(w http.ResponseWriter, r *http.Request, objs []common.MapStr, headers common.MapStr) {
+	if len(objs) > h.inFlight.Limit() {
+		sendErrorResponse(w, http.StatusRequestEntityTooLarge, errTooManyEvents)
+		return
+	}
+	if !h.inFlight.TryAcquire(len(objs)) {
+		w.Header().Set("Retry-After", strconv.Itoa(h.retryAfter))
+		sendErrorResponse(w, http.StatusServiceUnavailable, errTooManyInFlight)
+		return
+	}
+
+	tracker := batchack.NewTracker(len(objs), h.inFlight)
+	if err := h.publish(r.Context(), objs, headers, tracker); err != nil {
+		h.inFlight.Release(len(objs))
+		h.sendPublishError(w, err)
+		return
+	}
+
+	switch err := tracker.Wait(r.Context(), h.ackTimeout); err {
+	case nil:
+		h.sendResponse(w, h.responseCode, h.responseBody)
+	case batchack.ErrTimeout:
+		sendErrorResponse(w, http.StatusGatewayTimeout, err)
+	default:
+		h.log.Debugw("Request canceled while waiting for events to be acknowledged", "error", err)
+	}
+}
+
+// requestBody returns the decompressed request body. The size of the raw and
+// of the decompressed body are limited to maxBodySize.
+func (h *httpHandler) requestBody(r *http.Request) (io.Reader, bodyLimits, int, error) {
+	var limits bodyLimits
+
+	body := h.limit(r.Body, &limits)
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			if limits.exceeded() {
+				return nil, limits, http.StatusRequestEntityTooLarge, errBodyTooLarge
+			}
+			return nil, limits, http.StatusBadRequest, errors.Wrap(err, "invalid gzip body")
+		}
+		body = h.limit(gz, &limits)
+	default:
+		return nil, limits, http.StatusUnsupportedMediaType, errors.Errorf("unsupported Content-Encoding %q", enc)
+	}
+	return body, limits, http.StatusOK, nil
+}
+
+func (h *httpHandler) limit(r io.Reader, limits *bodyLimits) io.Reader {
+	if h.maxBodySize <= 0 {
+		return r
+	}
+	lr := &limitedReader{r: r, n: h.maxBodySize}
+	*limits = append(*limits, lr)
+	return lr
+}
+
 func (h *httpHandler) sendResponse(w http.ResponseWriter, status int, message string) {
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(status)
 	io.WriteString(w, message)
 }
 
-func (h *httpHandler) publishEvent(obj common.MapStr, headers common.MapStr) {
+// publish publishes the events of a request. It waits up to publishTimeout
+// for the events of other requests to be published and returns errQueueFull
+// if they are still blocked by a full queue. Either all or none of the events
+// are published.
+func (h *httpHandler) publish(ctx context.Context, objs []common.MapStr, headers common.MapStr, private interface{}) error {
+	timer := time.NewTimer(h.publishTimeout)
+	defer timer.Stop()
+
+	select {
+	case h.publishing <- struct{}{}:
+	case <-timer.C:
+		return errQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-h.publishing }()
+
+	for _, obj := range objs {
+		h.publishEvent(obj, headers, private)
+	}
+	return nil
+}
+
+func (h *httpHandler) sendPublishError(w http.ResponseWriter, err error) {
+	if err != errQueueFull {
+		h.log.Debugw("Request canceled while waiting to publish events", "error", err)
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(h.retryAfter))
+	sendErrorResponse(w, http.StatusServiceUnavailable, err)
+}
+
+func (h *httpHandler) publishEvent(obj common.MapStr, headers common.MapStr, private interface{}) {
 	event := beat.Event{
 		Timestamp: time.Now().UTC(),
 		Fields: common.MapStr{
 			h.messageField: obj,
 		},
+		Private: private,
 	}
 	if h.preserveOriginalEvent {
 		event.PutValue("event.original", obj.String())
@@ -94,6 +259,19 @@ func sendErrorResponse(w http.ResponseWriter, status int, err error) {
 	e.Encode(common.MapStr{"message": err.Error()})
 }
 
+func sendLineErrorsResponse(w http.ResponseWriter, lineErrs []lineError) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.Encode(common.MapStr{"message": errInvalidLines.Error(), "errors": lineErrs})
+}
+
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == ndjsonContentType
+}
+
 func httpReadJSON(body io.Reader) (objs []common.MapStr, rawMessages []json.RawMessage, status int, err error) {
 	if body == http.NoBody {
 		return nil, nil, http.StatusNotAcceptable, errBodyEmpty
@@ -106,6 +284,58 @@ func httpReadJSON(body io.Reader) (objs []common.MapStr, rawMessages []json.RawM
 
 }
 
+// httpReadNDJSON decodes a body with one JSON object per line. Lines that
+// can not be decoded are reported with their line number. Empty lines are
+// ignored.
+func httpReadNDJSON(body io.Reader) (objs []common.MapStr, lineErrs []lineError, status int, err error) {
+	reader := bufio.NewReader(body)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, http.StatusBadRequest, errors.Wrap(err, "failed to read request body")
+		}
+
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			obj, decErr := decodeNDJSONLine(data)
+			if decErr != nil {
+				lineErrs = append(lineErrs, lineError{Line: line, Message: decErr.Error()})
+			} else {
+				objs = append(objs, obj)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if len(objs) == 0 && len(lineErrs) == 0 {
+		return nil, nil, http.StatusNotAcceptable, errBodyEmpty
+	}
+	for i := range objs {
+		jsontransform.TransformNumbers(objs[i])
+	}
+	return objs, lineErrs, http.StatusOK, nil
+}
+
+func decodeNDJSONLine(data []byte) (common.MapStr, error) {
+	dec := newJSONDecoder(bytes.NewReader(data))
+
+	var obj interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, errors.Wrap(err, "malformed JSON object")
+	}
+	if dec.More() {
+		return nil, errors.New("more than one JSON value in line")
+	}
+
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil, errUnsupportedType
+	}
+	return m, nil
+}
+
 func decodeJSON(body io.Reader) (objs []common.MapStr, rawMessages []json.RawMessage, err error) {
 	decoder := json.NewDecoder(body)
 	for decoder.More() {
@@ -188,3 +418,41 @@ func newJSONDecoder(r io.Reader) *json.Decoder {
 	dec.UseNumber()
 	return dec
 }
+
+// limitedReader fails with errBodyTooLarge if more than n bytes can be read
+// from the underlying reader.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	tooLarge bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// check if the body ends right at the limit
+		var probe [1]byte
+		if n, _ := io.ReadFull(l.r, probe[:]); n > 0 {
+			l.tooLarge = true
+			return 0, errBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+type bodyLimits []*limitedReader
+
+func (b bodyLimits) exceeded() bool {
+	for _, l := range b {
+		if l.tooLarge {
+			return true
+		}
+	}
+	return false
+}
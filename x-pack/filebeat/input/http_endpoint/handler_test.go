@@ -5,14 +5,23 @@
 package http_endpoint
 
 import (
+	"bytes"
+	"compress/gzip"
 	"github.com/goccy/go-json"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/batchack"
 )
 
 func Test_httpReadJSON(t *testing.T) {
@@ -137,3 +146,211 @@ func Test_httpReadJSON(t *testing.T) {
 		})
 	}
 }
+
+func Test_httpReadNDJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantObjs     []common.MapStr
+		wantLineErrs []int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{
+			name:       "objects per line",
+			body:       "{\"a\":1}\n{\"a\":\"b\"}\n",
+			wantObjs:   []common.MapStr{{"a": int64(1)}, {"a": "b"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "empty lines and CRLF are ignored",
+			body:       "{\"a\":1}\r\n\r\n{\"a\":2}",
+			wantObjs:   []common.MapStr{{"a": int64(1)}, {"a": int64(2)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "invalid lines are reported",
+			body:         "{\"a\":1}\n{a:2}\n42\n{\"a\":3} {\"a\":4}\n",
+			wantObjs:     []common.MapStr{{"a": int64(1)}},
+			wantLineErrs: []int{2, 3, 4},
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:       "empty body",
+			body:       "\n\n",
+			wantStatus: http.StatusNotAcceptable,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotObjs, gotLineErrs, gotStatus, err := httpReadNDJSON(strings.NewReader(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantStatus, gotStatus)
+			assert.EqualValues(t, tt.wantObjs, gotObjs)
+
+			var lines []int
+			for _, lineErr := range gotLineErrs {
+				lines = append(lines, lineErr.Line)
+			}
+			assert.Equal(t, tt.wantLineErrs, lines)
+		})
+	}
+}
+
+type testPublisher struct {
+	mu     sync.Mutex
+	events []beat.Event
+	onPub  func(beat.Event)
+}
+
+func (p *testPublisher) Publish(event beat.Event) {
+	p.mu.Lock()
+	p.events = append(p.events, event)
+	p.mu.Unlock()
+	if p.onPub != nil {
+		p.onPub(event)
+	}
+}
+
+func newTestHandler(pub *testPublisher) *httpHandler {
+	return &httpHandler{
+		log:            logp.NewLogger("http_endpoint_test"),
+		publisher:      pub,
+		messageField:   "json",
+		responseCode:   http.StatusOK,
+		responseBody:   `{"message": "success"}`,
+		maxBodySize:    1024,
+		publishing:     make(chan struct{}, 1),
+		publishTimeout: time.Second,
+		ackTimeout:     time.Second,
+		inFlight:       batchack.NewLimiter(4),
+		retryAfter:     10,
+	}
+}
+
+func doRequest(h *httpHandler, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.apiResponse(rec, req)
+	return rec
+}
+
+func TestAPIResponse(t *testing.T) {
+	t.Run("gzip body", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(`{"a":"b"}`))
+		gz.Close()
+
+		pub := &testPublisher{}
+		rec := doRequest(newTestHandler(pub), buf.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, pub.events, 1)
+		assert.Equal(t, common.MapStr{"a": "b"}, pub.events[0].Fields["json"])
+	})
+
+	t.Run("unsupported content encoding", func(t *testing.T) {
+		rec := doRequest(newTestHandler(&testPublisher{}), []byte(`{"a":"b"}`), map[string]string{"Content-Encoding": "br"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		body := `{"a":"` + strings.Repeat("x", 2048) + `"}`
+		pub := &testPublisher{}
+		rec := doRequest(newTestHandler(pub), []byte(body), nil)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Empty(t, pub.events)
+	})
+
+	t.Run("decompressed body too large", func(t *testing.T) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(`{"a":"` + strings.Repeat("x", 4096) + `"}`))
+		gz.Close()
+
+		rec := doRequest(newTestHandler(&testPublisher{}), buf.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("ndjson with invalid lines is rejected", func(t *testing.T) {
+		pub := &testPublisher{}
+		rec := doRequest(newTestHandler(pub), []byte("{\"a\":1}\nnot json\n"), map[string]string{"Content-Type": ndjsonContentType})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, pub.events)
+
+		var resp struct {
+			Errors []lineError `json:"errors"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.Errors, 1)
+		assert.Equal(t, 2, resp.Errors[0].Line)
+	})
+
+	t.Run("wait for ack", func(t *testing.T) {
+		pub := &testPublisher{}
+		pub.onPub = func(event beat.Event) {
+			go event.Private.(*batchack.Tracker).ACK()
+		}
+		h := newTestHandler(pub)
+		h.waitForACK = true
+
+		rec := doRequest(h, []byte(`{"a":1} {"a":2}`), nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, pub.events, 2)
+		assert.Equal(t, 0, h.inFlight.InFlight())
+	})
+
+	t.Run("ack timeout", func(t *testing.T) {
+		h := newTestHandler(&testPublisher{})
+		h.waitForACK = true
+		h.ackTimeout = 10 * time.Millisecond
+
+		rec := doRequest(h, []byte(`{"a":1}`), nil)
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+		assert.Equal(t, 1, h.inFlight.InFlight())
+	})
+
+	t.Run("reject with retry after if too many events are in flight", func(t *testing.T) {
+		h := newTestHandler(&testPublisher{})
+		h.waitForACK = true
+		h.inFlight.TryAcquire(3)
+
+		rec := doRequest(h, []byte(`{"a":1} {"a":2}`), nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("reject with retry after if the queue is full", func(t *testing.T) {
+		for _, waitForACK := range []bool{false, true} {
+			pub := &testPublisher{}
+			h := newTestHandler(pub)
+			h.waitForACK = waitForACK
+			h.publishTimeout = 10 * time.Millisecond
+
+			// Another request is blocked publishing its events.
+			h.publishing <- struct{}{}
+
+			rec := doRequest(h, []byte(`{"a":1} {"a":2}`), nil)
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+			assert.Empty(t, pub.events)
+			assert.Equal(t, 0, h.inFlight.InFlight())
+		}
+	})
+
+	t.Run("reject requests larger than the in flight limit", func(t *testing.T) {
+		h := newTestHandler(&testPublisher{})
+		h.waitForACK = true
+
+		rec := doRequest(h, []byte(`[{"a":1},{"a":2},{"a":3},{"a":4},{"a":5}]`), nil)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"runtime/debug"
 
 	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
-	stateless "github.com/elastic/beats/v7/filebeat/input/v2/input-stateless"
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 	"github.com/elastic/beats/v7/libbeat/feature"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/batchack"
 	"github.com/elastic/go-concert/ctxtool"
 )
 
@@ -33,11 +35,11 @@ func Plugin() v2.Plugin {
 		Name:       inputName,
 		Stability:  feature.Beta,
 		Deprecated: false,
-		Manager:    stateless.NewInputManager(configure),
+		Manager:    v2.ConfigureWith(configure),
 	}
 }
 
-func configure(cfg *common.Config) (stateless.Input, error) {
+func configure(cfg *common.Config) (v2.Input, error) {
 	conf := defaultConfig()
 	if err := cfg.Unpack(&conf); err != nil {
 		return nil, err
@@ -79,9 +81,34 @@ func (e *httpEndpoint) Test(_ v2.TestContext) error {
 	return l.Close()
 }
 
-func (e *httpEndpoint) Run(ctx v2.Context, publisher stateless.Publisher) error {
+func (e *httpEndpoint) Run(ctx v2.Context, pipeline beat.PipelineConnector) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if perr, ok := v.(error); ok {
+				err = perr
+			} else {
+				err = fmt.Errorf("input panic with: %+v\n%s", v, debug.Stack())
+			}
+		}
+	}()
+
 	log := ctx.Logger.With("address", e.addr)
 
+	clientConfig := beat.ClientConfig{
+		PublishMode: beat.DefaultGuarantees,
+
+		// configure pipeline to disconnect input on stop signal.
+		CloseRef: ctx.Cancelation,
+	}
+	if e.config.WaitForACK {
+		clientConfig.ACKHandler = batchack.NewACKHandler()
+	}
+	client, err := pipeline.ConnectWith(clientConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
 	validator := &apiValidator{
 		basicAuth:    e.config.BasicAuth,
 		username:     e.config.Username,
@@ -98,12 +125,19 @@ func (e *httpEndpoint) Run(ctx v2.Context, publisher stateless.Publisher) error
 
 	handler := &httpHandler{
 		log:                   log,
-		publisher:             publisher,
+		publisher:             client,
 		messageField:          e.config.Prefix,
 		responseCode:          e.config.ResponseCode,
 		responseBody:          e.config.ResponseBody,
 		includeHeaders:        canonicalizeHeaders(e.config.IncludeHeaders),
 		preserveOriginalEvent: e.config.PreserveOriginalEvent,
+		maxBodySize:           int64(e.config.MaxBodySize),
+		publishing:            make(chan struct{}, 1),
+		publishTimeout:        e.config.PublishTimeout,
+		waitForACK:            e.config.WaitForACK,
+		ackTimeout:            e.config.ACKTimeout,
+		inFlight:              batchack.NewLimiter(e.config.MaxInFlightEvents),
+		retryAfter:            e.config.RetryAfter,
 	}
 
 	mux := http.NewServeMux()
@@ -112,7 +146,6 @@ func (e *httpEndpoint) Run(ctx v2.Context, publisher stateless.Publisher) error
 	_, cancel := ctxtool.WithFunc(ctx.Cancelation, func() { server.Close() })
 	defer cancel()
 
-	var err error
 	if server.TLSConfig != nil {
 		log.Infof("Starting HTTPS server on %s", server.Addr)
 		//certificate is already loaded. That's why the parameters are empty
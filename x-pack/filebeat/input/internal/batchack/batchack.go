@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package batchack tracks the acknowledgement of the events published for a
+// single request, for inputs that respond to a request only after all of its
+// events have been acknowledged by the output.
+package batchack
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+)
+
+// ErrTimeout is returned by Tracker.Wait if the events have not been
+// acknowledged in time.
+var ErrTimeout = errors.New("timeout waiting for events to be acknowledged")
+
+// Limiter limits the number of events that have been published but not yet
+// acknowledged by the output.
+type Limiter struct {
+	mu    sync.Mutex
+	count int
+	limit int
+}
+
+// NewLimiter creates a Limiter allowing up to limit events in flight.
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{limit: limit}
+}
+
+// Limit returns the maximum number of events in flight.
+func (l *Limiter) Limit() int {
+	return l.limit
+}
+
+// InFlight returns the number of events waiting to be acknowledged.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// TryAcquire reserves n events. It returns false if the events do not fit
+// into the limit.
+func (l *Limiter) TryAcquire(n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count+n > l.limit {
+		return false
+	}
+	l.count += n
+	return true
+}
+
+// Release returns n events to the limiter.
+func (l *Limiter) Release(n int) {
+	l.mu.Lock()
+	l.count -= n
+	l.mu.Unlock()
+}
+
+// Tracker tracks the events published for a single request. The Tracker must
+// be set as the Private field of the events, see NewACKHandler.
+type Tracker struct {
+	mu      sync.Mutex
+	pending int
+	done    chan struct{}
+	limiter *Limiter
+}
+
+// NewTracker creates a Tracker for the given number of events. If limiter is
+// not nil, every acknowledged event is released from the limiter.
+func NewTracker(events int, limiter *Limiter) *Tracker {
+	t := &Tracker{
+		pending: events,
+		done:    make(chan struct{}),
+		limiter: limiter,
+	}
+	if events == 0 {
+		close(t.done)
+	}
+	return t
+}
+
+// ACK marks one event as acknowledged.
+func (t *Tracker) ACK() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending <= 0 {
+		panic("misuse detected: negative ACK counter")
+	}
+
+	t.pending--
+	if t.limiter != nil {
+		t.limiter.Release(1)
+	}
+	if t.pending == 0 {
+		close(t.done)
+	}
+}
+
+// Done returns a channel that is closed once all events have been
+// acknowledged by the output or have been dropped by the processors.
+func (t *Tracker) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait blocks until all events have been acknowledged. It returns ErrTimeout
+// if the events have not been acknowledged within timeout, or the error of
+// ctx if it is cancelled.
+func (t *Tracker) Wait(ctx context.Context, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-t.done:
+		return nil
+	case <-timer.C:
+		return ErrTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewACKHandler returns a beat ACKer that reports acknowledged events to the
+// Tracker stored in the event private field.
+func NewACKHandler() beat.ACKer {
+	return acker.ConnectionOnly(
+		acker.EventPrivateReporter(func(_ int, privates []interface{}) {
+			for _, private := range privates {
+				if t, ok := private.(*Tracker); ok {
+					t.ACK()
+				}
+			}
+		}),
+	)
+}
@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package batchack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+func TestTracker(t *testing.T) {
+	t.Run("no events", func(t *testing.T) {
+		require.NoError(t, NewTracker(0, nil).Wait(context.Background(), time.Second))
+	})
+
+	t.Run("all events acknowledged", func(t *testing.T) {
+		limiter := NewLimiter(4)
+		require.True(t, limiter.TryAcquire(2))
+
+		tracker := NewTracker(2, limiter)
+		go func() {
+			tracker.ACK()
+			tracker.ACK()
+		}()
+		require.NoError(t, tracker.Wait(context.Background(), time.Second))
+		assert.Equal(t, 0, limiter.InFlight())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		tracker := NewTracker(1, nil)
+		assert.Equal(t, ErrTimeout, tracker.Wait(context.Background(), 10*time.Millisecond))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, context.Canceled, NewTracker(1, nil).Wait(ctx, time.Second))
+	})
+
+	t.Run("ACK handler", func(t *testing.T) {
+		tracker := NewTracker(2, nil)
+		handler := NewACKHandler()
+		handler.AddEvent(beat.Event{Private: tracker}, true)
+		handler.AddEvent(beat.Event{}, true)
+		handler.AddEvent(beat.Event{Private: tracker}, true)
+		handler.ACKEvents(3)
+		require.NoError(t, tracker.Wait(context.Background(), time.Second))
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(3)
+	assert.Equal(t, 3, limiter.Limit())
+	assert.True(t, limiter.TryAcquire(2))
+	assert.False(t, limiter.TryAcquire(2))
+	limiter.Release(1)
+	assert.True(t, limiter.TryAcquire(2))
+	assert.Equal(t, 3, limiter.InFlight())
+}
@@ -0,0 +1,34 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"context"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/batchack"
+)
+
+// eventPublisher is the subset of beat.Client used to publish events.
+type eventPublisher interface {
+	Publish(beat.Event)
+}
+
+// batchPublisher publishes the events of a single export request and waits
+// until all of them have been acknowledged by the output.
+type batchPublisher struct {
+	client     eventPublisher
+	ackTimeout time.Duration
+}
+
+func (p *batchPublisher) publish(ctx context.Context, events []beat.Event) error {
+	tracker := batchack.NewTracker(len(events), nil)
+	for _, event := range events {
+		event.Private = tracker
+		p.client.Publish(event)
+	}
+	return tracker.Wait(ctx, p.ackTimeout)
+}
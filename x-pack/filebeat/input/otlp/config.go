@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+)
+
+type config struct {
+	HTTP       serverConfig  `config:"http"`
+	GRPC       serverConfig  `config:"grpc"`
+	ACKTimeout time.Duration `config:"ack_timeout" validate:"positive"`
+}
+
+type serverConfig struct {
+	Enabled        bool                    `config:"enabled"`
+	Host           string                  `config:"host"`
+	TLS            *tlscommon.ServerConfig `config:"ssl"`
+	MaxMessageSize cfgtype.ByteSize        `config:"max_message_size" validate:"positive"`
+}
+
+func defaultConfig() config {
+	return config{
+		HTTP: serverConfig{
+			Enabled:        true,
+			Host:           "localhost:4318",
+			MaxMessageSize: 4 * 1024 * 1024,
+		},
+		GRPC: serverConfig{
+			Enabled:        true,
+			Host:           "localhost:4317",
+			MaxMessageSize: 4 * 1024 * 1024,
+		},
+		ACKTimeout: 30 * time.Second,
+	}
+}
+
+func (c *config) Validate() error {
+	if !c.HTTP.Enabled && !c.GRPC.Enabled {
+		return errors.New("at least one of http or grpc must be enabled")
+	}
+	if c.HTTP.Enabled && c.HTTP.Host == "" {
+		return errors.New("http.host must be set")
+	}
+	if c.GRPC.Enabled && c.GRPC.Host == "" {
+		return errors.New("grpc.host must be set")
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// resourceFields maps OpenTelemetry resource semantic conventions to ECS.
+var resourceFields = map[string]string{
+	"service.name":            "service.name",
+	"service.version":         "service.version",
+	"service.instance.id":     "service.node.name",
+	"deployment.environment":  "service.environment",
+	"host.name":               "host.name",
+	"host.id":                 "host.id",
+	"host.arch":               "host.architecture",
+	"host.type":               "host.type",
+	"os.type":                 "host.os.platform",
+	"os.description":          "host.os.full",
+	"os.version":              "host.os.version",
+	"process.pid":             "process.pid",
+	"process.executable.name": "process.name",
+	"process.executable.path": "process.executable",
+	"process.command_line":    "process.command_line",
+	"container.id":            "container.id",
+	"container.name":          "container.name",
+	"container.runtime":       "container.runtime",
+	"container.image.name":    "container.image.name",
+	"container.image.tag":     "container.image.tag",
+	"cloud.provider":          "cloud.provider",
+	"cloud.account.id":        "cloud.account.id",
+	"cloud.region":            "cloud.region",
+	"cloud.availability_zone": "cloud.availability_zone",
+	"cloud.platform":          "cloud.service.name",
+	"k8s.namespace.name":      "kubernetes.namespace",
+	"k8s.node.name":           "kubernetes.node.name",
+	"k8s.pod.name":            "kubernetes.pod.name",
+	"k8s.pod.uid":             "kubernetes.pod.uid",
+	"k8s.container.name":      "kubernetes.container.name",
+	"k8s.deployment.name":     "kubernetes.deployment.name",
+}
+
+// attributeFields maps OpenTelemetry log record and span attribute semantic
+// conventions to ECS.
+var attributeFields = map[string]string{
+	"exception.type":       "error.type",
+	"exception.message":    "error.message",
+	"exception.stacktrace": "error.stack_trace",
+	"code.function":        "log.origin.function",
+	"code.filepath":        "log.origin.file.name",
+	"code.lineno":          "log.origin.file.line",
+	"http.method":          "http.request.method",
+	"http.status_code":     "http.response.status_code",
+	"http.url":             "url.full",
+	"http.user_agent":      "user_agent.original",
+	"net.peer.ip":          "source.ip",
+	"net.peer.port":        "source.port",
+	"net.host.name":        "destination.domain",
+	"net.host.port":        "destination.port",
+	"db.system":            "db.type",
+	"db.statement":         "db.statement",
+	"enduser.id":           "user.id",
+}
+
+var spanKinds = map[tracepb.Span_SpanKind]string{
+	tracepb.Span_SPAN_KIND_INTERNAL: "internal",
+	tracepb.Span_SPAN_KIND_SERVER:   "server",
+	tracepb.Span_SPAN_KIND_CLIENT:   "client",
+	tracepb.Span_SPAN_KIND_PRODUCER: "producer",
+	tracepb.Span_SPAN_KIND_CONSUMER: "consumer",
+}
+
+var spanOutcomes = map[tracepb.Status_StatusCode]string{
+	tracepb.Status_STATUS_CODE_UNSET: "unknown",
+	tracepb.Status_STATUS_CODE_OK:    "success",
+	tracepb.Status_STATUS_CODE_ERROR: "failure",
+}
+
+// logsToEvents creates one event per log record.
+func logsToEvents(req *collectorlogs.ExportLogsServiceRequest, now time.Time) []beat.Event {
+	var events []beat.Event
+	for _, rl := range req.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			for _, record := range sl.GetLogRecords() {
+				event := newEvent(rl.GetResource(), sl.GetScope())
+				event.Timestamp = timestamp(record.GetTimeUnixNano(), record.GetObservedTimeUnixNano(), now)
+
+				if name := sl.GetScope().GetName(); name != "" {
+					event.PutValue("log.logger", name)
+				}
+				if observed := record.GetObservedTimeUnixNano(); observed != 0 {
+					event.PutValue("event.created", unixNano(observed))
+				}
+				if level := record.GetSeverityText(); level != "" {
+					event.PutValue("log.level", level)
+				}
+				if severity := record.GetSeverityNumber(); severity != 0 {
+					event.PutValue("event.severity", int64(severity))
+				}
+				if body := record.GetBody(); body != nil {
+					if s, ok := body.GetValue().(*commonpb.AnyValue_StringValue); ok {
+						event.PutValue("message", s.StringValue)
+					} else {
+						event.PutValue("otel.body", anyValue(body))
+					}
+				}
+				putIDs(&event, record.GetTraceId(), record.GetSpanId(), nil)
+				putAttributes(&event, record.GetAttributes(), attributeFields, "otel.attributes")
+
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+// tracesToEvents creates one event per span.
+func tracesToEvents(req *collectortrace.ExportTraceServiceRequest, now time.Time) []beat.Event {
+	var events []beat.Event
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				event := newEvent(rs.GetResource(), ss.GetScope())
+				event.Timestamp = timestamp(span.GetStartTimeUnixNano(), 0, now)
+
+				putIDs(&event, span.GetTraceId(), span.GetSpanId(), span.GetParentSpanId())
+				event.PutValue("span.name", span.GetName())
+				if kind, ok := spanKinds[span.GetKind()]; ok {
+					event.PutValue("span.kind", kind)
+				}
+
+				start, end := span.GetStartTimeUnixNano(), span.GetEndTimeUnixNano()
+				if start != 0 {
+					event.PutValue("event.start", unixNano(start))
+				}
+				if end != 0 {
+					event.PutValue("event.end", unixNano(end))
+				}
+				if start != 0 && end >= start {
+					event.PutValue("event.duration", int64(end-start))
+				}
+
+				status := span.GetStatus()
+				event.PutValue("event.outcome", spanOutcomes[status.GetCode()])
+				if msg := status.GetMessage(); msg != "" {
+					event.PutValue("otel.status.message", msg)
+				}
+				if state := span.GetTraceState(); state != "" {
+					event.PutValue("otel.trace_state", state)
+				}
+
+				putAttributes(&event, span.GetAttributes(), attributeFields, "otel.attributes")
+				if spanEvents := span.GetEvents(); len(spanEvents) > 0 {
+					event.PutValue("otel.span.events", convertSpanEvents(spanEvents))
+				}
+				if links := span.GetLinks(); len(links) > 0 {
+					event.PutValue("otel.span.links", convertSpanLinks(links))
+				}
+
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+func newEvent(resource *resourcepb.Resource, scope *commonpb.InstrumentationScope) beat.Event {
+	event := beat.Event{Fields: common.MapStr{}}
+	putAttributes(&event, resource.GetAttributes(), resourceFields, "otel.resource.attributes")
+
+	if name := scope.GetName(); name != "" {
+		event.PutValue("otel.scope.name", name)
+	}
+	if version := scope.GetVersion(); version != "" {
+		event.PutValue("otel.scope.version", version)
+	}
+	putAttributes(&event, scope.GetAttributes(), nil, "otel.scope.attributes")
+	return event
+}
+
+// putAttributes adds all attributes with a mapping to their ECS field. All
+// other attributes are added to the unmapped field, keeping their original
+// key.
+func putAttributes(event *beat.Event, attrs []*commonpb.KeyValue, mapping map[string]string, unmapped string) {
+	var other common.MapStr
+	for _, kv := range attrs {
+		value := anyValue(kv.GetValue())
+		if field, ok := mapping[kv.GetKey()]; ok {
+			event.PutValue(field, value)
+			continue
+		}
+		if other == nil {
+			other = common.MapStr{}
+		}
+		other[kv.GetKey()] = value
+	}
+	if len(other) > 0 {
+		event.PutValue(unmapped, other)
+	}
+}
+
+// putIDs adds the trace and span IDs as lower case hex strings.
+func putIDs(event *beat.Event, traceID, spanID, parentID []byte) {
+	if len(traceID) > 0 {
+		event.PutValue("trace.id", hex.EncodeToString(traceID))
+	}
+	if len(spanID) > 0 {
+		event.PutValue("span.id", hex.EncodeToString(spanID))
+	}
+	if len(parentID) > 0 {
+		event.PutValue("parent.id", hex.EncodeToString(parentID))
+	}
+}
+
+func convertSpanEvents(spanEvents []*tracepb.Span_Event) []common.MapStr {
+	out := make([]common.MapStr, 0, len(spanEvents))
+	for _, e := range spanEvents {
+		m := common.MapStr{"name": e.GetName()}
+		if ts := e.GetTimeUnixNano(); ts != 0 {
+			m["timestamp"] = unixNano(ts)
+		}
+		if attrs := attributesMap(e.GetAttributes()); len(attrs) > 0 {
+			m["attributes"] = attrs
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func convertSpanLinks(links []*tracepb.Span_Link) []common.MapStr {
+	out := make([]common.MapStr, 0, len(links))
+	for _, l := range links {
+		m := common.MapStr{
+			"trace": common.MapStr{"id": hex.EncodeToString(l.GetTraceId())},
+			"span":  common.MapStr{"id": hex.EncodeToString(l.GetSpanId())},
+		}
+		if attrs := attributesMap(l.GetAttributes()); len(attrs) > 0 {
+			m["attributes"] = attrs
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func attributesMap(attrs []*commonpb.KeyValue) common.MapStr {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(common.MapStr, len(attrs))
+	for _, kv := range attrs {
+		m[kv.GetKey()] = anyValue(kv.GetValue())
+	}
+	return m
+}
+
+// anyValue converts an attribute value to its Go representation. Byte values
+// are base64 encoded.
+func anyValue(v *commonpb.AnyValue) interface{} {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := v.ArrayValue.GetValues()
+		out := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			out = append(out, anyValue(value))
+		}
+		return out
+	case *commonpb.AnyValue_KvlistValue:
+		return attributesMap(v.KvlistValue.GetValues())
+	default:
+		return nil
+	}
+}
+
+func timestamp(ts, observed uint64, now time.Time) time.Time {
+	switch {
+	case ts != 0:
+		return unixNano(ts)
+	case observed != 0:
+		return unixNano(observed)
+	default:
+		return now
+	}
+}
+
+func unixNano(ts uint64) time.Time {
+	return time.Unix(0, int64(ts)).UTC()
+}
+
+// isIDField reports if a field of an OTLP/JSON message contains a trace or
+// span ID. IDs are hex encoded in OTLP/JSON instead of the base64 encoding
+// used for bytes fields by the protobuf JSON mapping.
+func isIDField(name string) bool {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "")) {
+	case "traceid", "spanid", "parentspanid":
+		return true
+	}
+	return false
+}
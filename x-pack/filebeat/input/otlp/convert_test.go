@@ -0,0 +1,163 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+var (
+	testTraceID = []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c}
+	testSpanID  = []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74}
+	testParent  = []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x73}
+)
+
+func stringValue(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
+
+func intValue(i int64) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+}
+
+func testResource() *resourcepb.Resource {
+	return &resourcepb.Resource{
+		Attributes: []*commonpb.KeyValue{
+			{Key: "service.name", Value: stringValue("checkout")},
+			{Key: "host.name", Value: stringValue("web-1")},
+			{Key: "process.pid", Value: intValue(42)},
+			{Key: "telemetry.sdk.language", Value: stringValue("go")},
+		},
+	}
+}
+
+func testLogsRequest() *collectorlogs.ExportLogsServiceRequest {
+	return &collectorlogs.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: testResource(),
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope: &commonpb.InstrumentationScope{Name: "checkout.payment", Version: "1.2.0"},
+				LogRecords: []*logspb.LogRecord{{
+					TimeUnixNano:   uint64(time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC).UnixNano()),
+					SeverityText:   "ERROR",
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+					Body:           stringValue("payment failed"),
+					TraceId:        testTraceID,
+					SpanId:         testSpanID,
+					Attributes: []*commonpb.KeyValue{
+						{Key: "exception.type", Value: stringValue("TimeoutError")},
+						{Key: "order.id", Value: intValue(1234)},
+					},
+				}},
+			}},
+		}},
+	}
+}
+
+func testTracesRequest() *collectortrace.ExportTraceServiceRequest {
+	start := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	return &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: testResource(),
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: "net/http"},
+				Spans: []*tracepb.Span{{
+					TraceId:           testTraceID,
+					SpanId:            testSpanID,
+					ParentSpanId:      testParent,
+					Name:              "GET /cart",
+					Kind:              tracepb.Span_SPAN_KIND_SERVER,
+					StartTimeUnixNano: uint64(start.UnixNano()),
+					EndTimeUnixNano:   uint64(start.Add(150 * time.Millisecond).UnixNano()),
+					Attributes: []*commonpb.KeyValue{
+						{Key: "http.method", Value: stringValue("GET")},
+						{Key: "http.status_code", Value: intValue(500)},
+					},
+					Events: []*tracepb.Span_Event{{
+						Name:         "exception",
+						TimeUnixNano: uint64(start.Add(time.Millisecond).UnixNano()),
+					}},
+					Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "internal error"},
+				}},
+			}},
+		}},
+	}
+}
+
+func TestLogsToEvents(t *testing.T) {
+	events := logsToEvents(testLogsRequest(), time.Now())
+	require.Len(t, events, 1)
+
+	event := events[0]
+	assert.Equal(t, time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC), event.Timestamp)
+	assert.Equal(t, common.MapStr{
+		"message": "payment failed",
+		"service": common.MapStr{"name": "checkout"},
+		"host":    common.MapStr{"name": "web-1"},
+		"process": common.MapStr{"pid": int64(42)},
+		"log":     common.MapStr{"level": "ERROR", "logger": "checkout.payment"},
+		"event":   common.MapStr{"severity": int64(17)},
+		"error":   common.MapStr{"type": "TimeoutError"},
+		"trace":   common.MapStr{"id": "5b8efff798038103d269b633813fc60c"},
+		"span":    common.MapStr{"id": "eee19b7ec3c1b174"},
+		"otel": common.MapStr{
+			"resource":   common.MapStr{"attributes": common.MapStr{"telemetry.sdk.language": "go"}},
+			"scope":      common.MapStr{"name": "checkout.payment", "version": "1.2.0"},
+			"attributes": common.MapStr{"order.id": int64(1234)},
+		},
+	}, event.Fields)
+}
+
+func TestTracesToEvents(t *testing.T) {
+	events := tracesToEvents(testTracesRequest(), time.Now())
+	require.Len(t, events, 1)
+
+	fields := events[0].Fields
+	get := func(key string) interface{} {
+		v, err := fields.GetValue(key)
+		require.NoError(t, err, key)
+		return v
+	}
+	assert.Equal(t, "5b8efff798038103d269b633813fc60c", get("trace.id"))
+	assert.Equal(t, "eee19b7ec3c1b174", get("span.id"))
+	assert.Equal(t, "eee19b7ec3c1b173", get("parent.id"))
+	assert.Equal(t, "GET /cart", get("span.name"))
+	assert.Equal(t, "server", get("span.kind"))
+	assert.Equal(t, int64(150*time.Millisecond), get("event.duration"))
+	assert.Equal(t, "failure", get("event.outcome"))
+	assert.Equal(t, "internal error", get("otel.status.message"))
+	assert.Equal(t, "GET", get("http.request.method"))
+	assert.Equal(t, int64(500), get("http.response.status_code"))
+	assert.Equal(t, "checkout", get("service.name"))
+	assert.Equal(t, "exception", get("otel.span.events").([]common.MapStr)[0]["name"])
+}
+
+func TestAnyValue(t *testing.T) {
+	v := &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+		Values: []*commonpb.KeyValue{
+			{Key: "list", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+				Values: []*commonpb.AnyValue{stringValue("a"), intValue(1)},
+			}}}},
+			{Key: "bytes", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte("hi")}}},
+		},
+	}}}
+	assert.Equal(t, common.MapStr{
+		"list":  []interface{}{"a", int64(1)},
+		"bytes": "aGk=",
+	}, anyValue(v))
+}
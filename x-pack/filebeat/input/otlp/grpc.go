@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // register gzip compression for OTLP/gRPC
+	"google.golang.org/grpc/status"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// grpcServer receives OTLP/gRPC exports.
+type grpcServer struct {
+	config    serverConfig
+	tlsConfig *tls.Config
+	log       *logp.Logger
+	publisher *batchPublisher
+
+	server   *grpc.Server
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+func newGRPCServer(config serverConfig, tlsConfig *tls.Config, log *logp.Logger, publisher *batchPublisher) *grpcServer {
+	return &grpcServer{
+		config:    config,
+		tlsConfig: tlsConfig,
+		log:       log.With("protocol", "grpc"),
+		publisher: publisher,
+	}
+}
+
+// Start listens on the configured address and serves requests in the
+// background.
+func (s *grpcServer) Start() error {
+	l, err := net.Listen("tcp", s.config.Host)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(int(s.config.MaxMessageSize))}
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	s.server = grpc.NewServer(opts...)
+	collectorlogs.RegisterLogsServiceServer(s.server, &logsService{publisher: s.publisher})
+	collectortrace.RegisterTraceServiceServer(s.server, &traceService{publisher: s.publisher})
+
+	s.log.Infof("Started listening for OTLP/gRPC requests on %s", l.Addr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(l); err != nil {
+			s.log.Errorw("OTLP/gRPC server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listener and cancels all active requests.
+func (s *grpcServer) Stop() {
+	s.server.Stop()
+	s.wg.Wait()
+}
+
+type logsService struct {
+	collectorlogs.UnimplementedLogsServiceServer
+	publisher *batchPublisher
+}
+
+func (s *logsService) Export(ctx context.Context, req *collectorlogs.ExportLogsServiceRequest) (*collectorlogs.ExportLogsServiceResponse, error) {
+	if err := s.publisher.publish(ctx, logsToEvents(req, time.Now())); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &collectorlogs.ExportLogsServiceResponse{}, nil
+}
+
+type traceService struct {
+	collectortrace.UnimplementedTraceServiceServer
+	publisher *batchPublisher
+}
+
+func (s *traceService) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	if err := s.publisher.publish(ctx, tracesToEvents(req, time.Now())); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
@@ -0,0 +1,260 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const (
+	logsPath   = "/v1/logs"
+	tracesPath = "/v1/traces"
+
+	protobufContentType = "application/x-protobuf"
+	jsonContentType     = "application/json"
+
+	// retryAfter is the number of seconds clients are asked to wait before
+	// retrying a request that could not be acknowledged in time.
+	retryAfter = 10
+)
+
+var errMessageTooLarge = errors.New("request body too large")
+
+// httpServer receives OTLP/HTTP exports encoded as protobuf or JSON.
+type httpServer struct {
+	config    serverConfig
+	tlsConfig *tls.Config
+	log       *logp.Logger
+	publisher *batchPublisher
+
+	server   *http.Server
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+func newHTTPServer(config serverConfig, tlsConfig *tls.Config, log *logp.Logger, publisher *batchPublisher) *httpServer {
+	return &httpServer{
+		config:    config,
+		tlsConfig: tlsConfig,
+		log:       log.With("protocol", "http"),
+		publisher: publisher,
+	}
+}
+
+// Start listens on the configured address and serves requests in the
+// background.
+func (s *httpServer) Start() error {
+	l, err := net.Listen("tcp", s.config.Host)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		l = tls.NewListener(l, s.tlsConfig)
+	}
+	s.listener = l
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(logsPath, s.handleLogs)
+	mux.HandleFunc(tracesPath, s.handleTraces)
+	s.server = &http.Server{Handler: mux}
+
+	s.log.Infof("Started listening for OTLP/HTTP requests on %s", l.Addr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			s.log.Errorw("OTLP/HTTP server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listener and all active connections.
+func (s *httpServer) Stop() {
+	s.server.Close()
+	s.wg.Wait()
+}
+
+func (s *httpServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	req := &collectorlogs.ExportLogsServiceRequest{}
+	s.handle(w, r, req, &collectorlogs.ExportLogsServiceResponse{}, func(now time.Time) []beat.Event {
+		return logsToEvents(req, now)
+	})
+}
+
+func (s *httpServer) handleTraces(w http.ResponseWriter, r *http.Request) {
+	req := &collectortrace.ExportTraceServiceRequest{}
+	s.handle(w, r, req, &collectortrace.ExportTraceServiceResponse{}, func(now time.Time) []beat.Event {
+		return tracesToEvents(req, now)
+	})
+}
+
+func (s *httpServer) handle(w http.ResponseWriter, r *http.Request, req, resp proto.Message, toEvents func(time.Time) []beat.Event) {
+	if r.Method != http.MethodPost {
+		writeError(w, protobufContentType, http.StatusMethodNotAllowed, codes.Unimplemented, fmt.Errorf("only %v requests are allowed", http.MethodPost))
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != protobufContentType && contentType != jsonContentType {
+		writeError(w, protobufContentType, http.StatusUnsupportedMediaType, codes.InvalidArgument, fmt.Errorf("unsupported Content-Type %q", contentType))
+		return
+	}
+
+	body, err := readBody(r, int64(s.config.MaxMessageSize))
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errMessageTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, contentType, code, codes.InvalidArgument, err)
+		return
+	}
+
+	if err := unmarshal(contentType, body, req); err != nil {
+		writeError(w, contentType, http.StatusBadRequest, codes.InvalidArgument, err)
+		return
+	}
+
+	if err := s.publisher.publish(r.Context(), toEvents(time.Now())); err != nil {
+		s.log.Debugw("Failed to publish OTLP export", "error", err)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeError(w, contentType, http.StatusServiceUnavailable, codes.Unavailable, err)
+		return
+	}
+
+	writeMessage(w, contentType, http.StatusOK, resp)
+}
+
+// readBody reads the optionally gzip compressed request body. The size of the
+// compressed and of the decompressed body are limited to maxSize.
+func readBody(r *http.Request, maxSize int64) ([]byte, error) {
+	body := io.Reader(io.LimitReader(r.Body, maxSize+1))
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxSize+1)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errMessageTooLarge
+	}
+	return data, nil
+}
+
+func unmarshal(contentType string, data []byte, msg proto.Message) error {
+	if contentType == protobufContentType {
+		return proto.Unmarshal(data, msg)
+	}
+
+	data, err := hexIDsToBase64(data)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+}
+
+// hexIDsToBase64 converts the hex encoded trace and span IDs of an OTLP/JSON
+// message to the base64 encoding expected by the protobuf JSON mapping.
+func hexIDsToBase64(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err := convertIDs(v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func convertIDs(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && isIDField(key) {
+				id, err := hex.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("invalid %s: %w", key, err)
+				}
+				v[key] = base64.StdEncoding.EncodeToString(id)
+				continue
+			}
+			if err := convertIDs(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if err := convertIDs(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeMessage(w http.ResponseWriter, contentType string, code int, msg proto.Message) {
+	var (
+		data []byte
+		err  error
+	)
+	if contentType == jsonContentType {
+		data, err = protojson.Marshal(msg)
+	} else {
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, contentType string, code int, rpcCode codes.Code, err error) {
+	writeMessage(w, contentType, code, &status.Status{Code: int32(rpcCode), Message: err.Error()})
+}
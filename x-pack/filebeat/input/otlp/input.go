@@ -0,0 +1,132 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/filebeat/inputsource"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/feature"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/batchack"
+)
+
+const inputName = "otlp"
+
+type otlpInput struct {
+	config  config
+	httpTLS *tls.Config
+	grpcTLS *tls.Config
+}
+
+func Plugin() v2.Plugin {
+	return v2.Plugin{
+		Name:       inputName,
+		Stability:  feature.Experimental,
+		Deprecated: false,
+		Info:       "OpenTelemetry OTLP receiver",
+		Doc:        "The otlp input receives OTLP/HTTP and OTLP/gRPC log and trace exports",
+		Manager:    v2.ConfigureWith(configure),
+	}
+}
+
+func configure(cfg *common.Config) (v2.Input, error) {
+	conf := defaultConfig()
+	if err := cfg.Unpack(&conf); err != nil {
+		return nil, err
+	}
+
+	return newOTLPInput(conf)
+}
+
+func newOTLPInput(config config) (*otlpInput, error) {
+	httpTLS, err := buildTLSConfig(config.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.ssl configuration: %w", err)
+	}
+	grpcTLS, err := buildTLSConfig(config.GRPC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc.ssl configuration: %w", err)
+	}
+
+	return &otlpInput{
+		config:  config,
+		httpTLS: httpTLS,
+		grpcTLS: grpcTLS,
+	}, nil
+}
+
+func buildTLSConfig(config serverConfig) (*tls.Config, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	builder, err := tlscommon.LoadTLSServerConfig(config.TLS)
+	if err != nil || builder == nil {
+		return nil, err
+	}
+	return builder.BuildServerConfig(config.Host), nil
+}
+
+func (*otlpInput) Name() string { return inputName }
+
+func (in *otlpInput) Test(_ v2.TestContext) error {
+	for _, server := range []serverConfig{in.config.HTTP, in.config.GRPC} {
+		if !server.Enabled {
+			continue
+		}
+		l, err := net.Listen("tcp", server.Host)
+		if err != nil {
+			return err
+		}
+		l.Close()
+	}
+	return nil
+}
+
+func (in *otlpInput) Run(ctx v2.Context, pipeline beat.PipelineConnector) error {
+	log := ctx.Logger
+
+	client, err := pipeline.ConnectWith(beat.ClientConfig{
+		PublishMode: beat.DefaultGuarantees,
+		ACKHandler:  batchack.NewACKHandler(),
+
+		// configure pipeline to disconnect input on stop signal.
+		CloseRef: ctx.Cancelation,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	publisher := &batchPublisher{client: client, ackTimeout: in.config.ACKTimeout}
+
+	var servers []inputsource.Network
+	if in.config.HTTP.Enabled {
+		servers = append(servers, newHTTPServer(in.config.HTTP, in.httpTLS, log, publisher))
+	}
+	if in.config.GRPC.Enabled {
+		servers = append(servers, newGRPCServer(in.config.GRPC, in.grpcTLS, log, publisher))
+	}
+
+	for i, server := range servers {
+		if err := server.Start(); err != nil {
+			for _, started := range servers[:i] {
+				started.Stop()
+			}
+			return fmt.Errorf("failed to start OTLP server: %w", err)
+		}
+	}
+
+	<-ctx.Cancelation.Done()
+	for _, server := range servers {
+		server.Stop()
+	}
+	return nil
+}
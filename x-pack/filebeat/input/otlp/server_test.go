@@ -0,0 +1,179 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/x-pack/filebeat/input/internal/batchack"
+)
+
+// ackingPublisher acknowledges all events asynchronously unless drop is set.
+type ackingPublisher struct {
+	mu     sync.Mutex
+	events []beat.Event
+	drop   bool
+}
+
+func (p *ackingPublisher) Publish(event beat.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	if !p.drop {
+		go event.Private.(*batchack.Tracker).ACK()
+	}
+}
+
+func (p *ackingPublisher) published() []beat.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]beat.Event(nil), p.events...)
+}
+
+func startHTTPServer(t *testing.T, pub *ackingPublisher) string {
+	t.Helper()
+	cfg := defaultConfig().HTTP
+	cfg.Host = "127.0.0.1:0"
+	s := newHTTPServer(cfg, nil, logp.NewLogger("otlp_test"), &batchPublisher{client: pub, ackTimeout: 100 * time.Millisecond})
+	require.NoError(t, s.Start())
+	t.Cleanup(s.Stop)
+	return "http://" + s.listener.Addr().String()
+}
+
+func TestHTTPServer(t *testing.T) {
+	t.Run("protobuf logs", func(t *testing.T) {
+		pub := &ackingPublisher{}
+		url := startHTTPServer(t, pub)
+
+		data, err := proto.Marshal(testLogsRequest())
+		require.NoError(t, err)
+		resp, err := http.Post(url+logsPath, protobufContentType, bytes.NewReader(data))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, protobufContentType, resp.Header.Get("Content-Type"))
+		require.Len(t, pub.published(), 1)
+	})
+
+	t.Run("gzip compressed protobuf traces", func(t *testing.T) {
+		pub := &ackingPublisher{}
+		url := startHTTPServer(t, pub)
+
+		data, err := proto.Marshal(testTracesRequest())
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+
+		req, err := http.NewRequest(http.MethodPost, url+tracesPath, &buf)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", protobufContentType)
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, pub.published(), 1)
+	})
+
+	t.Run("json with hex encoded ids", func(t *testing.T) {
+		pub := &ackingPublisher{}
+		url := startHTTPServer(t, pub)
+
+		body := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},
+			"scopeSpans":[{"spans":[{"traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174",
+			"name":"GET /cart","kind":2,"startTimeUnixNano":"1654077600000000000","endTimeUnixNano":"1654077600150000000"}]}]}]}`
+		resp, err := http.Post(url+tracesPath, jsonContentType, strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, jsonContentType, resp.Header.Get("Content-Type"))
+		events := pub.published()
+		require.Len(t, events, 1)
+		traceID, _ := events[0].Fields.GetValue("trace.id")
+		assert.Equal(t, "5b8efff798038103d269b633813fc60c", traceID)
+		duration, _ := events[0].Fields.GetValue("event.duration")
+		assert.Equal(t, int64(150*time.Millisecond), duration)
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		url := startHTTPServer(t, &ackingPublisher{})
+		resp, err := http.Post(url+logsPath, "text/plain", strings.NewReader("hello"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+
+	t.Run("retry if events are not acknowledged", func(t *testing.T) {
+		url := startHTTPServer(t, &ackingPublisher{drop: true})
+
+		data, err := proto.Marshal(testLogsRequest())
+		require.NoError(t, err)
+		resp, err := http.Post(url+logsPath, protobufContentType, bytes.NewReader(data))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	})
+}
+
+func TestGRPCServer(t *testing.T) {
+	startGRPCServer := func(t *testing.T, pub *ackingPublisher) *grpc.ClientConn {
+		cfg := defaultConfig().GRPC
+		cfg.Host = "127.0.0.1:0"
+		s := newGRPCServer(cfg, nil, logp.NewLogger("otlp_test"), &batchPublisher{client: pub, ackTimeout: 100 * time.Millisecond})
+		require.NoError(t, s.Start())
+		t.Cleanup(s.Stop)
+
+		conn, err := grpc.Dial(s.listener.Addr().String(), grpc.WithInsecure())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	t.Run("logs and traces", func(t *testing.T) {
+		pub := &ackingPublisher{}
+		conn := startGRPCServer(t, pub)
+
+		_, err := collectorlogs.NewLogsServiceClient(conn).Export(context.Background(), testLogsRequest())
+		require.NoError(t, err)
+		_, err = collectortrace.NewTraceServiceClient(conn).Export(context.Background(), testTracesRequest())
+		require.NoError(t, err)
+		assert.Len(t, pub.published(), 2)
+	})
+
+	t.Run("unavailable if events are not acknowledged", func(t *testing.T) {
+		conn := startGRPCServer(t, &ackingPublisher{drop: true})
+
+		_, err := collectorlogs.NewLogsServiceClient(conn).Export(context.Background(), testLogsRequest())
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+}
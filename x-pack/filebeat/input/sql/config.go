@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+type config struct {
+	Driver  string        `config:"driver" validate:"required"`
+	DSN     string        `config:"dsn" validate:"required"`
+	Query   string        `config:"sql_query" validate:"required"`
+	Cursor  cursorConfig  `config:"cursor"`
+	Period  time.Duration `config:"period" validate:"positive,nonzero"`
+	Timeout time.Duration `config:"timeout" validate:"positive,nonzero"`
+}
+
+type cursorConfig struct {
+	Column  string     `config:"column"`
+	Type    cursorType `config:"type"`
+	Default string     `config:"default"`
+}
+
+// driverName returns the name of the database/sql driver for the configured
+// driver, resolving the aliases supported by the sql metricbeat module.
+func driverName(driver string) string {
+	switch driver {
+	case "postgresql", "cockroach", "cockroachdb":
+		return "postgres"
+	}
+	return driver
+}
+
+// cursorPlaceholder matches the placeholder for the cursor value in queries.
+var cursorPlaceholder = regexp.MustCompile(`:cursor\b`)
+
+func defaultConfig() config {
+	return config{
+		Cursor: cursorConfig{
+			Type: cursorTypeInteger,
+		},
+		Period:  time.Minute,
+		Timeout: 30 * time.Second,
+	}
+}
+
+func (c *config) Validate() error {
+	if !isRegistered(driverName(c.Driver)) {
+		return fmt.Errorf("unsupported driver '%s'", c.Driver)
+	}
+	if c.Cursor.Column == "" {
+		return errors.New("cursor.column must be set")
+	}
+	if !cursorPlaceholder.MatchString(c.Query) {
+		return errors.New("sql_query must use the :cursor placeholder to select rows after the cursor")
+	}
+	if _, err := c.Cursor.initial(); err != nil {
+		return fmt.Errorf("invalid cursor.default: %w", err)
+	}
+	return nil
+}
+
+func isRegistered(driver string) bool {
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			return true
+		}
+	}
+	return false
+}
+
+// initial returns the cursor value used if no cursor is stored in the registry.
+func (c cursorConfig) initial() (interface{}, error) {
+	if c.Default == "" {
+		return c.Type.zero(), nil
+	}
+	return c.Type.parse(c.Default)
+}
@@ -0,0 +1,129 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sql
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// cursorType is the type of the column tracked by the cursor.
+type cursorType uint8
+
+const (
+	cursorTypeInteger cursorType = iota + 1
+	cursorTypeTimestamp
+)
+
+var cursorTypes = map[string]cursorType{
+	"integer":   cursorTypeInteger,
+	"timestamp": cursorTypeTimestamp,
+}
+
+// state is the cursor stored in the registry.
+type state struct {
+	Value string `struct:"value"`
+}
+
+func (t *cursorType) Unpack(value string) error {
+	ct, ok := cursorTypes[value]
+	if !ok {
+		return fmt.Errorf("invalid cursor type '%s'", value)
+	}
+	*t = ct
+	return nil
+}
+
+func (t cursorType) zero() interface{} {
+	if t == cursorTypeTimestamp {
+		return time.Unix(0, 0).UTC()
+	}
+	return int64(0)
+}
+
+// parse parses a cursor value from its string representation in the
+// configuration or the registry.
+func (t cursorType) parse(s string) (interface{}, error) {
+	if t == cursorTypeTimestamp {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// format returns the string representation of a cursor value.
+func (t cursorType) format(v interface{}) string {
+	if t == cursorTypeTimestamp {
+		return v.(time.Time).Format(time.RFC3339Nano)
+	}
+	return strconv.FormatInt(v.(int64), 10)
+}
+
+// fromColumn converts the value of the cursor column in a row to a cursor
+// value.
+func (t cursorType) fromColumn(v interface{}) (interface{}, error) {
+	switch t {
+	case cursorTypeTimestamp:
+		switch v := v.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			return t.parse(v)
+		}
+	default:
+		switch v := v.(type) {
+		case int64:
+			return v, nil
+		case uint64:
+			return int64(v), nil
+		case float64:
+			return int64(v), nil
+		case string:
+			return t.parse(v)
+		}
+	}
+	return nil, fmt.Errorf("unexpected value %v of type %T", v, v)
+}
+
+// less reports whether the cursor value a is before b.
+func (t cursorType) less(a, b interface{}) bool {
+	if t == cursorTypeTimestamp {
+		return a.(time.Time).Before(b.(time.Time))
+	}
+	return a.(int64) < b.(int64)
+}
+
+// bindCursor replaces the :cursor placeholders in the query with the bind
+// parameter syntax of the driver and returns the arguments for the query.
+func bindCursor(driver, query string, value interface{}) (string, []interface{}) {
+	switch driverName(driver) {
+	case "postgres":
+		return cursorPlaceholder.ReplaceAllLiteralString(query, "$1"), []interface{}{value}
+	case "mssql", "sqlserver":
+		return cursorPlaceholder.ReplaceAllLiteralString(query, "@p1"), []interface{}{value}
+	default:
+		n := len(cursorPlaceholder.FindAllStringIndex(query, -1))
+		args := make([]interface{}, n)
+		for i := range args {
+			args[i] = value
+		}
+		return cursorPlaceholder.ReplaceAllLiteralString(query, "?"), args
+	}
+}
+
+// sanitizeDSN returns the address of the database in a data source name,
+// without credentials.
+func sanitizeDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && len(u.Host) > 0 {
+		return u.Host
+	}
+	if config, err := mysql.ParseDSN(dsn); err == nil && config.Addr != "" {
+		return config.Addr
+	}
+	return "(redacted)"
+}
@@ -0,0 +1,224 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+
+	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/feature"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/metricbeat/helper/sql"
+	"github.com/elastic/go-concert/ctxtool"
+	"github.com/elastic/go-concert/timed"
+)
+
+const inputName = "sql"
+
+type sqlInput struct {
+	config config
+}
+
+// source identifies the rows of a query in a database. The query is part of
+// the name, so that inputs running different queries on the same database
+// keep separate cursors.
+type source struct {
+	driver string
+	host   string
+	query  string
+}
+
+func Plugin(log *logp.Logger, store cursor.StateStore) v2.Plugin {
+	return v2.Plugin{
+		Name:       inputName,
+		Stability:  feature.Experimental,
+		Deprecated: false,
+		Info:       "SQL query",
+		Doc:        "Collect rows from databases by running a SQL query periodically",
+		Manager: &cursor.InputManager{
+			Logger:     log,
+			StateStore: store,
+			Type:       inputName,
+			Configure:  configure,
+		},
+	}
+}
+
+func configure(cfg *common.Config) ([]cursor.Source, cursor.Input, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, nil, err
+	}
+
+	src := &source{
+		driver: config.Driver,
+		host:   sanitizeDSN(config.DSN),
+		query:  config.Query,
+	}
+	return []cursor.Source{src}, &sqlInput{config: config}, nil
+}
+
+func (s *source) Name() string {
+	sum := sha256.Sum256([]byte(s.query))
+	return s.driver + "::" + s.host + "::" + hex.EncodeToString(sum[:8])
+}
+
+func (inp *sqlInput) Name() string { return inputName }
+
+func (inp *sqlInput) Test(src cursor.Source, ctx v2.TestContext) error {
+	db, err := sql.NewDBClient(inp.config.Driver, inp.config.DSN, ctx.Logger)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s database: %w", inp.config.Driver, err)
+	}
+	return db.Close()
+}
+
+func (inp *sqlInput) Run(
+	ctx v2.Context,
+	src cursor.Source,
+	cursor cursor.Cursor,
+	publisher cursor.Publisher,
+) error {
+	log := ctx.Logger.With("host", src.(*source).host)
+
+	p := &poller{
+		config:    inp.config,
+		log:       log,
+		publisher: publisher,
+		cursor:    initCursor(log, inp.config.Cursor, cursor),
+	}
+	defer p.close()
+
+	pollCtx := ctxtool.FromCanceller(ctx.Cancelation)
+	if err := p.poll(pollCtx); err != nil {
+		return err
+	}
+	err := timed.Periodic(ctx.Cancelation, inp.config.Period, func() error {
+		return p.poll(pollCtx)
+	})
+	if ctx.Cancelation.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// initCursor returns the cursor value stored in the registry, or the initial
+// value configured for the cursor if no valid value is stored.
+func initCursor(log *logp.Logger, config cursorConfig, c cursor.Cursor) interface{} {
+	initial, _ := config.initial()
+	if c.IsNew() {
+		return initial
+	}
+
+	var st state
+	if err := c.Unpack(&st); err != nil {
+		log.Errorf("Reset sql cursor. Failed to read cursor from registry: %v", err)
+		return initial
+	}
+	value, err := config.Type.parse(st.Value)
+	if err != nil {
+		log.Errorf("Reset sql cursor. Invalid cursor '%s' in registry: %v", st.Value, err)
+		return initial
+	}
+	return value
+}
+
+// poller runs the query and publishes the rows after the cursor. The cursor
+// value is updated when a row is published, while the registry is only
+// updated after the events have been ACKed.
+type poller struct {
+	config    config
+	log       *logp.Logger
+	publisher cursor.Publisher
+	db        *sql.DbClient
+	cursor    interface{}
+}
+
+func (p *poller) poll(ctx context.Context) error {
+	if p.db == nil {
+		db, err := sql.NewDBClient(p.config.Driver, p.config.DSN, p.log)
+		if err != nil {
+			p.log.Errorf("Failed to connect to database, retrying in %v: %v", p.config.Period, err)
+			return nil
+		}
+		p.db = db
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	query, args := bindCursor(p.config.Driver, p.config.Query, p.cursor)
+	rows, err := p.db.FetchRows(queryCtx, query, args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.log.Errorf("Failed to run query, retrying in %v: %v", p.config.Period, err)
+		return nil
+	}
+
+	for _, row := range rows {
+		if err := p.publish(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *poller) publish(row common.MapStr) error {
+	cursorType := p.config.Cursor.Type
+
+	column, err := row.GetValue(p.config.Cursor.Column)
+	if err != nil {
+		return fmt.Errorf("cursor column '%s' is missing in the query result", p.config.Cursor.Column)
+	}
+	value, err := cursorType.fromColumn(column)
+	if err != nil {
+		return fmt.Errorf("invalid value in cursor column '%s': %w", p.config.Cursor.Column, err)
+	}
+
+	if cursorType.less(value, p.cursor) {
+		p.log.Warnf("Row with cursor %s is before the current cursor %s, order the query by the cursor column.",
+			cursorType.format(value), cursorType.format(p.cursor))
+	} else {
+		p.cursor = value
+	}
+
+	timestamp := time.Now()
+	if t, ok := value.(time.Time); ok {
+		timestamp = t
+	}
+
+	event := beat.Event{
+		Timestamp: timestamp,
+		Fields: common.MapStr{
+			"sql": common.MapStr{
+				"driver": p.config.Driver,
+				"row":    row,
+			},
+		},
+	}
+	return p.publisher.Publish(event, state{Value: cursorType.format(p.cursor)})
+}
+
+func (p *poller) close() {
+	if p.db == nil {
+		return
+	}
+	if err := p.db.Close(); err != nil {
+		p.log.Errorf("Failed to close database connection: %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/storetest"
+)
+
+type testStateStore struct {
+	*statestore.Store
+}
+
+func (s testStateStore) Access() (*statestore.Store, error) { return s.Store, nil }
+func (s testStateStore) CleanupInterval() time.Duration     { return time.Hour }
+
+func newTestStore(t *testing.T) testStateStore {
+	store, err := statestore.NewRegistry(storetest.NewMemoryStoreBackend()).Get("test")
+	require.NoError(t, err)
+	return testStateStore{Store: store}
+}
+
+// storedCursor returns the cursor value persisted in the registry.
+func (s testStateStore) storedCursor(t *testing.T, src *source) string {
+	var entry struct {
+		Cursor *state `struct:"cursor"`
+	}
+	key := inputName + "::" + src.Name()
+	if has, err := s.Has(key); err != nil || !has {
+		return ""
+	}
+	require.NoError(t, s.Get(key, &entry))
+	if entry.Cursor == nil {
+		return ""
+	}
+	return entry.Cursor.Value
+}
+
+// testRun is an input running with a publishing pipeline that records
+// events without ACKing them.
+type testRun struct {
+	events chan beat.Event
+	acker  beat.ACKer
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func runInput(t *testing.T, store testStateStore, settings common.MapStr) *testRun {
+	manager := Plugin(logp.NewLogger("test"), store).Manager
+	inp, err := manager.Create(common.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+
+	run := &testRun{events: make(chan beat.Event, 100)}
+	connected := make(chan struct{})
+	pipeline := &pubtest.FakeConnector{
+		ConnectFunc: func(cfg beat.ClientConfig) (beat.Client, error) {
+			run.acker = cfg.ACKHandler
+			close(connected)
+			return &pubtest.FakeClient{
+				PublishFunc: func(event beat.Event) {
+					run.acker.AddEvent(event, true)
+					run.events <- event
+				},
+			}, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run.cancel = cancel
+	run.wg.Add(1)
+	go func() {
+		defer run.wg.Done()
+		assert.NoError(t, inp.Run(v2.Context{
+			ID:          "test",
+			Logger:      logp.NewLogger("test"),
+			Cancelation: ctx,
+		}, pipeline))
+	}()
+	<-connected
+	return run
+}
+
+func (r *testRun) stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *testRun) next(t *testing.T) beat.Event {
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for event")
+		return beat.Event{}
+	}
+}
+
+func (r *testRun) expectNoEvent(t *testing.T) {
+	select {
+	case event := <-r.events:
+		t.Fatalf("unexpected event %v", event.Fields)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func openTestDB(t *testing.T) (*dbsql.DB, string) {
+	dsn := filepath.Join(t.TempDir(), "audit.db")
+	db, err := dbsql.Open("sqlite3", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE audit (
+		id INTEGER PRIMARY KEY,
+		user_name TEXT,
+		amount DECIMAL(10,2),
+		success BOOLEAN,
+		created DATETIME
+	)`)
+	require.NoError(t, err)
+	return db, dsn
+}
+
+func insertAuditRow(t *testing.T, db *dbsql.DB, id int, user string, created time.Time) {
+	_, err := db.Exec(`INSERT INTO audit (id, user_name, amount, success, created) VALUES (?, ?, ?, ?, ?)`,
+		id, user, 12.5, true, created)
+	require.NoError(t, err)
+}
+
+func TestInputIntegerCursor(t *testing.T) {
+	db, dsn := openTestDB(t)
+	created := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		insertAuditRow(t, db, i, "user"+string(rune('0'+i)), created)
+	}
+
+	settings := common.MapStr{
+		"driver":        "sqlite3",
+		"dsn":           dsn,
+		"sql_query":     "SELECT * FROM audit WHERE id > :cursor ORDER BY id",
+		"cursor.column": "id",
+		"period":        "50ms",
+	}
+	src := &source{driver: "sqlite3", host: sanitizeDSN(dsn), query: settings["sql_query"].(string)}
+	store := newTestStore(t)
+
+	run := runInput(t, store, settings)
+	for i := 1; i <= 3; i++ {
+		event := run.next(t)
+		row, err := event.GetValue("sql.row")
+		require.NoError(t, err)
+		assert.Equal(t, common.MapStr{
+			"id":        int64(i),
+			"user_name": "user" + string(rune('0'+i)),
+			"amount":    12.5,
+			"success":   true,
+			"created":   created,
+		}, row)
+		driver, _ := event.GetValue("sql.driver")
+		assert.Equal(t, "sqlite3", driver)
+	}
+
+	// The cursor only advances in the registry when events are ACKed.
+	assert.Equal(t, "", store.storedCursor(t, src))
+	run.acker.ACKEvents(2)
+	assert.Equal(t, "2", store.storedCursor(t, src))
+	run.acker.ACKEvents(1)
+	assert.Equal(t, "3", store.storedCursor(t, src))
+
+	// Rows are not published again while new rows are picked up.
+	insertAuditRow(t, db, 4, "user4", created)
+	event := run.next(t)
+	id, _ := event.GetValue("sql.row.id")
+	assert.Equal(t, int64(4), id)
+	run.expectNoEvent(t)
+	run.stop()
+
+	// The row that was not ACKed is published again after a restart.
+	assert.Equal(t, "3", store.storedCursor(t, src))
+	run = runInput(t, store, settings)
+	defer run.stop()
+	event = run.next(t)
+	id, _ = event.GetValue("sql.row.id")
+	assert.Equal(t, int64(4), id)
+	run.expectNoEvent(t)
+}
+
+func TestInputTimestampCursor(t *testing.T) {
+	db, dsn := openTestDB(t)
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		insertAuditRow(t, db, i, "user", start.Add(time.Duration(i)*time.Hour))
+	}
+
+	store := newTestStore(t)
+	run := runInput(t, store, common.MapStr{
+		"driver":         "sqlite3",
+		"dsn":            dsn,
+		"sql_query":      "SELECT id, created FROM audit WHERE created > :cursor ORDER BY created",
+		"cursor.column":  "created",
+		"cursor.type":    "timestamp",
+		"cursor.default": start.Add(90 * time.Minute).Format(time.RFC3339),
+		"period":         "50ms",
+	})
+	defer run.stop()
+
+	for i := 2; i <= 3; i++ {
+		event := run.next(t)
+		id, _ := event.GetValue("sql.row.id")
+		assert.Equal(t, int64(i), id)
+		assert.Equal(t, start.Add(time.Duration(i)*time.Hour), event.Timestamp)
+	}
+	run.expectNoEvent(t)
+}
+
+func TestInputTest(t *testing.T) {
+	_, dsn := openTestDB(t)
+	manager := Plugin(logp.NewLogger("test"), newTestStore(t)).Manager
+	inp, err := manager.Create(common.MustNewConfigFrom(common.MapStr{
+		"driver":        "sqlite3",
+		"dsn":           dsn,
+		"sql_query":     "SELECT * FROM audit WHERE id > :cursor",
+		"cursor.column": "id",
+	}))
+	require.NoError(t, err)
+	assert.NoError(t, inp.Test(v2.TestContext{Logger: logp.NewLogger("test"), Cancelation: context.Background()}))
+}
@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type config struct {
+	Fields        []string          `config:"fields"`
+	KeyField      string            `config:"key_field"`
+	IgnoreMissing bool              `config:"ignore_missing"`
+	TTL           time.Duration     `config:"ttl" validate:"positive,nonzero"`
+	MaxEntries    int               `config:"max_entries" validate:"min=1"`
+	Action        action            `config:"action"`
+	Tag           string            `config:"tag"`
+	Persistence   persistenceConfig `config:"persistence"`
+}
+
+type persistenceConfig struct {
+	Enabled bool   `config:"enabled"`
+	Name    string `config:"name"`
+	Path    string `config:"path"`
+}
+
+func defaultConfig() config {
+	return config{
+		TTL:        10 * time.Minute,
+		MaxEntries: 100000,
+		Action:     actionDrop,
+		Tag:        "duplicate",
+		Persistence: persistenceConfig{
+			Name: "dedupe",
+		},
+	}
+}
+
+func (c *config) Validate() error {
+	if len(c.Fields) == 0 && c.KeyField == "" {
+		return errors.New("one of fields or key_field must be set")
+	}
+	if len(c.Fields) > 0 && c.KeyField != "" {
+		return errors.New("fields and key_field can not be used together")
+	}
+	if c.Action == actionTag && c.Tag == "" {
+		return errors.New("tag must be set when the action is tag")
+	}
+	if c.Persistence.Enabled && c.Persistence.Name == "" {
+		return errors.New("persistence.name must be set when persistence is enabled")
+	}
+	return nil
+}
+
+// action is the action applied to duplicate events.
+type action uint8
+
+const (
+	actionDrop action = iota
+	actionTag
+)
+
+func (a *action) Unpack(v string) error {
+	switch strings.ToLower(v) {
+	case "drop":
+		*a = actionDrop
+	case "tag":
+		*a = actionTag
+	default:
+		return fmt.Errorf("invalid action %q, must be drop or tag", v)
+	}
+	return nil
+}
+
+func (a action) String() string {
+	if a == actionTag {
+		return "tag"
+	}
+	return "drop"
+}
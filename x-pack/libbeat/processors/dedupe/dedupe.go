@@ -0,0 +1,146 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dedupe
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+const processorName = "dedupe"
+const logName = "processor." + processorName
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type dedupe struct {
+	config config
+	fields []string
+	clock  clockwork.Clock
+	store  *store
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// New constructs a new dedupe processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the dedupe configuration")
+	}
+
+	// The fields are sorted, so the same fields produce the same fingerprint
+	// regardless of the configured order.
+	fields := common.MakeStringSet(config.Fields...).ToSlice()
+	store, err := acquireStore(config, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dedupe{
+		config: config,
+		fields: fields,
+		clock:  clockwork.NewRealClock(),
+		store:  store,
+	}, nil
+}
+
+// Run drops or tags the event if an event with the same fingerprint was seen
+// within the TTL.
+func (p *dedupe) Run(event *beat.Event) (*beat.Event, error) {
+	key, err := p.fingerprint(event)
+	if err != nil {
+		return event, err
+	}
+	if key == "" {
+		return event, nil
+	}
+
+	if !p.store.seen(key, p.clock.Now()) {
+		return event, nil
+	}
+	if p.config.Action == actionDrop {
+		return nil, nil
+	}
+
+	if event.Fields == nil {
+		event.Fields = common.MapStr{}
+	}
+	if err := common.AddTags(event.Fields, []string{p.config.Tag}); err != nil {
+		return event, errors.Wrap(err, "failed to tag duplicate event")
+	}
+	return event, nil
+}
+
+// fingerprint returns the SHA-256 hash of the key field or of the configured
+// fields. It returns an empty key if the fields are missing and missing fields
+// are ignored.
+func (p *dedupe) fingerprint(event *beat.Event) (string, error) {
+	h := sha256.New()
+
+	if p.config.KeyField != "" {
+		v, err := event.GetValue(p.config.KeyField)
+		if err != nil {
+			if p.config.IgnoreMissing {
+				return "", nil
+			}
+			return "", errors.Wrapf(err, "failed to get key field %v", p.config.KeyField)
+		}
+		fmt.Fprintf(h, "%v", v)
+		return string(h.Sum(nil)), nil
+	}
+
+	found := 0
+	for _, k := range p.fields {
+		v, err := event.GetValue(k)
+		if err != nil {
+			if p.config.IgnoreMissing {
+				continue
+			}
+			return "", errors.Wrapf(err, "failed to get field %v", k)
+		}
+		if t, ok := v.(time.Time); ok {
+			// Ensure we consistently hash times in UTC.
+			v = t.UTC()
+		}
+		fmt.Fprintf(h, "|%v|%v", k, v)
+		found++
+	}
+	if found == 0 {
+		return "", nil
+	}
+	io.WriteString(h, "|")
+	return string(h.Sum(nil)), nil
+}
+
+// Close releases the fingerprint set, closing it when no other processor
+// uses it.
+func (p *dedupe) Close() error {
+	p.closeOnce.Do(func() {
+		p.closeErr = p.store.release()
+	})
+	return p.closeErr
+}
+
+func (p *dedupe) String() string {
+	key := fmt.Sprintf("fields=%v", p.fields)
+	if p.config.KeyField != "" {
+		key = "key_field=" + p.config.KeyField
+	}
+	return fmt.Sprintf("%v=[%v, ttl=%v, max_entries=%v, action=%v, persistent=%v]",
+		processorName, key, p.config.TTL, p.config.MaxEntries, p.config.Action, p.config.Persistence.Enabled)
+}
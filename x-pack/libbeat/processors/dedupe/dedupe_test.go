@@ -0,0 +1,221 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dedupe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/processors/processortest"
+)
+
+func newTestDedupe(t *testing.T, cfg common.MapStr, clock clockwork.Clock) *dedupe {
+	t.Helper()
+	d := processortest.New(t, New, cfg).(*dedupe)
+	d.clock = clock
+	return d
+}
+
+func TestDedupeDrop(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	p := newTestDedupe(t, common.MapStr{
+		"fields": []string{"message", "log.file.path"},
+		"ttl":    "1m",
+	}, clock)
+
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"message": "a", "log": common.MapStr{"file": common.MapStr{"path": "/x"}}}))
+	assert.Nil(t, processortest.Run(t, p, common.MapStr{"message": "a", "log": common.MapStr{"file": common.MapStr{"path": "/x"}}}))
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"message": "a", "log": common.MapStr{"file": common.MapStr{"path": "/y"}}}))
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"message": "b", "log": common.MapStr{"file": common.MapStr{"path": "/x"}}}))
+
+	assert.Equal(t, uint64(1), p.store.metrics.hits.Get())
+	assert.Equal(t, uint64(3), p.store.metrics.misses.Get())
+	assert.Equal(t, int64(3), p.store.metrics.entries.Get())
+
+	clock.Advance(time.Minute)
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"message": "a", "log": common.MapStr{"file": common.MapStr{"path": "/x"}}}))
+	assert.Equal(t, uint64(3), p.store.metrics.expired.Get())
+	assert.Equal(t, int64(1), p.store.metrics.entries.Get())
+}
+
+func TestDedupeTag(t *testing.T) {
+	p := newTestDedupe(t, common.MapStr{
+		"key_field": "event.id",
+		"action":    "tag",
+	}, clockwork.NewFakeClock())
+
+	event := processortest.Run(t, p, common.MapStr{"event": common.MapStr{"id": "1"}})
+	assert.NotContains(t, event.Fields, "tags")
+
+	event = processortest.Run(t, p, common.MapStr{"event": common.MapStr{"id": "1"}, "tags": []string{"vehicle"}})
+	assert.Equal(t, []string{"vehicle", "duplicate"}, event.Fields["tags"])
+}
+
+func TestDedupeMissingFields(t *testing.T) {
+	p := newTestDedupe(t, common.MapStr{
+		"key_field": "event.id",
+	}, clockwork.NewFakeClock())
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{"message": "a"}})
+	assert.Error(t, err)
+	assert.NotNil(t, event)
+
+	p = newTestDedupe(t, common.MapStr{
+		"fields":         []string{"a", "b"},
+		"ignore_missing": true,
+	}, clockwork.NewFakeClock())
+
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"message": "a"}))
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"message": "a"}), "events without any of the fields are never duplicates")
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"a": 1}))
+	assert.Nil(t, processortest.Run(t, p, common.MapStr{"a": 1, "message": "b"}))
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"a": 1, "b": 1}))
+}
+
+func TestDedupeMaxEntries(t *testing.T) {
+	p := newTestDedupe(t, common.MapStr{
+		"key_field":   "id",
+		"max_entries": 2,
+	}, clockwork.NewFakeClock())
+
+	for _, id := range []int{1, 2, 3} {
+		assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": id}))
+	}
+	assert.Equal(t, uint64(1), p.store.metrics.evictions.Get())
+	assert.Len(t, p.store.entries, 2)
+
+	assert.Nil(t, processortest.Run(t, p, common.MapStr{"id": 3}))
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": 1}), "evicted keys are forgotten")
+}
+
+func TestDedupePersistence(t *testing.T) {
+	logp.TestingSetup()
+
+	clock := clockwork.NewFakeClock()
+	cfg := common.MapStr{
+		"key_field": "id",
+		"ttl":       "1h",
+		"persistence": common.MapStr{
+			"enabled": true,
+			"name":    "test",
+			"path":    t.TempDir(),
+		},
+	}
+
+	p := newTestDedupe(t, cfg, clock)
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": "a"}))
+	require.NoError(t, p.Close())
+
+	p = newTestDedupe(t, cfg, clock)
+	assert.Nil(t, processortest.Run(t, p, common.MapStr{"id": "a"}), "fingerprints must survive restarts")
+	assert.Equal(t, uint64(1), p.store.metrics.hits.Get())
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": "b"}))
+
+	clock.Advance(time.Hour)
+	require.NoError(t, p.Close())
+
+	p = newTestDedupe(t, cfg, clock)
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": "a"}), "expired fingerprints must be ignored")
+}
+
+func TestDedupePersistenceExpireOrder(t *testing.T) {
+	logp.TestingSetup()
+
+	clock := clockwork.NewFakeClock()
+	cfg := common.MapStr{
+		"key_field": "id",
+		"ttl":       "1h",
+		"persistence": common.MapStr{
+			"enabled": true,
+			"name":    "test",
+			"path":    t.TempDir(),
+		},
+	}
+
+	p := newTestDedupe(t, cfg, clock)
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": "a"}))
+	require.NoError(t, p.Close())
+
+	clock.Advance(30 * time.Minute)
+	p = newTestDedupe(t, cfg, clock)
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": "b"}))
+	assert.Nil(t, processortest.Run(t, p, common.MapStr{"id": "a"}), "fingerprints must survive restarts")
+
+	// The fingerprint restored from the cache expires before the one added
+	// to the set earlier.
+	clock.Advance(30 * time.Minute)
+	assert.NotNil(t, processortest.Run(t, p, common.MapStr{"id": "c"}))
+	assert.Equal(t, uint64(1), p.store.metrics.expired.Get())
+	assert.Equal(t, int64(2), p.store.metrics.entries.Get())
+	assert.Nil(t, processortest.Run(t, p, common.MapStr{"id": "b"}))
+}
+
+func TestDedupeSharedStore(t *testing.T) {
+	logp.TestingSetup()
+
+	clock := clockwork.NewFakeClock()
+	for name, cfg := range map[string]common.MapStr{
+		"memory": {"key_field": "id"},
+		"persistent": {
+			"key_field": "id",
+			"persistence": common.MapStr{
+				"enabled": true,
+				"path":    t.TempDir(),
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := newTestDedupe(t, cfg, clock)
+			b := newTestDedupe(t, cfg, clock)
+			assert.NotNil(t, processortest.Run(t, a, common.MapStr{"id": "x"}))
+			assert.Nil(t, processortest.Run(t, b, common.MapStr{"id": "x"}), "processors with the same config must share fingerprints")
+
+			other := newTestDedupe(t, common.MapStr{"key_field": "id", "ttl": "1h"}, clock)
+			assert.NotNil(t, processortest.Run(t, other, common.MapStr{"id": "x"}))
+
+			require.NoError(t, a.Close())
+			assert.Nil(t, processortest.Run(t, b, common.MapStr{"id": "x"}), "the store must stay open while it is used")
+			require.NoError(t, b.Close())
+		})
+	}
+
+	cfg := common.MapStr{
+		"key_field": "id",
+		"persistence": common.MapStr{
+			"enabled": true,
+			"path":    t.TempDir(),
+		},
+	}
+	newTestDedupe(t, cfg, clock)
+	cfg["ttl"] = "1h"
+	_, err := New(common.MustNewConfigFrom(cfg))
+	assert.Error(t, err, "persistent caches can't be shared with a different ttl")
+}
+
+func TestDedupeConfig(t *testing.T) {
+	tests := map[string]common.MapStr{
+		"no key":             {},
+		"fields and key":     {"fields": []string{"a"}, "key_field": "b"},
+		"invalid action":     {"key_field": "a", "action": "delete"},
+		"empty tag":          {"key_field": "a", "action": "tag", "tag": ""},
+		"zero ttl":           {"key_field": "a", "ttl": 0},
+		"zero max_entries":   {"key_field": "a", "max_entries": 0},
+		"no persistent name": {"key_field": "a", "persistence": common.MapStr{"enabled": true, "name": ""}},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(cfg))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dedupe
+
+import (
+	"container/list"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/paths"
+	"github.com/elastic/beats/v7/x-pack/libbeat/persistentcache"
+)
+
+// instanceID is used to assign each store a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+// stores are the open fingerprint sets by key. Filebeat builds the processors
+// of an input for every client, e.g. for every file harvested by filestream,
+// so all processors with the same configuration share one store. This also
+// ensures that a persistent cache is opened only once.
+var (
+	storesMutex sync.Mutex
+	stores      = map[string]*store{}
+)
+
+// store is a set of fingerprints shared by the dedupe processors with the
+// same configuration.
+type store struct {
+	key        string
+	refs       int // protected by storesMutex
+	ttl        time.Duration
+	maxEntries int
+
+	log     *logp.Logger
+	regName string
+	metrics metrics
+
+	// cacheMutex protects the persistent cache from being closed while it is
+	// in use. The cache is safe for concurrent use.
+	cacheMutex sync.RWMutex
+	cache      *persistentcache.PersistentCache
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // entries ordered by expiration, first to expire first
+}
+
+type metrics struct {
+	hits      *monitoring.Uint
+	misses    *monitoring.Uint
+	evictions *monitoring.Uint
+	expired   *monitoring.Uint
+	entries   *monitoring.Int
+}
+
+// entry is a fingerprint of an event seen before and its expiration time.
+type entry struct {
+	key     string
+	expires time.Time
+}
+
+// acquireStore returns the store for the configuration, opening it if no
+// other processor uses it. The store must be released when it is not needed
+// anymore.
+func acquireStore(config config, fields []string) (*store, error) {
+	key := storeKey(config, fields)
+
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+
+	if s, found := stores[key]; found {
+		if s.ttl != config.TTL || s.maxEntries != config.MaxEntries {
+			return nil, fmt.Errorf("persistent cache %v is used by another dedupe processor with a different ttl or max_entries",
+				config.Persistence.Name)
+		}
+		s.refs++
+		return s, nil
+	}
+
+	var (
+		id      = int(instanceID.Inc())
+		regName = logName + "." + strconv.Itoa(id)
+	)
+
+	var cache *persistentcache.PersistentCache
+	if config.Persistence.Enabled {
+		var err error
+		cache, err = persistentcache.New(config.Persistence.Name, persistentcache.Options{
+			Timeout:  config.TTL,
+			RootPath: persistencePath(config),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to open the dedupe persistent cache")
+		}
+	}
+
+	reg := monitoring.Default.NewRegistry(regName, monitoring.DoNotReport)
+	s := &store{
+		key:        key,
+		refs:       1,
+		ttl:        config.TTL,
+		maxEntries: config.MaxEntries,
+		log:        logp.NewLogger(logName).With("instance_id", id),
+		regName:    regName,
+		metrics: metrics{
+			hits:      monitoring.NewUint(reg, "hits"),
+			misses:    monitoring.NewUint(reg, "misses"),
+			evictions: monitoring.NewUint(reg, "evictions"),
+			expired:   monitoring.NewUint(reg, "expired"),
+			entries:   monitoring.NewInt(reg, "entries"),
+		},
+		cache:   cache,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+	stores[key] = s
+	return s, nil
+}
+
+// storeKey identifies the store of a configuration. Persistent stores are
+// identified by their location, in-memory stores by the settings that
+// determine which events are duplicates.
+func storeKey(config config, fields []string) string {
+	if config.Persistence.Enabled {
+		return "persistent:" + filepath.Join(persistencePath(config), config.Persistence.Name)
+	}
+	return fmt.Sprintf("memory:%q:%q:%v:%v", config.KeyField, fields, config.TTL, config.MaxEntries)
+}
+
+// persistencePath returns the directory of the persistent cache.
+func persistencePath(config config) string {
+	if config.Persistence.Path != "" {
+		return config.Persistence.Path
+	}
+	return paths.Resolve(paths.Data, "cache")
+}
+
+// release releases the store, closing it when it is not used anymore.
+func (s *store) release() error {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	delete(stores, s.key)
+	monitoring.Default.Remove(s.regName)
+
+	// The cache is closed while holding storesMutex, so it can't be opened
+	// again before it is closed.
+	s.cacheMutex.Lock()
+	defer s.cacheMutex.Unlock()
+
+	if s.cache == nil {
+		return nil
+	}
+	err := s.cache.Close()
+	s.cache = nil
+	return err
+}
+
+// seen reports whether the key was seen before and didn't expire yet. Unseen
+// keys are added to the set. The persistent cache is accessed without holding
+// the mutex.
+func (s *store) seen(key string, now time.Time) bool {
+	s.mutex.Lock()
+	found := s.contains(key, now)
+	s.mutex.Unlock()
+	if found {
+		return true
+	}
+
+	s.cacheMutex.RLock()
+	defer s.cacheMutex.RUnlock()
+
+	cacheKey := hex.EncodeToString([]byte(key))
+	if s.cache != nil {
+		var expires int64
+		if err := s.cache.Get(cacheKey, &expires); err == nil && now.UnixNano() < expires {
+			s.mutex.Lock()
+			if !s.contains(key, now) {
+				s.add(key, time.Unix(0, expires))
+				s.metrics.hits.Inc()
+			}
+			s.mutex.Unlock()
+			return true
+		}
+	}
+
+	expires := now.Add(s.ttl)
+	s.mutex.Lock()
+	// The key can have been added while the mutex was released.
+	if s.contains(key, now) {
+		s.mutex.Unlock()
+		return true
+	}
+	s.add(key, expires)
+	s.metrics.misses.Inc()
+	s.mutex.Unlock()
+
+	if s.cache != nil {
+		if err := s.cache.Put(cacheKey, expires.UnixNano()); err != nil {
+			s.log.Warnf("Failed to persist event fingerprint: %v", err)
+		}
+	}
+	return false
+}
+
+// contains removes the expired keys and reports whether the key is in the
+// set, counting it as a hit. Must be called with the mutex held.
+func (s *store) contains(key string, now time.Time) bool {
+	s.expire(now)
+	if _, found := s.entries[key]; found {
+		s.metrics.hits.Inc()
+		return true
+	}
+	return false
+}
+
+// add adds a key, evicting the key expiring first if the set is full. New keys
+// expire last, but keys restored from the persistent cache can expire earlier,
+// so the key is inserted in expiration order. Must be called with the mutex
+// held.
+func (s *store) add(key string, expires time.Time) {
+	if len(s.entries) >= s.maxEntries {
+		s.remove(s.order.Front())
+		s.metrics.evictions.Inc()
+	}
+
+	e := &entry{key: key, expires: expires}
+	mark := s.order.Back()
+	for mark != nil && mark.Value.(*entry).expires.After(expires) {
+		mark = mark.Prev()
+	}
+	if mark == nil {
+		s.entries[key] = s.order.PushFront(e)
+	} else {
+		s.entries[key] = s.order.InsertAfter(e, mark)
+	}
+	s.metrics.entries.Set(int64(len(s.entries)))
+}
+
+// expire removes the expired keys. The keys are ordered by expiration, so it
+// stops at the first key that didn't expire. Must be called with the mutex
+// held.
+func (s *store) expire(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		if now.Before(elem.Value.(*entry).expires) {
+			return
+		}
+		s.remove(elem)
+		s.metrics.expired.Inc()
+	}
+}
+
+// remove removes a key. Must be called with the mutex held.
+func (s *store) remove(elem *list.Element) {
+	delete(s.entries, elem.Value.(*entry).key)
+	s.order.Remove(elem)
+	s.metrics.entries.Set(int64(len(s.entries)))
+}